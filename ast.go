@@ -2,23 +2,180 @@ package mathval
 
 import (
 	"math/big"
+	"time"
 )
 
 /*  The parseable language described using EBNF. Order of Operations is maintained by expanding expressions
 	through the highest precendence first (ie: exponentiation then multiplication then addition)
 
+PROGRAM     = [ STATEMENT ] { SEPARATOR [ STATEMENT ] } ;
+SEPARATOR   = ';' | NEWLINE ;
+STATEMENT   = ASSIGNMENT | DEFINITION | CONDITIONAL ;
+ASSIGNMENT  = IDENTIFIER '=' CONDITIONAL ;
+DEFINITION  = IDENTIFIER '(' [ IDENTIFIER { ',' IDENTIFIER } ] ')' '=' CONDITIONAL ;
+CONDITIONAL = ( DISJUNCTION | DISJUNCTION '?' CONDITIONAL ':' CONDITIONAL ) [ 'to' ( UNIT | CURRENCY ) ] ;
+DISJUNCTION = CONJUNCTION | CONJUNCTION OR_OP DISJUNCTION ;
+CONJUNCTION = COMPARISON | COMPARISON AND_OP CONJUNCTION ;
+COMPARISON  = { NOT_OP } CONCATENATION | { NOT_OP } CONCATENATION COMPARE_OP CONCATENATION ;
+CONCATENATION = EXPRESSION { '&' EXPRESSION } ;
 EXPRESSION  = FACTOR | FACTOR ADD_OP EXPRESSION ;
 FACTOR      = POWER | POWER MULTIPLY_OP FACTOR ;
-POWER       = TERM | TERM EXPONENT_OP POWER ;
-TERM        = '(' EXPRESSION ')' | NUMBER ;
+POWER       = { UNARY_OP } TERM | { UNARY_OP } TERM EXPONENT_OP POWER | { UNARY_OP } TERM SUPERSCRIPT ;
+TERM        = ( '(' CONDITIONAL ')' | LIST | LAMBDA | PIECEWISE | NUMBER [ UNIT | CURRENCY ] | DATE | DURATION | RANGE | STRING | IDENTIFIER | CALL | '√' TERM ) { INDEX } { POSTFIX_OP } ;
+LIST        = '[' [ CONDITIONAL { ',' CONDITIONAL } ] ']' ;
+INDEX       = '[' CONDITIONAL ']' | '[' [ CONDITIONAL ] ':' [ CONDITIONAL ] ']' ;
+PIECEWISE   = 'piecewise' '(' CASE { ',' CASE } [ ',' 'else' ':' CONDITIONAL ] ')' ;
+CASE        = CONDITIONAL ':' CONDITIONAL ;
+LAMBDA      = ( IDENTIFIER | '(' [ IDENTIFIER { ',' IDENTIFIER } ] ')' ) '->' CONDITIONAL ;
+CALL        = IDENTIFIER '(' [ CONDITIONAL { ',' CONDITIONAL } ] ')' ;
+UNIT        = UNIT_POWER { ( '*' | '/' ) UNIT_POWER } ;
+UNIT_POWER  = IDENTIFIER [ '^' [ '-' ] DIGITS ] ;
+CURRENCY    = UPPER UPPER UPPER ;
+RANGE       = CELL ':' CELL ;
+CELL        = UPPER { UPPER } NONZERO_DIGIT { DIGIT } ;
+STRING      = '"' { CHARACTER | '""' } '"' ;
+IDENTIFIER  = LETTER { LETTER | DIGIT | '_' } ;
 NUMBER      = { DIGIT } | { DIGIT } '.' { DIGIT }
 DIGIT       = '0' | '1' | '2' | '3' | '4' | '5' | '6' | '7' | '8' | '9'
+DATE        = DIGIT{4} '-' DIGIT{2} '-' DIGIT{2} [ 'T' TIME ] ;
+TIME        = DIGIT{2} ':' DIGIT{2} [ ':' DIGIT{2} [ '.' { DIGIT } ] ] [ 'Z' | ( '+' | '-' ) DIGIT{2} ':' DIGIT{2} ] ;
+DURATION    = DIGITS DURATION_UNIT { DIGITS DURATION_UNIT } | ISO_DURATION ;
+DURATION_UNIT = 'w' | 'd' | 'h' | 'm' | 's' | 'ms' ;
+ISO_DURATION  = 'P' [ DIGITS 'W' ] [ DIGITS 'D' ] [ 'T' [ DIGITS 'H' ] [ DIGITS 'M' ] [ DIGITS 'S' ] ] ;
+OR_OP       = 'or' ;
+AND_OP      = 'and' ;
+NOT_OP      = 'not' ;
+COMPARE_OP  = '==' | '!=' | '<' | '<=' | '>' | '>=' ;
 ADD_OP      = '+' | '-' ;
 MULTIPLY_OP = '*' | '/' | '%' ;
 EXPONENT_OP = '^' ;
+UNARY_OP    = '+' | '-' ;
+POSTFIX_OP  = '!' | '%' ;
+SUPERSCRIPT = [ '⁻' ] SUPERSCRIPT_DIGIT { SUPERSCRIPT_DIGIT } ;
+
+The Unicode symbols '×', '·', '⋅', '÷', '−', '≤', '≥' and '≠' are read as the operators they stand for and 'π' as
+pi. A SUPERSCRIPT is an integer exponent, and '√' TERM is sqrt(TERM).
+
+A CURRENCY is an ISO 4217 code such as "USD", and is only read in Money mode.
+
+A RANGE is only read in Cells mode, and is written without whitespace, so the ':' of a ternary between two cells
+needs whitespace before it. A CELL on its own is an IDENTIFIER.
+
+A CONCATENATION with a '&' and a STRING are only read in Excel mode, where a CONCATENATION is a call to concat and
+the formula may start with a '=', which is dropped. In Excel mode '=' and '<>' are also read as '==' and '!=',
+';' separates arguments like ',', and the spreadsheet functions are mapped to their equivalents, see Excel.
+
+DATE and DURATION are only read in Dates mode, and are written without whitespace. A DATE without an offset is in
+UTC.
+
+Comments are '#' or '//' to the end of the line, or C style block comments, and may appear anywhere
+whitespace can.
+They are not part of the grammar, but are kept on the nearest Term, Statement or Program so that the printer
+can reproduce them
 
 */
 
+// Program represents a PROGRAM in the EBNF grammar. Empty statements are dropped. A NEWLINE only separates
+// statements outside parentheses and after a token which can end a statement, see Parser.lex
+// PROGRAM = [ STATEMENT ] { SEPARATOR [ STATEMENT ] }
+type Program struct {
+	statements []*Statement
+	comments   []string // after the last statement
+}
+
+// Statement represents a STATEMENT in the EBNF grammar
+// STATEMENT = ASSIGNMENT | DEFINITION | CONDITIONAL
+type Statement struct {
+	assignment *Assignment
+	definition *Definition
+	cond       *Conditional
+	comments   []string // before the statement, or on the name and parameters of an assignment or definition
+}
+
+// Assignment represents an ASSIGNMENT in the EBNF grammar
+// ASSIGNMENT = IDENTIFIER '=' CONDITIONAL
+type Assignment struct {
+	name  string
+	value *Conditional
+}
+
+// Definition represents a DEFINITION in the EBNF grammar
+// DEFINITION = IDENTIFIER '(' [ IDENTIFIER { ',' IDENTIFIER } ] ')' '=' CONDITIONAL
+type Definition struct {
+	name   string
+	params []string
+	body   *Conditional
+}
+
+// Conditional represents a CONDITIONAL in the EBNF grammar. A conversion at the end of a ternary belongs to
+// its else branch, as that is the innermost Conditional
+// CONDITIONAL = ( DISJUNCTION | DISJUNCTION '?' CONDITIONAL ':' CONDITIONAL ) [ 'to' ( UNIT | CURRENCY ) ]
+type Conditional struct {
+	disjunction *Disjunction
+	then        *Conditional
+	els         *Conditional
+	to          *Unit  // unit to convert the result to, see Units
+	currency    string // currency to convert the result to, see Money
+}
+
+// conditionalOf returns a Conditional holding only the given Expression
+func conditionalOf(exp *Expression) *Conditional {
+	return &Conditional{disjunction: &Disjunction{conjunction: &Conjunction{comparison: &Comparison{expression: exp}}}}
+}
+
+// soleExpression returns the Expression if the Conditional consists of a single Expression with no logical,
+// comparison or ternary operators, otherwise nil
+func (cond *Conditional) soleExpression() *Expression {
+	if cond.then != nil || cond.to != nil || cond.currency != "" || cond.disjunction.op != nil || cond.disjunction.conjunction.op != nil {
+		return nil
+	}
+	cmp := cond.disjunction.conjunction.comparison
+	if len(cmp.not) != 0 || cmp.op != nil {
+		return nil
+	}
+	return cmp.expression
+}
+
+// soleTerm returns the Term if the Conditional consists of a single Term with no operators, unit, currency or
+// indexes, otherwise nil
+func (cond *Conditional) soleTerm() *Term {
+	exp := cond.soleExpression()
+	if exp == nil || exp.op != nil || exp.factor.op != nil {
+		return nil
+	}
+	pow := exp.factor.power
+	if len(pow.unary) != 0 || pow.op != nil || pow.term.unit != nil || pow.term.currency != "" || len(pow.term.index) != 0 || len(pow.term.postfix) != 0 {
+		return nil
+	}
+	return pow.term
+}
+
+// Disjunction represents a DISJUNCTION in the EBNF grammar
+// DISJUNCTION = CONJUNCTION | CONJUNCTION OR_OP DISJUNCTION
+type Disjunction struct {
+	conjunction *Conjunction
+	op          *OrOp
+	disjunction *Disjunction
+}
+
+// Conjunction represents a CONJUNCTION in the EBNF grammar
+// CONJUNCTION = COMPARISON | COMPARISON AND_OP CONJUNCTION
+type Conjunction struct {
+	comparison  *Comparison
+	op          *AndOp
+	conjunction *Conjunction
+}
+
+// Comparison represents a COMPARISON in the EBNF grammar. Any leading NOT_OPs apply to the result of the
+// whole comparison, so "not 1 > 2" is "not (1 > 2)"
+// COMPARISON = { NOT_OP } EXPRESSION | { NOT_OP } EXPRESSION COMPARE_OP EXPRESSION
+type Comparison struct {
+	not        []*NotOp
+	expression *Expression
+	op         *CompareOp
+	right      *Expression
+}
+
 // Expression represents an EXPRESSION in the EBNF grammar
 // EXPRESSION = POWER | POWER ADD_OP EXPRESSION
 type Expression struct {
@@ -35,31 +192,151 @@ type Factor struct {
 	factor *Factor
 }
 
-// Power represents a POWER in the EBNF grammar
-// POWER = TERM | TERM EXPONENT_OP POWER
+// Power represents a POWER in the EBNF grammar. Any leading UNARY_OPs apply to the result of the
+// exponentiation, so "-2^2" is "-(2^2)"
+// POWER = { UNARY_OP } TERM | { UNARY_OP } TERM EXPONENT_OP POWER
 type Power struct {
+	unary []*UnaryOp
 	term  *Term
 	op    *ExponentOp
 	power *Power
 }
 
-// Term represents a TERM in the EBNF grammar
-// TERM = '(' EXPRESSION ')' | NUMBER
+// Term represents a TERM in the EBNF grammar. POSTFIX_OPs bind tighter than anything else, so "2^3!" is
+// "2^(3!)" and "-3!" is "-(3!)"
+// TERM = ( '(' CONDITIONAL ')' | LIST | LAMBDA | PIECEWISE | NUMBER [ UNIT ] | IDENTIFIER | CALL | '√' TERM ) { INDEX } { POSTFIX_OP }
 type Term struct {
-	exp    *Expression
-	number *Number
+	exp       *Conditional
+	number    *Number
+	ident     *Identifier
+	call      *Call
+	lambda    *Lambda
+	list      *ListLiteral
+	piecewise *Piecewise
+	unit      *Unit  // unit of the number, see Units
+	currency  string // currency of the number, see Money
+	date      *Date
+	duration  *Duration
+	cells     *Range
+	text      *StringLiteral
+	index     []*Index
+	postfix   []*PostfixOp
+	group     bool // exp holds juxtaposed terms grouped by TightImplicitMultiplication, not written in parens
+
+	leading  []string // comments before the term
+	trailing []string // comments after the term and its postfix operators
+}
+
+// comments returns all of the comments on the Term
+func (term *Term) comments() []string {
+	return append(append([]string{}, term.leading...), term.trailing...)
+}
+
+// ListLiteral represents a LIST in the EBNF grammar
+// LIST = '[' [ CONDITIONAL { ',' CONDITIONAL } ] ']'
+type ListLiteral struct {
+	elems []*Conditional
+}
+
+// Index represents an INDEX in the EBNF grammar. For a slice, either bound may be nil
+// INDEX = '[' CONDITIONAL ']' | '[' [ CONDITIONAL ] ':' [ CONDITIONAL ] ']'
+type Index struct {
+	from  *Conditional
+	to    *Conditional
+	slice bool
+}
+
+// Piecewise represents a PIECEWISE in the EBNF grammar. Its value is that of the first Case whose condition
+// is true, or the else value if there is one and none are
+// PIECEWISE = 'piecewise' '(' CASE { ',' CASE } [ ',' 'else' ':' CONDITIONAL ] ')'
+type Piecewise struct {
+	cases []*Case
+	els   *Conditional
+}
+
+// Case represents a CASE in the EBNF grammar
+// CASE = CONDITIONAL ':' CONDITIONAL
+type Case struct {
+	cond  *Conditional
+	value *Conditional
+}
+
+// Lambda represents a LAMBDA in the EBNF grammar. The body extends as far right as possible, so
+// "x -> x + 1" is a lambda returning x + 1
+// LAMBDA = ( IDENTIFIER | '(' [ IDENTIFIER { ',' IDENTIFIER } ] ')' ) '->' CONDITIONAL
+type Lambda struct {
+	params []string
+	body   *Conditional
+}
+
+// Call represents a CALL in the EBNF grammar
+// CALL = IDENTIFIER '(' [ CONDITIONAL { ',' CONDITIONAL } ] ')'
+type Call struct {
+	name string
+	args []*Conditional
+	pos  int // offset in runes of the name in the source
+}
+
+// Identifier represents an IDENTIFIER in the EBNF grammar
+// IDENTIFIER = LETTER { LETTER | DIGIT | '_' }
+type Identifier struct {
+	name string
 }
 
+// Number represents a NUMBER in the EBNF grammar
+// NUMBER = { DIGIT } | { DIGIT } '.' { DIGIT }
 type Number struct {
 	str string
 	val *big.Rat
 }
 
+// Date represents a DATE in the EBNF grammar
+type Date struct {
+	str string
+	val time.Time
+}
+
+// Duration represents a DURATION in the EBNF grammar
+type Duration struct {
+	str string
+	val time.Duration
+}
+
+// Range represents a RANGE in the EBNF grammar
+// RANGE = CELL ':' CELL
+type Range struct {
+	from, to string
+}
+
+// StringLiteral represents a STRING in the EBNF grammar
+// STRING = '"' { CHARACTER | '""' } '"'
+type StringLiteral struct {
+	str string // as written, in quotes
+	val string
+}
+
 // Operator represents the different groups of operators in the EBNF grammar
 type Operator struct {
-	op Token
+	op  Token
+	pos int // offset in runes of the operator in the source, or of the right operand for juxtaposition
 }
 
+// OrOp represents an OR_OP in the EBNF grammar
+// OR_OP = 'or'
+type OrOp Operator
+
+// AndOp represents an AND_OP in the EBNF grammar
+// AND_OP = 'and'
+type AndOp Operator
+
+// NotOp represents a NOT_OP in the EBNF grammar
+// NOT_OP = 'not'
+type NotOp Operator
+
+// CompareOp represents a COMPARE_OP in the EBNF grammar
+// COMPARE_OP = '==' | '!=' | '<' | '<=' | '>' | '>='
+type CompareOp Operator
+
 // AddOp represents an ADD_OP in the EBNF grammar
 // ADD_OP = '+' | '-'
 type AddOp Operator
@@ -71,3 +348,11 @@ type MultiplyOp Operator
 // ExponentOp represents an ExponentOp in the EBNF grammar
 // EXPONENT_OP = '^'
 type ExponentOp Operator
+
+// UnaryOp represents a UNARY_OP in the EBNF grammar
+// UNARY_OP = '+' | '-'
+type UnaryOp Operator
+
+// PostfixOp represents a POSTFIX_OP in the EBNF grammar
+// POSTFIX_OP = '!' | '%'
+type PostfixOp Operator
@@ -0,0 +1,110 @@
+package mathval
+
+import (
+	"math/big"
+)
+
+// guardBits is the extra precision used while computing an irrational value, so that it is still accurate
+// once rounded to the requested precision
+const guardBits = 64
+
+// constants holds the built-in mathematical constants, keyed by name, as functions computing their value
+// to the given number of bits
+var constants = map[string]func(prec uint) *big.Float{
+	"pi":    computePi,
+	"tau":   computeTau,
+	"e":     computeE,
+	"phi":   computePhi,
+	"sqrt2": computeSqrt2,
+	"ln2":   computeLn2,
+}
+
+// newFloat returns a zero big.Float with the given precision
+func newFloat(prec uint) *big.Float {
+	return new(big.Float).SetPrec(prec)
+}
+
+// negligible returns whether term is too small to affect sum at the given precision
+func negligible(term, sum *big.Float, prec uint) bool {
+	return term.Sign() == 0 || (sum.Sign() != 0 && term.MantExp(nil) < sum.MantExp(nil)-int(prec))
+}
+
+// computePi computes pi with Machin's formula, pi = 16*atan(1/5) - 4*atan(1/239)
+func computePi(prec uint) *big.Float {
+	wp := prec + guardBits
+	a := arctanInv(5, wp)
+	a.Mul(a, big.NewFloat(16))
+	b := arctanInv(239, wp)
+	b.Mul(b, big.NewFloat(4))
+	return newFloat(prec).Sub(a, b)
+}
+
+// computeTau computes tau = 2*pi
+func computeTau(prec uint) *big.Float {
+	pi := computePi(prec + 1)
+	return newFloat(prec).Mul(pi, big.NewFloat(2))
+}
+
+// arctanInv computes atan(1/n) using its Taylor series, which converges quickly for large n
+func arctanInv(n int64, prec uint) *big.Float {
+	n2 := newFloat(prec).SetInt64(n * n)
+	power := newFloat(prec).Quo(newFloat(prec).SetInt64(1), newFloat(prec).SetInt64(n))
+	sum := newFloat(prec).Set(power)
+	term := newFloat(prec)
+	for k := int64(1); ; k++ {
+		power.Quo(power, n2)
+		term.Quo(power, newFloat(prec).SetInt64(2*k+1))
+		if negligible(term, sum, prec) {
+			return sum
+		}
+		if k%2 == 1 {
+			sum.Sub(sum, term)
+		} else {
+			sum.Add(sum, term)
+		}
+	}
+}
+
+// computeE computes e as the sum of 1/k!
+func computeE(prec uint) *big.Float {
+	wp := prec + guardBits
+	sum := newFloat(wp).SetInt64(1)
+	term := newFloat(wp).SetInt64(1)
+	for k := int64(1); ; k++ {
+		term.Quo(term, newFloat(wp).SetInt64(k))
+		if negligible(term, sum, wp) {
+			return newFloat(prec).Set(sum)
+		}
+		sum.Add(sum, term)
+	}
+}
+
+// computePhi computes the golden ratio, (1 + sqrt(5))/2
+func computePhi(prec uint) *big.Float {
+	wp := prec + guardBits
+	phi := newFloat(wp).Sqrt(newFloat(wp).SetInt64(5))
+	phi.Add(phi, newFloat(wp).SetInt64(1))
+	return newFloat(prec).Quo(phi, newFloat(wp).SetInt64(2))
+}
+
+// computeSqrt2 computes the square root of 2
+func computeSqrt2(prec uint) *big.Float {
+	return newFloat(prec).Sqrt(newFloat(prec).SetInt64(2))
+}
+
+// computeLn2 computes the natural logarithm of 2 as the sum of 1/(k*2^k)
+func computeLn2(prec uint) *big.Float {
+	wp := prec + guardBits
+	sum := newFloat(wp)
+	power := newFloat(wp).SetInt64(1)
+	term := newFloat(wp)
+	half := newFloat(wp).SetFloat64(0.5)
+	for k := int64(1); ; k++ {
+		power.Mul(power, half)
+		term.Quo(power, newFloat(wp).SetInt64(k))
+		if negligible(term, sum, wp) {
+			return newFloat(prec).Set(sum)
+		}
+		sum.Add(sum, term)
+	}
+}
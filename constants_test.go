@@ -0,0 +1,49 @@
+package mathval
+
+import (
+	"math/big"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConstantsSuite struct{}
+
+var _ = Suite(&ConstantsSuite{})
+
+// closeTo returns whether a and b differ by less than 10^-digits
+func closeTo(a *big.Float, b string, digits int) bool {
+	ref, _, err := big.ParseFloat(b, 10, 512, big.ToNearestEven)
+	if err != nil {
+		return false
+	}
+	diff := new(big.Float).SetPrec(512).Sub(a, ref)
+	tolerance, _, _ := big.ParseFloat("1e-"+big.NewInt(int64(digits)).String(), 10, 512, big.ToNearestEven)
+	return diff.Abs(diff).Cmp(tolerance) < 0
+}
+
+func (s *ConstantsSuite) TestConstants(c *C) {
+	expected := map[string]string{
+		"pi":    "3.14159265358979323846264338327950288419716939937510582097494459",
+		"tau":   "6.28318530717958647692528676655900576839433879875021164194988918",
+		"e":     "2.71828182845904523536028747135266249775724709369995957496696763",
+		"phi":   "1.61803398874989484820458683436563811772030917980576286213544862",
+		"sqrt2": "1.41421356237309504880168872420969807856967187537694807317667974",
+		"ln2":   "0.693147180559945309417232121458176568075500134360255254120680009",
+	}
+	c.Assert(constants, HasLen, len(expected))
+
+	for name, ref := range expected {
+		val := constants[name](256)
+		c.Assert(val.Prec(), Equals, uint(256), Commentf(name))
+		c.Assert(closeTo(val, ref, 60), Equals, true, Commentf("%s = %s", name, val.Text('g', 65)))
+	}
+}
+
+func (s *ConstantsSuite) TestConstantsLowPrecision(c *C) {
+	for name, compute := range constants {
+		val, _ := compute(53).Float64()
+		c.Assert(val > 0, Equals, true, Commentf(name))
+	}
+	val, _ := computePi(53).Float64()
+	c.Assert(val, Equals, 3.141592653589793)
+}
@@ -0,0 +1,261 @@
+package mathval
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// day is the length of a "d" in a duration. Days are always 24 hours, whatever daylight saving does
+const day = 24 * time.Hour
+
+var (
+	// durationUnits are the units of a duration such as "2h30m"
+	durationUnits = map[string]time.Duration{
+		"w": 7 * day, "d": day, "h": time.Hour, "m": time.Minute, "s": time.Second, "ms": time.Millisecond,
+	}
+
+	// isoDateUnits and isoTimeUnits are the units before and after the 'T' of an ISO 8601 duration
+	isoDateUnits = map[string]time.Duration{"W": 7 * day, "D": day}
+	isoTimeUnits = map[string]time.Duration{"H": time.Hour, "M": time.Minute, "S": time.Second}
+
+	// durationComponent matches a whole number and its unit within a duration
+	durationComponent = regexp.MustCompile(`(\d+)([a-zA-Z]+)`)
+
+	// dateLayouts are the forms a DATE may take, see time.Parse, which also accepts fractional seconds
+	dateLayouts = []string{
+		"2006-01-02",
+		"2006-01-02T15:04",
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04:05Z07:00",
+	}
+)
+
+// parseDate returns the time a DATE literal represents, in UTC if it has no offset
+func parseDate(lit string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, lit); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid date %s", lit)
+}
+
+// parseDuration returns the length of a DURATION literal. ISO 8601 durations in years or months are rejected,
+// as their length depends on the date they are added to
+func parseDuration(lit string) (time.Duration, error) {
+	if !strings.HasPrefix(lit, "P") {
+		return addComponents(0, lit, lit, durationUnits)
+	}
+
+	date, clock := lit[1:], ""
+	if i := strings.IndexByte(date, 'T'); i >= 0 {
+		date, clock = date[:i], date[i+1:]
+	}
+	if strings.ContainsAny(date, "YM") {
+		return 0, fmt.Errorf("Ambiguous duration %s, years and months vary in length", lit)
+	}
+	total, err := addComponents(0, lit, date, isoDateUnits)
+	if err != nil {
+		return 0, err
+	}
+	return addComponents(total, lit, clock, isoTimeUnits)
+}
+
+// addComponents adds the length of each number and unit in s, which is part of the DURATION lit, to total
+func addComponents(total time.Duration, lit, s string, units map[string]time.Duration) (time.Duration, error) {
+	for _, match := range durationComponent.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseInt(match[1], 10, 64)
+		unit := units[match[2]]
+		if err != nil || n > int64(math.MaxInt64-total)/int64(unit) {
+			return 0, fmt.Errorf("Duration %s is out of range", lit)
+		}
+		total += time.Duration(n) * unit
+	}
+	return total, nil
+}
+
+// DateValue is an instant in time, from a DATE, now() or date arithmetic
+type DateValue struct {
+	val time.Time
+}
+
+// NewDateValue returns a DateValue holding the given time
+func NewDateValue(t time.Time) *DateValue {
+	return &DateValue{val: t}
+}
+
+// Time returns the time held by the DateValue
+func (d *DateValue) Time() time.Time {
+	return d.val
+}
+
+// String returns the date in ISO 8601 form, leaving out the time of a date at midnight UTC
+func (d *DateValue) String() string {
+	t := d.val
+	if _, offset := t.Zone(); offset == 0 && t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// DurationValue is a length of time, from a DURATION or the difference between two dates
+type DurationValue struct {
+	val time.Duration
+}
+
+// NewDurationValue returns a DurationValue holding the given duration
+func NewDurationValue(d time.Duration) *DurationValue {
+	return &DurationValue{val: d}
+}
+
+// Duration returns the duration held by the DurationValue
+func (d *DurationValue) Duration() time.Duration {
+	return d.val
+}
+
+// String returns the duration in days, hours, minutes and seconds, as in "1d2h30m" or "1.5s"
+func (d *DurationValue) String() string {
+	if d.val == 0 {
+		return "0s"
+	}
+
+	var buf strings.Builder
+	// Negating as a uint64 is also correct for the most negative duration
+	n := uint64(d.val)
+	if d.val < 0 {
+		buf.WriteByte('-')
+		n = -n
+	}
+	for _, unit := range []struct {
+		name string
+		size time.Duration
+	}{{"d", day}, {"h", time.Hour}, {"m", time.Minute}} {
+		if q := n / uint64(unit.size); q != 0 {
+			buf.WriteString(strconv.FormatUint(q, 10) + unit.name)
+			n %= uint64(unit.size)
+		}
+	}
+	if n != 0 {
+		buf.WriteString(strconv.FormatUint(n/uint64(time.Second), 10))
+		if frac := n % uint64(time.Second); frac != 0 {
+			buf.WriteString("." + strings.TrimRight(fmt.Sprintf("%09d", frac), "0"))
+		}
+		buf.WriteByte('s')
+	}
+	return buf.String()
+}
+
+// isTemporal returns whether the value is a DateValue or DurationValue
+func isTemporal(val Value) bool {
+	switch val.(type) {
+	case *DateValue, *DurationValue:
+		return true
+	}
+	return false
+}
+
+// nanoseconds returns the length of a DurationValue in nanoseconds as a NumberValue, and any other value as it
+// is
+func nanoseconds(val Value) Value {
+	if d, ok := val.(*DurationValue); ok {
+		return NewNumberValue(big.NewRat(int64(d.val), 1))
+	}
+	return val
+}
+
+// durationOf returns a DurationValue of r nanoseconds, rounded half away from zero
+func durationOf(r *big.Rat) (Value, error) {
+	num := new(big.Int).Mul(r.Num(), big.NewInt(2))
+	den := new(big.Int).Mul(r.Denom(), big.NewInt(2))
+	if r.Sign() < 0 {
+		num.Sub(num, r.Denom())
+	} else {
+		num.Add(num, r.Denom())
+	}
+	n := num.Quo(num, den)
+	if !n.IsInt64() {
+		return nil, errors.New("Duration out of range")
+	}
+	return &DurationValue{val: time.Duration(n.Int64())}, nil
+}
+
+// temporalArithmetic applies the arithmetic operator where at least one operand is a DateValue or
+// DurationValue. Subtracting dates gives a duration, and a duration can be added to or subtracted from a date.
+// Durations can be added to and subtracted from each other, scaled by numbers, and divided to give a number
+func temporalArithmetic(op Token, a, b Value) (Value, error) {
+	x, xDate := a.(*DateValue)
+	y, yDate := b.(*DateValue)
+	xDuration, _ := a.(*DurationValue)
+	yDuration, _ := b.(*DurationValue)
+	scale := op == MULTIPLY || op == IMPLICIT_MULTIPLY
+
+	switch {
+	case xDate && yDate && op == MINUS:
+		// Sub saturates rather than overflowing
+		d := x.val.Sub(y.val)
+		if d == math.MaxInt64 || d == math.MinInt64 {
+			return nil, errors.New("Duration out of range")
+		}
+		return &DurationValue{val: d}, nil
+	case xDate && yDuration != nil && op == PLUS:
+		return &DateValue{val: x.val.Add(yDuration.val)}, nil
+	case xDate && yDuration != nil && op == MINUS:
+		return &DateValue{val: x.val.Add(-yDuration.val)}, nil
+	case xDuration != nil && yDate && op == PLUS:
+		return &DateValue{val: y.val.Add(xDuration.val)}, nil
+	case xDuration != nil && yDuration != nil && (op == DIVIDE || op == INT_DIVIDE):
+		return arithmetic(op, nanoseconds(a), nanoseconds(b))
+	case xDuration != nil && yDuration != nil && (op == PLUS || op == MINUS || op == MODULO),
+		xDuration != nil && !isTemporal(b) && (scale || op == DIVIDE),
+		yDuration != nil && !isTemporal(a) && scale:
+		res, err := arithmetic(op, nanoseconds(a), nanoseconds(b))
+		if err != nil {
+			return nil, err
+		}
+		return durationOf(res.(*NumberValue).val)
+	}
+	return nil, fmt.Errorf("Cannot apply %s to %s and %s", op, a, b)
+}
+
+// compareTemporal applies the comparison operator to two dates or two durations
+func compareTemporal(op Token, a, b Value) (Value, error) {
+	c := 0
+	switch x := a.(type) {
+	case *DateValue:
+		y, ok := b.(*DateValue)
+		if !ok {
+			return nil, fmt.Errorf("Cannot compare %s with %s", a, b)
+		}
+		if x.val.Before(y.val) {
+			c = -1
+		} else if x.val.After(y.val) {
+			c = 1
+		}
+	case *DurationValue:
+		if _, ok := b.(*DurationValue); !ok {
+			return nil, fmt.Errorf("Cannot compare %s with %s", a, b)
+		}
+		return compare(op, nanoseconds(a), nanoseconds(b))
+	default:
+		return nil, fmt.Errorf("Cannot compare %s with %s", a, b)
+	}
+	return compare(op, NewNumberValue(big.NewRat(int64(c), 1)), NewNumberValue(new(big.Rat)))
+}
+
+// builtinNow implements now(), the current time from the Evaluator's Clock
+func builtinNow(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("now expects no arguments, got %d", len(args))
+	}
+	if ev.Clock != nil {
+		return &DateValue{val: ev.Clock()}, nil
+	}
+	return &DateValue{val: time.Now()}, nil
+}
@@ -0,0 +1,172 @@
+package mathval
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type DatesSuite struct{}
+
+var _ = Suite(&DatesSuite{})
+
+// clock is the fixed time now() returns in these tests
+var clock = time.Date(2026, 10, 18, 9, 15, 0, 0, time.UTC)
+
+// runDates parses the program in Dates mode and runs it with the clock fixed, and deadline set to 2024-06-30
+func runDates(input string) (Value, error) {
+	parser := NewParser(strings.NewReader(input))
+	parser.SetMode(Dates)
+	prog, err := parser.ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	ev := NewEvaluator()
+	ev.Clock = func() time.Time { return clock }
+	ev.Set("deadline", NewDateValue(time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)))
+	res, err := ev.Run(prog)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (d *DatesSuite) TestDates(c *C) {
+	expected := []EvalResult{
+		{input: "deadline - 3d", expected: "2024-06-27"},
+		{input: "now()", expected: "2026-10-18T09:15:00Z"},
+		{input: "now() + 2h30m", expected: "2026-10-18T11:45:00Z"},
+		{input: "2h30m + now()", expected: "2026-10-18T11:45:00Z"},
+		{input: "2024-03-15 - 2024-01-01", expected: "74d"},
+		{input: "2024-01-01 - 2024-03-15", expected: "-74d"},
+		{input: "2024-03-15T10:30:00Z - 2024-03-15", expected: "10h30m"},
+		{input: "2024-03-15T10:30 + 90m", expected: "2024-03-15T12:00:00Z"},
+		{input: "2024-03-15T10:30+01:00", expected: "2024-03-15T10:30:00+01:00"},
+		{input: "2024-03-15T10:30+01:00 == 2024-03-15T09:30Z", expected: "true"},
+		{input: "2024-03-15T10:30:00.25Z + 1s", expected: "2024-03-15T10:30:01.25Z"},
+		{input: "2024-02-28 + 1d", expected: "2024-02-29"},
+		{input: "2024-03-15 - P1W", expected: "2024-03-08"},
+		{input: "2024-03-15 < deadline", expected: "true"},
+		{input: "deadline > now()", expected: "false"},
+		{input: "d = 2024-01-01; [d + 1w, d + 2w]", expected: "[2024-01-08, 2024-01-15]"},
+		{input: "(deadline - 2024-06-01) / 1d", expected: "29"},
+	}
+	for _, res := range expected {
+		val, err := runDates(res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (d *DatesSuite) TestDurations(c *C) {
+	expected := []EvalResult{
+		{input: "3d", expected: "3d"},
+		{input: "2h30m", expected: "2h30m"},
+		{input: "PT2H30M", expected: "2h30m"},
+		{input: "P1DT12H", expected: "1d12h"},
+		{input: "1w + 36h", expected: "8d12h"},
+		{input: "90s", expected: "1m30s"},
+		{input: "500ms", expected: "0.5s"},
+		{input: "1s / 3", expected: "0.333333333s"},
+		{input: "2s / 3", expected: "0.666666667s"},
+		{input: "3d * 1.5", expected: "4d12h"},
+		{input: "2 * 45m", expected: "1h30m"},
+		{input: "-3d", expected: "-3d"},
+		{input: "1h - 2h", expected: "-1h"},
+		{input: "1h - 1h", expected: "0s"},
+		{input: "2h30m / 1h", expected: "5/2"},
+		{input: "2h \\ 45m", expected: "2"},
+		{input: "2h % 45m", expected: "30m"},
+		{input: "3d > 2h", expected: "true"},
+		{input: "24h == 1d", expected: "true"},
+		{input: "[1d, 2d] * 2", expected: "[2d, 4d]"},
+	}
+	for _, res := range expected {
+		val, err := runDates(res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (d *DatesSuite) TestDateErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "deadline + 1", err: "Cannot apply + to 2024-06-30 and 1"},
+		{input: "deadline + deadline", err: "Cannot apply + to 2024-06-30 and 2024-06-30"},
+		{input: "3d - deadline", err: "Cannot apply - to 3d and 2024-06-30"},
+		{input: "deadline * 2", err: "Cannot apply * to 2024-06-30 and 2"},
+		{input: "3d * 2d", err: "Cannot apply * to 3d and 2d"},
+		{input: "2 / 3d", err: "Cannot apply / to 2 and 3d"},
+		{input: "3d + 2", err: "Cannot apply + to 3d and 2"},
+		{input: "3d / 0", err: "Division by zero"},
+		{input: "3d / 0s", err: "Division by zero"},
+		{input: "-deadline", err: "Expected number, got 2024-06-30"},
+		{input: "3d > 2", err: "Cannot compare 3d with 2"},
+		{input: "deadline < 3d", err: "Cannot compare 2024-06-30 with 3d"},
+		{input: "2 < deadline", err: "Cannot compare 2 with 2024-06-30"},
+		{input: "now(1)", err: "now expects no arguments, got 1"},
+		{input: "2024-02-30", err: "Invalid date 2024-02-30"},
+		{input: "P1M", err: "Ambiguous duration P1M, years and months vary in length"},
+		{input: "99999999999d", err: "Duration 99999999999d is out of range"},
+		{input: "106751d * 2", err: "Duration out of range"},
+		{input: "0001-01-01 - 2024-01-01", err: "Duration out of range"},
+	}
+	for _, res := range expected {
+		_, err := runDates(res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+}
+
+func (d *DatesSuite) TestParseDates(c *C) {
+	expected := map[string]string{
+		"deadline-3d":                  "deadline - 3d",
+		"now()+2h30m":                  "now() + 2h30m",
+		"2024-03-15T10:30:00Z-PT1H":    "2024-03-15T10:30:00Z - PT1H",
+		"x % 3d":                       "x % 3d",
+		"[2024-01-01,2024-12-31]":      "[2024-01-01, 2024-12-31]",
+		"t > 2024-01-01 ? 1d : 2d":     "t > 2024-01-01 ? 1d : 2d",
+		"f(t) = t + 1w":                "f(t) = t + 1w",
+		"2024-03-15T10:30+01:00 + 5ms": "2024-03-15T10:30+01:00 + 5ms",
+	}
+	for input, output := range expected {
+		parser = NewParser(strings.NewReader(input))
+		parser.SetMode(Dates)
+		prog, err := parser.ParseProgram()
+		c.Assert(err, IsNil, Commentf(input))
+		c.Assert(prog.String(), Equals, output, Commentf(input))
+	}
+
+	// Without Dates mode a date is arithmetic
+	val, err := evaluate(NewEvaluator(), "2024-03-15")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "2006")
+}
+
+func (d *DatesSuite) TestValues(c *C) {
+	t := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	c.Assert(NewDateValue(t).Time().Equal(t), Equals, true)
+	c.Assert(NewDurationValue(90*time.Minute).Duration(), Equals, 90*time.Minute)
+	c.Assert(NewDurationValue(math.MinInt64).String(), Equals, "-106751d23h47m16.854775808s")
+
+	// now() uses the wall clock without a Clock
+	before := time.Now()
+	val, err := NewEvaluator().Eval(mustParse(c, "now()"))
+	c.Assert(err, IsNil)
+	now := val.(*DateValue).Time()
+	c.Assert(now.Before(before), Equals, false)
+	c.Assert(now.After(time.Now()), Equals, false)
+}
+
+// mustParse parses the input in Dates mode, failing the test on error
+func mustParse(c *C, input string) *Conditional {
+	parser := NewParser(strings.NewReader(input))
+	parser.SetMode(Dates)
+	cond, err := parser.Parse()
+	c.Assert(err, IsNil)
+	return cond
+}
@@ -0,0 +1,696 @@
+package mathval
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// builtin is a function callable from an expression. Arguments are passed unevaluated so that builtins
+// such as if() can choose which of them to evaluate
+type builtin func(ev *Evaluator, args []*Conditional) (Value, error)
+
+// builtins holds the functions available to every Evaluator, keyed by name
+var builtins map[string]builtin
+
+func init() {
+	builtins = map[string]builtin{
+		"if":        builtinIf,
+		"map":       builtinMap,
+		"filter":    builtinFilter,
+		"reduce":    builtinReduce,
+		"any":       builtinAny,
+		"all":       builtinAll,
+		"len":       builtinLen,
+		"sum":       builtinSum,
+		"product":   builtinProduct,
+		"mean":      builtinMean,
+		"median":    builtinMedian,
+		"min":       builtinMin,
+		"max":       builtinMax,
+		"transpose": builtinTranspose,
+		"det":       builtinDet,
+		"inverse":   builtinInverse,
+		"solve":     builtinSolve,
+		"prod":      builtinProd,
+		"now":       builtinNow,
+		"flatten":   builtinFlatten,
+		"round":     builtinRound,
+		"abs":       builtinAbs,
+		"concat":    builtinConcat,
+		"true":      builtinBool(true),
+		"false":     builtinBool(false),
+	}
+}
+
+const (
+	// DefaultMaxFactorial is the largest argument to the factorial operator a new Evaluator accepts
+	DefaultMaxFactorial = 10000
+
+	// DefaultMaxExponent is the largest magnitude of an integer exponent a new Evaluator accepts
+	DefaultMaxExponent = 100000
+
+	// DefaultPrecision is the number of bits a new Evaluator computes inexact values to
+	DefaultPrecision = 256
+
+	// DefaultMaxDepth is the deepest a new Evaluator allows calls to user-defined functions to nest
+	DefaultMaxDepth = 1000
+
+	// DefaultMaxIterations is the most terms a new Evaluator allows a sum or product to iterate over
+	DefaultMaxIterations = 1000000
+)
+
+// Evaluator evaluates parsed expressions against a set of variables
+type Evaluator struct {
+	vars      map[string]Value
+	constants map[string]Value       // registered by the user, see RegisterConstant
+	functions map[string]*Definition // defined by the user, see Define
+
+	// scope holds the parameters of the user-defined function currently being evaluated, nil at the top level
+	scope *scope
+	depth int
+
+	// currency is the currency of the innermost conversion being evaluated, which money is converted to as it is
+	// evaluated so that amounts in different currencies can be combined, see Money
+	currency string
+
+	// cache holds built-in constants already computed at cachePrec bits
+	cache     map[string]*NumberValue
+	cachePrec uint
+
+	// MaxFactorial is the largest argument to the factorial operator, as the result grows very quickly
+	MaxFactorial int64
+
+	// MaxExponent is the largest magnitude of an integer exponent, as exact powers grow just as quickly
+	MaxExponent int64
+
+	// Precision is the number of bits inexact values, such as pi, are computed to
+	Precision uint
+
+	// MaxDepth is the deepest calls to user-defined functions may nest, which limits recursion
+	MaxDepth int
+
+	// MaxIterations is the most terms a sum or product may iterate over. Sums with a closed form are exempt
+	MaxIterations int64
+
+	// Clock returns the current time for now(). time.Now is used if it is nil, so set it to make results
+	// deterministic
+	Clock func() time.Time
+
+	// Rates converts money between currencies, see Money. Without it only amounts in the same currency can be
+	// combined
+	Rates RateProvider
+}
+
+// NewEvaluator returns a new instance of Evaluator with no variables set
+func NewEvaluator() *Evaluator {
+	return &Evaluator{
+		vars:          make(map[string]Value),
+		constants:     make(map[string]Value),
+		functions:     make(map[string]*Definition),
+		MaxFactorial:  DefaultMaxFactorial,
+		MaxExponent:   DefaultMaxExponent,
+		Precision:     DefaultPrecision,
+		MaxDepth:      DefaultMaxDepth,
+		MaxIterations: DefaultMaxIterations,
+	}
+}
+
+// Set binds the named variable to the given value. Constants cannot be reassigned
+func (ev *Evaluator) Set(name string, val Value) error {
+	if ev.isConstant(name) {
+		return fmt.Errorf("Cannot assign to constant %s", name)
+	}
+	ev.vars[name] = val
+	return nil
+}
+
+// RegisterConstant adds a named constant, such as a tax rate, to the evaluator. Unlike variables, constants
+// cannot be reassigned, so the name must not already be in use
+func (ev *Evaluator) RegisterConstant(name string, val Value) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("Invalid constant name %q", name)
+	}
+	if ev.isConstant(name) {
+		return fmt.Errorf("Constant %s is already defined", name)
+	}
+	if _, ok := ev.vars[name]; ok {
+		return fmt.Errorf("Constant %s would shadow a variable", name)
+	}
+	ev.constants[name] = val
+	return nil
+}
+
+// isConstant returns whether the name refers to a built-in or registered constant
+func (ev *Evaluator) isConstant(name string) bool {
+	_, builtin := constants[name]
+	_, registered := ev.constants[name]
+	return builtin || registered
+}
+
+// constant returns the value of the named built-in or registered constant
+func (ev *Evaluator) constant(name string) (Value, bool) {
+	if val, ok := ev.constants[name]; ok {
+		return val, true
+	}
+
+	compute, ok := constants[name]
+	if !ok {
+		return nil, false
+	}
+	if ev.cache == nil || ev.cachePrec != ev.Precision {
+		ev.cache, ev.cachePrec = make(map[string]*NumberValue), ev.Precision
+	}
+	if val, ok := ev.cache[name]; ok {
+		return val, true
+	}
+	r, _ := compute(ev.Precision).Rat(nil)
+	ev.cache[name] = &NumberValue{val: r, prec: ev.Precision}
+	return ev.cache[name], true
+}
+
+// Eval evaluates the given expression
+func (ev *Evaluator) Eval(cond *Conditional) (Value, error) {
+	return ev.evalConditional(cond)
+}
+
+// evalConditional evaluates a Conditional, only evaluating the branch selected by the condition
+func (ev *Evaluator) evalConditional(cond *Conditional) (Value, error) {
+	if cond.currency != "" {
+		outer := ev.currency
+		ev.currency = cond.currency
+		defer func() { ev.currency = outer }()
+	}
+
+	val, err := ev.evalDisjunction(cond.disjunction)
+	if err == nil && cond.then != nil {
+		var b bool
+		if b, err = toBool(val); err != nil {
+			return nil, err
+		} else if b {
+			val, err = ev.evalConditional(cond.then)
+		} else {
+			val, err = ev.evalConditional(cond.els)
+		}
+	}
+	switch {
+	case err != nil:
+		return nil, err
+	case cond.to != nil:
+		return convert(val, cond.to)
+	case cond.currency != "":
+		return ev.exchange(val, cond.currency, true)
+	}
+	return val, nil
+}
+
+// evalDisjunction evaluates a Disjunction, stopping at the first true operand
+func (ev *Evaluator) evalDisjunction(dis *Disjunction) (Value, error) {
+	for ; ; dis = dis.disjunction {
+		val, err := ev.evalConjunction(dis.conjunction)
+		if err != nil || dis.op == nil {
+			return val, err
+		}
+		if b, err := toBool(val); err != nil {
+			return nil, err
+		} else if b {
+			return val, nil
+		}
+	}
+}
+
+// evalConjunction evaluates a Conjunction, stopping at the first false operand
+func (ev *Evaluator) evalConjunction(con *Conjunction) (Value, error) {
+	for ; ; con = con.conjunction {
+		val, err := ev.evalComparison(con.comparison)
+		if err != nil || con.op == nil {
+			return val, err
+		}
+		if b, err := toBool(val); err != nil {
+			return nil, err
+		} else if !b {
+			return val, nil
+		}
+	}
+}
+
+// evalComparison evaluates a Comparison, then applies any leading NOT_OPs to the result
+func (ev *Evaluator) evalComparison(cmp *Comparison) (Value, error) {
+	val, err := ev.evalExpression(cmp.expression)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmp.op != nil {
+		right, err := ev.evalExpression(cmp.right)
+		if err != nil {
+			return nil, err
+		}
+		if val, err = compare(cmp.op.op, val, right); err != nil {
+			return nil, err
+		}
+	}
+
+	for range cmp.not {
+		b, err := toBool(val)
+		if err != nil {
+			return nil, err
+		}
+		val = NewBoolValue(!b)
+	}
+	return val, nil
+}
+
+// evalExpression evaluates an Expression. The grammar nests to the right, so the chain of operands is
+// folded from the left to keep "10-2-3" equal to 5. A percentage added or subtracted is a percentage of the
+// left operand, so "100 + 10%" is 110 and "100 - 10%" is 90
+func (ev *Evaluator) evalExpression(exp *Expression) (Value, error) {
+	acc, err := ev.evalFactor(exp.factor)
+	if err != nil {
+		return nil, err
+	}
+
+	for ; exp.op != nil; exp = exp.expression {
+		right, err := ev.evalFactor(exp.expression.factor)
+		if err != nil {
+			return nil, err
+		}
+		if isPercentage(exp.expression.factor) {
+			if right, err = arithmetic(MULTIPLY, acc, right); err != nil {
+				return nil, positioned(err, exp.op.pos)
+			}
+		}
+		if acc, err = arithmetic(exp.op.op, acc, right); err != nil {
+			return nil, positioned(err, exp.op.pos)
+		}
+	}
+	return acc, nil
+}
+
+// isPercentage returns whether the Factor is a lone, possibly negated, percentage such as "10%" or "-(x + 1)%"
+func isPercentage(fac *Factor) bool {
+	if fac.op != nil || fac.power.op != nil {
+		return false
+	}
+	post := fac.power.term.postfix
+	return len(post) > 0 && post[len(post)-1].op == PERCENT
+}
+
+// evalFactor evaluates a Factor, folding the chain of operands from the left like evalExpression
+func (ev *Evaluator) evalFactor(fac *Factor) (Value, error) {
+	acc, err := ev.evalPower(fac.power)
+	if err != nil {
+		return nil, err
+	}
+
+	for ; fac.op != nil; fac = fac.factor {
+		right, err := ev.evalPower(fac.factor.power)
+		if err != nil {
+			return nil, err
+		}
+		if acc, err = arithmetic(fac.op.op, acc, right); err != nil {
+			return nil, positioned(err, fac.op.pos)
+		}
+	}
+	return acc, nil
+}
+
+// evalPower evaluates a Power. Exponentiation is right associative so this simply recurses. Any unary
+// operators are applied to the result
+func (ev *Evaluator) evalPower(pow *Power) (Value, error) {
+	val, err := ev.evalTerm(pow.term)
+	if err != nil {
+		return nil, err
+	}
+
+	if pow.op != nil {
+		exp, err := ev.evalPower(pow.power)
+		if err != nil {
+			return nil, err
+		}
+		if err := ev.checkExponent(exp); err != nil {
+			return nil, err
+		}
+		if val, err = arithmetic(pow.op.op, val, exp); err != nil {
+			return nil, positioned(err, pow.op.pos)
+		}
+	}
+
+	for _, unary := range pow.unary {
+		if unary.op != MINUS {
+			continue
+		}
+		if val, err = negate(val); err != nil {
+			return nil, err
+		}
+	}
+	return val, nil
+}
+
+// evalTerm evaluates a Term, then applies any indexes and postfix operators to the result
+func (ev *Evaluator) evalTerm(term *Term) (Value, error) {
+	val, err := ev.evalOperand(term)
+	if err == nil && ev.currency != "" {
+		val, err = ev.exchange(val, ev.currency, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range term.index {
+		if val, err = ev.evalIndex(val, index); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, post := range term.postfix {
+		r, err := toRat(val)
+		if err != nil {
+			return nil, err
+		}
+		switch post.op {
+		case FACTORIAL:
+			if val, err = ev.factorial(r); err != nil {
+				return nil, err
+			}
+		case PERCENT:
+			val = numberOf(new(big.Rat).Quo(r, big.NewRat(100, 1)), precOf(val))
+		}
+	}
+	return val, nil
+}
+
+// checkExponent returns an error if the exponent, or any element of a list or matrix of exponents, is an
+// integer larger in magnitude than MaxExponent
+func (ev *Evaluator) checkExponent(exp Value) error {
+	var rats []*big.Rat
+	switch exp := exp.(type) {
+	case *NumberValue:
+		rats = []*big.Rat{exp.val}
+	case *ListValue:
+		for _, elem := range exp.elems {
+			if err := ev.checkExponent(elem); err != nil {
+				return err
+			}
+		}
+	case *MatrixValue:
+		for _, row := range exp.rows {
+			rats = append(rats, row...)
+		}
+	}
+	for _, r := range rats {
+		if r.IsInt() && new(big.Int).Abs(r.Num()).Cmp(big.NewInt(ev.MaxExponent)) > 0 {
+			return fmt.Errorf("Exponent %s exceeds the limit of %d", r.RatString(), ev.MaxExponent)
+		}
+	}
+	return nil
+}
+
+// factorial returns n! exactly, provided n is a non-negative integer no larger than MaxFactorial
+func (ev *Evaluator) factorial(n *big.Rat) (Value, error) {
+	if !n.IsInt() || n.Sign() < 0 {
+		return nil, fmt.Errorf("Factorial of %s is undefined", n.RatString())
+	}
+	if n.Num().Cmp(big.NewInt(ev.MaxFactorial)) > 0 {
+		return nil, fmt.Errorf("Factorial of %s exceeds the limit of %d", n.RatString(), ev.MaxFactorial)
+	}
+	f := new(big.Int).MulRange(1, n.Num().Int64())
+	return numberOf(new(big.Rat).SetInt(f), 0), nil
+}
+
+// evalOperand evaluates the operand of a Term, ignoring any postfix operators
+func (ev *Evaluator) evalOperand(term *Term) (Value, error) {
+	switch {
+	case term.exp != nil:
+		return ev.evalConditional(term.exp)
+	case term.number != nil && term.currency != "":
+		return NewMoneyValue(term.number.val, term.currency), nil
+	case term.number != nil && term.unit != nil:
+		return quantityOf(new(big.Rat).Mul(term.number.val, term.unit.scale), 0, term.unit), nil
+	case term.number != nil:
+		return NewNumberValue(term.number.val), nil
+	case term.date != nil:
+		return NewDateValue(term.date.val), nil
+	case term.duration != nil:
+		return NewDurationValue(term.duration.val), nil
+	case term.cells != nil:
+		return ev.evalRange(term.cells)
+	case term.text != nil:
+		return &StringValue{val: term.text.val}, nil
+	case term.ident != nil:
+		if val, ok := ev.constant(term.ident.name); ok {
+			return val, nil
+		}
+		if val, ok := ev.scope.lookup(term.ident.name); ok {
+			return val, nil
+		}
+		if val, ok := ev.vars[term.ident.name]; ok {
+			return val, nil
+		}
+		if def, ok := ev.functions[term.ident.name]; ok {
+			return def.function(), nil
+		}
+		return nil, fmt.Errorf("Unknown variable %s", term.ident.name)
+	case term.call != nil:
+		// Functions bound to parameters shadow everything else, global variables holding functions nothing
+		if val, ok := ev.scope.lookup(term.call.name); ok {
+			if fn, ok := val.(*FunctionValue); ok {
+				return ev.call(fn, term.call.args)
+			}
+		}
+		if fn, ok := builtins[term.call.name]; ok {
+			val, err := fn(ev, term.call.args)
+			if err != nil {
+				return nil, positioned(err, term.call.pos)
+			}
+			return val, nil
+		}
+		if fn, ok := realFuncs[term.call.name]; ok {
+			return ev.evalRealFunc(term.call.name, fn, term.call.args)
+		}
+		if def, ok := ev.functions[term.call.name]; ok {
+			return ev.call(def.function(), term.call.args)
+		}
+		if fn, ok := ev.vars[term.call.name].(*FunctionValue); ok {
+			return ev.call(fn, term.call.args)
+		}
+		return nil, fmt.Errorf("Unknown function %s", term.call.name)
+	case term.lambda != nil:
+		return ev.lambda(term.lambda)
+	case term.piecewise != nil:
+		return ev.evalPiecewise(term.piecewise)
+	case term.list != nil:
+		elems := make([]Value, len(term.list.elems))
+		for i, elem := range term.list.elems {
+			val, err := ev.evalConditional(elem)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = val
+		}
+		list := &ListValue{elems: elems}
+		if m, ok := matrixOf(list); ok {
+			return m, nil
+		}
+		return list, nil
+	}
+	return nil, errors.New("Empty term")
+}
+
+// toBool returns the bool held by the given value, or an error if it is not a BoolValue
+func toBool(val Value) (bool, error) {
+	if b, ok := val.(*BoolValue); ok {
+		return b.val, nil
+	}
+	return false, fmt.Errorf("Expected boolean, got %s", val)
+}
+
+// toRat returns the rational held by the given value, or an error if it is not a NumberValue
+func toRat(val Value) (*big.Rat, error) {
+	if n, ok := val.(*NumberValue); ok {
+		return n.val, nil
+	}
+	return nil, fmt.Errorf("Expected number, got %s", val)
+}
+
+// compare applies the comparison operator to the two values. Booleans only support equality
+func compare(op Token, a, b Value) (Value, error) {
+	if x, ok := a.(*BoolValue); ok {
+		y, ok := b.(*BoolValue)
+		if !ok {
+			return nil, fmt.Errorf("Cannot compare %s with %s", a, b)
+		}
+		switch op {
+		case EQ:
+			return NewBoolValue(x.val == y.val), nil
+		case NEQ:
+			return NewBoolValue(x.val != y.val), nil
+		}
+		return nil, errors.New("Booleans can only be compared for equality")
+	}
+	if err := moneyAndUnits(a, b); err != nil {
+		return nil, err
+	}
+	if isQuantity(a) || isQuantity(b) {
+		return compareQuantities(op, a, b)
+	}
+	if isTemporal(a) || isTemporal(b) {
+		return compareTemporal(op, a, b)
+	}
+	if isMoney(a) || isMoney(b) {
+		return compareMoney(op, a, b)
+	}
+	if isText(a) || isText(b) {
+		return compareText(op, a, b)
+	}
+
+	x, err := toRat(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toRat(b)
+	if err != nil {
+		return nil, err
+	}
+
+	c := x.Cmp(y)
+	switch op {
+	case EQ:
+		return NewBoolValue(c == 0), nil
+	case NEQ:
+		return NewBoolValue(c != 0), nil
+	case LT:
+		return NewBoolValue(c < 0), nil
+	case LTE:
+		return NewBoolValue(c <= 0), nil
+	case GT:
+		return NewBoolValue(c > 0), nil
+	case GTE:
+		return NewBoolValue(c >= 0), nil
+	}
+	return nil, errors.New("Expected comparison operator")
+}
+
+// arithmetic applies the arithmetic operator to the two values, element-wise if either is a list
+func arithmetic(op Token, a, b Value) (Value, error) {
+	if isMatrix(a) || isMatrix(b) {
+		return matrixArithmetic(op, a, b)
+	}
+	if isList(a) || isList(b) {
+		return broadcast(op, a, b)
+	}
+	if err := moneyAndUnits(a, b); err != nil {
+		return nil, err
+	}
+	if isQuantity(a) || isQuantity(b) {
+		return quantityArithmetic(op, a, b)
+	}
+	if isTemporal(a) || isTemporal(b) {
+		return temporalArithmetic(op, a, b)
+	}
+	if isMoney(a) || isMoney(b) {
+		return moneyArithmetic(op, a, b)
+	}
+
+	x, err := toRat(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toRat(b)
+	if err != nil {
+		return nil, err
+	}
+
+	res := new(big.Rat)
+	switch op {
+	case PLUS:
+		res.Add(x, y)
+	case MINUS:
+		res.Sub(x, y)
+	case MULTIPLY, IMPLICIT_MULTIPLY:
+		res.Mul(x, y)
+	case DIVIDE:
+		if y.Sign() == 0 {
+			return nil, errors.New("Division by zero")
+		}
+		res.Quo(x, y)
+	case INT_DIVIDE:
+		if y.Sign() == 0 {
+			return nil, errors.New("Division by zero")
+		}
+		res.SetInt(floorQuo(x, y))
+	case MODULO:
+		if y.Sign() == 0 {
+			return nil, errors.New("Division by zero")
+		}
+		// Floored modulo, so the result takes the sign of the divisor
+		res.Sub(x, res.Mul(y, new(big.Rat).SetInt(floorQuo(x, y))))
+	case POW:
+		if res, err = pow(x, y); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("Expected arithmetic operator")
+	}
+	return numberOf(res, precOf(a, b)), nil
+}
+
+// negate returns the negation of a number, quantity, duration or amount of money, or of each element of a list
+// or matrix
+func negate(val Value) (Value, error) {
+	if _, ok := val.(*DurationValue); ok || isList(val) || isMatrix(val) || isQuantity(val) || isMoney(val) {
+		return arithmetic(MULTIPLY, NewNumberValue(big.NewRat(-1, 1)), val)
+	}
+	r, err := toRat(val)
+	if err != nil {
+		return nil, err
+	}
+	return numberOf(new(big.Rat).Neg(r), precOf(val)), nil
+}
+
+// floorQuo returns the largest integer less than or equal to x/y
+func floorQuo(x, y *big.Rat) *big.Int {
+	q := new(big.Rat).Quo(x, y)
+	n, d := q.Num(), q.Denom()
+	// Int.Div is Euclidean, which is floored division for a positive divisor
+	return new(big.Int).Div(n, d)
+}
+
+// pow raises x to the integer power y
+func pow(x, y *big.Rat) (*big.Rat, error) {
+	if !y.IsInt() {
+		return nil, fmt.Errorf("Non-integer exponent %s", y.RatString())
+	}
+
+	e := new(big.Int).Abs(y.Num())
+	num := new(big.Int).Exp(x.Num(), e, nil)
+	den := new(big.Int).Exp(x.Denom(), e, nil)
+	if y.Sign() < 0 {
+		if num.Sign() == 0 {
+			return nil, errors.New("Division by zero")
+		}
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// builtinIf implements if(condition, then, else), evaluating only the selected branch
+func builtinIf(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("if expects 3 arguments, got %d", len(args))
+	}
+
+	val, err := ev.evalConditional(args[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := toBool(val)
+	if err != nil {
+		return nil, err
+	}
+	if b {
+		return ev.evalConditional(args[1])
+	}
+	return ev.evalConditional(args[2])
+}
@@ -0,0 +1,292 @@
+package mathval
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type EvalSuite struct{}
+
+var _ = Suite(&EvalSuite{})
+
+type EvalResult struct {
+	input    string
+	expected string
+}
+
+// evaluate parses and evaluates the input with the given evaluator
+func evaluate(ev *Evaluator, input string) (Value, error) {
+	cond, err := NewParser(strings.NewReader(input)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	return ev.Eval(cond)
+}
+
+func (e *EvalSuite) TestEvalArithmetic(c *C) {
+	expected := []EvalResult{
+		{input: "10^2*4+1", expected: "401"},
+		{input: "10-2-3", expected: "5"},
+		{input: "2^3^2", expected: "512"},
+		{input: "2^(0-2)", expected: "1/4"},
+		{input: "12/4/3", expected: "1"},
+		{input: "7\\2", expected: "3"},
+		{input: "(0-7)\\2", expected: "-4"},
+		{input: "7%3", expected: "1"},
+		{input: "(0-7)%3", expected: "2"},
+		{input: "1.5*(2+2)", expected: "6"},
+	}
+
+	ev := NewEvaluator()
+	for _, res := range expected {
+		val, err := evaluate(ev, res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (e *EvalSuite) TestEvalLogical(c *C) {
+	expected := []EvalResult{
+		{input: "1 < 2", expected: "true"},
+		{input: "2 <= 2", expected: "true"},
+		{input: "1 + 1 == 2", expected: "true"},
+		{input: "3 != 3", expected: "false"},
+		{input: "1 > 2 or 3 >= 3", expected: "true"},
+		{input: "1 < 2 and 2 > 3", expected: "false"},
+		{input: "not 1 > 2", expected: "true"},
+		{input: "not not 1 > 2", expected: "false"},
+		{input: "(1 < 2) == (3 < 4)", expected: "true"},
+		{input: "1 < 2 ? 10 : 20", expected: "10"},
+		{input: "1 > 2 ? 10 : 2 > 1 ? 30 : 40", expected: "30"},
+	}
+
+	ev := NewEvaluator()
+	for _, res := range expected {
+		val, err := evaluate(ev, res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (e *EvalSuite) TestEvalPostfix(c *C) {
+	expected := []EvalResult{
+		{input: "5!", expected: "120"},
+		{input: "0!", expected: "1"},
+		{input: "3!!", expected: "720"},
+		{input: "2^3!", expected: "64"},
+		{input: "-3!", expected: "-6"},
+		{input: "-2^2", expected: "-4"},
+		{input: "2^-1", expected: "1/2"},
+		{input: "--2", expected: "2"},
+		{input: "3*-2", expected: "-6"},
+		{input: "1 - -1", expected: "2"},
+		{input: "20%", expected: "1/5"},
+		{input: "200 * 15%", expected: "30"},
+		{input: "50% - 1", expected: "-1/2"},
+		{input: "100 + 10%", expected: "110"},
+		{input: "100 - 10%", expected: "90"},
+		{input: "80 - 25% + 50%", expected: "90"},
+		{input: "100 + -10%", expected: "90"},
+		{input: "100 + 10% * 2", expected: "501/5"},
+		{input: "20 % 3", expected: "2"},
+		{input: "20 % -3", expected: "-1"},
+		{input: "20% - 3", expected: "-14/5"},
+		{input: "20%-3", expected: "-14/5"},
+		{input: "25!", expected: "15511210043330985984000000"},
+	}
+
+	ev := NewEvaluator()
+	for _, res := range expected {
+		val, err := evaluate(ev, res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (e *EvalSuite) TestEvalFactorialLimit(c *C) {
+	ev := NewEvaluator()
+	ev.MaxFactorial = 20
+	_, err := evaluate(ev, "20!")
+	c.Assert(err, IsNil)
+	_, err = evaluate(ev, "21!")
+	c.Assert(err, ErrorMatches, ".*exceeds the limit.*")
+}
+
+func (e *EvalSuite) TestEvalExponentLimit(c *C) {
+	ev := NewEvaluator()
+	ev.MaxExponent = 20
+	for _, input := range []string{"2^20", "2^-20", "[2, 3]^20"} {
+		_, err := evaluate(ev, input)
+		c.Assert(err, IsNil, Commentf(input))
+	}
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "2^21", err: "Exponent 21 exceeds the limit of 20"},
+		{input: "2^-21", err: "Exponent -21 exceeds the limit of 20"},
+		{input: "2^[1, 21]", err: "Exponent 21 exceeds the limit of 20"},
+		{input: "2^(3 * 7)", err: "Exponent 21 exceeds the limit of 20"},
+	}
+	for _, res := range expected {
+		_, err := evaluate(ev, res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+
+	// The default limit stops a short input from hanging the evaluator
+	_, err := evaluate(NewEvaluator(), "2^100000000")
+	c.Assert(err, ErrorMatches, "Exponent 100000000 exceeds the limit of 100000")
+}
+
+func (e *EvalSuite) TestEvalImplicitMultiplication(c *C) {
+	ev := NewEvaluator()
+	ev.Set("x", NewNumberValue(big.NewRat(4, 1)))
+	ev.Set("a", NewNumberValue(big.NewRat(3, 1)))
+	ev.Set("b", NewNumberValue(big.NewRat(2, 1)))
+
+	expected := []struct {
+		mode     Mode
+		input    string
+		expected string
+	}{
+		{mode: ImplicitMultiplication, input: "2x", expected: "8"},
+		{mode: ImplicitMultiplication, input: "3(a+b)", expected: "15"},
+		{mode: ImplicitMultiplication, input: "(a+b)(a-b)", expected: "5"},
+		{mode: ImplicitMultiplication, input: "1/2x", expected: "2"},
+		{mode: ImplicitMultiplication, input: "2x^2", expected: "32"},
+		{mode: TightImplicitMultiplication, input: "1/2x", expected: "1/8"},
+		{mode: TightImplicitMultiplication, input: "2x^2 + 1", expected: "33"},
+		{mode: TightImplicitMultiplication, input: "a/2b*x", expected: "3"},
+	}
+
+	for _, res := range expected {
+		parser := NewParser(strings.NewReader(res.input))
+		parser.SetMode(res.mode)
+		cond, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(res.input))
+		val, err := ev.Eval(cond)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (e *EvalSuite) TestEvalConstants(c *C) {
+	ev := NewEvaluator()
+	val, err := evaluate(ev, "pi")
+	c.Assert(err, IsNil)
+	c.Assert(val.(*NumberValue).Exact(), Equals, false)
+	c.Assert(val.String()[:20], Equals, "3.141592653589793238")
+
+	val, err = evaluate(ev, "2 * pi == tau")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "true")
+
+	val, err = evaluate(ev, "e^2 > 7 and e^2 < 7.4")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "true")
+
+	ev.Precision = 53
+	val, err = evaluate(ev, "pi * 2")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "6.28318530717959")
+
+	// Exact values stay exact
+	val, err = evaluate(ev, "1/3")
+	c.Assert(err, IsNil)
+	c.Assert(val.(*NumberValue).Exact(), Equals, true)
+}
+
+func (e *EvalSuite) TestEvalRegisterConstant(c *C) {
+	ev := NewEvaluator()
+	c.Assert(ev.RegisterConstant("vat", NewNumberValue(big.NewRat(1, 5))), IsNil)
+
+	val, err := evaluate(ev, "100 * (1 + vat)")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "120")
+
+	// Constants cannot be shadowed or redefined
+	c.Assert(ev.Set("vat", NewNumberValue(big.NewRat(1, 10))), NotNil)
+	c.Assert(ev.Set("pi", NewNumberValue(big.NewRat(3, 1))), NotNil)
+	c.Assert(ev.RegisterConstant("vat", NewNumberValue(big.NewRat(1, 10))), NotNil)
+	c.Assert(ev.RegisterConstant("e", NewNumberValue(big.NewRat(3, 1))), NotNil)
+	c.Assert(ev.RegisterConstant("and", NewNumberValue(big.NewRat(3, 1))), NotNil)
+
+	c.Assert(ev.Set("x", NewNumberValue(big.NewRat(1, 1))), IsNil)
+	c.Assert(ev.RegisterConstant("x", NewNumberValue(big.NewRat(3, 1))), NotNil)
+}
+
+func (e *EvalSuite) TestEvalShortCircuit(c *C) {
+	// The right hand side would fail with an unknown variable if it were evaluated
+	ev := NewEvaluator()
+	for _, input := range []string{"1 > 2 and missing", "1 < 2 or missing", "1 < 2 ? 1 : missing", "if(1 > 2, missing, 3)"} {
+		_, err := evaluate(ev, input)
+		c.Assert(err, IsNil, Commentf(input))
+	}
+}
+
+func (e *EvalSuite) TestEvalVariables(c *C) {
+	ev := NewEvaluator()
+	ev.Set("x", NewNumberValue(big.NewRat(20, 1)))
+	ev.Set("y", NewNumberValue(big.NewRat(2, 1)))
+
+	val, err := evaluate(ev, "if(x > 10 and y <= 3, x*0.9, x)")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "18")
+
+	ev.Set("y", NewNumberValue(big.NewRat(5, 1)))
+	val, err = evaluate(ev, "if(x > 10 and y <= 3, x*0.9, x)")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "20")
+}
+
+func (e *EvalSuite) TestEvalErrors(c *C) {
+	inputs := []string{
+		"1/0",
+		"1%0",
+		"2^0.5",
+		"0^(0-1)",
+		"1 and 2 > 1",
+		"not 1",
+		"1 ? 2 : 3",
+		"(1 < 2) < 3",
+		"(1 < 2) + 1",
+		"missing",
+		"missing()",
+		"if(1 < 2, 3)",
+		"(-1)!",
+		"0.5!",
+		"(1 < 2)!",
+		"-(1 < 2)",
+	}
+
+	ev := NewEvaluator()
+	for _, input := range inputs {
+		_, err := evaluate(ev, input)
+		c.Assert(err, NotNil, Commentf(input))
+	}
+}
+
+func (e *EvalSuite) TestEvalUnicode(c *C) {
+	expected := []EvalResult{
+		{input: "6 × 7", expected: "42"},
+		{input: "1 ÷ 4 − 1", expected: "-3/4"},
+		{input: "2³", expected: "8"},
+		{input: "2⁻²", expected: "1/4"},
+		{input: "−3²", expected: "-9"},
+		{input: "√16", expected: "4"},
+		{input: "√(9 + 16)", expected: "5"},
+		{input: "√4! == sqrt(24)", expected: "true"},
+		{input: "√√16 + 1", expected: "3"},
+		{input: "√+9 − √−−4^2", expected: "-1"},
+		{input: "3 ≤ 3 and 4 ≥ 5 or 1 ≠ 2", expected: "true"},
+		{input: "π == pi", expected: "true"},
+	}
+	for _, res := range expected {
+		val, err := evaluate(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
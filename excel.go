@@ -0,0 +1,229 @@
+package mathval
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// maxRoundPlaces is the most decimal places round accepts either side of the decimal mark
+const maxRoundPlaces = 1000
+
+// excelFunctions maps the spreadsheet functions read in Excel mode onto mathval's builtins. Variadic functions
+// take any mix of values and ranges, which are flattened into a single list for the builtin
+var excelFunctions = map[string]struct {
+	name     string
+	variadic bool
+}{
+	"IF":      {name: "if"},
+	"TRUE":    {name: "true"},
+	"FALSE":   {name: "false"},
+	"ROUND":   {name: "round"},
+	"ABS":     {name: "abs"},
+	"SUM":     {name: "sum", variadic: true},
+	"AVERAGE": {name: "mean", variadic: true},
+	"MIN":     {name: "min", variadic: true},
+	"MAX":     {name: "max", variadic: true},
+}
+
+// excelBoolean returns whether the name is TRUE or FALSE, in any case, which Excel mode reads as calls to true()
+// and false() whether or not they are written with parentheses
+func excelBoolean(name string) bool {
+	upper := strings.ToUpper(name)
+	return upper == "TRUE" || upper == "FALSE"
+}
+
+// excelCall rewrites the call held by the Term, read in Excel mode, as its mathval equivalent. MOD becomes the
+// '%' operator, which is also floored, IF without a value for when the condition is false gives FALSE, and
+// other functions outside excelFunctions are called by their lower case name, so "SQRT(4)" is "sqrt(4)"
+func excelCall(term *Term) error {
+	call := term.call
+	name := strings.ToUpper(call.name)
+	if name == "MOD" {
+		if len(call.args) != 2 {
+			return fmt.Errorf("MOD expects 2 arguments, got %d", len(call.args))
+		}
+		term.call, term.exp = nil, binary(call.args[0], MODULO, call.args[1])
+		return nil
+	}
+
+	fn, ok := excelFunctions[name]
+	if !ok {
+		call.name = strings.ToLower(call.name)
+		return nil
+	}
+	call.name = fn.name
+	if name == "IF" && len(call.args) == 2 {
+		call.args = append(call.args, termConditional(&Term{call: &Call{name: "false", pos: call.pos}}))
+	}
+	if len(call.args) == 1 {
+		if arg := call.args[0].soleTerm(); arg != nil && arg.cells != nil {
+			// A single range is already a list
+			return nil
+		}
+	}
+	if fn.variadic {
+		list := &Term{list: &ListLiteral{elems: call.args}}
+		flatten := &Call{name: "flatten", args: []*Conditional{conditionalOf(&Expression{factor: &Factor{power: &Power{term: list}}})}}
+		call.args = []*Conditional{conditionalOf(&Expression{factor: &Factor{power: &Power{term: &Term{call: flatten}}}})}
+	}
+	return nil
+}
+
+// StringValue is text, from a STRING or a concatenation in Excel mode
+type StringValue struct {
+	val string
+}
+
+// NewStringValue returns a StringValue holding the given text
+func NewStringValue(s string) *StringValue {
+	return &StringValue{val: s}
+}
+
+// Text returns the text held by the StringValue
+func (s *StringValue) Text() string {
+	return s.val
+}
+
+// String returns the text as a STRING, in double quotes with any '"' in it doubled
+func (s *StringValue) String() string {
+	return `"` + strings.ReplaceAll(s.val, `"`, `""`) + `"`
+}
+
+// isText returns whether the value is a StringValue
+func isText(val Value) bool {
+	_, ok := val.(*StringValue)
+	return ok
+}
+
+// textOf returns the text a value is joined as by concat. Numbers are written in decimal to at most 15
+// significant digits and booleans in upper case, as spreadsheets do
+func textOf(val Value) string {
+	switch v := val.(type) {
+	case *StringValue:
+		return v.val
+	case *NumberValue:
+		return formatFloat(new(big.Float).SetRat(v.val), 15)
+	case *BoolValue:
+		return strings.ToUpper(v.String())
+	}
+	return val.String()
+}
+
+// compareText applies the comparison operator to two strings, ignoring case as spreadsheets do
+func compareText(op Token, a, b Value) (Value, error) {
+	x, xText := a.(*StringValue)
+	y, yText := b.(*StringValue)
+	if !xText || !yText {
+		return nil, fmt.Errorf("Cannot compare %s with %s", a, b)
+	}
+	c := strings.Compare(strings.ToLower(x.val), strings.ToLower(y.val))
+	return compare(op, NewNumberValue(big.NewRat(int64(c), 1)), NewNumberValue(new(big.Rat)))
+}
+
+// builtinConcat implements concat(a, b, ...), which '&' is read as in Excel mode, joining the text of each
+// argument, see textOf
+func builtinConcat(ev *Evaluator, args []*Conditional) (Value, error) {
+	var buf strings.Builder
+	for _, arg := range args {
+		val, err := ev.evalConditional(arg)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(textOf(val))
+	}
+	return &StringValue{val: buf.String()}, nil
+}
+
+// builtinBool returns the builtin for true() or false(), which Excel's TRUE and FALSE are read as
+func builtinBool(b bool) builtin {
+	return func(ev *Evaluator, args []*Conditional) (Value, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%t expects no arguments, got %d", b, len(args))
+		}
+		return NewBoolValue(b), nil
+	}
+}
+
+// builtinRound implements round(x) and round(x, places), rounding a number or amount of money to the given
+// number of decimal places, 0 by default, with halves away from zero. Negative places round to tens, hundreds
+// and so on. The result is exact
+func builtinRound(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("round expects 1 or 2 arguments, got %d", len(args))
+	}
+	val, err := ev.evalConditional(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var places int64
+	if len(args) == 2 {
+		arg, err := ev.evalConditional(args[1])
+		if err != nil {
+			return nil, err
+		}
+		p, err := toRat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("round: %s", err)
+		}
+		if !p.IsInt() || p.Num().CmpAbs(big.NewInt(maxRoundPlaces)) > 0 {
+			return nil, fmt.Errorf("round: Places must be an integer from -%d to %d, got %s", maxRoundPlaces, maxRoundPlaces, arg)
+		}
+		places = p.Num().Int64()
+	}
+
+	switch v := val.(type) {
+	case *NumberValue:
+		return NewNumberValue(roundRat(v.val, places)), nil
+	case *MoneyValue:
+		return &MoneyValue{amount: roundRat(v.amount, places), currency: v.currency}, nil
+	}
+	return nil, fmt.Errorf("round: Expected number, got %s", val)
+}
+
+// roundRat returns r rounded to the given number of decimal places, with halves away from zero
+func roundRat(r *big.Rat, places int64) *big.Rat {
+	e := places
+	if e < 0 {
+		e = -e
+	}
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(e), nil))
+	if places < 0 {
+		scale.Inv(scale)
+	}
+	x := new(big.Rat).Mul(r, scale)
+
+	num := new(big.Int).Mul(x.Num(), big.NewInt(2))
+	den := new(big.Int).Mul(x.Denom(), big.NewInt(2))
+	if x.Sign() < 0 {
+		num.Sub(num, x.Denom())
+	} else {
+		num.Add(num, x.Denom())
+	}
+	n := new(big.Rat).SetInt(num.Quo(num, den))
+	return n.Quo(n, scale)
+}
+
+// builtinAbs implements abs(x), the magnitude of a number or amount of money
+func builtinAbs(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("abs expects 1 argument, got %d", len(args))
+	}
+	val, err := ev.evalConditional(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var r *big.Rat
+	switch v := val.(type) {
+	case *NumberValue:
+		r = v.val
+	case *MoneyValue:
+		r = v.amount
+	default:
+		return nil, fmt.Errorf("abs: Expected number, got %s", val)
+	}
+	if r.Sign() < 0 {
+		return negate(val)
+	}
+	return val, nil
+}
@@ -0,0 +1,167 @@
+package mathval
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type ExcelSuite struct{}
+
+var _ = Suite(&ExcelSuite{})
+
+// parseExcel parses the formula in Excel mode
+func parseExcel(input string) (*Conditional, error) {
+	parser := NewParser(strings.NewReader(input))
+	parser.SetMode(Excel)
+	return parser.Parse()
+}
+
+// evaluateExcel parses the formula in Excel mode and evaluates it with A1 to A3 set to 5, 15 and -2.5
+func evaluateExcel(input string) (Value, error) {
+	cond, err := parseExcel(input)
+	if err != nil {
+		return nil, err
+	}
+	ev := NewEvaluator()
+	ev.Set("A1", NewNumberValue(big.NewRat(5, 1)))
+	ev.Set("A2", NewNumberValue(big.NewRat(15, 1)))
+	ev.Set("A3", NewNumberValue(big.NewRat(-5, 2)))
+	return ev.Eval(cond)
+}
+
+func (e *ExcelSuite) TestFormulas(c *C) {
+	expected := []EvalResult{
+		{input: "=IF(A1>10, ROUND(A1*1.2, 2), 0)", expected: "0"},
+		{input: "=IF(A2>10, ROUND(A2*1.23456, 2), 0)", expected: "463/25"},
+		{input: "=if(A2 > 10; Round(A2 / 7; 3); 0)", expected: "2143/1000"},
+		{input: "1 + 2", expected: "3"},
+		{input: "=SUM(A1:A3)", expected: "35/2"},
+		{input: "=SUM(A1:A3, 10, A1)", expected: "65/2"},
+		{input: "=SUM(5)", expected: "5"},
+		{input: "=AVERAGE(A1:A2)", expected: "10"},
+		{input: "=AVERAGE(A1:A3; 2.5)", expected: "5"},
+		{input: "=MIN(A1:A3)", expected: "-5/2"},
+		{input: "=MAX(A1:A2, 20)", expected: "20"},
+		{input: "=ABS(A3)", expected: "5/2"},
+		{input: "=MOD(A2, 4)", expected: "3"},
+		{input: "=MOD(-7, 3)", expected: "2"},
+		{input: "=MOD(7, -3)", expected: "-2"},
+		{input: "=MOD(A2, 4) * 2", expected: "6"},
+		{input: "=ROUND(2.5)", expected: "3"},
+		{input: "=ROUND(-2.5, 0)", expected: "-3"},
+		{input: "=ROUND(1234, -2)", expected: "1200"},
+		{input: "=SQRT(16)", expected: "4"},
+		{input: "=A1=5", expected: "true"},
+		{input: "=A1<>5", expected: "false"},
+		{input: "=A1 <= 5", expected: "true"},
+		{input: "=50%*A2", expected: "15/2"},
+		{input: `="Total: "&SUM(A1:A2)`, expected: `"Total: 20"`},
+		{input: `=A1&"/"&A3&" "&(A1>0)`, expected: `"5/-2.5 TRUE"`},
+		{input: `="a"&1+2`, expected: `"a3"`},
+		{input: `="say ""hi"""`, expected: `"say ""hi"""`},
+		{input: `="abc"="ABC"`, expected: "true"},
+		{input: `="abc"<"abd"`, expected: "true"},
+		{input: `=IF(A1&""="5", "five", "other")`, expected: `"five"`},
+		{input: `=ROUND(1/3, 4)&""`, expected: `"0.3333"`},
+		{input: "=IF(A1>10, 1)", expected: "false"},
+		{input: "=IF(A2>10; A2)", expected: "15"},
+		{input: "=TRUE", expected: "true"},
+		{input: "=IF(FALSE(), 1, 2) + IF(true, 3, 4)", expected: "5"},
+		{input: "=(A1 > 0) = TRUE", expected: "true"},
+		{input: `="x"&FALSE`, expected: `"xFALSE"`},
+	}
+	for _, res := range expected {
+		val, err := evaluateExcel(res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+
+	val, err := evaluateExcel(`="a"&"b"`)
+	c.Assert(err, IsNil)
+	c.Assert(val.(*StringValue).Text(), Equals, "ab")
+}
+
+func (e *ExcelSuite) TestPrinting(c *C) {
+	// Formulas are printed in mathval's syntax
+	expected := []EvalResult{
+		{input: "=IF(A1>10, ROUND(A1*1.2, 2), 0)", expected: "if(A1 > 10, round(A1 * 1.2, 2), 0)"},
+		{input: "=SUM(A1:A10)", expected: "sum(A1:A10)"},
+		{input: "=SUM(A1:A10; B1; 2)", expected: "sum(flatten([A1:A10, B1, 2]))"},
+		{input: "=AVERAGE(A1)", expected: "mean(flatten([A1]))"},
+		{input: "=MOD(A1, -3)", expected: "(A1 % (-3))"},
+		{input: "=MOD(A1 + 1, 3)^2", expected: "((A1 + 1) % 3)^2"},
+		{input: "=A1<>B1", expected: "A1 != B1"},
+		{input: `="x"&A1&"y"`, expected: `concat("x", A1, "y")`},
+		{input: `=Max(1, 2)`, expected: "max(flatten([1, 2]))"},
+		{input: "=IF(A1>10, A1)", expected: "if(A1 > 10, A1, false())"},
+		{input: "=TRUE() <> False", expected: "true() != false()"},
+	}
+	for _, res := range expected {
+		cond, err := parseExcel(res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(cond.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (e *ExcelSuite) TestErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "=MOD(1)", err: "MOD expects 2 arguments, got 1"},
+		{input: "=ROUND(1, 2, 3)", err: "round expects 1 or 2 arguments, got 3"},
+		{input: "=ROUND(1, 0.5)", err: "round: Places must be an integer from -1000 to 1000, got 1/2"},
+		{input: "=ABS(\"a\")", err: `abs: Expected number, got "a"`},
+		{input: `="a" + 1`, err: `Expected number, got "a"`},
+		{input: `="a" < 1`, err: `Cannot compare "a" with 1`},
+		{input: `="abc`, err: `Unexpected ILLEGAL`},
+		{input: "=AVERAGE(A4:A9)", err: "mean: Empty list"},
+		{input: "=IF(A1)", err: "if expects 3 arguments, got 1"},
+		{input: "=TRUE(1)", err: "true expects no arguments, got 1"},
+	}
+	for _, res := range expected {
+		_, err := evaluateExcel(res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+
+	// Strings and '&' are only read in Excel mode
+	parser = NewParser(strings.NewReader(`"a" & 1`))
+	_, err := parser.Parse()
+	c.Assert(err, ErrorMatches, "Unexpected STRING")
+	parser = NewParser(strings.NewReader("1 & 2"))
+	_, err = parser.Parse()
+	c.Assert(err, ErrorMatches, regexp.QuoteMeta(`Unexpected "&" after expression`))
+}
+
+func (e *ExcelSuite) TestSheet(c *C) {
+	sheet := NewSheet()
+	sheet.SetMode(Excel)
+	set(c, sheet,
+		"A1", "=4",
+		"A2", "=A1*2.5",
+		"A3", "=SUM(A1:A2, 1)",
+		"B1", `=IF(A3>10; "big"; "small")`,
+		"B2", `=B1&" "&ROUND(AVERAGE(A1:A3)/3, 2)`,
+	)
+	c.Assert(values(sheet, "A3", "B1", "B2"), DeepEquals, []string{"15", `"big"`, `"big 3.22"`})
+
+	set(c, sheet, "A1", "=1")
+	c.Assert(values(sheet, "A3", "B1", "B2"), DeepEquals, []string{"9/2", `"small"`, `"small 0.89"`})
+}
+
+func (e *ExcelSuite) TestFlatten(c *C) {
+	expected := []EvalResult{
+		{input: "flatten([1, [2, [3, 4]], [[5, 6], [7, 8]]])", expected: "[1, 2, 3, 4, 5, 6, 7, 8]"},
+		{input: "flatten([[1, 2], [3, 4]])", expected: "[1, 2, 3, 4]"},
+		{input: "flatten([])", expected: "[]"},
+		{input: "abs(-3) + round(2.345, 2)", expected: "107/20"},
+	}
+	for _, res := range expected {
+		val, err := evaluate(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
@@ -0,0 +1,167 @@
+package mathval
+
+import (
+	"fmt"
+	"io"
+)
+
+// scope holds the parameters bound by a call to a user-defined function or lambda. Scopes are lexical, so the
+// parent is the scope the function was defined in rather than the one it was called from
+type scope struct {
+	vars   map[string]Value
+	parent *scope
+}
+
+// lookup returns the value of the named variable in the innermost scope binding it
+func (s *scope) lookup(name string) (Value, bool) {
+	for ; s != nil; s = s.parent {
+		if val, ok := s.vars[name]; ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// isBuiltinFunction returns whether the name refers to a built-in function
+func isBuiltinFunction(name string) bool {
+	_, builtin := builtins[name]
+	_, real := realFuncs[name]
+	return builtin || real
+}
+
+// Define adds a user-defined function to the evaluator, replacing any previous definition with the same name.
+// Built-in functions cannot be redefined, and parameters cannot shadow constants
+func (ev *Evaluator) Define(def *Definition) error {
+	if isBuiltinFunction(def.name) {
+		return fmt.Errorf("Cannot redefine built-in function %s", def.name)
+	}
+	if err := ev.checkParams(def.name, def.params); err != nil {
+		return err
+	}
+
+	ev.functions[def.name] = def
+	return nil
+}
+
+// checkParams returns an error if any of the parameters of the named function shadow a constant or are
+// repeated
+func (ev *Evaluator) checkParams(name string, params []string) error {
+	seen := make(map[string]bool)
+	for _, param := range params {
+		if ev.isConstant(param) {
+			return fmt.Errorf("Parameter %s of %s shadows a constant", param, name)
+		}
+		if seen[param] {
+			return fmt.Errorf("Duplicate parameter %s in definition of %s", param, name)
+		}
+		seen[param] = true
+	}
+	return nil
+}
+
+// function returns the user-defined function as a value. Definitions are global, so it has no closure
+func (def *Definition) function() *FunctionValue {
+	return &FunctionValue{name: def.name, params: def.params, body: def.body}
+}
+
+// lambda returns the Lambda as a value, closing over the current scope
+func (ev *Evaluator) lambda(lambda *Lambda) (*FunctionValue, error) {
+	if err := ev.checkParams("lambda", lambda.params); err != nil {
+		return nil, err
+	}
+	return &FunctionValue{params: lambda.params, body: lambda.body, closure: ev.scope}, nil
+}
+
+// RunResult is the outcome of running a Program
+type RunResult struct {
+	// Value is the value of the last expression or assignment, or nil if the program contains neither
+	Value Value
+
+	// Bindings holds the final value of every variable the program assigned to
+	Bindings map[string]Value
+}
+
+// Run runs each statement of the program in turn. Assignments bind variables in the evaluator, so they are
+// visible to later statements and later runs
+func (ev *Evaluator) Run(prog *Program) (*RunResult, error) {
+	res := &RunResult{Bindings: make(map[string]Value)}
+	for _, stmt := range prog.statements {
+		var err error
+		switch {
+		case stmt.assignment != nil:
+			if res.Value, err = ev.evalConditional(stmt.assignment.value); err == nil {
+				err = ev.Set(stmt.assignment.name, res.Value)
+				res.Bindings[stmt.assignment.name] = res.Value
+			}
+		case stmt.definition != nil:
+			err = ev.Define(stmt.definition)
+		default:
+			res.Value, err = ev.evalConditional(stmt.cond)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Load parses a program from the reader and runs it, so that a library of function definitions can be
+// shared between formulas
+func (ev *Evaluator) Load(r io.Reader) error {
+	prog, err := NewParser(r).ParseProgram()
+	if err != nil {
+		return err
+	}
+	_, err = ev.Run(prog)
+	return err
+}
+
+// call evaluates the arguments in the caller's scope, then calls the function with them
+func (ev *Evaluator) call(fn *FunctionValue, args []*Conditional) (Value, error) {
+	if len(args) != len(fn.params) {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", fn.displayName(), len(fn.params), len(args))
+	}
+
+	vals := make([]Value, len(args))
+	for i, arg := range args {
+		val, err := ev.evalConditional(arg)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return ev.apply(fn, vals)
+}
+
+// apply evaluates the body of the function with its parameters bound to the given values, in a scope whose
+// parent is the one the function closed over
+func (ev *Evaluator) apply(fn *FunctionValue, vals []Value) (Value, error) {
+	if len(vals) != len(fn.params) {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", fn.displayName(), len(fn.params), len(vals))
+	}
+	if ev.depth >= ev.MaxDepth {
+		return nil, fmt.Errorf("Maximum call depth of %d exceeded in %s", ev.MaxDepth, fn.displayName())
+	}
+
+	local := &scope{vars: make(map[string]Value, len(vals)), parent: fn.closure}
+	for i, val := range vals {
+		local.vars[fn.params[i]] = val
+	}
+
+	caller := ev.scope
+	ev.scope = local
+	ev.depth++
+	defer func() {
+		ev.scope = caller
+		ev.depth--
+	}()
+	return ev.evalConditional(fn.body)
+}
+
+// displayName returns the name of the function for use in error messages
+func (f *FunctionValue) displayName() string {
+	if f.name != "" {
+		return f.name
+	}
+	return "lambda"
+}
@@ -0,0 +1,146 @@
+package mathval
+
+import (
+	"math/big"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type FunctionsSuite struct{}
+
+var _ = Suite(&FunctionsSuite{})
+
+// run parses and runs the program with the given evaluator, returning the value of the result
+func run(ev *Evaluator, input string) (Value, error) {
+	prog, err := NewParser(strings.NewReader(input)).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	res, err := ev.Run(prog)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (f *FunctionsSuite) TestRun(c *C) {
+	expected := []EvalResult{
+		{input: "f(x, y) = x^2 + y; f(3, 4) * 2", expected: "26"},
+		{input: "one() = 1; one() + one()", expected: "2"},
+		{input: "sq(x) = x * x; quad(x) = sq(sq(x)); quad(3)", expected: "81"},
+		{input: "fact(n) = n <= 1 ? 1 : n * fact(n - 1); fact(20)", expected: "2432902008176640000"},
+		{input: "fib(n) = if(n < 2, n, fib(n - 1) + fib(n - 2)); fib(15)", expected: "610"},
+		{input: "area(r) = pi * r^2; area(2) > 12.5", expected: "true"},
+		{input: "1; 2; 3", expected: "3"},
+	}
+
+	for _, res := range expected {
+		val, err := run(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+
+	// Only definitions
+	val, err := run(NewEvaluator(), "f(x) = x")
+	c.Assert(err, IsNil)
+	c.Assert(val, IsNil)
+}
+
+func (f *FunctionsSuite) TestAssignment(c *C) {
+	expected := []EvalResult{
+		{input: "a = 1\nb = a + 1\nb * 2", expected: "4"},
+		{input: "a = 2; a = a^10", expected: "1024"},
+		{input: "r = 2\nsq(x) = x * x\n\narea = pi * sq(r)\narea > 12.5", expected: "true"},
+		{input: "x = 1 +\n  2\nx", expected: "3"},
+		{input: "x = (1\n + 2)\nx", expected: "3"},
+		{input: "n = 5\nn!\n", expected: "120"},
+	}
+	for _, res := range expected {
+		val, err := run(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+
+	ev := NewEvaluator()
+	prog, err := NewParser(strings.NewReader("a = 1; b = 2\na = a + b\nf(x) = x")).ParseProgram()
+	c.Assert(err, IsNil)
+	res, err := ev.Run(prog)
+	c.Assert(err, IsNil)
+	c.Assert(res.Value.String(), Equals, "3")
+	c.Assert(res.Bindings, HasLen, 2)
+	c.Assert(res.Bindings["a"].String(), Equals, "3")
+	c.Assert(res.Bindings["b"].String(), Equals, "2")
+
+	// Bindings persist in the evaluator
+	val, err := run(ev, "a * b")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "6")
+
+	_, err = run(NewEvaluator(), "pi = 3")
+	c.Assert(err, ErrorMatches, ".*pi.*")
+	_, err = run(NewEvaluator(), "a = 1; b = c")
+	c.Assert(err, ErrorMatches, "Unknown variable c")
+}
+
+func (f *FunctionsSuite) TestLexicalScope(c *C) {
+	ev := NewEvaluator()
+	ev.Set("x", NewNumberValue(big.NewRat(100, 1)))
+	ev.Set("y", NewNumberValue(big.NewRat(1, 1)))
+
+	// Parameters shadow variables, free variables refer to the global scope, and a function called from
+	// another can't see the caller's parameters
+	expected := []EvalResult{
+		{input: "f(x) = x + y; f(2)", expected: "3"},
+		{input: "g(y) = f(10); g(50)", expected: "11"},
+		{input: "x", expected: "100"},
+	}
+	for _, res := range expected {
+		val, err := run(ev, res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+
+	_, err := run(ev, "h(a) = k(); k() = a; h(1)")
+	c.Assert(err, ErrorMatches, "Unknown variable a")
+}
+
+func (f *FunctionsSuite) TestRecursionLimit(c *C) {
+	ev := NewEvaluator()
+	ev.MaxDepth = 50
+	_, err := run(ev, "down(n) = n == 0 ? 0 : down(n - 1); down(49)")
+	c.Assert(err, IsNil)
+	_, err = run(ev, "down(50)")
+	c.Assert(err, ErrorMatches, "Maximum call depth of 50 exceeded in down")
+
+	_, err = run(NewEvaluator(), "loop(n) = loop(n + 1); loop(0)")
+	c.Assert(err, NotNil)
+}
+
+func (f *FunctionsSuite) TestLoad(c *C) {
+	ev := NewEvaluator()
+	c.Assert(ev.Load(strings.NewReader("gross(net) = net * 1.2; net(gross) = gross / 1.2")), IsNil)
+
+	val, err := evaluate(ev, "net(gross(50))")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "50")
+
+	c.Assert(ev.Load(strings.NewReader("broken(")), NotNil)
+	c.Assert(ev.Load(strings.NewReader("sin(x) = x")), NotNil)
+}
+
+func (f *FunctionsSuite) TestDefineErrors(c *C) {
+	inputs := []string{
+		"sin(x) = x",
+		"if(a, b, c) = a",
+		"f(pi) = pi",
+		"f(x, x) = x",
+		"f(x) = x; f(1, 2)",
+		"f(x) = x; f()",
+	}
+
+	for _, input := range inputs {
+		_, err := run(NewEvaluator(), input)
+		c.Assert(err, NotNil, Commentf(input))
+	}
+}
@@ -1,6 +1,7 @@
 package mathval
 
 import (
+	"strings"
 	"unicode"
 )
 
@@ -20,3 +21,23 @@ func isLetter(ch rune) bool {
 func isDigit(ch rune) bool {
 	return unicode.IsDigit(ch)
 }
+
+// superscripts maps each superscript rune accepted as an exponent to its ASCII equivalent
+var superscripts = map[rune]rune{
+	'⁰': '0', '¹': '1', '²': '2', '³': '3', '⁴': '4', '⁵': '5', '⁶': '6', '⁷': '7', '⁸': '8', '⁹': '9', '⁻': '-',
+}
+
+// superscriptDigits holds the superscript form of each decimal digit
+var superscriptDigits = []rune("⁰¹²³⁴⁵⁶⁷⁸⁹")
+
+// isSuperscript returns true if the rune is a superscript digit or minus
+func isSuperscript(ch rune) bool {
+	_, ok := superscripts[ch]
+	return ok
+}
+
+// isIdentifier returns true if the string would be scanned as a single identifier, rather than a keyword
+func isIdentifier(s string) bool {
+	tok, lit := NewScanner(strings.NewReader(s)).Scan()
+	return tok == UNKNOWN_KEYWORD && lit == s
+}
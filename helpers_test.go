@@ -31,3 +31,12 @@ func (t *HelpersSuite) TestIsDigit(c *C) {
 		c.Assert(isDigit(rune(ch)), Equals, true)
 	}
 }
+
+func (t *HelpersSuite) TestIsIdentifier(c *C) {
+	for _, s := range []string{"x", "pi", "rate", "x1", "tax_rate"} {
+		c.Assert(isIdentifier(s), Equals, true, Commentf(s))
+	}
+	for _, s := range []string{"", "and", "not", "x y", "1x", "_x", "1"} {
+		c.Assert(isIdentifier(s), Equals, false, Commentf(s))
+	}
+}
@@ -0,0 +1,157 @@
+package mathval
+
+import (
+	"fmt"
+)
+
+// toList returns the ListValue held by the given value, or an error if it is not a list. A matrix is the list
+// of its rows, so the list builtins work on nested list literals, which evaluate to matrices
+func toList(val Value) (*ListValue, error) {
+	switch val := val.(type) {
+	case *ListValue:
+		return val, nil
+	case *MatrixValue:
+		return val.list(), nil
+	}
+	return nil, fmt.Errorf("Expected list, got %s", val)
+}
+
+// toFunction returns the FunctionValue held by the given value, or an error if it is not a function
+func toFunction(val Value) (*FunctionValue, error) {
+	if f, ok := val.(*FunctionValue); ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("Expected function, got %s", val)
+}
+
+// listAndFunction evaluates the list and function arguments shared by all higher-order builtins
+func (ev *Evaluator) listAndFunction(name string, args []*Conditional, arities ...int) (*ListValue, *FunctionValue, error) {
+	valid := false
+	for _, arity := range arities {
+		valid = valid || len(args) == arity
+	}
+	if !valid {
+		return nil, nil, fmt.Errorf("%s expects %d arguments, got %d", name, arities[0], len(args))
+	}
+
+	val, err := ev.evalConditional(args[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	list, err := toList(val)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", name, err)
+	}
+	if val, err = ev.evalConditional(args[1]); err != nil {
+		return nil, nil, err
+	}
+	fn, err := toFunction(val)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return list, fn, nil
+}
+
+// builtinMap implements map(list, f), returning the list of f applied to each element
+func builtinMap(ev *Evaluator, args []*Conditional) (Value, error) {
+	list, fn, err := ev.listAndFunction("map", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Value, len(list.elems))
+	for i, elem := range list.elems {
+		if res[i], err = ev.apply(fn, []Value{elem}); err != nil {
+			return nil, err
+		}
+	}
+	return &ListValue{elems: res}, nil
+}
+
+// builtinFilter implements filter(list, f), returning the elements for which f is true
+func builtinFilter(ev *Evaluator, args []*Conditional) (Value, error) {
+	list, fn, err := ev.listAndFunction("filter", args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Value{}
+	for _, elem := range list.elems {
+		keep, err := ev.predicate(fn, elem)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			res = append(res, elem)
+		}
+	}
+	return &ListValue{elems: res}, nil
+}
+
+// builtinReduce implements reduce(list, f, initial), folding f over the list from the left. Without an
+// initial value the first element is used, so the list must not be empty
+func builtinReduce(ev *Evaluator, args []*Conditional) (Value, error) {
+	list, fn, err := ev.listAndFunction("reduce", args, 3, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	elems := list.elems
+	var acc Value
+	if len(args) == 3 {
+		if acc, err = ev.evalConditional(args[2]); err != nil {
+			return nil, err
+		}
+	} else if len(elems) == 0 {
+		return nil, fmt.Errorf("reduce: Empty list with no initial value")
+	} else {
+		acc, elems = elems[0], elems[1:]
+	}
+
+	for _, elem := range elems {
+		if acc, err = ev.apply(fn, []Value{acc, elem}); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// builtinAny implements any(list, f), returning whether f is true for any element. Elements after the first
+// for which f is true are not tested
+func builtinAny(ev *Evaluator, args []*Conditional) (Value, error) {
+	return ev.quantify("any", args, true)
+}
+
+// builtinAll implements all(list, f), returning whether f is true for every element. Elements after the first
+// for which f is false are not tested
+func builtinAll(ev *Evaluator, args []*Conditional) (Value, error) {
+	return ev.quantify("all", args, false)
+}
+
+// quantify returns want if f gives want for any element of the list, otherwise !want
+func (ev *Evaluator) quantify(name string, args []*Conditional, want bool) (Value, error) {
+	list, fn, err := ev.listAndFunction(name, args, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, elem := range list.elems {
+		b, err := ev.predicate(fn, elem)
+		if err != nil {
+			return nil, err
+		}
+		if b == want {
+			return NewBoolValue(want), nil
+		}
+	}
+	return NewBoolValue(!want), nil
+}
+
+// predicate applies f to the value, which must give a boolean
+func (ev *Evaluator) predicate(fn *FunctionValue, val Value) (bool, error) {
+	res, err := ev.apply(fn, []Value{val})
+	if err != nil {
+		return false, err
+	}
+	return toBool(res)
+}
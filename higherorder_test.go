@@ -0,0 +1,97 @@
+package mathval
+
+import (
+	"math/big"
+	"regexp"
+
+	. "gopkg.in/check.v1"
+)
+
+type HigherOrderSuite struct{}
+
+var _ = Suite(&HigherOrderSuite{})
+
+// numbers returns a ListValue holding the given integers
+func numbers(ns ...int64) *ListValue {
+	vals := make([]Value, len(ns))
+	for i, n := range ns {
+		vals[i] = NewNumberValue(big.NewRat(n, 1))
+	}
+	return NewListValue(vals...)
+}
+
+func (h *HigherOrderSuite) TestHigherOrder(c *C) {
+	ev := NewEvaluator()
+	c.Assert(ev.Set("xs", numbers(1, 2, 3, 4)), IsNil)
+	c.Assert(ev.Set("empty", NewListValue()), IsNil)
+
+	expected := []EvalResult{
+		{input: "map(xs, x -> x * 1.2)", expected: "[6/5, 12/5, 18/5, 24/5]"},
+		{input: "map(empty, x -> x)", expected: "[]"},
+		{input: "filter(xs, x -> x % 2 == 0)", expected: "[2, 4]"},
+		{input: "reduce(xs, (a, b) -> a + b, 0)", expected: "10"},
+		{input: "reduce(xs, (a, b) -> a * b)", expected: "24"},
+		{input: "reduce(empty, (a, b) -> a + b, 7)", expected: "7"},
+		{input: "any(xs, x -> x > 3)", expected: "true"},
+		{input: "any(empty, x -> x > 3)", expected: "false"},
+		{input: "all(xs, x -> x > 0)", expected: "true"},
+		{input: "all(xs, x -> x > 1)", expected: "false"},
+		{input: "all(empty, x -> x < 0)", expected: "true"},
+		{input: "sq(x) = x * x; map(xs, sq)", expected: "[1, 4, 9, 16]"},
+		{input: "double = x -> 2 * x; double(21)", expected: "42"},
+		{input: "five = () -> 5; five() + 1", expected: "6"},
+		{input: "twice(f, x) = f(f(x)); twice(y -> y^2, 3)", expected: "81"},
+		{input: "x -> x * 1.2", expected: "x -> x * 1.2"},
+		{input: "sq", expected: "sq"},
+	}
+	for _, res := range expected {
+		val, err := run(ev, res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (h *HigherOrderSuite) TestClosures(c *C) {
+	ev := NewEvaluator()
+	c.Assert(ev.Set("xs", numbers(1, 2, 3)), IsNil)
+
+	expected := []EvalResult{
+		// Lambdas capture the parameters of the enclosing function
+		{input: "scale(k) = map(xs, x -> x * k); scale(10)", expected: "[10, 20, 30]"},
+		{input: "adder(n) = x -> x + n; add5 = adder(5); add5(1)", expected: "6"},
+		{input: "compose(f, g) = x -> f(g(x)); inc = compose(x -> x + 1, x -> x * 2); inc(10)", expected: "21"},
+		// Parameters shadow variables and functions of the same name
+		{input: "k = 100; scale(2)", expected: "[2, 4, 6]"},
+		{input: "apply(sq, x) = sq(x); sq(x) = x * x; apply(x -> -x, 3)", expected: "-3"},
+	}
+	for _, res := range expected {
+		val, err := run(ev, res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (h *HigherOrderSuite) TestHigherOrderErrors(c *C) {
+	ev := NewEvaluator()
+	c.Assert(ev.Set("xs", numbers(1, 2, 3)), IsNil)
+	c.Assert(ev.Set("empty", NewListValue()), IsNil)
+
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "map(xs)", err: "map expects 2 arguments, got 1"},
+		{input: "map(1, x -> x)", err: "map: Expected list, got 1"},
+		{input: "map(xs, 1)", err: "map: Expected function, got 1"},
+		{input: "map(xs, (a, b) -> a)", err: "lambda expects 2 arguments, got 1"},
+		{input: "filter(xs, x -> x)", err: "Expected boolean, got 1"},
+		{input: "reduce(empty, (a, b) -> a)", err: "reduce: Empty list with no initial value"},
+		{input: "map(xs, (x, x) -> x)", err: "Duplicate parameter x in definition of lambda"},
+		{input: "map(xs, pi -> pi)", err: "Parameter pi of lambda shadows a constant"},
+		{input: "f = 1; f(2)", err: "Unknown function f"},
+	}
+	for _, res := range expected {
+		_, err := run(ev, res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+}
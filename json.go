@@ -0,0 +1,895 @@
+package mathval
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// The methods below encode the AST as JSON and decode it again without losing anything, so that the decoded
+// AST prints, evaluates and encodes exactly as the original. Every node of the grammar is an object holding its
+// children by the names of its fields, so parentheses, chains of operators, comments and the source text of
+// numbers and dates are all kept. Exact values are strings, with rationals as "num/den", and the offsets of
+// operators and calls in the source are only written if asked for, as in Program.JSON. A Program is a versioned
+// document, see JSONVersion, and it and a Conditional implement json.Marshaler and json.Unmarshaler, writing
+// positions.
+//
+// Decoding checks that the document is a well formed AST, such as a Term having exactly one operand or an
+// operator having a right operand, but not that it parses: a Unit is read as it was written rather than
+// looked up in a UnitRegistry
+
+// JSONVersion is the version of the JSON schema written for a Program. It is increased whenever the schema
+// changes incompatibly, and documents of any other version are rejected
+const JSONVersion = 1
+
+// jsonOperatorNames holds the name in JSON of each operator which isn't its source representation
+var jsonOperatorNames = map[Token]string{IMPLICIT_MULTIPLY: "implicit"}
+
+// jsonOperatorName returns the name in JSON of the operator
+func jsonOperatorName(tok Token) string {
+	if s, ok := jsonOperatorNames[tok]; ok {
+		return s
+	}
+	return tok.String()
+}
+
+// operatorJSON is an operator of any kind in JSON, with its offset if positions are written
+type operatorJSON struct {
+	Op  string `json:"op"`
+	Pos *int   `json:"pos,omitempty"`
+}
+
+// jsonPosition returns the offset to write, or nil if positions aren't written
+func jsonPosition(pos int, positions bool) *int {
+	if !positions {
+		return nil
+	}
+	return &pos
+}
+
+// operatorToJSON returns the operator in JSON
+func operatorToJSON(op Operator, positions bool) *operatorJSON {
+	return &operatorJSON{Op: jsonOperatorName(op.op), Pos: jsonPosition(op.pos, positions)}
+}
+
+// operator returns the operator, which must be one of the allowed tokens
+func (op *operatorJSON) operator(allowed ...Token) (Operator, error) {
+	res := Operator{}
+	if op.Pos != nil {
+		res.pos = *op.Pos
+	}
+	for _, tok := range allowed {
+		if jsonOperatorName(tok) == op.Op {
+			res.op = tok
+			return res, nil
+		}
+	}
+	return res, fmt.Errorf("Invalid operator %q", op.Op)
+}
+
+// missing returns the error for a required field absent from a node
+func missing(field, node string) error {
+	return fmt.Errorf("Missing %s in %s", field, node)
+}
+
+// ratToJSON returns the rational as "num/den"
+func ratToJSON(r *big.Rat) string {
+	return r.String()
+}
+
+// ratFromJSON parses a rational written as "num/den"
+func ratFromJSON(s string) (*big.Rat, error) {
+	num, den, ok := strings.Cut(s, "/")
+	if ok && isInteger(strings.TrimPrefix(num, "-")) && isInteger(den) {
+		if r, ok := new(big.Rat).SetString(s); ok {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid rational %q, expected num/den", s)
+}
+
+// isInteger returns whether s is a non-empty run of ASCII digits
+func isInteger(s string) bool {
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// programJSON is a Program as a document, with its version and the comments outside statements
+type programJSON struct {
+	Version    int              `json:"version"`
+	Statements []*statementJSON `json:"statements"`
+	Comments   []string         `json:"comments,omitempty"`
+}
+
+// JSON returns the Program as a JSON document of the current JSONVersion, with the offsets of operators and
+// calls if positions is set
+func (prog *Program) JSON(positions bool) ([]byte, error) {
+	return json.Marshal(prog.json(positions))
+}
+
+// MarshalJSON returns the Program as a JSON document with positions, see JSON
+func (prog *Program) MarshalJSON() ([]byte, error) {
+	return prog.JSON(true)
+}
+
+// UnmarshalJSON reads a Program from a JSON document of the current JSONVersion
+func (prog *Program) UnmarshalJSON(data []byte) error {
+	var v programJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	res, err := v.node()
+	if err != nil {
+		return err
+	}
+	*prog = *res
+	return nil
+}
+
+// json returns the Program stamped with the current JSONVersion
+func (prog *Program) json(positions bool) *programJSON {
+	v := &programJSON{Version: JSONVersion, Statements: []*statementJSON{}, Comments: prog.comments}
+	for _, stmt := range prog.statements {
+		v.Statements = append(v.Statements, stmt.json(positions))
+	}
+	return v
+}
+
+// node returns the Program, rejecting a document of any other version
+func (v *programJSON) node() (*Program, error) {
+	if v.Version != JSONVersion {
+		return nil, fmt.Errorf("Unsupported JSON schema version %d, expected %d", v.Version, JSONVersion)
+	}
+	prog := &Program{comments: v.Comments}
+	for _, s := range v.Statements {
+		if s == nil {
+			return nil, missing("statement", "program")
+		}
+		stmt, err := s.node()
+		if err != nil {
+			return nil, err
+		}
+		prog.statements = append(prog.statements, stmt)
+	}
+	return prog, nil
+}
+
+// statementJSON holds one of an assignment, a definition and a conditional, and the comments around it
+type statementJSON struct {
+	Assignment *assignmentJSON  `json:"assignment,omitempty"`
+	Definition *definitionJSON  `json:"definition,omitempty"`
+	Cond       *conditionalJSON `json:"conditional,omitempty"`
+	Comments   []string         `json:"comments,omitempty"`
+}
+
+// assignmentJSON is a name and the value assigned to it
+type assignmentJSON struct {
+	Name  string           `json:"name"`
+	Value *conditionalJSON `json:"value"`
+}
+
+// definitionJSON is a user-defined function by its name, parameters and body
+type definitionJSON struct {
+	Name   string           `json:"name"`
+	Params []string         `json:"params"`
+	Body   *conditionalJSON `json:"body"`
+}
+
+// json returns whichever of the assignment, definition or conditional the Statement is
+func (stmt *Statement) json(positions bool) *statementJSON {
+	v := &statementJSON{Comments: stmt.comments}
+	switch {
+	case stmt.assignment != nil:
+		v.Assignment = &assignmentJSON{Name: stmt.assignment.name, Value: stmt.assignment.value.json(positions)}
+	case stmt.definition != nil:
+		def := stmt.definition
+		v.Definition = &definitionJSON{Name: def.name, Params: append([]string{}, def.params...), Body: def.body.json(positions)}
+	default:
+		v.Cond = stmt.cond.json(positions)
+	}
+	return v
+}
+
+// node returns the Statement, which must be exactly one of an assignment, definition and conditional
+func (v *statementJSON) node() (stmt *Statement, err error) {
+	if n := countSet(v.Assignment != nil, v.Definition != nil, v.Cond != nil); n != 1 {
+		return nil, fmt.Errorf("Statement must have exactly one of assignment, definition and conditional, got %d", n)
+	}
+	stmt = &Statement{comments: v.Comments}
+	switch {
+	case v.Assignment != nil:
+		if !isIdentifier(v.Assignment.Name) || v.Assignment.Value == nil {
+			return nil, missing("name or value", "assignment")
+		}
+		stmt.assignment = &Assignment{name: v.Assignment.Name}
+		stmt.assignment.value, err = v.Assignment.Value.node()
+	case v.Definition != nil:
+		if !isIdentifier(v.Definition.Name) || v.Definition.Body == nil || !identifiers(v.Definition.Params) {
+			return nil, missing("name, parameters or body", "definition")
+		}
+		stmt.definition = &Definition{name: v.Definition.Name, params: v.Definition.Params}
+		stmt.definition.body, err = v.Definition.Body.node()
+	default:
+		stmt.cond, err = v.Cond.node()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// conditionalJSON is a Conditional with the branches of a ternary and the unit or currency it's converted to
+type conditionalJSON struct {
+	Disjunction *disjunctionJSON `json:"disjunction"`
+	Then        *conditionalJSON `json:"then,omitempty"`
+	Else        *conditionalJSON `json:"else,omitempty"`
+	To          *unitJSON        `json:"to,omitempty"`
+	Currency    string           `json:"currency,omitempty"`
+}
+
+// MarshalJSON returns the Conditional as JSON with positions. Unlike a Program, it isn't versioned
+func (cond *Conditional) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cond.json(true))
+}
+
+// UnmarshalJSON reads a Conditional from JSON
+func (cond *Conditional) UnmarshalJSON(data []byte) error {
+	var v conditionalJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	res, err := v.node()
+	if err != nil {
+		return err
+	}
+	*cond = *res
+	return nil
+}
+
+// json returns the Conditional with both branches if it is a ternary
+func (cond *Conditional) json(positions bool) *conditionalJSON {
+	v := &conditionalJSON{Disjunction: cond.disjunction.json(positions), Currency: cond.currency}
+	if cond.then != nil {
+		v.Then, v.Else = cond.then.json(positions), cond.els.json(positions)
+	}
+	if cond.to != nil {
+		v.To = cond.to.json()
+	}
+	return v
+}
+
+// node returns the Conditional, which has both branches of a ternary or neither
+func (v *conditionalJSON) node() (cond *Conditional, err error) {
+	if v.Disjunction == nil {
+		return nil, missing("disjunction", "conditional")
+	} else if (v.Then == nil) != (v.Else == nil) {
+		return nil, missing("then or else", "conditional")
+	} else if v.To != nil && v.Currency != "" {
+		return nil, fmt.Errorf("Conditional can't be converted to both a unit and a currency")
+	}
+	cond = &Conditional{currency: v.Currency}
+	if cond.disjunction, err = v.Disjunction.node(); err != nil {
+		return nil, err
+	}
+	if v.Then != nil {
+		if cond.then, err = v.Then.node(); err != nil {
+			return nil, err
+		}
+		if cond.els, err = v.Else.node(); err != nil {
+			return nil, err
+		}
+	}
+	if v.To != nil {
+		if cond.to, err = v.To.node(); err != nil {
+			return nil, err
+		}
+	}
+	return cond, nil
+}
+
+// disjunctionJSON is a chain of 'or', nested to the right as in Disjunction
+type disjunctionJSON struct {
+	Conjunction *conjunctionJSON `json:"conjunction"`
+	Op          *operatorJSON    `json:"op,omitempty"`
+	Disjunction *disjunctionJSON `json:"disjunction,omitempty"`
+}
+
+// json returns the Disjunction with the rest of the chain after its operator
+func (dis *Disjunction) json(positions bool) *disjunctionJSON {
+	v := &disjunctionJSON{Conjunction: dis.conjunction.json(positions)}
+	if dis.op != nil {
+		v.Op, v.Disjunction = operatorToJSON(Operator(*dis.op), positions), dis.disjunction.json(positions)
+	}
+	return v
+}
+
+// node returns the Disjunction, whose operator must be 'or' and have a right operand
+func (v *disjunctionJSON) node() (dis *Disjunction, err error) {
+	if v.Conjunction == nil || (v.Op == nil) != (v.Disjunction == nil) {
+		return nil, missing("conjunction or operand", "disjunction")
+	}
+	dis = &Disjunction{}
+	if dis.conjunction, err = v.Conjunction.node(); err != nil || v.Op == nil {
+		return dis, err
+	}
+	op, err := v.Op.operator(OR)
+	if err != nil {
+		return nil, err
+	}
+	dis.op = (*OrOp)(&op)
+	if dis.disjunction, err = v.Disjunction.node(); err != nil {
+		return nil, err
+	}
+	return dis, nil
+}
+
+// conjunctionJSON is a chain of 'and'
+type conjunctionJSON struct {
+	Comparison  *comparisonJSON  `json:"comparison"`
+	Op          *operatorJSON    `json:"op,omitempty"`
+	Conjunction *conjunctionJSON `json:"conjunction,omitempty"`
+}
+
+// json returns the Conjunction and the chain of 'and' that follows it
+func (con *Conjunction) json(positions bool) *conjunctionJSON {
+	v := &conjunctionJSON{Comparison: con.comparison.json(positions)}
+	if con.op != nil {
+		v.Op, v.Conjunction = operatorToJSON(Operator(*con.op), positions), con.conjunction.json(positions)
+	}
+	return v
+}
+
+// node returns the Conjunction, whose operator must be 'and'
+func (v *conjunctionJSON) node() (con *Conjunction, err error) {
+	if v.Comparison == nil || (v.Op == nil) != (v.Conjunction == nil) {
+		return nil, missing("comparison or operand", "conjunction")
+	}
+	con = &Conjunction{}
+	if con.comparison, err = v.Comparison.node(); err != nil || v.Op == nil {
+		return con, err
+	}
+	op, err := v.Op.operator(AND)
+	if err != nil {
+		return nil, err
+	}
+	con.op = (*AndOp)(&op)
+	if con.conjunction, err = v.Conjunction.node(); err != nil {
+		return nil, err
+	}
+	return con, nil
+}
+
+// comparisonJSON is a comparison of two expressions, or a single one, negated by each 'not'
+type comparisonJSON struct {
+	Not        []*operatorJSON `json:"not,omitempty"`
+	Expression *expressionJSON `json:"expression"`
+	Op         *operatorJSON   `json:"op,omitempty"`
+	Right      *expressionJSON `json:"right,omitempty"`
+}
+
+// json returns the Comparison with each of its leading 'not' operators
+func (cmp *Comparison) json(positions bool) *comparisonJSON {
+	v := &comparisonJSON{Expression: cmp.expression.json(positions)}
+	for _, not := range cmp.not {
+		v.Not = append(v.Not, operatorToJSON(Operator(*not), positions))
+	}
+	if cmp.op != nil {
+		v.Op, v.Right = operatorToJSON(Operator(*cmp.op), positions), cmp.right.json(positions)
+	}
+	return v
+}
+
+// node returns the Comparison, whose operators must be 'not' and a comparison
+func (v *comparisonJSON) node() (cmp *Comparison, err error) {
+	if v.Expression == nil || (v.Op == nil) != (v.Right == nil) {
+		return nil, missing("expression or operand", "comparison")
+	}
+	cmp = &Comparison{}
+	for _, n := range v.Not {
+		if n == nil {
+			return nil, missing("operator", "comparison")
+		}
+		op, err := n.operator(NOT)
+		if err != nil {
+			return nil, err
+		}
+		cmp.not = append(cmp.not, (*NotOp)(&op))
+	}
+	if cmp.expression, err = v.Expression.node(); err != nil || v.Op == nil {
+		return cmp, err
+	}
+	op, err := v.Op.operator(EQ, NEQ, LT, LTE, GT, GTE)
+	if err != nil {
+		return nil, err
+	}
+	cmp.op = (*CompareOp)(&op)
+	if cmp.right, err = v.Right.node(); err != nil {
+		return nil, err
+	}
+	return cmp, nil
+}
+
+// expressionJSON is a chain of '+' and '-'
+type expressionJSON struct {
+	Factor     *factorJSON     `json:"factor"`
+	Op         *operatorJSON   `json:"op,omitempty"`
+	Expression *expressionJSON `json:"expression,omitempty"`
+}
+
+// json returns the Expression and the terms added or subtracted after it
+func (exp *Expression) json(positions bool) *expressionJSON {
+	v := &expressionJSON{Factor: exp.factor.json(positions)}
+	if exp.op != nil {
+		v.Op, v.Expression = operatorToJSON(Operator(*exp.op), positions), exp.expression.json(positions)
+	}
+	return v
+}
+
+// node returns the Expression, whose operator must be '+' or '-'
+func (v *expressionJSON) node() (exp *Expression, err error) {
+	if v.Factor == nil || (v.Op == nil) != (v.Expression == nil) {
+		return nil, missing("factor or operand", "expression")
+	}
+	exp = &Expression{}
+	if exp.factor, err = v.Factor.node(); err != nil || v.Op == nil {
+		return exp, err
+	}
+	op, err := v.Op.operator(PLUS, MINUS)
+	if err != nil {
+		return nil, err
+	}
+	exp.op = (*AddOp)(&op)
+	if exp.expression, err = v.Expression.node(); err != nil {
+		return nil, err
+	}
+	return exp, nil
+}
+
+// factorJSON is a chain of multiplicative operators, with implicit multiplication named "implicit"
+type factorJSON struct {
+	Power  *powerJSON    `json:"power"`
+	Op     *operatorJSON `json:"op,omitempty"`
+	Factor *factorJSON   `json:"factor,omitempty"`
+}
+
+// json returns the Factor and the factors multiplied or divided after it
+func (factor *Factor) json(positions bool) *factorJSON {
+	v := &factorJSON{Power: factor.power.json(positions)}
+	if factor.op != nil {
+		v.Op, v.Factor = operatorToJSON(Operator(*factor.op), positions), factor.factor.json(positions)
+	}
+	return v
+}
+
+// node returns the Factor, whose operator must be multiplicative
+func (v *factorJSON) node() (factor *Factor, err error) {
+	if v.Power == nil || (v.Op == nil) != (v.Factor == nil) {
+		return nil, missing("power or operand", "factor")
+	}
+	factor = &Factor{}
+	if factor.power, err = v.Power.node(); err != nil || v.Op == nil {
+		return factor, err
+	}
+	op, err := v.Op.operator(MULTIPLY, DIVIDE, INT_DIVIDE, MODULO, IMPLICIT_MULTIPLY)
+	if err != nil {
+		return nil, err
+	}
+	factor.op = (*MultiplyOp)(&op)
+	if factor.factor, err = v.Factor.node(); err != nil {
+		return nil, err
+	}
+	return factor, nil
+}
+
+// powerJSON is a signed Term and the exponent it is raised to, if any
+type powerJSON struct {
+	Unary []*operatorJSON `json:"unary,omitempty"`
+	Term  *termJSON       `json:"term"`
+	Op    *operatorJSON   `json:"op,omitempty"`
+	Power *powerJSON      `json:"power,omitempty"`
+}
+
+// json returns the Power with its signs and exponent
+func (pow *Power) json(positions bool) *powerJSON {
+	v := &powerJSON{Term: pow.term.json(positions)}
+	for _, op := range pow.unary {
+		v.Unary = append(v.Unary, operatorToJSON(Operator(*op), positions))
+	}
+	if pow.op != nil {
+		v.Op, v.Power = operatorToJSON(Operator(*pow.op), positions), pow.power.json(positions)
+	}
+	return v
+}
+
+// node returns the Power, whose signs must be '+' or '-' and operator '^'
+func (v *powerJSON) node() (pow *Power, err error) {
+	if v.Term == nil || (v.Op == nil) != (v.Power == nil) {
+		return nil, missing("term or operand", "power")
+	}
+	pow = &Power{}
+	for _, u := range v.Unary {
+		if u == nil {
+			return nil, missing("operator", "power")
+		}
+		op, err := u.operator(PLUS, MINUS)
+		if err != nil {
+			return nil, err
+		}
+		pow.unary = append(pow.unary, (*UnaryOp)(&op))
+	}
+	if pow.term, err = v.Term.node(); err != nil || v.Op == nil {
+		return pow, err
+	}
+	op, err := v.Op.operator(POW)
+	if err != nil {
+		return nil, err
+	}
+	pow.op = (*ExponentOp)(&op)
+	if pow.power, err = v.Power.node(); err != nil {
+		return nil, err
+	}
+	return pow, nil
+}
+
+// termJSON is a Term with exactly one of its operand fields set
+type termJSON struct {
+	Exp       *conditionalJSON `json:"exp,omitempty"`
+	Group     bool             `json:"group,omitempty"`
+	Number    *numberJSON      `json:"number,omitempty"`
+	Unit      *unitJSON        `json:"unit,omitempty"`
+	Currency  string           `json:"currency,omitempty"`
+	Ident     string           `json:"identifier,omitempty"`
+	Call      *callJSON        `json:"call,omitempty"`
+	Lambda    *lambdaJSON      `json:"lambda,omitempty"`
+	List      *listJSON        `json:"list,omitempty"`
+	Piecewise *piecewiseJSON   `json:"piecewise,omitempty"`
+	Date      *dateJSON        `json:"date,omitempty"`
+	Duration  *durationJSON    `json:"duration,omitempty"`
+	Cells     *rangeJSON       `json:"range,omitempty"`
+	Text      *textJSON        `json:"string,omitempty"`
+	Index     []*indexJSON     `json:"index,omitempty"`
+	Postfix   []*operatorJSON  `json:"postfix,omitempty"`
+	Leading   []string         `json:"leading,omitempty"`
+	Trailing  []string         `json:"trailing,omitempty"`
+}
+
+// listJSON holds the elements of a ListLiteral, which are never null even if there are none
+type listJSON struct {
+	Elems []*conditionalJSON `json:"elems"`
+}
+
+// numberJSON is a number as written and its exact value
+type numberJSON struct {
+	Str string `json:"str"`
+	Val string `json:"val"`
+}
+
+// callJSON is a call by name, with the offset of the name if positions are written
+type callJSON struct {
+	Name string             `json:"name"`
+	Args []*conditionalJSON `json:"args"`
+	Pos  *int               `json:"pos,omitempty"`
+}
+
+// lambdaJSON is the parameters and body of a Lambda
+type lambdaJSON struct {
+	Params []string         `json:"params"`
+	Body   *conditionalJSON `json:"body"`
+}
+
+// piecewiseJSON is the cases of a Piecewise in order and its optional else
+type piecewiseJSON struct {
+	Cases []*caseJSON      `json:"cases"`
+	Else  *conditionalJSON `json:"else,omitempty"`
+}
+
+// caseJSON is a condition and the value when it is the first to hold
+type caseJSON struct {
+	Cond  *conditionalJSON `json:"cond"`
+	Value *conditionalJSON `json:"value"`
+}
+
+// dateJSON is a date as written and the instant it parsed to
+type dateJSON struct {
+	Str string `json:"str"`
+	Val string `json:"val"` // in RFC 3339 with nanoseconds
+}
+
+// durationJSON is a duration as written and its length
+type durationJSON struct {
+	Str string `json:"str"`
+	Val int64  `json:"val"` // in nanoseconds
+}
+
+// rangeJSON is the first and last cell of a Range
+type rangeJSON struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// textJSON is a string as quoted in the source and its unescaped value
+type textJSON struct {
+	Str string `json:"str"`
+	Val string `json:"val"`
+}
+
+// indexJSON is an index, or a slice with either bound optional
+type indexJSON struct {
+	From  *conditionalJSON `json:"from,omitempty"`
+	To    *conditionalJSON `json:"to,omitempty"`
+	Slice bool             `json:"slice,omitempty"`
+}
+
+// json returns the Term with its one operand, indexes, postfix operators and comments
+func (term *Term) json(positions bool) *termJSON {
+	v := &termJSON{Group: term.group, Currency: term.currency, Leading: term.leading, Trailing: term.trailing}
+	switch {
+	case term.exp != nil:
+		v.Exp = term.exp.json(positions)
+	case term.number != nil:
+		v.Number = &numberJSON{Str: term.number.str, Val: ratToJSON(term.number.val)}
+	case term.ident != nil:
+		v.Ident = term.ident.name
+	case term.call != nil:
+		v.Call = &callJSON{Name: term.call.name, Args: []*conditionalJSON{}, Pos: jsonPosition(term.call.pos, positions)}
+		for _, arg := range term.call.args {
+			v.Call.Args = append(v.Call.Args, arg.json(positions))
+		}
+	case term.lambda != nil:
+		v.Lambda = &lambdaJSON{Params: append([]string{}, term.lambda.params...), Body: term.lambda.body.json(positions)}
+	case term.list != nil:
+		v.List = &listJSON{Elems: []*conditionalJSON{}}
+		for _, elem := range term.list.elems {
+			v.List.Elems = append(v.List.Elems, elem.json(positions))
+		}
+	case term.piecewise != nil:
+		v.Piecewise = &piecewiseJSON{Cases: []*caseJSON{}}
+		for _, c := range term.piecewise.cases {
+			v.Piecewise.Cases = append(v.Piecewise.Cases, &caseJSON{Cond: c.cond.json(positions), Value: c.value.json(positions)})
+		}
+		if term.piecewise.els != nil {
+			v.Piecewise.Else = term.piecewise.els.json(positions)
+		}
+	case term.date != nil:
+		v.Date = &dateJSON{Str: term.date.str, Val: term.date.val.Format(time.RFC3339Nano)}
+	case term.duration != nil:
+		v.Duration = &durationJSON{Str: term.duration.str, Val: int64(term.duration.val)}
+	case term.cells != nil:
+		v.Cells = &rangeJSON{From: term.cells.from, To: term.cells.to}
+	case term.text != nil:
+		v.Text = &textJSON{Str: term.text.str, Val: term.text.val}
+	}
+	if term.unit != nil {
+		v.Unit = term.unit.json()
+	}
+	for _, index := range term.index {
+		i := &indexJSON{Slice: index.slice}
+		if index.from != nil {
+			i.From = index.from.json(positions)
+		}
+		if index.to != nil {
+			i.To = index.to.json(positions)
+		}
+		v.Index = append(v.Index, i)
+	}
+	for _, post := range term.postfix {
+		v.Postfix = append(v.Postfix, operatorToJSON(Operator(*post), positions))
+	}
+	return v
+}
+
+// operands returns the number of operands the Term has, of which there must be exactly one
+func (v *termJSON) operands() int {
+	return countSet(v.Exp != nil, v.Number != nil, v.Ident != "", v.Call != nil, v.Lambda != nil, v.List != nil,
+		v.Piecewise != nil, v.Date != nil, v.Duration != nil, v.Cells != nil, v.Text != nil)
+}
+
+// countSet returns how many of the fields are set
+func countSet(set ...bool) int {
+	n := 0
+	for _, s := range set {
+		if s {
+			n++
+		}
+	}
+	return n
+}
+
+// identifiers returns whether each name is an identifier
+func identifiers(names []string) bool {
+	for _, name := range names {
+		if !isIdentifier(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// node returns the Term, which must have exactly one operand, and a unit or currency only on a number
+func (v *termJSON) node() (term *Term, err error) {
+	if v.operands() != 1 {
+		return nil, fmt.Errorf("Term must have exactly one operand, got %d", v.operands())
+	} else if (v.Unit != nil || v.Currency != "") && v.Number == nil {
+		return nil, fmt.Errorf("Term with a unit or currency must be a number")
+	} else if v.Unit != nil && v.Currency != "" {
+		return nil, fmt.Errorf("Term can't have both a unit and a currency")
+	} else if v.Group && v.Exp == nil {
+		return nil, fmt.Errorf("Grouped term must be an exp")
+	}
+
+	term = &Term{group: v.Group, currency: v.Currency, leading: v.Leading, trailing: v.Trailing}
+	switch {
+	case v.Exp != nil:
+		term.exp, err = v.Exp.node()
+	case v.Number != nil:
+		term.number = &Number{str: v.Number.Str}
+		term.number.val, err = ratFromJSON(v.Number.Val)
+	case v.Ident != "":
+		if !isIdentifier(v.Ident) {
+			return nil, fmt.Errorf("Invalid identifier %q", v.Ident)
+		}
+		term.ident = &Identifier{name: v.Ident}
+	case v.Call != nil:
+		term.call, err = v.Call.node()
+	case v.Lambda != nil:
+		if v.Lambda.Body == nil || !identifiers(v.Lambda.Params) {
+			return nil, missing("parameters or body", "lambda")
+		}
+		term.lambda = &Lambda{params: v.Lambda.Params}
+		term.lambda.body, err = v.Lambda.Body.node()
+	case v.List != nil:
+		term.list = &ListLiteral{}
+		term.list.elems, err = conditionalsFromJSON(v.List.Elems, "list")
+	case v.Piecewise != nil:
+		term.piecewise, err = v.Piecewise.node()
+	case v.Date != nil:
+		term.date = &Date{str: v.Date.Str}
+		term.date.val, err = time.Parse(time.RFC3339Nano, v.Date.Val)
+	case v.Duration != nil:
+		term.duration = &Duration{str: v.Duration.Str, val: time.Duration(v.Duration.Val)}
+	case v.Cells != nil:
+		term.cells = &Range{from: v.Cells.From, to: v.Cells.To}
+	case v.Text != nil:
+		term.text = &StringLiteral{str: v.Text.Str, val: v.Text.Val}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Unit != nil {
+		if term.unit, err = v.Unit.node(); err != nil {
+			return nil, err
+		}
+	}
+	for _, i := range v.Index {
+		if i == nil || (i.From == nil && !i.Slice) || (i.To != nil && !i.Slice) {
+			return nil, missing("bound", "index")
+		}
+		index := &Index{slice: i.Slice}
+		if i.From != nil {
+			if index.from, err = i.From.node(); err != nil {
+				return nil, err
+			}
+		}
+		if i.To != nil {
+			if index.to, err = i.To.node(); err != nil {
+				return nil, err
+			}
+		}
+		term.index = append(term.index, index)
+	}
+	for _, p := range v.Postfix {
+		if p == nil {
+			return nil, missing("operator", "term")
+		}
+		op, err := p.operator(FACTORIAL, PERCENT)
+		if err != nil {
+			return nil, err
+		}
+		term.postfix = append(term.postfix, (*PostfixOp)(&op))
+	}
+	return term, nil
+}
+
+// conditionalsFromJSON decodes each of the Conditionals of the node
+func conditionalsFromJSON(vs []*conditionalJSON, node string) ([]*Conditional, error) {
+	conds := []*Conditional{}
+	for _, v := range vs {
+		if v == nil {
+			return nil, missing("conditional", node)
+		}
+		cond, err := v.node()
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+// node returns the Call, checking that its name is an identifier
+func (v *callJSON) node() (call *Call, err error) {
+	if !isIdentifier(v.Name) {
+		return nil, fmt.Errorf("Invalid function name %q", v.Name)
+	}
+	call = &Call{name: v.Name}
+	if v.Pos != nil {
+		call.pos = *v.Pos
+	}
+	if call.args, err = conditionalsFromJSON(v.Args, "call"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// node returns the Piecewise, which needs at least one case with both a condition and value
+func (v *piecewiseJSON) node() (pw *Piecewise, err error) {
+	if len(v.Cases) == 0 {
+		return nil, missing("case", "piecewise")
+	}
+	pw = &Piecewise{}
+	for _, c := range v.Cases {
+		if c == nil || c.Cond == nil || c.Value == nil {
+			return nil, missing("condition or value", "case")
+		}
+		res := &Case{}
+		if res.cond, err = c.Cond.node(); err != nil {
+			return nil, err
+		}
+		if res.value, err = c.Value.node(); err != nil {
+			return nil, err
+		}
+		pw.cases = append(pw.cases, res)
+	}
+	if v.Else != nil {
+		if pw.els, err = v.Else.node(); err != nil {
+			return nil, err
+		}
+	}
+	return pw, nil
+}
+
+// unitJSON is a Unit with its scale and dimensions, so reading it needs no UnitRegistry
+type unitJSON struct {
+	Factors []*unitFactorJSON `json:"factors"`
+	Scale   string            `json:"scale"`
+	Dims    dimension         `json:"dims"`
+}
+
+// unitFactorJSON is a symbol of a Unit and the power it is raised to
+type unitFactorJSON struct {
+	Name string `json:"name"`
+	Exp  int    `json:"exp"`
+}
+
+// json returns the Unit with the scale and dimensions it was looked up with
+func (unit *Unit) json() *unitJSON {
+	v := &unitJSON{Factors: []*unitFactorJSON{}, Scale: ratToJSON(unit.scale), Dims: unit.dims}
+	for _, f := range unit.factors {
+		v.Factors = append(v.Factors, &unitFactorJSON{Name: f.name, Exp: f.exp})
+	}
+	return v
+}
+
+// node returns the Unit as it was written, with a positive scale
+func (v *unitJSON) node() (unit *Unit, err error) {
+	unit = &Unit{dims: v.Dims}
+	if unit.scale, err = ratFromJSON(v.Scale); err != nil {
+		return nil, err
+	} else if unit.scale.Sign() <= 0 {
+		return nil, fmt.Errorf("Unit scale must be positive, got %s", v.Scale)
+	}
+	for _, f := range v.Factors {
+		if f == nil || !isIdentifier(f.Name) || f.Exp == 0 {
+			return nil, missing("name or exponent", "unit")
+		}
+		unit.factors = append(unit.factors, unitFactor{name: f.Name, exp: f.Exp})
+	}
+	return unit, nil
+}
@@ -0,0 +1,197 @@
+package mathval
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type JSONSuite struct{}
+
+var _ = Suite(&JSONSuite{})
+
+// goldenInputs returns the formulas of the cases in the golden file, see checkGolden
+func goldenInputs(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var inputs []string
+	for _, block := range strings.Split(strings.TrimSpace(string(data)), "\n\n") {
+		for _, line := range strings.Split(block, "\n") {
+			if !strings.HasPrefix(line, "#") {
+				inputs = append(inputs, line)
+				break
+			}
+		}
+	}
+	return inputs, nil
+}
+
+// parseProgram parses the Program in the Mode of golden files
+func parseProgram(input string) (*Program, error) {
+	p := NewParser(strings.NewReader(input))
+	p.SetMode(goldenMode)
+	return p.ParseProgram()
+}
+
+// checkJSONRoundTrip checks that the Program decodes from its JSON, with and without positions, to a Program
+// which prints and encodes the same
+func checkJSONRoundTrip(fatalf func(format string, args ...interface{}), prog *Program) {
+	for _, positions := range []bool{true, false} {
+		data, err := prog.JSON(positions)
+		if err != nil {
+			fatalf("%s: %s", prog, err)
+		}
+		read := &Program{}
+		if err := json.Unmarshal(data, read); err != nil {
+			fatalf("%s: %s in %s", prog, err, data)
+		}
+		again, err := read.JSON(positions)
+		if err != nil {
+			fatalf("%s: %s", prog, err)
+		}
+		if read.String() != prog.String() || string(again) != string(data) {
+			fatalf("%s: read back as %s\n%s\n%s", prog, read, data, again)
+		}
+	}
+}
+
+func (j *JSONSuite) TestEncode(c *C) {
+	prog, err := parseProgram("-x + 1.5")
+	c.Assert(err, IsNil)
+
+	data, err := prog.JSON(false)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `{"version":1,"statements":[{"conditional":{"disjunction":{"conjunction":{"comparison":{"expression":{"factor":{"power":{"unary":[{"op":"-"}],"term":{"identifier":"x"}}},"op":{"op":"+"},"expression":{"factor":{"power":{"term":{"number":{"str":"1.5","val":"3/2"}}}}}}}}}}}]}`)
+
+	data, err = json.Marshal(prog)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, `{"version":1,"statements":[{"conditional":{"disjunction":{"conjunction":{"comparison":{"expression":{"factor":{"power":{"unary":[{"op":"-","pos":0}],"term":{"identifier":"x"}}},"op":{"op":"+","pos":3},"expression":{"factor":{"power":{"term":{"number":{"str":"1.5","val":"3/2"}}}}}}}}}}}]}`)
+
+	// Exact values, units and dates are kept without their registries or time zones
+	prog, err = parseProgram("0.1 km/h + 2024-03-15T10:30:00+02:00 + 2h")
+	c.Assert(err, IsNil)
+	data, err = prog.JSON(false)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Matches, `.*"number":\{"str":"0.1","val":"1/10"\},"unit":\{"factors":\[\{"name":"km","exp":1\},\{"name":"h","exp":-1\}\],"scale":"5/18","dims":\[1,0,-1,0,0,0,0\]\}.*`)
+	c.Assert(string(data), Matches, `.*"date":\{"str":"2024-03-15T10:30:00\+02:00","val":"2024-03-15T10:30:00\+02:00"\}.*"duration":\{"str":"2h","val":7200000000000\}.*`)
+}
+
+func (j *JSONSuite) TestRoundTrip(c *C) {
+	for _, path := range []string{"testdata/latex.golden", "testdata/mathml.golden"} {
+		inputs, err := goldenInputs(path)
+		c.Assert(err, IsNil)
+		for _, input := range inputs {
+			prog, err := parseProgram(input)
+			c.Assert(err, IsNil, Commentf(input))
+			checkJSONRoundTrip(c.Fatalf, prog)
+		}
+	}
+
+	// Comments, implicit multiplication and positions survive
+	prog, err := parseProgram("# area\nr = 2 // radius\npi r^2 /* of r */")
+	c.Assert(err, IsNil)
+	checkJSONRoundTrip(c.Fatalf, prog)
+	data, err := json.Marshal(prog)
+	c.Assert(err, IsNil)
+	read := &Program{}
+	c.Assert(json.Unmarshal(data, read), IsNil)
+	c.Assert(read.String(), Equals, prog.String())
+	c.Assert(read.String(), Matches, "(?s)# area.*// radius.*/\\* of r \\*/.*")
+	c.Assert(read.statements[1].cond.soleExpression().factor.op.pos, Equals, 26)
+}
+
+func (j *JSONSuite) TestConditional(c *C) {
+	cond, err := parseInfix("2 x^2 > 3 ? abs(x) : x!")
+	c.Assert(err, IsNil)
+	data, err := json.Marshal(cond)
+	c.Assert(err, IsNil)
+
+	read := &Conditional{}
+	c.Assert(json.Unmarshal(data, read), IsNil)
+	c.Assert(read.String(), Equals, cond.String())
+	c.Assert(read.soleTerm(), IsNil)
+	c.Assert(read.then.soleTerm().call.pos, Equals, 12)
+
+	ev := NewEvaluator()
+	ev.Set("x", NewNumberValue(big.NewRat(3, 1)))
+	val, err := ev.Eval(read)
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "3")
+}
+
+func (j *JSONSuite) TestErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: `{"statements":[]}`, err: "Unsupported JSON schema version 0, expected 1"},
+		{input: `{"version":2,"statements":[]}`, err: "Unsupported JSON schema version 2, expected 1"},
+		{input: `{"version":1,"statements":[{}]}`, err: "Statement must have exactly one of assignment, definition and conditional, got 0"},
+		{input: `{"version":1,"statements":[{"conditional":{}}]}`, err: "Missing disjunction in conditional"},
+		{input: `{"version":1,"statements":[{"conditional":{"disjunction":{"conjunction":{"comparison":{"expression":{"factor":{"power":{"term":{}}}}}}}}}]}`, err: "Term must have exactly one operand, got 0"},
+		{input: `{"version":1,"statements":[{"conditional":{"disjunction":{"conjunction":{"comparison":{"expression":{"factor":{"power":{"term":{"identifier":"x"}},"op":{"op":"+"},"factor":{"power":{"term":{"identifier":"y"}}}}}}}}}}]}`, err: `Invalid operator "+"`},
+		{input: `{"version":1,"statements":[{"conditional":{"disjunction":{"conjunction":{"comparison":{"expression":{"factor":{"power":{"term":{"identifier":"x"}},"op":{"op":"*"}}}}}}}}]}`, err: "Missing power or operand in factor"},
+		{input: `{"version":1,"statements":[{"conditional":{"disjunction":{"conjunction":{"comparison":{"expression":{"factor":{"power":{"term":{"number":{"str":"0.5","val":"0.5"}}}}}}}}}}]}`, err: `Invalid rational "0.5", expected num/den`},
+		{input: `{"version":1,"statements":[{"conditional":{"disjunction":{"conjunction":{"comparison":{"expression":{"factor":{"power":{"term":{"identifier":"not"}}}}}}}}}]}`, err: `Invalid identifier "not"`},
+		{input: `{"version":1,"statements":[{"assignment":{"name":"x"}}]}`, err: "Missing name or value in assignment"},
+		{input: `[1]`, err: ".*cannot unmarshal array.*"},
+	}
+	for _, res := range expected {
+		prog := &Program{}
+		err := json.Unmarshal([]byte(res.input), prog)
+		if strings.HasPrefix(res.err, ".*") {
+			c.Assert(err, ErrorMatches, res.err, Commentf(res.input))
+		} else {
+			c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+		}
+	}
+}
+
+// FuzzJSON checks that any formula which parses round trips through JSON
+func FuzzJSON(f *testing.F) {
+	for _, path := range []string{"testdata/latex.golden", "testdata/mathml.golden", "testdata/contentmathml.golden"} {
+		inputs, err := goldenInputs(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, input := range inputs {
+			f.Add(input)
+		}
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		prog, err := parseProgram(input)
+		if err != nil {
+			return
+		}
+		checkJSONRoundTrip(t.Fatalf, prog)
+	})
+}
+
+// FuzzDecodeJSON checks that decoding any JSON either fails or gives a Program which round trips
+func FuzzDecodeJSON(f *testing.F) {
+	for _, input := range []string{"1 + 2", "x = [1, 2][0:1]", "f(x) = x -> x ? 1 : 2", "piecewise(x < 1: 2, else: 3)"} {
+		prog, err := parseProgram(input)
+		if err != nil {
+			f.Fatal(err)
+		}
+		data, err := prog.JSON(true)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		prog := &Program{}
+		if err := json.Unmarshal(data, prog); err != nil {
+			return
+		}
+		checkJSONRoundTrip(t.Fatalf, prog)
+	})
+}
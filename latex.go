@@ -0,0 +1,478 @@
+package mathval
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The methods below print the AST as LaTeX math for typesetting. Division is a \frac, exponents are superscripts
+// and functions use their LaTeX commands where there is one. Parentheses written in the source are dropped, and
+// only added, as \left( and \right), where the precedence of the operators or the typesetting needs them. So
+// "(a + b) / 2" is "\frac{a + b}{2}" but "(a + b) * 2" keeps them. Comments are not printed
+
+// Precedence levels of LaTeX output, from loosest to tightest. A node printed where a higher level is needed
+// is parenthesised
+const (
+	levelConditional = iota // ternaries, conversions and lambdas
+	levelOr
+	levelAnd
+	levelComparison
+	levelAdditive
+	levelUnary
+	levelMultiplicative
+	levelPower // also a \frac, which needs parentheses as the base of a power
+	levelTerm
+)
+
+// latexOperators holds the LaTeX for each operator which isn't written as it is typed
+var latexOperators = map[Token]string{
+	MULTIPLY: `\cdot`,
+	MODULO:   `\bmod`,
+	EQ:       "=",
+	NEQ:      `\neq`,
+	LTE:      `\leq`,
+	GTE:      `\geq`,
+	AND:      `\land`,
+	OR:       `\lor`,
+	NOT:      `\lnot`,
+	PERCENT:  `\%`,
+}
+
+// latexOperator returns the LaTeX for the operator
+func latexOperator(tok Token) string {
+	if s, ok := latexOperators[tok]; ok {
+		return s
+	}
+	return tok.String()
+}
+
+// latexFunctions holds the LaTeX command of each function which has one, whose argument is parenthesised
+var latexFunctions = map[string]string{
+	"sin": `\sin`, "cos": `\cos`, "tan": `\tan`, "sinh": `\sinh`, "cosh": `\cosh`, "tanh": `\tanh`,
+	"asin": `\arcsin`, "acos": `\arccos`, "atan": `\arctan`, "ln": `\ln`, "exp": `\exp`, "log10": `\log_{10}`,
+	"min": `\min`, "max": `\max`, "det": `\det`,
+}
+
+// latexSymbols holds the LaTeX for identifiers which are Greek letters or constants
+var latexSymbols = map[string]string{
+	"sqrt2": `\sqrt{2}`, "ln2": `\ln 2`,
+}
+
+func init() {
+	for _, name := range []string{
+		"alpha", "beta", "gamma", "delta", "epsilon", "zeta", "eta", "theta", "iota", "kappa", "lambda", "mu",
+		"nu", "xi", "pi", "rho", "sigma", "tau", "upsilon", "phi", "chi", "psi", "omega",
+		"Gamma", "Delta", "Theta", "Lambda", "Xi", "Pi", "Sigma", "Upsilon", "Phi", "Psi", "Omega",
+	} {
+		latexSymbols[name] = `\` + name
+	}
+}
+
+// latexParens returns s in \left( and \right) if its level is below min, otherwise as it is
+func latexParens(s string, level, min int) string {
+	if level < min {
+		return `\left(` + s + `\right)`
+	}
+	return s
+}
+
+// latexName returns the LaTeX for an identifier. Single letters are italic and longer names upright, and the
+// part of the name after an underscore is a subscript, so "x_max" is "x_{\mathrm{max}}"
+func latexName(name string) string {
+	if i := strings.IndexByte(name, '_'); i > 0 && i < len(name)-1 {
+		return latexName(name[:i]) + "_{" + latexName(name[i+1:]) + "}"
+	}
+	if s, ok := latexSymbols[name]; ok {
+		return s
+	}
+	if utf8.RuneCountInString(name) == 1 || strings.IndexFunc(name, func(ch rune) bool { return !unicode.IsDigit(ch) }) < 0 {
+		return name
+	}
+	return `\mathrm{` + latexText(name) + "}"
+}
+
+// latexText escapes the characters which are special to LaTeX, for text in \text or \mathrm
+func latexText(s string) string {
+	var buf strings.Builder
+	for _, ch := range s {
+		switch ch {
+		case '\\':
+			buf.WriteString(`\textbackslash{}`)
+		case '~':
+			buf.WriteString(`\textasciitilde{}`)
+		case '^':
+			buf.WriteString(`\textasciicircum{}`)
+		case '{', '}', '$', '&', '#', '_', '%':
+			buf.WriteString(`\` + string(ch))
+		default:
+			buf.WriteRune(ch)
+		}
+	}
+	return buf.String()
+}
+
+// LaTeX returns the Program as LaTeX, with each statement on its own line
+func (prog *Program) LaTeX() string {
+	lines := make([]string, len(prog.statements))
+	for i, stmt := range prog.statements {
+		switch {
+		case stmt.assignment != nil:
+			lines[i] = latexName(stmt.assignment.name) + " = " + stmt.assignment.value.latex(levelConditional)
+		case stmt.definition != nil:
+			def := stmt.definition
+			params := make([]string, len(def.params))
+			for j, param := range def.params {
+				params[j] = latexName(param)
+			}
+			lines[i] = latexCallee(def.name) + `\left(` + strings.Join(params, ", ") + `\right) = ` + def.body.latex(levelConditional)
+		default:
+			lines[i] = stmt.cond.latex(levelConditional)
+		}
+	}
+	return strings.Join(lines, " \\\\\n")
+}
+
+// LaTeX returns the Conditional as LaTeX
+func (cond *Conditional) LaTeX() string {
+	return cond.latex(levelConditional)
+}
+
+// latex returns the Conditional as LaTeX, parenthesised if it is looser than min. A ternary is written as
+// cases, with those in its else branch as further rows
+func (cond *Conditional) latex(min int) string {
+	if cond.then == nil {
+		s := cond.disjunction.latex(min)
+		if cond.to != nil {
+			s = latexParens(s+` \rightarrow `+cond.to.latex(), levelConditional, min)
+		} else if cond.currency != "" {
+			s = latexParens(s+` \rightarrow \mathrm{`+cond.currency+"}", levelConditional, min)
+		}
+		return s
+	}
+
+	var rows []string
+	for ; cond.then != nil; cond = cond.els {
+		rows = append(rows, cond.then.latex(levelConditional)+` & \text{if } `+cond.disjunction.latex(levelConditional))
+	}
+	rows = append(rows, cond.latex(levelConditional)+` & \text{otherwise}`)
+	return latexCases(rows)
+}
+
+// latexCases returns the rows in a cases environment
+func latexCases(rows []string) string {
+	return `\begin{cases} ` + strings.Join(rows, ` \\ `) + ` \end{cases}`
+}
+
+// latex returns the Disjunction as LaTeX, parenthesised if it is looser than min
+func (dis *Disjunction) latex(min int) string {
+	if dis.op == nil {
+		return dis.conjunction.latex(min)
+	}
+	var items []string
+	for ; dis != nil; dis = dis.disjunction {
+		items = append(items, dis.conjunction.latex(levelAnd))
+	}
+	return latexParens(strings.Join(items, " "+latexOperator(OR)+" "), levelOr, min)
+}
+
+// latex returns the Conjunction as LaTeX, parenthesised if it is looser than min
+func (con *Conjunction) latex(min int) string {
+	if con.op == nil {
+		return con.comparison.latex(min)
+	}
+	var items []string
+	for ; con != nil; con = con.conjunction {
+		items = append(items, con.comparison.latex(levelComparison))
+	}
+	return latexParens(strings.Join(items, " "+latexOperator(AND)+" "), levelAnd, min)
+}
+
+// latex returns the Comparison as LaTeX, parenthesised if it is looser than min
+func (cmp *Comparison) latex(min int) string {
+	if len(cmp.not) == 0 && cmp.op == nil {
+		return cmp.expression.latex(min)
+	}
+	var buf strings.Builder
+	for _, not := range cmp.not {
+		buf.WriteString(latexOperator(not.op) + " ")
+	}
+	buf.WriteString(cmp.expression.latex(levelAdditive))
+	if cmp.op != nil {
+		buf.WriteString(" " + latexOperator(cmp.op.op) + " " + cmp.right.latex(levelAdditive))
+	}
+	return latexParens(buf.String(), levelComparison, min)
+}
+
+// latex returns the Expression as LaTeX, parenthesised if it is looser than min. Operands after the first are
+// parenthesised if they are sums or differences themselves, or negated
+func (exp *Expression) latex(min int) string {
+	if exp.op == nil {
+		return exp.factor.latex(min)
+	}
+	var buf strings.Builder
+	buf.WriteString(exp.factor.latex(levelAdditive))
+	for ; exp.op != nil; exp = exp.expression {
+		buf.WriteString(" " + latexOperator(exp.op.op) + " " + exp.expression.factor.latex(levelMultiplicative))
+	}
+	return latexParens(buf.String(), levelAdditive, min)
+}
+
+// latex returns the Factor as LaTeX, parenthesised if it is looser than min. The chain of operators folds from
+// the left, so a division makes everything before it the numerator, and integer division is the floor of a
+// \frac
+func (fac *Factor) latex(min int) string {
+	if fac.op == nil {
+		return fac.power.latex(min)
+	}
+
+	first := levelUnary
+	if fac.op.op == DIVIDE || fac.op.op == INT_DIVIDE {
+		first = levelConditional
+	}
+	s, level := fac.power.latex(first), levelMultiplicative
+	for ; fac.op != nil; fac = fac.factor {
+		switch op := fac.op.op; op {
+		case DIVIDE:
+			s, level = `\frac{`+s+"}{"+fac.factor.power.latex(levelConditional)+"}", levelPower
+		case INT_DIVIDE:
+			s, level = `\left\lfloor \frac{`+s+"}{"+fac.factor.power.latex(levelConditional)+`} \right\rfloor`, levelTerm
+		case IMPLICIT_MULTIPLY:
+			// Juxtaposed digits would read as one number
+			right := fac.factor.power.latex(levelPower)
+			if r, _ := utf8.DecodeRuneInString(right); unicode.IsDigit(r) {
+				s += " " + latexOperator(MULTIPLY) + " " + right
+			} else {
+				s += " " + right
+			}
+			level = levelMultiplicative
+		default:
+			s, level = s+" "+latexOperator(op)+" "+fac.factor.power.latex(levelPower), levelMultiplicative
+		}
+	}
+	return latexParens(s, level, min)
+}
+
+// latex returns the Power as LaTeX, parenthesised if it is looser than min. The exponent is a superscript
+func (pow *Power) latex(min int) string {
+	if len(pow.unary) == 0 && pow.op == nil {
+		return pow.term.latex(min)
+	}
+
+	var buf strings.Builder
+	for _, unary := range pow.unary {
+		buf.WriteString(latexOperator(unary.op))
+	}
+	level := levelPower
+	if pow.op != nil {
+		buf.WriteString(pow.term.latex(levelTerm) + "^{" + pow.power.latex(levelConditional) + "}")
+	} else {
+		buf.WriteString(pow.term.latex(levelMultiplicative))
+	}
+	if len(pow.unary) != 0 {
+		level = levelUnary
+	}
+	return latexParens(buf.String(), level, min)
+}
+
+// latex returns the Term as LaTeX, parenthesised if it is looser than min
+func (term *Term) latex(min int) string {
+	if term.exp != nil && len(term.index) == 0 && len(term.postfix) == 0 {
+		// Parentheses written in the source are only kept where they are needed
+		return term.exp.latex(min)
+	}
+
+	s, level := term.latexOperand()
+	if len(term.index) == 0 && len(term.postfix) == 0 {
+		return latexParens(s, level, min)
+	}
+	s = latexParens(s, level, levelTerm)
+	for _, index := range term.index {
+		s += index.latex()
+	}
+	for _, post := range term.postfix {
+		s += latexOperator(post.op)
+	}
+	return latexParens(s, levelTerm, min)
+}
+
+// latexOperand returns the Term without its indexes and postfix operators as LaTeX, and its level
+func (term *Term) latexOperand() (string, int) {
+	switch {
+	case term.exp != nil:
+		return term.exp.latex(levelTerm), levelTerm
+	case term.number != nil && term.unit != nil:
+		return term.number.String() + `\,` + term.unit.latex(), levelPower
+	case term.number != nil && term.currency != "":
+		return term.number.String() + `\,\mathrm{` + term.currency + "}", levelPower
+	case term.number != nil:
+		return term.number.String(), levelTerm
+	case term.date != nil:
+		return `\text{` + term.date.str + "}", levelTerm
+	case term.duration != nil:
+		return `\text{` + term.duration.str + "}", levelTerm
+	case term.cells != nil:
+		return `\text{` + term.cells.String() + "}", levelTerm
+	case term.text != nil:
+		return `\text{` + latexText(term.text.str) + "}", levelTerm
+	case term.ident != nil:
+		return latexName(term.ident.name), levelTerm
+	case term.call != nil:
+		return term.call.latex()
+	case term.lambda != nil:
+		return term.lambda.latex(), levelConditional
+	case term.list != nil:
+		return term.list.latex(), levelTerm
+	case term.piecewise != nil:
+		return term.piecewise.latex(), levelTerm
+	}
+	return "", levelTerm
+}
+
+// latex returns the Unit as LaTeX, with the factors with negative exponents as divisors
+func (unit *Unit) latex() string {
+	var num, den []string
+	for _, f := range unit.factors {
+		if f.exp > 0 {
+			num = append(num, f.latex())
+		} else {
+			den = append(den, unitFactor{name: f.name, exp: -f.exp}.latex())
+		}
+	}
+	if len(num) == 0 {
+		for _, f := range unit.factors {
+			num = append(num, f.latex())
+		}
+		den = nil
+	}
+	s := strings.Join(num, `\,`)
+	for _, d := range den {
+		s += "/" + d
+	}
+	return s
+}
+
+// latex returns the unit's name upright, followed by its exponent unless that is 1
+func (f unitFactor) latex() string {
+	s := `\mathrm{` + latexText(f.name) + "}"
+	if f.exp != 1 {
+		s += "^{" + strconv.Itoa(f.exp) + "}"
+	}
+	return s
+}
+
+// latex returns the Call as LaTeX, and its level. Sums and products of series are written with \sum and \prod,
+// and bind looser than multiplication
+func (call *Call) latex() (string, int) {
+	args := make([]string, len(call.args))
+	for i, arg := range call.args {
+		args[i] = arg.latex(levelConditional)
+	}
+
+	switch {
+	case call.name == "sqrt" && len(args) == 1:
+		return `\sqrt{` + args[0] + "}", levelTerm
+	case call.name == "abs" && len(args) == 1:
+		return `\left|` + args[0] + `\right|`, levelTerm
+	case call.name == "log" && len(args) == 2:
+		return `\log_{` + args[0] + `}\left(` + args[1] + `\right)`, levelTerm
+	case (call.name == "sum" || call.name == "prod") && len(args) == 4:
+		op := `\sum`
+		if call.name == "prod" {
+			op = `\prod`
+		}
+		return op + "_{" + args[0] + " = " + args[1] + "}^{" + args[2] + "} " + call.args[3].latex(levelMultiplicative), levelAdditive
+	}
+	if cmd, ok := latexFunctions[call.name]; ok {
+		return cmd + `\left(` + strings.Join(args, ", ") + `\right)`, levelTerm
+	}
+	return latexCallee(call.name) + `\left(` + strings.Join(args, ", ") + `\right)`, levelTerm
+}
+
+// latexCallee returns the name of a function without a LaTeX command, which is upright unless it is a single
+// letter
+func latexCallee(name string) string {
+	if utf8.RuneCountInString(name) == 1 {
+		return name
+	}
+	return `\operatorname{` + latexText(name) + "}"
+}
+
+// latex returns the Lambda as LaTeX, with \mapsto for its arrow
+func (lambda *Lambda) latex() string {
+	params := make([]string, len(lambda.params))
+	for i, param := range lambda.params {
+		params[i] = latexName(param)
+	}
+	s := strings.Join(params, ", ")
+	if len(params) != 1 {
+		s = `\left(` + s + `\right)`
+	}
+	return s + ` \mapsto ` + lambda.body.latex(levelConditional)
+}
+
+// latex returns the ListLiteral as LaTeX. A list of lists of the same non-zero length is written as a matrix
+func (list *ListLiteral) latex() string {
+	if rows, ok := list.matrixRows(); ok {
+		lines := make([]string, len(rows))
+		for i, row := range rows {
+			cells := make([]string, len(row.elems))
+			for j, cell := range row.elems {
+				cells[j] = cell.latex(levelConditional)
+			}
+			lines[i] = strings.Join(cells, " & ")
+		}
+		return `\begin{bmatrix} ` + strings.Join(lines, ` \\ `) + ` \end{bmatrix}`
+	}
+	elems := make([]string, len(list.elems))
+	for i, elem := range list.elems {
+		elems[i] = elem.latex(levelConditional)
+	}
+	return `\left[` + strings.Join(elems, ", ") + `\right]`
+}
+
+// matrixRows returns the elements of a ListLiteral whose elements are all ListLiterals of the same non-zero
+// length, which are printed as the rows of a matrix
+func (list *ListLiteral) matrixRows() ([]*ListLiteral, bool) {
+	rows := make([]*ListLiteral, len(list.elems))
+	for i, elem := range list.elems {
+		term := elem.soleTerm()
+		if term == nil || term.list == nil || len(term.list.elems) == 0 {
+			return nil, false
+		}
+		if rows[i] = term.list; len(rows[i].elems) != len(rows[0].elems) {
+			return nil, false
+		}
+	}
+	return rows, len(rows) != 0
+}
+
+// latex returns the Piecewise as LaTeX cases
+func (pw *Piecewise) latex() string {
+	rows := make([]string, 0, len(pw.cases)+1)
+	for _, c := range pw.cases {
+		rows = append(rows, c.value.latex(levelConditional)+` & \text{if } `+c.cond.latex(levelConditional))
+	}
+	if pw.els != nil {
+		rows = append(rows, pw.els.latex(levelConditional)+` & \text{otherwise}`)
+	}
+	return latexCases(rows)
+}
+
+// latex returns the Index as LaTeX
+func (index *Index) latex() string {
+	var buf strings.Builder
+	buf.WriteString(`\left[`)
+	if index.from != nil {
+		buf.WriteString(index.from.latex(levelConditional))
+	}
+	if index.slice {
+		buf.WriteString("{:}")
+	}
+	if index.to != nil {
+		buf.WriteString(index.to.latex(levelConditional))
+	}
+	buf.WriteString(`\right]`)
+	return buf.String()
+}
@@ -0,0 +1,87 @@
+package mathval
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+// update rewrites the golden files in testdata with the current output rather than checking it
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+type LaTeXSuite struct{}
+
+var _ = Suite(&LaTeXSuite{})
+
+// goldenMode is the Mode the formulas in golden files are parsed in
+const goldenMode = ImplicitMultiplication | Units | Dates | Money | Cells
+
+// golden is a formula from a golden file and its expected output
+type golden struct {
+	input    string
+	expected string
+}
+
+// checkGolden parses each formula in the golden file as a Program and compares print's output for it with the
+// lines that follow, up to a blank line, or rewrites those lines if -update is set. Lines starting with '#' before the first case
+// are kept as a header
+func checkGolden(c *C, path string, print func(*Program) string) {
+	data, err := os.ReadFile(path)
+	c.Assert(err, IsNil)
+
+	var header []string
+	var cases []golden
+	for _, block := range strings.Split(strings.TrimSpace(string(data)), "\n\n") {
+		lines := strings.Split(block, "\n")
+		for len(cases) == 0 && len(lines) != 0 && strings.HasPrefix(lines[0], "#") {
+			header, lines = append(header, lines[0]), lines[1:]
+		}
+		c.Assert(len(lines) != 0, Equals, true, Commentf("%q", block))
+		cases = append(cases, golden{input: lines[0], expected: strings.Join(lines[1:], "\n")})
+	}
+
+	var out strings.Builder
+	out.WriteString(strings.Join(header, "\n") + "\n")
+	for i, res := range cases {
+		parser := NewParser(strings.NewReader(res.input))
+		parser.SetMode(goldenMode)
+		prog, err := parser.ParseProgram()
+		c.Assert(err, IsNil, Commentf(res.input))
+		actual := print(prog)
+		if !*update {
+			c.Check(actual, Equals, res.expected, Commentf(res.input))
+		}
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(res.input + "\n" + actual + "\n")
+	}
+	if *update {
+		c.Assert(os.WriteFile(path, []byte(out.String()), 0644), IsNil)
+	}
+}
+
+func (l *LaTeXSuite) TestGolden(c *C) {
+	checkGolden(c, "testdata/latex.golden", (*Program).LaTeX)
+}
+
+func (l *LaTeXSuite) TestConditional(c *C) {
+	expected := []struct {
+		mode     Mode
+		input    string
+		expected string
+	}{
+		{input: "/* half */ x / 2 # of x", expected: `\frac{x}{2}`},
+		{input: "1/2x", expected: `\frac{1}{2 x}`, mode: TightImplicitMultiplication},
+		{input: `=IF(A1>10; "50% & more"; "less")`, expected: `\operatorname{if}\left(\mathrm{A1} > 10, \text{"50\% \& more"}, \text{"less"}\right)`, mode: Excel},
+	}
+	for _, res := range expected {
+		parser = NewParser(strings.NewReader(res.input))
+		parser.SetMode(res.mode)
+		cond, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(cond.LaTeX(), Equals, res.expected, Commentf(res.input))
+	}
+}
@@ -0,0 +1,992 @@
+package mathval
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// LaTeXParser reads formulas written in LaTeX math into the same AST as Parser, so they can be evaluated,
+// simplified and printed like any other. It reads a practical subset: numbers, variables, Greek letters, \frac,
+// \sqrt and \sqrt[n], superscripts, \cdot, \times, \div, comparisons, \lnot, \land, \lor, factorials,
+// \left( \right), \left| \right|, \left\lfloor \frac{a}{b} \right\rfloor, lists and indexes in \left[ \right],
+// bmatrix and cases environments and the functions with LaTeX commands such as \sin and \log_{2}. This covers
+// what Conditional.LaTeX prints, except for sums and products, lambdas, conversions, units, currencies and
+// \text operands such as dates. Anything else is a SyntaxError at its offset.
+//
+// As in LaTeX, a run of letters is a product of single letter variables, so "xy" is "x y", and longer names are
+// written \mathrm{rate}. A subscript is part of the name, so "x_{max}" is the variable x_max. Juxtaposition
+// multiplies as in ImplicitMultiplication, and a name directly followed by a parenthesis is a call, so "f(x)"
+// and "\operatorname{rate}\left(x\right)" are calls but "x \left(a + b\right)" is a product. A function
+// command without parentheses takes the following power as its argument, so "\sin x^2" is "sin(x^2)", and a
+// superscript on the command raises the result, so "\sin^2 x" is "sin(x)^2". \sqrt[n]{x} is x^(1/n). The rows
+// of a cases environment are a value and "\text{if } condition", and optionally a last "\text{otherwise}", and
+// are read as a Piecewise. Spacing commands such as \, and comments are ignored
+type LaTeXParser struct {
+	r    io.Reader
+	toks []latexToken
+	i    int // index of the next token
+}
+
+// NewLaTeXParser returns a new instance of LaTeXParser
+func NewLaTeXParser(r io.Reader) *LaTeXParser {
+	return &LaTeXParser{r: r}
+}
+
+// latexToken is a command, as in \frac, or a single character of LaTeX
+type latexToken struct {
+	cmd   string // name of the command without its backslash, or "" for a character
+	ch    rune   // the character, or eof at the end of the source
+	pos   int    // offset in runes in the source
+	space bool   // whether whitespace or a spacing command precedes the token
+}
+
+// String returns the token as it is written, or EOF
+func (tok latexToken) String() string {
+	if tok.cmd != "" {
+		return `\` + tok.cmd
+	} else if tok.ch == eof {
+		return "EOF"
+	}
+	return fmt.Sprintf("%q", string(tok.ch))
+}
+
+// is returns whether the token is the given character
+func (tok latexToken) is(ch rune) bool {
+	return tok.cmd == "" && tok.ch == ch
+}
+
+// digit returns whether the token is an ASCII digit
+func (tok latexToken) digit() bool {
+	return tok.cmd == "" && tok.ch >= '0' && tok.ch <= '9'
+}
+
+// letter returns whether the token is a letter or a Greek letter command, either of which is a variable
+func (tok latexToken) letter() bool {
+	return (tok.cmd == "" && isLetter(tok.ch)) || isGreek(tok.cmd)
+}
+
+// latexSpacing holds the spacing commands, which are read as whitespace
+var latexSpacing = map[string]bool{",": true, ";": true, ":": true, "!": true, " ": true, "quad": true, "qquad": true}
+
+// latexComparisons holds the comparison operators by their command or character
+var latexComparisons = map[string]Token{
+	"=": EQ, "<": LT, ">": GT, "neq": NEQ, "ne": NEQ, "leq": LTE, "le": LTE, "geq": GTE, "ge": GTE, "lt": LT, "gt": GT,
+}
+
+// latexLogic holds the logical operators by their command
+var latexLogic = map[string]Token{"lor": OR, "vee": OR, "land": AND, "wedge": AND, "lnot": NOT, "neg": NOT}
+
+// latexMultiplications holds the explicit multiplicative operators by their command or character
+var latexMultiplications = map[string]Token{
+	"*": MULTIPLY, "cdot": MULTIPLY, "times": MULTIPLY, "/": DIVIDE, "div": DIVIDE, "bmod": MODULO,
+}
+
+// latexCommands maps the LaTeX commands of functions back to the functions, see latexFunctions
+var latexCommands = map[string]string{}
+
+func init() {
+	for name, cmd := range latexFunctions {
+		if isIdentifier(cmd[1:]) {
+			latexCommands[cmd[1:]] = name
+		}
+	}
+}
+
+// scanLaTeX splits the source into tokens, dropping whitespace, spacing commands and comments
+func scanLaTeX(src []rune) []latexToken {
+	var toks []latexToken
+	space := false
+	for i := 0; i < len(src); i++ {
+		ch := src[i]
+		switch {
+		case isWhitespace(ch):
+			space = true
+			continue
+		case ch == '%':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			space = true
+			continue
+		}
+
+		tok := latexToken{ch: ch, pos: i, space: space}
+		if ch == '\\' && i+1 < len(src) {
+			j := i + 1
+			for j < len(src) && isLetter(src[j]) && src[j] < 0x80 {
+				j++
+			}
+			if j == i+1 {
+				j++
+			}
+			tok.cmd, i = string(src[i+1:j]), j-1
+		}
+		if latexSpacing[tok.cmd] {
+			space = true
+			continue
+		}
+		toks, space = append(toks, tok), false
+	}
+	return append(toks, latexToken{ch: eof, pos: len(src), space: space})
+}
+
+// Parse parses the LaTeX into a Conditional
+func (p *LaTeXParser) Parse() (*Conditional, error) {
+	src, err := io.ReadAll(p.r)
+	if err != nil {
+		return nil, err
+	}
+	p.toks, p.i = scanLaTeX([]rune(string(src))), 0
+
+	cond, err := p.parseDisjunction()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); !tok.is(eof) {
+		return nil, p.unexpected(tok)
+	}
+	return cond, nil
+}
+
+// peek returns the next token without reading it
+func (p *LaTeXParser) peek() latexToken {
+	return p.toks[p.i]
+}
+
+// next reads the next token. The last token, eof, is never read past
+func (p *LaTeXParser) next() latexToken {
+	tok := p.toks[p.i]
+	if p.i < len(p.toks)-1 {
+		p.i++
+	}
+	return tok
+}
+
+// readIf reads the next token if it is the given command, or character if s is a single character, and
+// returns whether it did
+func (p *LaTeXParser) readIf(s string) bool {
+	if p.peek().matches(s) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// matches returns whether the token is the given command, or character if s is a single character
+func (tok latexToken) matches(s string) bool {
+	return (len(s) > 1 && tok.cmd == s) || (len(s) == 1 && tok.cmd == "" && string(tok.ch) == s)
+}
+
+// readRowEnd reads the next token if it is \\, which ends a row of an environment, and returns whether it did
+func (p *LaTeXParser) readRowEnd() bool {
+	if p.peek().cmd == `\` {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expect reads the next token, which must be the given character or command
+func (p *LaTeXParser) expect(s string) error {
+	if !p.readIf(s) {
+		tok := p.peek()
+		return &SyntaxError{Msg: fmt.Sprintf("Expected %q, got %s", s, tok), Pos: tok.pos}
+	}
+	return nil
+}
+
+// unexpected returns the error for an unexpected token, which is unsupported if it is an unknown command
+func (p *LaTeXParser) unexpected(tok latexToken) error {
+	if tok.cmd != "" && !p.knows(tok.cmd) {
+		return &SyntaxError{Msg: "Unsupported command " + tok.String(), Pos: tok.pos}
+	}
+	return &SyntaxError{Msg: "Unexpected " + tok.String(), Pos: tok.pos}
+}
+
+// knows returns whether the command is one the LaTeXParser reads
+func (p *LaTeXParser) knows(cmd string) bool {
+	switch cmd {
+	case "frac", "dfrac", "tfrac", "sqrt", "left", "right", "mathrm", "operatorname", "log", "%", "_",
+		"begin", "end", "text", "lfloor", "rfloor", `\`:
+		return true
+	}
+	_, cmp := latexComparisons[cmd]
+	_, logic := latexLogic[cmd]
+	_, mul := latexMultiplications[cmd]
+	_, fn := latexCommands[cmd]
+	return cmp || logic || mul || fn || isGreek(cmd)
+}
+
+// isGreek returns whether the command is a Greek letter, which is read as the variable or constant of the same
+// name, as in \pi
+func isGreek(cmd string) bool {
+	return latexSymbols[cmd] == `\`+cmd
+}
+
+// comparison returns the comparison operator the token stands for, if any
+func (tok latexToken) comparison() (Token, bool) {
+	if tok.cmd != "" {
+		op, ok := latexComparisons[tok.cmd]
+		return op, ok
+	}
+	op, ok := latexComparisons[string(tok.ch)]
+	return op, ok
+}
+
+// multiplication returns the explicit multiplicative operator the token stands for, if any
+func (tok latexToken) multiplication() (Token, bool) {
+	if tok.cmd != "" {
+		op, ok := latexMultiplications[tok.cmd]
+		return op, ok
+	}
+	op, ok := latexMultiplications[string(tok.ch)]
+	return op, ok
+}
+
+// startsOperand returns whether the token can start an operand, so that juxtaposing it multiplies. Unknown
+// commands do, so that they are reported as unsupported
+func (tok latexToken) startsOperand() bool {
+	if tok.cmd == "" {
+		return tok.letter() || tok.digit() || tok.ch == '(' || tok.ch == '{'
+	}
+	switch tok.cmd {
+	case "right", "%", "end", "rfloor", `\`:
+		return false
+	}
+	_, cmp := tok.comparison()
+	_, logic := latexLogic[tok.cmd]
+	_, mul := tok.multiplication()
+	return !cmp && !logic && !mul
+}
+
+// parseDisjunction parses a chain of \lor, which binds loosest
+func (p *LaTeXParser) parseDisjunction() (*Conditional, error) {
+	cond, err := p.parseConjunction()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok.cmd != "" && latexLogic[tok.cmd] == OR; tok = p.peek() {
+		p.next()
+		right, err := p.parseConjunction()
+		if err != nil {
+			return nil, err
+		}
+		cond = binaryAt(cond, OR, tok.pos, right)
+	}
+	return cond, nil
+}
+
+// parseConjunction parses a chain of \land
+func (p *LaTeXParser) parseConjunction() (*Conditional, error) {
+	cond, err := p.parseNegation()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok.cmd != "" && latexLogic[tok.cmd] == AND; tok = p.peek() {
+		p.next()
+		right, err := p.parseNegation()
+		if err != nil {
+			return nil, err
+		}
+		cond = binaryAt(cond, AND, tok.pos, right)
+	}
+	return cond, nil
+}
+
+// parseNegation parses a comparison with any leading \lnot, which negates the whole comparison as in
+// Comparison
+func (p *LaTeXParser) parseNegation() (*Conditional, error) {
+	tok := p.peek()
+	if tok.cmd == "" || latexLogic[tok.cmd] != NOT {
+		return p.parseComparison()
+	}
+	p.next()
+	cond, err := p.parseNegation()
+	if err != nil {
+		return nil, err
+	}
+	return unaryAt(NOT, tok.pos, cond), nil
+}
+
+// parseComparison parses an expression, compared with a second if a comparison operator follows
+func (p *LaTeXParser) parseComparison() (*Conditional, error) {
+	left, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.peek().comparison()
+	if !ok {
+		return left, nil
+	}
+	pos := p.next().pos
+	right, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return binaryAt(left, op, pos, right), nil
+}
+
+// parseExpression parses a chain of additive operators
+func (p *LaTeXParser) parseExpression() (*Conditional, error) {
+	cond, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for tok := p.peek(); tok.is('+') || tok.is('-'); tok = p.peek() {
+		p.next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		op := PLUS
+		if tok.is('-') {
+			op = MINUS
+		}
+		cond = binaryAt(cond, op, tok.pos, right)
+	}
+	return cond, nil
+}
+
+// parseFactor parses a chain of multiplicative operators and juxtaposed operands
+func (p *LaTeXParser) parseFactor() (*Conditional, error) {
+	cond, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op, ok := tok.multiplication()
+		if ok {
+			p.next()
+		} else if tok.startsOperand() && !p.atSliceColon() {
+			op = IMPLICIT_MULTIPLY
+		} else {
+			return cond, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		cond = binaryAt(cond, op, tok.pos, right)
+	}
+}
+
+// parseUnary parses a power with any leading signs, which apply to the result of the exponentiation as in
+// Power
+func (p *LaTeXParser) parseUnary() (*Conditional, error) {
+	var unary []*UnaryOp
+	for tok := p.peek(); tok.is('+') || tok.is('-'); tok = p.peek() {
+		p.next()
+		op := PLUS
+		if tok.is('-') {
+			op = MINUS
+		}
+		unary = append(unary, &UnaryOp{op: op, pos: tok.pos})
+	}
+	cond, err := p.parsePower()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(unary) - 1; i >= 0; i-- {
+		cond = unaryAt(unary[i].op, unary[i].pos, cond)
+	}
+	return cond, nil
+}
+
+// parsePower parses an operand followed by any superscript and postfix operators
+func (p *LaTeXParser) parsePower() (*Conditional, error) {
+	cond, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	raised := false
+	for {
+		tok := p.peek()
+		switch {
+		case tok.is('^'):
+			if raised {
+				return nil, &SyntaxError{Msg: "Double superscript", Pos: tok.pos}
+			}
+			p.next()
+			exp, err := p.parseArgument()
+			if err != nil {
+				return nil, err
+			}
+			cond, raised = binaryAt(cond, POW, tok.pos, exp), true
+		case tok.is('!'), tok.cmd == "%":
+			p.next()
+			op := FACTORIAL
+			if tok.cmd == "%" {
+				op = PERCENT
+			}
+			term := operandTerm(cond, false)
+			term.postfix = append(append([]*PostfixOp{}, term.postfix...), &PostfixOp{op: op, pos: tok.pos})
+			cond, raised = termConditional(&term), false
+		case tok.cmd == "left" && !tok.space && p.toks[p.i+1].is('['):
+			index, err := p.parseIndex()
+			if err != nil {
+				return nil, err
+			}
+			term := operandTerm(cond, true)
+			term.index = append(append([]*Index{}, term.index...), index)
+			cond, raised = termConditional(&term), false
+		default:
+			return cond, nil
+		}
+	}
+}
+
+// operandTerm returns a copy of the Term the Conditional consists of, with any indexes and postfix operators,
+// so that more can be appended, or else the Conditional parenthesised. An index can't follow a postfix operator
+func operandTerm(cond *Conditional, index bool) Term {
+	if exp := cond.soleExpression(); exp != nil && exp.op == nil && exp.factor.op == nil {
+		pow := exp.factor.power
+		if len(pow.unary) == 0 && pow.op == nil && pow.term.unit == nil && pow.term.currency == "" && (!index || len(pow.term.postfix) == 0) {
+			return *pow.term
+		}
+	}
+	return Term{exp: cond}
+}
+
+// parseIndex parses an index or slice in \left[ \right], whose colon is written {:} as in "\left[1{:}\right]"
+func (p *LaTeXParser) parseIndex() (*Index, error) {
+	p.next()
+	p.next()
+	index := &Index{}
+	var err error
+	if !p.atSliceColon() {
+		if index.from, err = p.parseDisjunction(); err != nil {
+			return nil, err
+		}
+	}
+	if p.atSliceColon() {
+		if p.readIf("{") {
+			p.next()
+			p.next()
+		} else {
+			p.next()
+		}
+		index.slice = true
+		if tok := p.peek(); tok.cmd != "right" {
+			if index.to, err = p.parseDisjunction(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return index, p.closeParens(true, "]")
+}
+
+// atSliceColon returns whether the next token is the colon of a slice, either as it is or in braces
+func (p *LaTeXParser) atSliceColon() bool {
+	if tok := p.peek(); tok.is(':') {
+		return true
+	} else if !tok.is('{') || p.i+2 >= len(p.toks) {
+		return false
+	}
+	return p.toks[p.i+1].is(':') && p.toks[p.i+2].is('}')
+}
+
+// parseArgument parses the argument of a command or superscript, which is a group in braces or else a single
+// token, so "x^23" is "x^2 3" and "\frac12" is "\frac{1}{2}"
+func (p *LaTeXParser) parseArgument() (*Conditional, error) {
+	tok := p.peek()
+	switch {
+	case tok.is('{'):
+		return p.parseGroup()
+	case tok.digit():
+		p.next()
+		return termConditional(&Term{number: &Number{str: string(tok.ch), val: big.NewRat(int64(tok.ch-'0'), 1)}}), nil
+	case tok.letter():
+		p.next()
+		return termConditional(&Term{ident: &Identifier{name: tok.name()}}), nil
+	}
+	return nil, p.unexpected(tok)
+}
+
+// name returns the name of the variable a letter or Greek letter stands for
+func (tok latexToken) name() string {
+	if tok.cmd != "" {
+		return tok.cmd
+	}
+	return string(tok.ch)
+}
+
+// parseGroup parses a Conditional in braces, which group without being parenthesised in the AST
+func (p *LaTeXParser) parseGroup() (*Conditional, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	cond, err := p.parseDisjunction()
+	if err != nil {
+		return nil, err
+	}
+	return cond, p.expect("}")
+}
+
+// termConditional returns a Conditional holding only the given Term
+func termConditional(term *Term) *Conditional {
+	return conditionalOf(&Expression{factor: &Factor{power: &Power{term: term}}})
+}
+
+// parseOperand parses a number, variable, call, fraction, root or parenthesised Conditional
+func (p *LaTeXParser) parseOperand() (*Conditional, error) {
+	tok := p.peek()
+	switch {
+	case tok.digit():
+		return p.parseNumber()
+	case tok.letter():
+		p.next()
+		name, err := p.parseSubscript(tok.name())
+		if err != nil {
+			return nil, err
+		}
+		return p.parseName(name, tok.pos)
+	case tok.is('{'):
+		return p.parseGroup()
+	case tok.is('('), tok.cmd == "left", tok.cmd == "lfloor":
+		return p.parseParens()
+	}
+
+	switch tok.cmd {
+	case "frac", "dfrac", "tfrac":
+		p.next()
+		num, err := p.parseArgument()
+		if err != nil {
+			return nil, err
+		}
+		den, err := p.parseArgument()
+		if err != nil {
+			return nil, err
+		}
+		return binaryAt(num, DIVIDE, tok.pos, den), nil
+	case "sqrt":
+		return p.parseRoot()
+	case "mathrm", "operatorname":
+		p.next()
+		name, err := p.parseText()
+		if err != nil {
+			return nil, err
+		}
+		if name, err = p.parseSubscript(name); err != nil {
+			return nil, err
+		}
+		if tok.cmd == "operatorname" && !p.startsCall() {
+			next := p.peek()
+			return nil, &SyntaxError{Msg: fmt.Sprintf("Expected arguments to %s, got %s", name, next), Pos: next.pos}
+		}
+		return p.parseName(name, tok.pos)
+	case "log":
+		return p.parseLog()
+	case "begin":
+		return p.parseEnvironment()
+	}
+	if name, ok := latexCommands[tok.cmd]; ok {
+		p.next()
+		return p.parseFunction(name, tok.pos, nil)
+	}
+	return nil, p.unexpected(tok)
+}
+
+// parseNumber parses digits with an optional fractional part, without whitespace between them
+func (p *LaTeXParser) parseNumber() (*Conditional, error) {
+	start := p.next()
+	str := string(start.ch)
+	for tok := p.peek(); !tok.space && (tok.digit() || tok.is('.')); tok = p.peek() {
+		str += string(p.next().ch)
+	}
+	val, ok := new(big.Rat).SetString(str)
+	if !ok || strings.HasSuffix(str, ".") {
+		return nil, &SyntaxError{Msg: "Invalid number " + str, Pos: start.pos}
+	}
+	return termConditional(&Term{number: &Number{str: str, val: val}}), nil
+}
+
+// parseSubscript parses any subscript after a name, returning the name with the subscript appended after an
+// underscore. A subscript is a single letter or digit, or a group of them, Greek letters and \mathrm names
+func (p *LaTeXParser) parseSubscript(name string) (string, error) {
+	tok := p.peek()
+	if !tok.is('_') {
+		return name, nil
+	}
+	p.next()
+
+	arg := p.peek()
+	switch {
+	case arg.letter() || arg.digit():
+		p.next()
+		return name + "_" + arg.name(), nil
+	case !arg.is('{'):
+		return "", &SyntaxError{Msg: "Expected subscript, got " + arg.String(), Pos: arg.pos}
+	}
+
+	p.next()
+	sub := ""
+	for arg = p.peek(); !arg.is('}'); arg = p.peek() {
+		switch {
+		case arg.cmd == "mathrm":
+			p.next()
+			text, err := p.parseText()
+			if err != nil {
+				return "", err
+			}
+			sub += text
+		case arg.letter() || arg.digit():
+			p.next()
+			sub += arg.name()
+		default:
+			return "", &SyntaxError{Msg: "Invalid subscript " + arg.String(), Pos: arg.pos}
+		}
+	}
+	p.next()
+	if sub == "" {
+		return "", &SyntaxError{Msg: "Empty subscript", Pos: tok.pos}
+	}
+	return name + "_" + sub, nil
+}
+
+// parseText parses the braced name of \mathrm or \operatorname, in which "\_" is an underscore
+func (p *LaTeXParser) parseText() (string, error) {
+	open := p.peek()
+	if err := p.expect("{"); err != nil {
+		return "", err
+	}
+	name := ""
+	for tok := p.peek(); !tok.is('}'); tok = p.peek() {
+		switch {
+		case tok.cmd == "_":
+			name += "_"
+		case tok.cmd == "" && tok.ch != eof && !tok.space:
+			name += string(tok.ch)
+		default:
+			return "", &SyntaxError{Msg: "Invalid name " + tok.String(), Pos: tok.pos}
+		}
+		p.next()
+	}
+	p.next()
+	if !isIdentifier(name) {
+		return "", &SyntaxError{Msg: fmt.Sprintf("Invalid name %q", name), Pos: open.pos}
+	}
+	return name, nil
+}
+
+// startsCall returns whether the next token directly opens a parenthesis, making the name before it a call
+func (p *LaTeXParser) startsCall() bool {
+	tok := p.peek()
+	if tok.space {
+		return false
+	}
+	if tok.is('(') {
+		return true
+	}
+	return tok.cmd == "left" && p.toks[p.i+1].is('(')
+}
+
+// parseName returns the variable with the given name, or a call to it if a parenthesis follows directly
+func (p *LaTeXParser) parseName(name string, pos int) (*Conditional, error) {
+	if !p.startsCall() {
+		return termConditional(&Term{ident: &Identifier{name: name}}), nil
+	}
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+	return termConditional(&Term{call: &Call{name: name, args: args, pos: pos}}), nil
+}
+
+// latexClosers holds the closing delimiter of each opening one LaTeXParser reads, as readIf takes it
+var latexClosers = map[string]string{"(": ")", "|": "|", "[": "]", "lfloor": "rfloor"}
+
+// parseParens parses a Conditional in parentheses, its absolute value in \left| \right|, a list in
+// \left[ \right], or an integer division as the floor of a \frac, which is how Conditional.LaTeX writes one
+func (p *LaTeXParser) parseParens() (*Conditional, error) {
+	open := p.next()
+	left := open.cmd == "left"
+	if left {
+		open = p.next()
+	}
+	delim := open.cmd
+	if delim == "" {
+		delim = string(open.ch)
+	}
+	close, ok := latexClosers[delim]
+	if !ok || (open.is('|') || open.is('[')) && !left {
+		return nil, &SyntaxError{Msg: "Unsupported delimiter " + open.String(), Pos: open.pos}
+	}
+
+	if open.is('[') {
+		list := &ListLiteral{}
+		for empty := p.peek().cmd == "right"; !empty; {
+			elem, err := p.parseDisjunction()
+			if err != nil {
+				return nil, err
+			}
+			if list.elems = append(list.elems, elem); !p.readIf(",") {
+				break
+			}
+		}
+		return termConditional(&Term{list: list}), p.closeParens(left, close)
+	}
+
+	cond, err := p.parseDisjunction()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.closeParens(left, close); err != nil {
+		return nil, err
+	}
+	switch {
+	case open.is('|'):
+		return termConditional(&Term{call: &Call{name: "abs", args: []*Conditional{cond}, pos: open.pos}}), nil
+	case open.cmd == "lfloor":
+		return floorDivision(cond, open.pos)
+	}
+	return termConditional(&Term{exp: cond}), nil
+}
+
+// floorDivision returns the floor of a chain of products ending in a division, which is the chain ending in an
+// integer division instead
+func floorDivision(cond *Conditional, pos int) (*Conditional, error) {
+	var last *MultiplyOp
+	if exp := cond.soleExpression(); exp != nil && exp.op == nil {
+		for fac := exp.factor; fac.op != nil; fac = fac.factor {
+			last = fac.op
+		}
+	}
+	if last == nil || last.op != DIVIDE {
+		return nil, &SyntaxError{Msg: `Unsupported \lfloor other than of a \frac`, Pos: pos}
+	}
+	last.op = INT_DIVIDE
+	return cond, nil
+}
+
+// closeParens reads the delimiter close, which is \right'd if left is set
+func (p *LaTeXParser) closeParens(left bool, close string) error {
+	if !left {
+		return p.expect(close)
+	}
+	written := close
+	if len(close) > 1 {
+		written = `\` + close
+	}
+	if tok := p.peek(); tok.cmd != "right" || !p.toks[p.i+1].matches(close) {
+		return &SyntaxError{Msg: fmt.Sprintf(`Expected "\right%s", got %s`, written, tok), Pos: tok.pos}
+	}
+	p.next()
+	p.next()
+	return nil
+}
+
+// parseEnvironment parses a \begin{cases} environment as a Piecewise, or a \begin{bmatrix} environment as a
+// list of its rows
+func (p *LaTeXParser) parseEnvironment() (*Conditional, error) {
+	begin := p.next()
+	name, err := p.parseText()
+	if err != nil {
+		return nil, err
+	}
+	var cond *Conditional
+	switch name {
+	case "cases":
+		cond, err = p.parseCases()
+	case "bmatrix":
+		cond, err = p.parseMatrix()
+	default:
+		return nil, &SyntaxError{Msg: "Unsupported environment " + name, Pos: begin.pos}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	end := p.peek()
+	if !p.readIf("end") {
+		return nil, &SyntaxError{Msg: fmt.Sprintf(`Expected "\end{%s}", got %s`, name, end), Pos: end.pos}
+	}
+	if closing, err := p.parseText(); err != nil {
+		return nil, err
+	} else if closing != name {
+		return nil, &SyntaxError{Msg: fmt.Sprintf(`Expected "\end{%s}", got "\end{%s}"`, name, closing), Pos: end.pos}
+	}
+	return cond, nil
+}
+
+// parseCases parses the rows of a cases environment, each a value and "\text{if } condition", and optionally a
+// last row of a value and "\text{otherwise}"
+func (p *LaTeXParser) parseCases() (*Conditional, error) {
+	pw := &Piecewise{}
+	for pw.els == nil {
+		value, err := p.parseDisjunction()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect("&"); err != nil {
+			return nil, err
+		}
+		text := p.peek()
+		words, err := p.parseWords()
+		if err != nil {
+			return nil, err
+		}
+		switch words {
+		case "if":
+			cond, err := p.parseDisjunction()
+			if err != nil {
+				return nil, err
+			}
+			pw.cases = append(pw.cases, &Case{cond: cond, value: value})
+		case "otherwise":
+			if len(pw.cases) == 0 {
+				return nil, &SyntaxError{Msg: "Expected a case before otherwise", Pos: text.pos}
+			}
+			pw.els = value
+		default:
+			return nil, &SyntaxError{Msg: fmt.Sprintf(`Expected "\text{if }" or "\text{otherwise}", got %q`, words), Pos: text.pos}
+		}
+		if !p.readRowEnd() {
+			break
+		}
+	}
+	return termConditional(&Term{piecewise: pw}), nil
+}
+
+// parseWords parses \text{...} and returns its words, separated by single spaces
+func (p *LaTeXParser) parseWords() (string, error) {
+	if err := p.expect("text"); err != nil {
+		return "", err
+	}
+	if err := p.expect("{"); err != nil {
+		return "", err
+	}
+	var words []string
+	for tok := p.next(); !tok.is('}'); tok = p.next() {
+		switch {
+		case tok.cmd != "" || tok.is(eof):
+			return "", &SyntaxError{Msg: "Unexpected " + tok.String() + " in text", Pos: tok.pos}
+		case tok.space || len(words) == 0:
+			words = append(words, string(tok.ch))
+		default:
+			words[len(words)-1] += string(tok.ch)
+		}
+	}
+	return strings.Join(words, " "), nil
+}
+
+// parseMatrix parses the rows of a bmatrix environment, with cells separated by & and rows by \\
+func (p *LaTeXParser) parseMatrix() (*Conditional, error) {
+	matrix := &ListLiteral{}
+	for {
+		row := &ListLiteral{}
+		for {
+			cell, err := p.parseDisjunction()
+			if err != nil {
+				return nil, err
+			}
+			if row.elems = append(row.elems, cell); !p.readIf("&") {
+				break
+			}
+		}
+		matrix.elems = append(matrix.elems, termConditional(&Term{list: row}))
+		if !p.readRowEnd() {
+			return termConditional(&Term{list: matrix}), nil
+		}
+	}
+}
+
+// parseArgs parses a parenthesised, comma separated argument list
+func (p *LaTeXParser) parseArgs() (args []*Conditional, err error) {
+	left := p.readIf("left")
+	if err = p.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		arg, err := p.parseDisjunction()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.readIf(",") {
+			return args, p.closeParens(left, ")")
+		}
+	}
+}
+
+// parseFunction parses the arguments of a function command, with any superscript raising the result, as in
+// "\sin^2 x". The arguments are parenthesised, or else the following power. Those of \min and \max are
+// passed as a list, as the builtins take one
+func (p *LaTeXParser) parseFunction(name string, pos int, base *Conditional) (*Conditional, error) {
+	var exp *Conditional
+	caret := p.peek()
+	if caret.is('^') {
+		p.next()
+		var err error
+		if exp, err = p.parseArgument(); err != nil {
+			return nil, err
+		}
+	}
+
+	var args []*Conditional
+	var err error
+	if tok := p.peek(); tok.is('(') || (tok.cmd == "left" && p.toks[p.i+1].is('(')) {
+		args, err = p.parseArgs()
+	} else {
+		var arg *Conditional
+		arg, err = p.parsePower()
+		args = []*Conditional{arg}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if base != nil {
+		args = append([]*Conditional{base}, args...)
+	}
+	if (name == "min" || name == "max") && len(args) > 1 {
+		args = []*Conditional{termConditional(&Term{list: &ListLiteral{elems: args}})}
+	}
+
+	cond := termConditional(&Term{call: &Call{name: name, args: args, pos: pos}})
+	if exp != nil {
+		cond = binaryAt(cond, POW, caret.pos, exp)
+	}
+	return cond, nil
+}
+
+// parseLog parses \log, which needs a base, as in "\log_{2} x". Base 10 is log10
+func (p *LaTeXParser) parseLog() (*Conditional, error) {
+	tok := p.next()
+	if !p.readIf("_") {
+		next := p.peek()
+		return nil, &SyntaxError{Msg: `Expected base after \log, as in \log_{2}`, Pos: next.pos}
+	}
+	base, err := p.parseArgument()
+	if err != nil {
+		return nil, err
+	}
+	if isNumber(base, 10) {
+		return p.parseFunction("log10", tok.pos, nil)
+	}
+	return p.parseFunction("log", tok.pos, base)
+}
+
+// parseRoot parses \sqrt{x}, which is sqrt(x), or \sqrt[n]{x}, which is x^(1/n)
+func (p *LaTeXParser) parseRoot() (*Conditional, error) {
+	tok := p.next()
+	var degree *Conditional
+	if p.readIf("[") {
+		var err error
+		if degree, err = p.parseDisjunction(); err != nil {
+			return nil, err
+		}
+		if err = p.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+	radicand, err := p.parseArgument()
+	if err != nil {
+		return nil, err
+	}
+	if degree != nil {
+		return binaryAt(radicand, POW, tok.pos, binaryAt(numberConditional(1), DIVIDE, tok.pos, degree)), nil
+	}
+	return termConditional(&Term{call: &Call{name: "sqrt", args: []*Conditional{radicand}, pos: tok.pos}}), nil
+}
@@ -0,0 +1,212 @@
+package mathval
+
+import (
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type LaTeXParserSuite struct{}
+
+var _ = Suite(&LaTeXParserSuite{})
+
+// parseLaTeX parses the LaTeX with a new LaTeXParser
+func parseLaTeX(input string) (*Conditional, error) {
+	return NewLaTeXParser(strings.NewReader(input)).Parse()
+}
+
+func (l *LaTeXParserSuite) TestParse(c *C) {
+	// Formulas are printed in mathval's syntax
+	expected := []EvalResult{
+		{input: `\frac{a + b}{2}`, expected: "(a + b) / 2"},
+		{input: `\frac12 + \dfrac{x}{y z}`, expected: "1 / 2 + x / (y z)"},
+		{input: `2x^2 + 3xy - 1`, expected: "2 x^2 + 3 x y - 1"},
+		{input: `x^23`, expected: "x^2 3"},
+		{input: `x^{y^{z}}`, expected: "x^y^z"},
+		{input: `\left(x^{y}\right)^{z}`, expected: "(x^y)^z"},
+		{input: `-2^{2}`, expected: "-2^2"},
+		{input: `a \cdot b \times c \div d`, expected: "a * b * c / d"},
+		{input: `a - \left(b - c\right)`, expected: "a - (b - c)"},
+		{input: `2\pi r`, expected: "2 pi r"},
+		{input: `x_1 + x_{max} + \theta_{0} + x_{\mathrm{min}} + \alpha_i`, expected: "x_1 + x_max + theta_0 + x_min + alpha_i"},
+		{input: `\mathrm{rate} \cdot \mathrm{my\_var}`, expected: "rate * my_var"},
+		{input: `\sqrt{x^2 + 1} + \sqrt[3]{8}`, expected: "sqrt(x^2 + 1) + 8^(1 / 3)"},
+		{input: `\sin x + \sin\left(2 x\right) + \sin x^2`, expected: "sin(x) + sin(2 x) + sin(x^2)"},
+		{input: `\sin^2 x + \cos^{2}(x)`, expected: "sin(x)^2 + cos(x)^2"},
+		{input: `\log_{2} 8 + \log_{10}(x) + \ln x`, expected: "log(2, 8) + log10(x) + ln(x)"},
+		{input: `\arctan\left(1\right) + \max(a, b) + \exp(1)`, expected: "atan(1) + max([a, b]) + exp(1)"},
+		{input: `f(x, y) + \operatorname{rate}\left(x\right) + x \left(a + b\right) + x(y)`, expected: "f(x, y) + rate(x) + x (a + b) + x(y)"},
+		{input: `\left|x - 1\right|`, expected: "abs(x - 1)"},
+		{input: `n! + \left(n + 1\right)! + 50\%`, expected: "n! + (n + 1)! + 50%"},
+		{input: `x^{2}!`, expected: "(x^2)!"},
+		{input: `a \bmod b`, expected: "a % b"},
+		{input: `x \leq 1`, expected: "x <= 1"},
+		{input: `x = 1 \lor \lnot y \neq 2 \land z \leq 3`, expected: "x == 1 or not y != 2 and z <= 3"},
+		{input: `\lnot \lnot a \wedge b \vee c`, expected: "not not a and b or c"},
+		{input: `\left\lfloor\frac{7}{2}\right\rfloor + \lfloor \frac{a \cdot b}{c} \rfloor`, expected: "7 \\ 2 + a * b \\ c"},
+		{input: `\left[1, 2 x, 3\right] + \left[\right]`, expected: "[1, 2 x, 3] + []"},
+		{input: `\begin{bmatrix} 1 & 2 \\ 3 & 4 \end{bmatrix} x`, expected: "[[1, 2], [3, 4]] x"},
+		{input: `\mathrm{xs}\left[0\right] + \mathrm{xs}\left[1{:}\right] - \mathrm{xs}\left[{:}-1\right]`, expected: "xs[0] + xs[1:] - xs[:-1]"},
+		{input: `n!\left[2\right] + x \left[2\right]`, expected: "(n!)[2] + x [2]"},
+		{input: `\begin{cases} -x & \text{if } x < 0 \\ x & \text{otherwise} \end{cases}`, expected: "piecewise(x < 0: -x, else: x)"},
+		{input: `\begin{cases} 1 & \text{if } a \\ 2 & \text{if } b \end{cases}`, expected: "piecewise(a: 1, b: 2)"},
+		{input: `a + b = c \neq`, expected: ""},
+		{input: `{a + b} c`, expected: "(a + b) c"},
+		{input: "1.5 \\, x % a comment\n + 2", expected: "1.5 x + 2"},
+	}
+	for _, res := range expected {
+		cond, err := parseLaTeX(res.input)
+		if res.expected == "" {
+			c.Assert(err, NotNil, Commentf(res.input))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(cond.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (l *LaTeXParserSuite) TestEval(c *C) {
+	expected := []EvalResult{
+		{input: `\frac{1}{2} + \frac{1}{3}`, expected: "5/6"},
+		{input: `2 \cdot 3^{2}`, expected: "18"},
+		{input: `-2^{2}`, expected: "-4"},
+		{input: `\sqrt{16} + \sqrt{9}`, expected: "7"},
+		{input: `\left\lfloor \frac{x \cdot y}{4} \right\rfloor`, expected: "3"},
+		{input: `\begin{cases} 1 & \text{if } x < 0 \\ 2 & \text{if } x < 5 \\ 3 & \text{otherwise} \end{cases}`, expected: "2"},
+		{input: `x > 0 \land \lnot y < 0`, expected: "true"},
+		{input: `\left[x, y, 7\right]\left[1{:}\right]`, expected: "[5, 7]"},
+		{input: `\begin{bmatrix} 1 & 0 \\ 0 & 2 \end{bmatrix} \cdot \begin{bmatrix} x \\ y \end{bmatrix}`, expected: "[[3], [10]]"},
+		{input: `\frac{x + 1}{x - 1}`, expected: "2"},
+		{input: `x_1 y`, expected: "10"},
+		{input: `\left|1 - x\right| \times 4!`, expected: "48"},
+		{input: `3 x_{1} = 6`, expected: "true"},
+		{input: `\log_{2}\left(8\right)`, expected: "3"},
+		{input: `\max(x, x_1, 4)`, expected: "4"},
+	}
+	ev := NewEvaluator()
+	ev.Set("x", NewNumberValue(big.NewRat(3, 1)))
+	ev.Set("y", NewNumberValue(big.NewRat(5, 1)))
+	ev.Set("x_1", NewNumberValue(big.NewRat(2, 1)))
+	for _, res := range expected {
+		cond, err := parseLaTeX(res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		val, err := ev.Eval(cond)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (l *LaTeXParserSuite) TestRoundTrip(c *C) {
+	// Printing as LaTeX and reading it back gives the same formula
+	inputs := []string{
+		"(a + b) / 2",
+		"a * b / c * d",
+		"x^2 + y^(n - 1)",
+		"(a / b)^2",
+		"(-2)^2",
+		"a - (b - c) + (d + e)",
+		"sqrt(x^2 + 1) * x^(1 / 3)",
+		"sin(x)^2 + cos(x)^2",
+		"log(2, 8) + log10(x) + ln(x)",
+		"abs(x - 1) + f(x) + rate(x, 2)",
+		"n! + (n + 1)! + 50%",
+		"x_1 + x_max + alpha + theta_0 + pi r^2",
+		"x <= 2 y",
+		"xs[0] + [1, 2][i:] * [[1, 2], [3, 4]]",
+		"7 \\ 2 + a * b \\ c",
+		"not (a or b) and c",
+	}
+	for _, input := range inputs {
+		parser := NewParser(strings.NewReader(input))
+		parser.SetMode(ImplicitMultiplication)
+		cond, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(input))
+
+		latex := cond.LaTeX()
+		read, err := parseLaTeX(latex)
+		c.Assert(err, IsNil, Commentf(latex))
+		c.Assert(read.String(), Equals, cond.String(), Commentf(latex))
+	}
+}
+
+func (l *LaTeXParserSuite) TestErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: `\frac{1}{2} + \int x`, err: `Unsupported command \int at offset 14`},
+		{input: `x \infty`, err: `Unsupported command \infty at offset 2`},
+		{input: `\left\{x\right\}`, err: `Unsupported delimiter \{ at offset 5`},
+		{input: `\lfloor x \rfloor`, err: `Unsupported \lfloor other than of a \frac at offset 0`},
+		{input: `\begin{align} x \end{align}`, err: `Unsupported environment align at offset 0`},
+		{input: `\begin{cases} 1 & \text{if } x \end{bmatrix}`, err: `Expected "\end{cases}", got "\end{bmatrix}" at offset 31`},
+		{input: `\begin{cases} 1 & \text{otherwise} \end{cases}`, err: `Expected a case before otherwise at offset 18`},
+		{input: `\begin{cases} 1 & \text{when } x \end{cases}`, err: `Expected "\text{if }" or "\text{otherwise}", got "when" at offset 18`},
+		{input: `\frac{1}{2`, err: `Expected "}", got EOF at offset 10`},
+		{input: `\left(x + 1)`, err: `Expected "\right)", got ")" at offset 11`},
+		{input: `x^2^3`, err: `Double superscript at offset 3`},
+		{input: `2 + `, err: `Unexpected EOF at offset 4`},
+		{input: `a + }`, err: `Unexpected "}" at offset 4`},
+		{input: `x \cdot \cdot y`, err: `Unexpected \cdot at offset 8`},
+		{input: `\log x`, err: `Expected base after \log, as in \log_{2} at offset 5`},
+		{input: `\operatorname{rate} x`, err: `Expected arguments to rate, got "x" at offset 20`},
+		{input: `\mathrm{and}`, err: `Invalid name "and" at offset 7`},
+		{input: `x_{i + 1}`, err: `Invalid subscript "+" at offset 5`},
+		{input: `1.2.3`, err: `Invalid number 1.2.3 at offset 0`},
+		{input: `2_1`, err: `Unexpected "_" at offset 1`},
+	}
+	for _, res := range expected {
+		_, err := parseLaTeX(res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+
+	_, err := parseLaTeX(`\sqrt{x} \oint`)
+	syntax, ok := err.(*SyntaxError)
+	c.Assert(ok, Equals, true)
+	c.Assert(syntax.Pos, Equals, 9)
+}
+
+func (l *LaTeXParserSuite) TestGoldenRoundTrip(c *C) {
+	// The formulas in latex.golden whose LaTeX can't be read back, by the error reading it
+	unsupported := map[string]string{
+		"sum(k, 1, n, k^2) + prod(k, 1, n, k + 1)": `Unsupported command \sum at offset 0`,
+		"2 * sum(k, 1, n, k)":                      `Unsupported command \sum at offset 14`,
+		"map(xs, x -> x^2)":                        `Unsupported command \mapsto at offset 39`,
+		"(a, b) -> a + b":                          `Expected "\right)", got "," at offset 7`,
+		"5 km/h to m/s":                            `Unsupported command \rightarrow at offset 26`,
+		"100 USD + 50 EUR to GBP":                  `Unsupported command \rightarrow at offset 37`,
+		"2024-03-15T10:30:00Z + 2h30m":             `Unexpected \text at offset 0`,
+		"sum(A1:B10)":                              `Unexpected \text at offset 24`,
+		"f(x, y) = x^2 + y; f(3, 4) * 2":           `Unexpected \\ at offset 31`,
+	}
+
+	// Units read back as variables
+	readAs := map[string]string{"2 m * 3 m^2": `2 m \cdot 3 m^{2}`}
+
+	data, err := os.ReadFile("testdata/latex.golden")
+	c.Assert(err, IsNil)
+	for _, block := range strings.Split(strings.TrimSpace(string(data)), "\n\n") {
+		lines := strings.Split(block, "\n")
+		for strings.HasPrefix(lines[0], "#") {
+			lines = lines[1:]
+		}
+		input := lines[0]
+		prog, err := parseProgram(input)
+		c.Assert(err, IsNil, Commentf(input))
+		latex := prog.LaTeX()
+
+		read, err := parseLaTeX(latex)
+		if msg, ok := unsupported[input]; ok {
+			c.Check(err, ErrorMatches, regexp.QuoteMeta(msg), Commentf(latex))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf(latex))
+		if expected, ok := readAs[input]; ok {
+			latex = expected
+		}
+		c.Check(read.LaTeX(), Equals, latex, Commentf(input))
+	}
+}
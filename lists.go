@@ -0,0 +1,305 @@
+package mathval
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// isList returns whether the value is a ListValue
+func isList(val Value) bool {
+	_, ok := val.(*ListValue)
+	return ok
+}
+
+// broadcast applies the arithmetic operator element-wise. Two lists must have the same length, and a scalar
+// is applied to every element of a list. Nested lists broadcast recursively
+func broadcast(op Token, a, b Value) (Value, error) {
+	x, xList := a.(*ListValue)
+	y, yList := b.(*ListValue)
+
+	var res []Value
+	switch {
+	case xList && yList:
+		if len(x.elems) != len(y.elems) {
+			return nil, dimensionError("Cannot apply %s to lists of length %d and %d", op, len(x.elems), len(y.elems))
+		}
+		res = make([]Value, len(x.elems))
+		for i := range x.elems {
+			val, err := arithmetic(op, x.elems[i], y.elems[i])
+			if err != nil {
+				return nil, err
+			}
+			res[i] = val
+		}
+	case xList:
+		res = make([]Value, len(x.elems))
+		for i := range x.elems {
+			val, err := arithmetic(op, x.elems[i], b)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = val
+		}
+	default:
+		res = make([]Value, len(y.elems))
+		for i := range y.elems {
+			val, err := arithmetic(op, a, y.elems[i])
+			if err != nil {
+				return nil, err
+			}
+			res[i] = val
+		}
+	}
+	return &ListValue{elems: res}, nil
+}
+
+// evalIndex applies the Index to the value, which must be a list. Negative indexes count back from the end
+// of the list, so "xs[-1]" is the last element. Slice bounds are clamped to the list like Python's, but a
+// single index must be in range
+func (ev *Evaluator) evalIndex(val Value, index *Index) (Value, error) {
+	if m, ok := val.(*MatrixValue); ok {
+		return ev.evalMatrixIndex(m, index)
+	}
+	list, err := toList(val)
+	if err != nil {
+		return nil, err
+	}
+	n := len(list.elems)
+
+	bound := func(cond *Conditional, def int) (int, error) {
+		if cond == nil {
+			return def, nil
+		}
+		val, err := ev.evalConditional(cond)
+		if err != nil {
+			return 0, err
+		}
+		r, err := toRat(val)
+		if err != nil {
+			return 0, err
+		}
+		if !r.IsInt() || !r.Num().IsInt64() {
+			return 0, fmt.Errorf("Invalid index %s", val)
+		}
+		i := r.Num().Int64()
+		if i < 0 {
+			i += int64(n)
+		}
+		if index.slice {
+			if i < 0 {
+				i = 0
+			} else if i > int64(n) {
+				i = int64(n)
+			}
+		} else if i < 0 || i >= int64(n) {
+			return 0, fmt.Errorf("Index %s out of range for list of length %d", val, n)
+		}
+		return int(i), nil
+	}
+
+	from, err := bound(index.from, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !index.slice {
+		return list.elems[from], nil
+	}
+	to, err := bound(index.to, n)
+	if err != nil {
+		return nil, err
+	}
+	if to < from {
+		to = from
+	}
+	return NewListValue(list.elems[from:to]...), nil
+}
+
+// evalMatrixIndex applies the Index to the rows of the matrix. A slice of a matrix is also a matrix, unless
+// it is empty
+func (ev *Evaluator) evalMatrixIndex(m *MatrixValue, index *Index) (Value, error) {
+	val, err := ev.evalIndex(m.list(), index)
+	if err != nil {
+		return nil, err
+	}
+	if list, ok := val.(*ListValue); ok && index.slice {
+		if sub, ok := matrixOf(list); ok {
+			return sub, nil
+		}
+	}
+	return val, nil
+}
+
+// aggregate evaluates the single list argument of the named aggregate builtin, returning its elements as
+// rationals along with their combined precision
+func (ev *Evaluator) aggregate(name string, args []*Conditional) ([]*big.Rat, uint, error) {
+	if len(args) != 1 {
+		return nil, 0, fmt.Errorf("%s expects 1 argument, got %d", name, len(args))
+	}
+	val, err := ev.evalConditional(args[0])
+	if err != nil {
+		return nil, 0, err
+	}
+	list, err := toList(val)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %s", name, err)
+	}
+
+	rats := make([]*big.Rat, len(list.elems))
+	for i, elem := range list.elems {
+		if rats[i], err = toRat(elem); err != nil {
+			return nil, 0, fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return rats, precOf(list.elems...), nil
+}
+
+// builtinLen implements len(list), returning the number of elements
+func builtinLen(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("len expects 1 argument, got %d", len(args))
+	}
+	val, err := ev.evalConditional(args[0])
+	if err != nil {
+		return nil, err
+	}
+	list, err := toList(val)
+	if err != nil {
+		return nil, fmt.Errorf("len: %s", err)
+	}
+	return NewNumberValue(big.NewRat(int64(len(list.elems)), 1)), nil
+}
+
+// builtinFlatten implements flatten(list), returning the elements of the list with any nested lists and
+// matrices replaced by their elements, recursively
+func builtinFlatten(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("flatten expects 1 argument, got %d", len(args))
+	}
+	val, err := ev.evalConditional(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := val.(*MatrixValue); ok {
+		val = m.list()
+	}
+	list, err := toList(val)
+	if err != nil {
+		return nil, fmt.Errorf("flatten: %s", err)
+	}
+	return &ListValue{elems: flatten(nil, list.elems)}, nil
+}
+
+// flatten appends the values to elems, replacing lists and matrices with their elements, recursively
+func flatten(elems, vals []Value) []Value {
+	for _, val := range vals {
+		if m, ok := val.(*MatrixValue); ok {
+			val = m.list()
+		}
+		if list, ok := val.(*ListValue); ok {
+			elems = flatten(elems, list.elems)
+		} else {
+			elems = append(elems, val)
+		}
+	}
+	return elems
+}
+
+// builtinSum implements sum(list), which is 0 for an empty list, and sum(k, lo, hi, body), see series
+func builtinSum(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) == 4 {
+		return ev.series("sum", args)
+	} else if len(args) != 1 {
+		return nil, fmt.Errorf("sum expects 1 or 4 arguments, got %d", len(args))
+	}
+	rats, prec, err := ev.aggregate("sum", args)
+	if err != nil {
+		return nil, err
+	}
+	return numberOf(sumOf(rats), prec), nil
+}
+
+// builtinProduct implements product(list), which is 1 for an empty list
+func builtinProduct(ev *Evaluator, args []*Conditional) (Value, error) {
+	rats, prec, err := ev.aggregate("product", args)
+	if err != nil {
+		return nil, err
+	}
+	res := big.NewRat(1, 1)
+	for _, r := range rats {
+		res.Mul(res, r)
+	}
+	return numberOf(res, prec), nil
+}
+
+// builtinMean implements mean(list), the arithmetic mean
+func builtinMean(ev *Evaluator, args []*Conditional) (Value, error) {
+	rats, prec, err := ev.aggregate("mean", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rats) == 0 {
+		return nil, errors.New("mean: Empty list")
+	}
+	res := sumOf(rats)
+	return numberOf(res.Quo(res, big.NewRat(int64(len(rats)), 1)), prec), nil
+}
+
+// builtinMedian implements median(list). A list with an even number of elements has the mean of the middle
+// two as its median
+func builtinMedian(ev *Evaluator, args []*Conditional) (Value, error) {
+	rats, prec, err := ev.aggregate("median", args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rats) == 0 {
+		return nil, errors.New("median: Empty list")
+	}
+
+	sort.Slice(rats, func(i, j int) bool { return rats[i].Cmp(rats[j]) < 0 })
+	mid := len(rats) / 2
+	if len(rats)%2 == 1 {
+		return numberOf(new(big.Rat).Set(rats[mid]), prec), nil
+	}
+	res := new(big.Rat).Add(rats[mid-1], rats[mid])
+	return numberOf(res.Quo(res, big.NewRat(2, 1)), prec), nil
+}
+
+// builtinMin implements min(list)
+func builtinMin(ev *Evaluator, args []*Conditional) (Value, error) {
+	return ev.extreme("min", args, -1)
+}
+
+// builtinMax implements max(list)
+func builtinMax(ev *Evaluator, args []*Conditional) (Value, error) {
+	return ev.extreme("max", args, 1)
+}
+
+// extreme returns the element of the list comparing as sign against every other element
+func (ev *Evaluator) extreme(name string, args []*Conditional, sign int) (Value, error) {
+	rats, prec, err := ev.aggregate(name, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rats) == 0 {
+		return nil, fmt.Errorf("%s: Empty list", name)
+	}
+
+	res := rats[0]
+	for _, r := range rats[1:] {
+		if r.Cmp(res) == sign {
+			res = r
+		}
+	}
+	return numberOf(new(big.Rat).Set(res), prec), nil
+}
+
+// sumOf returns the sum of the rationals
+func sumOf(rats []*big.Rat) *big.Rat {
+	res := new(big.Rat)
+	for _, r := range rats {
+		res.Add(res, r)
+	}
+	return res
+}
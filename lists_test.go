@@ -0,0 +1,100 @@
+package mathval
+
+import (
+	"regexp"
+
+	. "gopkg.in/check.v1"
+)
+
+type ListsSuite struct{}
+
+var _ = Suite(&ListsSuite{})
+
+func (l *ListsSuite) TestLists(c *C) {
+	expected := []EvalResult{
+		{input: "[1, 2, 3]", expected: "[1, 2, 3]"},
+		{input: "[]", expected: "[]"},
+		{input: "[1 + 1, [2, 3], 1 < 2]", expected: "[2, [2, 3], true]"},
+		{input: "[10, 20, 30][0]", expected: "10"},
+		{input: "[10, 20, 30][-1]", expected: "30"},
+		{input: "[[1, 2], [3, 4]][1][0]", expected: "3"},
+		{input: "[1, 2, 3, 4][1:3]", expected: "[2, 3]"},
+		{input: "[1, 2, 3, 4][:2]", expected: "[1, 2]"},
+		{input: "[1, 2, 3, 4][2:]", expected: "[3, 4]"},
+		{input: "[1, 2, 3, 4][-2:]", expected: "[3, 4]"},
+		{input: "[1, 2, 3, 4][:]", expected: "[1, 2, 3, 4]"},
+		{input: "[1, 2, 3, 4][3:1]", expected: "[]"},
+		{input: "[1, 2, 3, 4][1:100]", expected: "[2, 3, 4]"},
+		{input: "[1, 2, 3][1]!", expected: "2"},
+		{input: "len([1, 2, 3])", expected: "3"},
+		{input: "len([])", expected: "0"},
+	}
+	for _, res := range expected {
+		val, err := evaluate(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (l *ListsSuite) TestBroadcast(c *C) {
+	expected := []EvalResult{
+		{input: "[1, 2, 3] + [10, 20, 30]", expected: "[11, 22, 33]"},
+		{input: "[1, 2, 3] * 2", expected: "[2, 4, 6]"},
+		{input: "1 / [1, 2, 3]", expected: "[1, 1/2, 1/3]"},
+		{input: "[1, 2, 3]^2", expected: "[1, 4, 9]"},
+		{input: "2^[1, 2, 3]", expected: "[2, 4, 8]"},
+		{input: "[4, 6] - 1", expected: "[3, 5]"},
+		{input: "-[1, -2]", expected: "[-1, 2]"},
+		{input: "[[1, 2], [3, 4]] * 10", expected: "[[10, 20], [30, 40]]"},
+		{input: "[0.1, 0.2] + [0.2, 0.1]", expected: "[3/10, 3/10]"},
+	}
+	for _, res := range expected {
+		val, err := evaluate(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (l *ListsSuite) TestAggregates(c *C) {
+	expected := []EvalResult{
+		{input: "sum([1, 2, 3, 4])", expected: "10"},
+		{input: "sum([])", expected: "0"},
+		{input: "sum([0.1, 0.2]) == 0.3", expected: "true"},
+		{input: "product([1, 2, 3, 4])", expected: "24"},
+		{input: "product([])", expected: "1"},
+		{input: "mean([1, 2, 3, 4])", expected: "5/2"},
+		{input: "median([3, 1, 2])", expected: "2"},
+		{input: "median([4, 1, 3, 2])", expected: "5/2"},
+		{input: "min([3, -1, 2])", expected: "-1"},
+		{input: "max([3, -1, 2])", expected: "3"},
+		{input: "max([1/3, 0.3])", expected: "1/3"},
+		{input: "sum([1, 2] * [3, 4])", expected: "11"},
+	}
+	for _, res := range expected {
+		val, err := evaluate(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (l *ListsSuite) TestListErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "[1, 2] + [1, 2, 3]", err: "Cannot apply + to lists of length 2 and 3 at offset 7"},
+		{input: "[1, 2][2]", err: "Index 2 out of range for list of length 2"},
+		{input: "[1, 2][-3]", err: "Index -3 out of range for list of length 2"},
+		{input: "[1, 2][1/2]", err: "Invalid index 1/2"},
+		{input: "1[0]", err: "Expected list, got 1"},
+		{input: "mean([])", err: "mean: Empty list"},
+		{input: "max([])", err: "max: Empty list"},
+		{input: "sum([1, [2]])", err: "sum: Expected number, got [2]"},
+		{input: "sum(1, 2)", err: "sum expects 1 or 4 arguments, got 2"},
+		{input: "len(1)", err: "len: Expected list, got 1"},
+	}
+	for _, res := range expected {
+		_, err := evaluate(NewEvaluator(), res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+}
@@ -0,0 +1,90 @@
+package mathval
+
+import (
+	"math/big"
+	"strings"
+)
+
+// Locale holds the separators used to read numbers and argument lists, and to format results
+type Locale struct {
+	// Decimal is the decimal mark, '.' or ','
+	Decimal rune
+
+	// Group separates groups of three digits in the integer part of a number, or is 0 for no grouping. It is
+	// only accepted in input when it differs from Separator, so "1,234" is never a number in the en Locale
+	Group rune
+
+	// Separator separates the arguments of calls and the elements of lists, ',' or ';'. A ';' only
+	// separates statements outside parentheses and brackets
+	Separator rune
+}
+
+// The preset Locales. LocaleEN is the default
+var (
+	LocaleEN = &Locale{Decimal: '.', Group: ',', Separator: ','}
+	LocaleDE = &Locale{Decimal: ',', Group: '.', Separator: ';'}
+	LocaleFR = &Locale{Decimal: ',', Group: ' ', Separator: ';'}
+	LocaleCH = &Locale{Decimal: '.', Group: '\'', Separator: ','}
+)
+
+// groups returns whether the Group separator is accepted in input
+func (l *Locale) groups() bool {
+	return l.Group != 0 && l.Group != l.Separator
+}
+
+// Format returns the value formatted for the Locale. Numbers are written in decimal with places digits after
+// the decimal mark, rounding halves away from zero, and the digits of the integer part are grouped. The
+// elements of lists and matrices are formatted in turn and joined by the Separator. Money is formatted like a
+// number followed by its currency code
+func (l *Locale) Format(val Value, places int) string {
+	switch v := val.(type) {
+	case *NumberValue:
+		return l.formatRat(v.val, places)
+	case *MoneyValue:
+		return l.formatRat(v.amount, places) + " " + v.currency
+	case *MatrixValue:
+		return l.Format(v.list(), places)
+	case *ListValue:
+		elems := make([]string, len(v.elems))
+		for i, elem := range v.elems {
+			elems[i] = l.Format(elem, places)
+		}
+		return "[" + strings.Join(elems, string(l.Separator)+" ") + "]"
+	}
+	return val.String()
+}
+
+// formatRat returns the rational in decimal with the given number of places, see Format
+func (l *Locale) formatRat(r *big.Rat, places int) string {
+	if places < 0 {
+		places = 0
+	}
+	s := r.FloatString(places)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	// Don't write a minus sign on a number which rounds to zero
+	if strings.Trim(s, "0.") == "" {
+		sign = ""
+	}
+
+	integral, fractional := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		integral, fractional = s[:i], s[i+1:]
+	}
+
+	var buf strings.Builder
+	buf.WriteString(sign)
+	for i, ch := range integral {
+		if i > 0 && l.Group != 0 && (len(integral)-i)%3 == 0 {
+			buf.WriteRune(l.Group)
+		}
+		buf.WriteRune(ch)
+	}
+	if fractional != "" {
+		buf.WriteRune(l.Decimal)
+		buf.WriteString(fractional)
+	}
+	return buf.String()
+}
@@ -0,0 +1,102 @@
+package mathval
+
+import (
+	"math/big"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type LocaleSuite struct{}
+
+var _ = Suite(&LocaleSuite{})
+
+// evaluateIn parses the input in the given Locale and evaluates it
+func evaluateIn(locale *Locale, input string) (Value, error) {
+	parser := NewParser(strings.NewReader(input))
+	parser.SetLocale(locale)
+	prog, err := parser.ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	res, err := NewEvaluator().Run(prog)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (l *LocaleSuite) TestParseLocale(c *C) {
+	expected := []struct {
+		locale   *Locale
+		input    string
+		expected string
+	}{
+		{locale: LocaleEN, input: "1234.56 * 100", expected: "123456"},
+		{locale: LocaleEN, input: "max([1,234])", expected: "234"},
+		{locale: LocaleEN, input: "if(1 < 2, 0.5, 1.5)", expected: "1/2"},
+		{locale: LocaleDE, input: "1.234,56 * 100", expected: "123456"},
+		{locale: LocaleDE, input: "1.234.567", expected: "1234567"},
+		{locale: LocaleDE, input: "if(1 < 2; 0,5; 1,5)", expected: "1/2"},
+		{locale: LocaleDE, input: "max([1,5; 2,5])", expected: "5/2"},
+		{locale: LocaleDE, input: "f(a; b) = a - b; f(3; 1,5)", expected: "3/2"},
+		{locale: LocaleDE, input: "[1; 2; 3][1:]", expected: "[2, 3]"},
+		{locale: LocaleFR, input: "1 234,56 * 100", expected: "123456"},
+		{locale: LocaleFR, input: "sum([1 000; 2 000,5])", expected: "6001/2"},
+		{locale: LocaleFR, input: "x = 0,25\nx * 4", expected: "1"},
+		{locale: LocaleCH, input: "1'234.56 * 100", expected: "123456"},
+		{locale: LocaleCH, input: "max([1'000, 999.5])", expected: "1000"},
+	}
+	for _, res := range expected {
+		val, err := evaluateIn(res.locale, res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+
+	// Only groups of three digits are groups, anything else is left to the parser
+	for _, input := range []string{"1.23", "1.2345", "1234.567", "1,2,3"} {
+		_, err := evaluateIn(LocaleDE, input)
+		c.Assert(err, NotNil, Commentf(input))
+	}
+}
+
+func (l *LocaleSuite) TestPrintLocale(c *C) {
+	// The AST prints in the canonical form whatever the Locale it was read in
+	parser := NewParser(strings.NewReader("f(1.234,5; [2; 3])"))
+	parser.SetLocale(LocaleDE)
+	cond, err := parser.Parse()
+	c.Assert(err, IsNil)
+	c.Assert(cond.String(), Equals, "f(1234.5, [2, 3])")
+}
+
+func (l *LocaleSuite) TestFormat(c *C) {
+	num := func(a, b int64) Value {
+		return NewNumberValue(big.NewRat(a, b))
+	}
+	expected := []struct {
+		locale   *Locale
+		val      Value
+		places   int
+		expected string
+	}{
+		{locale: LocaleEN, val: num(123456, 100), places: 2, expected: "1,234.56"},
+		{locale: LocaleDE, val: num(123456, 100), places: 2, expected: "1.234,56"},
+		{locale: LocaleFR, val: num(123456, 100), places: 2, expected: "1 234,56"},
+		{locale: LocaleCH, val: num(123456, 100), places: 2, expected: "1'234.56"},
+		{locale: LocaleDE, val: num(-1234567, 1), places: 0, expected: "-1.234.567"},
+		{locale: LocaleEN, val: num(2, 3), places: 3, expected: "0.667"},
+		{locale: LocaleEN, val: num(5, 2), places: 0, expected: "3"},
+		{locale: LocaleEN, val: num(-1, 1000), places: 2, expected: "0.00"},
+		{locale: LocaleEN, val: num(123, 1), places: 1, expected: "123.0"},
+		{locale: LocaleDE, val: NewListValue(num(3, 2), num(1000, 1)), places: 1, expected: "[1,5; 1.000,0]"},
+		{locale: LocaleEN, val: NewListValue(num(3, 2), num(1000, 1)), places: 1, expected: "[1.5, 1,000.0]"},
+		{locale: LocaleFR, val: NewBoolValue(true), places: 2, expected: "true"},
+	}
+	for _, res := range expected {
+		c.Assert(res.locale.Format(res.val, res.places), Equals, res.expected, Commentf(res.val.String()))
+	}
+
+	m, err := evaluate(NewEvaluator(), "[[1, 2], [3, 4]] / 2")
+	c.Assert(err, IsNil)
+	c.Assert(LocaleDE.Format(m, 1), Equals, "[[0,5; 1,0]; [1,5; 2,0]]")
+}
@@ -0,0 +1,828 @@
+package mathval
+
+import (
+	"strconv"
+	"strings"
+)
+
+// The methods below print the AST as MathML, in presentation markup for display and in content markup for its
+// meaning. Presentation markup follows the LaTeX output, see LaTeX, with division as an mfrac, exponents as
+// msup and parentheses only where they are needed. Function application and juxtaposition are written with the
+// invisible operators U+2061 and U+2062, so that screen readers say "sine of x" and "2 times x". Content
+// markup applies the operators as in "<apply><plus/>...</apply>", with sums and products of more than two
+// operands as one apply. Nodes without a Content MathML element, such as units and dates, are applied as
+// csymbols from the "mathval" content dictionary. Comments are not printed
+
+// mathmlNamespace is the namespace of the math element
+const mathmlNamespace = "http://www.w3.org/1998/Math/MathML"
+
+// Invisible operators, written as character references so that they are visible in the markup
+const (
+	mathmlApply = "&#x2061;" // function application
+	mathmlTimes = "&#x2062;" // juxtaposition
+)
+
+// mathmlOperators holds the presentation of each operator which isn't written as it is typed
+var mathmlOperators = map[Token]string{
+	MINUS:             "−",
+	MULTIPLY:          "⋅",
+	MODULO:            "mod",
+	IMPLICIT_MULTIPLY: mathmlTimes,
+	EQ:                "=",
+	NEQ:               "≠",
+	LT:                "&lt;",
+	LTE:               "≤",
+	GT:                "&gt;",
+	GTE:               "≥",
+	AND:               "∧",
+	OR:                "∨",
+	NOT:               "¬",
+}
+
+// mathmlOperator returns the presentation of the operator
+func mathmlOperator(tok Token) string {
+	if s, ok := mathmlOperators[tok]; ok {
+		return s
+	}
+	return tok.String()
+}
+
+// mathmlGreek holds the character of each Greek letter, by the name of its LaTeX command
+var mathmlGreek = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ε", "zeta": "ζ", "eta": "η", "theta": "θ",
+	"iota": "ι", "kappa": "κ", "lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "rho": "ρ", "sigma": "σ",
+	"tau": "τ", "upsilon": "υ", "phi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω", "Gamma": "Γ", "Delta": "Δ",
+	"Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π", "Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ",
+	"Omega": "Ω",
+}
+
+// mathmlEscaper escapes the characters which are special to XML
+var mathmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// mathmlElement returns the element with the given name and content
+func mathmlElement(name, content string) string {
+	return "<" + name + ">" + content + "</" + name + ">"
+}
+
+// mrow returns the items as a single element, in an mrow unless there is only one
+func mrow(items ...string) string {
+	if len(items) == 1 {
+		return items[0]
+	}
+	return mathmlElement("mrow", strings.Join(items, ""))
+}
+
+// mo returns an operator element
+func mo(op string) string {
+	return mathmlElement("mo", op)
+}
+
+// mathmlParens returns s in parentheses if its level is below min, otherwise as it is
+func mathmlParens(s string, level, min int) string {
+	if level < min {
+		return mrow(mo("("), s, mo(")"))
+	}
+	return s
+}
+
+// mathmlList returns the items separated by commas in the given brackets
+func mathmlList(open, close string, items []string) string {
+	row := []string{mo(open)}
+	for i, item := range items {
+		if i > 0 {
+			row = append(row, mo(","))
+		}
+		row = append(row, item)
+	}
+	return mrow(append(row, mo(close))...)
+}
+
+// mathmlName returns the presentation of an identifier. Greek letters are written as their characters and the
+// part of the name after an underscore is a subscript, as in LaTeX
+func mathmlName(name string) string {
+	if i := strings.IndexByte(name, '_'); i > 0 && i < len(name)-1 {
+		return "<msub>" + mathmlName(name[:i]) + mathmlName(name[i+1:]) + "</msub>"
+	}
+	switch {
+	case mathmlGreek[name] != "":
+		return mathmlElement("mi", mathmlGreek[name])
+	case name == "sqrt2":
+		return mathmlElement("msqrt", mathmlElement("mn", "2"))
+	case name == "ln2":
+		return mrow(mathmlElement("mi", "ln"), mo(mathmlApply), mathmlElement("mn", "2"))
+	case strings.IndexFunc(name, func(ch rune) bool { return !isDigit(ch) }) < 0:
+		return mathmlElement("mn", name)
+	}
+	return mathmlElement("mi", mathmlEscaper.Replace(name))
+}
+
+// mathmlCases returns the rows of values and conditions as a table after a brace
+func mathmlCases(rows [][2]string) string {
+	var buf strings.Builder
+	for _, row := range rows {
+		buf.WriteString("<mtr>" + mathmlElement("mtd", row[0]) + mathmlElement("mtd", row[1]) + "</mtr>")
+	}
+	return mrow(mo("{"), mathmlElement("mtable", buf.String()))
+}
+
+// mathmlIf returns the condition of a row of cases
+func mathmlIf(cond string) string {
+	return mrow(mathmlElement("mtext", "if"), `<mspace width="1em"/>`, cond)
+}
+
+// mathmlOtherwise is the condition of the last row of cases
+var mathmlOtherwise = mathmlElement("mtext", "otherwise")
+
+// mathmlMath returns the element in a math element
+func mathmlMath(s string) string {
+	return `<math xmlns="` + mathmlNamespace + `">` + s + "</math>"
+}
+
+// MathML returns the Program as presentation MathML, with each statement in its own math element on its own
+// line
+func (prog *Program) MathML() string {
+	lines := make([]string, len(prog.statements))
+	for i, stmt := range prog.statements {
+		switch {
+		case stmt.assignment != nil:
+			lines[i] = mrow(mathmlName(stmt.assignment.name), mo("="), stmt.assignment.value.mathml(levelConditional))
+		case stmt.definition != nil:
+			def := stmt.definition
+			params := make([]string, len(def.params))
+			for j, param := range def.params {
+				params[j] = mathmlName(param)
+			}
+			lines[i] = mrow(mathmlName(def.name), mo(mathmlApply), mathmlList("(", ")", params), mo("="), def.body.mathml(levelConditional))
+		default:
+			lines[i] = stmt.cond.mathml(levelConditional)
+		}
+		lines[i] = mathmlMath(lines[i])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// MathML returns the Conditional as presentation MathML, in a math element
+func (cond *Conditional) MathML() string {
+	return mathmlMath(cond.mathml(levelConditional))
+}
+
+// mathml returns the Conditional as presentation MathML, parenthesised if it is looser than min. A ternary is
+// written as cases, with those in its else branch as further rows
+func (cond *Conditional) mathml(min int) string {
+	if cond.then == nil {
+		s := cond.disjunction.mathml(min)
+		if cond.to != nil {
+			s = mathmlParens(mrow(s, mo("→"), cond.to.mathml()), levelConditional, min)
+		} else if cond.currency != "" {
+			s = mathmlParens(mrow(s, mo("→"), mathmlElement("mi", cond.currency)), levelConditional, min)
+		}
+		return s
+	}
+
+	var rows [][2]string
+	for ; cond.then != nil; cond = cond.els {
+		rows = append(rows, [2]string{cond.then.mathml(levelConditional), mathmlIf(cond.disjunction.mathml(levelConditional))})
+	}
+	rows = append(rows, [2]string{cond.mathml(levelConditional), mathmlOtherwise})
+	return mathmlCases(rows)
+}
+
+// mathml returns the Disjunction as presentation MathML, parenthesised if it is looser than min
+func (dis *Disjunction) mathml(min int) string {
+	if dis.op == nil {
+		return dis.conjunction.mathml(min)
+	}
+	var row []string
+	for ; dis != nil; dis = dis.disjunction {
+		if len(row) != 0 {
+			row = append(row, mo(mathmlOperator(OR)))
+		}
+		row = append(row, dis.conjunction.mathml(levelAnd))
+	}
+	return mathmlParens(mrow(row...), levelOr, min)
+}
+
+// mathml returns the Conjunction as presentation MathML, parenthesised if it is looser than min
+func (con *Conjunction) mathml(min int) string {
+	if con.op == nil {
+		return con.comparison.mathml(min)
+	}
+	var row []string
+	for ; con != nil; con = con.conjunction {
+		if len(row) != 0 {
+			row = append(row, mo(mathmlOperator(AND)))
+		}
+		row = append(row, con.comparison.mathml(levelComparison))
+	}
+	return mathmlParens(mrow(row...), levelAnd, min)
+}
+
+// mathml returns the Comparison as presentation MathML, parenthesised if it is looser than min
+func (cmp *Comparison) mathml(min int) string {
+	if len(cmp.not) == 0 && cmp.op == nil {
+		return cmp.expression.mathml(min)
+	}
+	var row []string
+	for _, not := range cmp.not {
+		row = append(row, mo(mathmlOperator(not.op)))
+	}
+	row = append(row, cmp.expression.mathml(levelAdditive))
+	if cmp.op != nil {
+		row = append(row, mo(mathmlOperator(cmp.op.op)), cmp.right.mathml(levelAdditive))
+	}
+	return mathmlParens(mrow(row...), levelComparison, min)
+}
+
+// mathml returns the Expression as presentation MathML, parenthesised if it is looser than min
+func (exp *Expression) mathml(min int) string {
+	if exp.op == nil {
+		return exp.factor.mathml(min)
+	}
+	row := []string{exp.factor.mathml(levelAdditive)}
+	for ; exp.op != nil; exp = exp.expression {
+		row = append(row, mo(mathmlOperator(exp.op.op)), exp.expression.factor.mathml(levelMultiplicative))
+	}
+	return mathmlParens(mrow(row...), levelAdditive, min)
+}
+
+// mathml returns the Factor as presentation MathML, parenthesised if it is looser than min. The chain of
+// operators folds from the left as in LaTeX
+func (fac *Factor) mathml(min int) string {
+	if fac.op == nil {
+		return fac.power.mathml(min)
+	}
+
+	first := levelUnary
+	if fac.op.op == DIVIDE || fac.op.op == INT_DIVIDE {
+		first = levelConditional
+	}
+	row, level := []string{fac.power.mathml(first)}, levelMultiplicative
+	for ; fac.op != nil; fac = fac.factor {
+		switch op := fac.op.op; op {
+		case DIVIDE:
+			row, level = []string{"<mfrac>" + mrow(row...) + fac.factor.power.mathml(levelConditional) + "</mfrac>"}, levelPower
+		case INT_DIVIDE:
+			frac := "<mfrac>" + mrow(row...) + fac.factor.power.mathml(levelConditional) + "</mfrac>"
+			row, level = []string{mrow(mo("⌊"), frac, mo("⌋"))}, levelTerm
+		default:
+			row, level = append(row, mo(mathmlOperator(op)), fac.factor.power.mathml(levelPower)), levelMultiplicative
+		}
+	}
+	return mathmlParens(mrow(row...), level, min)
+}
+
+// mathml returns the Power as presentation MathML, parenthesised if it is looser than min
+func (pow *Power) mathml(min int) string {
+	if len(pow.unary) == 0 && pow.op == nil {
+		return pow.term.mathml(min)
+	}
+
+	var row []string
+	for _, unary := range pow.unary {
+		row = append(row, mo(mathmlOperator(unary.op)))
+	}
+	level := levelPower
+	if pow.op != nil {
+		row = append(row, "<msup>"+pow.term.mathml(levelTerm)+pow.power.mathml(levelConditional)+"</msup>")
+	} else {
+		row = append(row, pow.term.mathml(levelMultiplicative))
+	}
+	if len(pow.unary) != 0 {
+		level = levelUnary
+	}
+	return mathmlParens(mrow(row...), level, min)
+}
+
+// mathml returns the Term as presentation MathML, parenthesised if it is looser than min
+func (term *Term) mathml(min int) string {
+	if term.exp != nil && len(term.index) == 0 && len(term.postfix) == 0 {
+		// Parentheses written in the source are only kept where they are needed
+		return term.exp.mathml(min)
+	}
+
+	s, level := term.mathmlOperand()
+	if len(term.index) == 0 && len(term.postfix) == 0 {
+		return mathmlParens(s, level, min)
+	}
+	row := []string{mathmlParens(s, level, levelTerm)}
+	for _, index := range term.index {
+		row = append(row, index.mathml())
+	}
+	for _, post := range term.postfix {
+		row = append(row, mo(mathmlOperator(post.op)))
+	}
+	return mathmlParens(mrow(row...), levelTerm, min)
+}
+
+// mathmlOperand returns the Term without its indexes and postfix operators as presentation MathML, and its
+// level
+func (term *Term) mathmlOperand() (string, int) {
+	switch {
+	case term.exp != nil:
+		return term.exp.mathml(levelTerm), levelTerm
+	case term.number != nil && term.unit != nil:
+		return mrow(mathmlElement("mn", term.number.String()), mo(mathmlTimes), term.unit.mathml()), levelPower
+	case term.number != nil && term.currency != "":
+		return mrow(mathmlElement("mn", term.number.String()), mo(mathmlTimes), mathmlElement("mi", term.currency)), levelPower
+	case term.number != nil:
+		return mathmlElement("mn", term.number.String()), levelTerm
+	case term.date != nil:
+		return mathmlElement("mtext", term.date.str), levelTerm
+	case term.duration != nil:
+		return mathmlElement("mtext", term.duration.str), levelTerm
+	case term.cells != nil:
+		return mathmlElement("mtext", term.cells.String()), levelTerm
+	case term.text != nil:
+		return mathmlElement("ms", mathmlEscaper.Replace(term.text.val)), levelTerm
+	case term.ident != nil:
+		return mathmlName(term.ident.name), levelTerm
+	case term.call != nil:
+		return term.call.mathml()
+	case term.lambda != nil:
+		return term.lambda.mathml(), levelConditional
+	case term.list != nil:
+		return term.list.mathml(), levelTerm
+	case term.piecewise != nil:
+		return term.piecewise.mathml(), levelTerm
+	}
+	return "", levelTerm
+}
+
+// mathml returns the Unit as presentation MathML, with the factors with negative exponents as divisors. Unit
+// names are always upright
+func (unit *Unit) mathml() string {
+	var num, den []string
+	for _, f := range unit.factors {
+		if f.exp > 0 {
+			num = append(num, f.mathml())
+		} else {
+			den = append(den, unitFactor{name: f.name, exp: -f.exp}.mathml())
+		}
+	}
+	if len(num) == 0 {
+		for _, f := range unit.factors {
+			num = append(num, f.mathml())
+		}
+		den = nil
+	}
+	var row []string
+	for i, n := range num {
+		if i > 0 {
+			row = append(row, mo(mathmlTimes))
+		}
+		row = append(row, n)
+	}
+	for _, d := range den {
+		row = append(row, mo("/"), d)
+	}
+	return mrow(row...)
+}
+
+// mathml returns the unit's name, with its exponent unless that is 1
+func (f unitFactor) mathml() string {
+	s := `<mi mathvariant="normal">` + mathmlEscaper.Replace(f.name) + "</mi>"
+	if f.exp != 1 {
+		s = "<msup>" + s + mathmlElement("mn", strconv.Itoa(f.exp)) + "</msup>"
+	}
+	return s
+}
+
+// mathmlCallee returns the name of a function as it is written, which is that of its LaTeX command if it has
+// one, so asin is "arcsin"
+func mathmlCallee(name string) string {
+	if cmd, ok := latexFunctions[name]; ok && isIdentifier(cmd[1:]) {
+		name = cmd[1:]
+	}
+	return mathmlElement("mi", mathmlEscaper.Replace(name))
+}
+
+// mathml returns the Call as presentation MathML, and its level. Roots, absolute values and logarithms are
+// written as in LaTeX, and sums and products of series with a large operator
+func (call *Call) mathml() (string, int) {
+	args := make([]string, len(call.args))
+	for i, arg := range call.args {
+		args[i] = arg.mathml(levelConditional)
+	}
+
+	switch {
+	case call.name == "sqrt" && len(args) == 1:
+		return mathmlElement("msqrt", args[0]), levelTerm
+	case call.name == "abs" && len(args) == 1:
+		return mrow(mo("|"), args[0], mo("|")), levelTerm
+	case call.name == "log" && len(args) == 2:
+		return mrow("<msub>"+mathmlElement("mi", "log")+args[0]+"</msub>", mo(mathmlApply), mathmlList("(", ")", args[1:])), levelTerm
+	case call.name == "log10" && len(args) == 1:
+		return mrow("<msub>"+mathmlElement("mi", "log")+mathmlElement("mn", "10")+"</msub>", mo(mathmlApply), mathmlList("(", ")", args)), levelTerm
+	case (call.name == "sum" || call.name == "prod") && len(args) == 4:
+		op := "∑"
+		if call.name == "prod" {
+			op = "∏"
+		}
+		under := mrow(args[0], mo("="), args[1])
+		return mrow("<munderover>"+mo(op)+under+args[2]+"</munderover>", call.args[3].mathml(levelMultiplicative)), levelAdditive
+	}
+	return mrow(mathmlCallee(call.name), mo(mathmlApply), mathmlList("(", ")", args)), levelTerm
+}
+
+// mathml returns the Lambda as presentation MathML, with ↦ for its arrow
+func (lambda *Lambda) mathml() string {
+	params := make([]string, len(lambda.params))
+	for i, param := range lambda.params {
+		params[i] = mathmlName(param)
+	}
+	s := mathmlList("(", ")", params)
+	if len(params) == 1 {
+		s = params[0]
+	}
+	return mrow(s, mo("↦"), lambda.body.mathml(levelConditional))
+}
+
+// mathml returns the ListLiteral as presentation MathML. A list of lists of the same non-zero length is written
+// as a matrix
+func (list *ListLiteral) mathml() string {
+	if rows, ok := list.matrixRows(); ok {
+		var buf strings.Builder
+		for _, row := range rows {
+			buf.WriteString("<mtr>")
+			for _, cell := range row.elems {
+				buf.WriteString(mathmlElement("mtd", cell.mathml(levelConditional)))
+			}
+			buf.WriteString("</mtr>")
+		}
+		return mrow(mo("["), mathmlElement("mtable", buf.String()), mo("]"))
+	}
+	elems := make([]string, len(list.elems))
+	for i, elem := range list.elems {
+		elems[i] = elem.mathml(levelConditional)
+	}
+	return mathmlList("[", "]", elems)
+}
+
+// mathml returns the Piecewise as presentation MathML cases
+func (pw *Piecewise) mathml() string {
+	rows := make([][2]string, 0, len(pw.cases)+1)
+	for _, c := range pw.cases {
+		rows = append(rows, [2]string{c.value.mathml(levelConditional), mathmlIf(c.cond.mathml(levelConditional))})
+	}
+	if pw.els != nil {
+		rows = append(rows, [2]string{pw.els.mathml(levelConditional), mathmlOtherwise})
+	}
+	return mathmlCases(rows)
+}
+
+// mathml returns the Index as presentation MathML
+func (index *Index) mathml() string {
+	row := []string{mo("[")}
+	if index.from != nil {
+		row = append(row, index.from.mathml(levelConditional))
+	}
+	if index.slice {
+		row = append(row, mo(":"))
+	}
+	if index.to != nil {
+		row = append(row, index.to.mathml(levelConditional))
+	}
+	return mrow(append(row, mo("]"))...)
+}
+
+// contentOperators holds the Content MathML element of each operator
+var contentOperators = map[Token]string{
+	PLUS:              "<plus/>",
+	MINUS:             "<minus/>",
+	MULTIPLY:          "<times/>",
+	IMPLICIT_MULTIPLY: "<times/>",
+	DIVIDE:            "<divide/>",
+	MODULO:            "<rem/>",
+	POW:               "<power/>",
+	EQ:                "<eq/>",
+	NEQ:               "<neq/>",
+	LT:                "<lt/>",
+	LTE:               "<leq/>",
+	GT:                "<gt/>",
+	GTE:               "<geq/>",
+	AND:               "<and/>",
+	OR:                "<or/>",
+	NOT:               "<not/>",
+	FACTORIAL:         "<factorial/>",
+}
+
+// contentFunctions holds the Content MathML element of each builtin function which has one
+var contentFunctions = map[string]string{
+	"sin": "sin", "cos": "cos", "tan": "tan", "sinh": "sinh", "cosh": "cosh", "tanh": "tanh", "asin": "arcsin",
+	"acos": "arccos", "atan": "arctan", "exp": "exp", "ln": "ln", "log10": "log", "sqrt": "root", "abs": "abs",
+	"min": "min", "max": "max", "mean": "mean", "median": "median", "det": "determinant", "transpose": "transpose",
+	"inverse": "inverse",
+}
+
+// apply returns the apply element of the operator element to the arguments
+func apply(op string, args ...string) string {
+	return mathmlElement("apply", op+strings.Join(args, ""))
+}
+
+// csymbol returns the symbol with the given name from the "mathval" content dictionary
+func csymbol(name string) string {
+	return `<csymbol cd="mathval">` + name + "</csymbol>"
+}
+
+// cs returns a string literal
+func cs(s string) string {
+	return mathmlElement("cs", mathmlEscaper.Replace(s))
+}
+
+// contentFold applies the operators to the operands from the left, with each run of plus or times in a single
+// apply. Integer division is the floor of a division
+func contentFold(operands []string, ops []Token) string {
+	args, last := operands[:1], Token(0)
+	for i, op := range ops {
+		if op == IMPLICIT_MULTIPLY {
+			op = MULTIPLY
+		}
+		if last != 0 && (op != last || (op != PLUS && op != MULTIPLY)) {
+			args = []string{apply(contentOperators[last], args...)}
+		}
+		args, last = append(args, operands[i+1]), op
+		if op == INT_DIVIDE {
+			args, last = []string{apply("<floor/>", apply(contentOperators[DIVIDE], args...))}, 0
+		}
+	}
+	if last == 0 {
+		return args[0]
+	}
+	return apply(contentOperators[last], args...)
+}
+
+// contentPiecewise returns the pieces, each a value and its condition, and the value otherwise, if any, as a
+// piecewise element
+func contentPiecewise(pieces [][2]string, otherwise string) string {
+	var buf strings.Builder
+	for _, piece := range pieces {
+		buf.WriteString(mathmlElement("piece", piece[0]+piece[1]))
+	}
+	if otherwise != "" {
+		buf.WriteString(mathmlElement("otherwise", otherwise))
+	}
+	return mathmlElement("piecewise", buf.String())
+}
+
+// ContentMathML returns the Program as content MathML, with each statement in its own math element on its own
+// line. An assignment applies the "assign" csymbol to the name and value, and a definition assigns a lambda
+func (prog *Program) ContentMathML() string {
+	lines := make([]string, len(prog.statements))
+	for i, stmt := range prog.statements {
+		switch {
+		case stmt.assignment != nil:
+			lines[i] = apply(csymbol("assign"), mathmlElement("ci", stmt.assignment.name), stmt.assignment.value.content())
+		case stmt.definition != nil:
+			def := stmt.definition
+			lambda := &Lambda{params: def.params, body: def.body}
+			lines[i] = apply(csymbol("assign"), mathmlElement("ci", def.name), lambda.content())
+		default:
+			lines[i] = stmt.cond.content()
+		}
+		lines[i] = mathmlMath(lines[i])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ContentMathML returns the Conditional as content MathML, in a math element
+func (cond *Conditional) ContentMathML() string {
+	return mathmlMath(cond.content())
+}
+
+// content returns the Conditional as content MathML. A ternary is a piecewise, with those in its else branch
+// as further pieces, and a conversion applies the "convert" csymbol to the value and unit or currency
+func (cond *Conditional) content() string {
+	if cond.then == nil {
+		s := cond.disjunction.content()
+		if cond.to != nil {
+			s = apply(csymbol("convert"), s, cs(cond.to.String()))
+		} else if cond.currency != "" {
+			s = apply(csymbol("convert"), s, cs(cond.currency))
+		}
+		return s
+	}
+
+	var pieces [][2]string
+	for ; cond.then != nil; cond = cond.els {
+		pieces = append(pieces, [2]string{cond.then.content(), cond.disjunction.content()})
+	}
+	return contentPiecewise(pieces, cond.content())
+}
+
+// content returns the Disjunction as content MathML
+func (dis *Disjunction) content() string {
+	if dis.op == nil {
+		return dis.conjunction.content()
+	}
+	var args []string
+	for ; dis != nil; dis = dis.disjunction {
+		args = append(args, dis.conjunction.content())
+	}
+	return apply(contentOperators[OR], args...)
+}
+
+// content returns the Conjunction as content MathML
+func (con *Conjunction) content() string {
+	if con.op == nil {
+		return con.comparison.content()
+	}
+	var args []string
+	for ; con != nil; con = con.conjunction {
+		args = append(args, con.comparison.content())
+	}
+	return apply(contentOperators[AND], args...)
+}
+
+// content returns the Comparison as content MathML
+func (cmp *Comparison) content() string {
+	s := cmp.expression.content()
+	if cmp.op != nil {
+		s = apply(contentOperators[cmp.op.op], s, cmp.right.content())
+	}
+	for range cmp.not {
+		s = apply(contentOperators[NOT], s)
+	}
+	return s
+}
+
+// content returns the Expression as content MathML. A percentage added or subtracted multiplies the operands
+// before it by one plus or minus the percentage
+func (exp *Expression) content() string {
+	operands := []string{exp.factor.content()}
+	var ops []Token
+	for ; exp.op != nil; exp = exp.expression {
+		right := exp.expression.factor.content()
+		if isPercentage(exp.expression.factor) {
+			right = apply(contentOperators[exp.op.op], mathmlElement("cn", "1"), right)
+			operands, ops = []string{apply(contentOperators[MULTIPLY], contentFold(operands, ops), right)}, nil
+			continue
+		}
+		operands, ops = append(operands, right), append(ops, exp.op.op)
+	}
+	return contentFold(operands, ops)
+}
+
+// content returns the Factor as content MathML
+func (fac *Factor) content() string {
+	operands := []string{fac.power.content()}
+	var ops []Token
+	for ; fac.op != nil; fac = fac.factor {
+		operands, ops = append(operands, fac.factor.power.content()), append(ops, fac.op.op)
+	}
+	return contentFold(operands, ops)
+}
+
+// content returns the Power as content MathML. A unary minus applies minus to a single argument
+func (pow *Power) content() string {
+	s := pow.term.content()
+	if pow.op != nil {
+		s = apply(contentOperators[POW], s, pow.power.content())
+	}
+	for _, unary := range pow.unary {
+		if unary.op == MINUS {
+			s = apply(contentOperators[MINUS], s)
+		}
+	}
+	return s
+}
+
+// content returns the Term as content MathML. An index applies the "index" csymbol to the list and index,
+// and a slice the "slice" csymbol with its bounds as a lowlimit and uplimit
+func (term *Term) content() string {
+	s := term.contentOperand()
+	for _, index := range term.index {
+		if !index.slice {
+			s = apply(csymbol("index"), s, index.from.content())
+			continue
+		}
+		args := []string{s}
+		if index.from != nil {
+			args = append(args, mathmlElement("lowlimit", index.from.content()))
+		}
+		if index.to != nil {
+			args = append(args, mathmlElement("uplimit", index.to.content()))
+		}
+		s = apply(csymbol("slice"), args...)
+	}
+	for _, post := range term.postfix {
+		if post.op == PERCENT {
+			s = apply(contentOperators[DIVIDE], s, mathmlElement("cn", "100"))
+		} else {
+			s = apply(contentOperators[post.op], s)
+		}
+	}
+	return s
+}
+
+// contentOperand returns the Term without its indexes and postfix operators as content MathML. Quantities,
+// money, dates, durations and ranges apply csymbols of the same names to strings
+func (term *Term) contentOperand() string {
+	switch {
+	case term.exp != nil:
+		return term.exp.content()
+	case term.number != nil && term.unit != nil:
+		return apply(csymbol("quantity"), mathmlElement("cn", term.number.String()), cs(term.unit.String()))
+	case term.number != nil && term.currency != "":
+		return apply(csymbol("money"), mathmlElement("cn", term.number.String()), cs(term.currency))
+	case term.number != nil:
+		return mathmlElement("cn", term.number.String())
+	case term.date != nil:
+		return apply(csymbol("date"), cs(term.date.str))
+	case term.duration != nil:
+		return apply(csymbol("duration"), cs(term.duration.str))
+	case term.cells != nil:
+		return apply(csymbol("range"), cs(term.cells.from), cs(term.cells.to))
+	case term.text != nil:
+		return cs(term.text.val)
+	case term.ident != nil:
+		return contentName(term.ident.name)
+	case term.call != nil:
+		return term.call.content()
+	case term.lambda != nil:
+		return term.lambda.content()
+	case term.list != nil:
+		return term.list.content()
+	case term.piecewise != nil:
+		return term.piecewise.content()
+	}
+	return ""
+}
+
+// contentName returns the identifier as content MathML, which is its element for pi and e
+func contentName(name string) string {
+	switch name {
+	case "pi":
+		return "<pi/>"
+	case "e":
+		return "<exponentiale/>"
+	}
+	return mathmlElement("ci", mathmlEscaper.Replace(name))
+}
+
+// content returns the Call as content MathML. Functions without an element of their own are applied as ci
+// elements, and if is a piecewise
+func (call *Call) content() string {
+	args := make([]string, len(call.args))
+	for i, arg := range call.args {
+		args[i] = arg.content()
+	}
+
+	switch {
+	case call.name == "log" && len(args) == 2:
+		return apply("<log/>", mathmlElement("logbase", args[0]), args[1])
+	case (call.name == "sum" || call.name == "prod") && len(args) == 4:
+		op := "<sum/>"
+		if call.name == "prod" {
+			op = "<product/>"
+		}
+		return apply(op, mathmlElement("bvar", args[0]), mathmlElement("lowlimit", args[1]), mathmlElement("uplimit", args[2]), args[3])
+	case call.name == "if" && len(args) == 3:
+		return contentPiecewise([][2]string{{args[1], args[0]}}, args[2])
+	}
+	if el, ok := contentFunctions[call.name]; ok {
+		return apply("<"+el+"/>", args...)
+	}
+	return apply(mathmlElement("ci", mathmlEscaper.Replace(call.name)), args...)
+}
+
+// content returns the Lambda as content MathML, with a bvar for each parameter
+func (lambda *Lambda) content() string {
+	var buf strings.Builder
+	for _, param := range lambda.params {
+		buf.WriteString(mathmlElement("bvar", mathmlElement("ci", param)))
+	}
+	return mathmlElement("lambda", buf.String()+lambda.body.content())
+}
+
+// content returns the ListLiteral as content MathML, which is a matrix if it would be printed as one
+func (list *ListLiteral) content() string {
+	if rows, ok := list.matrixRows(); ok {
+		var buf strings.Builder
+		for _, row := range rows {
+			var cells strings.Builder
+			for _, cell := range row.elems {
+				cells.WriteString(cell.content())
+			}
+			buf.WriteString(mathmlElement("matrixrow", cells.String()))
+		}
+		return mathmlElement("matrix", buf.String())
+	}
+	var buf strings.Builder
+	for _, elem := range list.elems {
+		buf.WriteString(elem.content())
+	}
+	return mathmlElement("list", buf.String())
+}
+
+// content returns the Piecewise as content MathML
+func (pw *Piecewise) content() string {
+	pieces := make([][2]string, len(pw.cases))
+	for i, c := range pw.cases {
+		pieces[i] = [2]string{c.value.content(), c.cond.content()}
+	}
+	otherwise := ""
+	if pw.els != nil {
+		otherwise = pw.els.content()
+	}
+	return contentPiecewise(pieces, otherwise)
+}
@@ -0,0 +1,54 @@
+package mathval
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type MathMLSuite struct{}
+
+var _ = Suite(&MathMLSuite{})
+
+func (m *MathMLSuite) TestGolden(c *C) {
+	checkGolden(c, "testdata/mathml.golden", (*Program).MathML)
+}
+
+func (m *MathMLSuite) TestContentGolden(c *C) {
+	checkGolden(c, "testdata/contentmathml.golden", (*Program).ContentMathML)
+}
+
+func (m *MathMLSuite) TestConditional(c *C) {
+	expected := []struct {
+		mode    Mode
+		input   string
+		mathml  string
+		content string
+	}{
+		{
+			input:   "/* half */ x / 2 # of x",
+			mathml:  `<math xmlns="http://www.w3.org/1998/Math/MathML"><mfrac><mi>x</mi><mn>2</mn></mfrac></math>`,
+			content: `<math xmlns="http://www.w3.org/1998/Math/MathML"><apply><divide/><ci>x</ci><cn>2</cn></apply></math>`,
+		},
+		{
+			input:   "1/2x",
+			mode:    TightImplicitMultiplication,
+			mathml:  `<math xmlns="http://www.w3.org/1998/Math/MathML"><mfrac><mn>1</mn><mrow><mn>2</mn><mo>&#x2062;</mo><mi>x</mi></mrow></mfrac></math>`,
+			content: `<math xmlns="http://www.w3.org/1998/Math/MathML"><apply><divide/><cn>1</cn><apply><times/><cn>2</cn><ci>x</ci></apply></apply></math>`,
+		},
+		{
+			input:   `=IF(A1<>0; "<a & b>"; "")`,
+			mode:    Excel,
+			mathml:  `<math xmlns="http://www.w3.org/1998/Math/MathML"><mrow><mi>if</mi><mo>&#x2061;</mo><mrow><mo>(</mo><mrow><mi>A1</mi><mo>≠</mo><mn>0</mn></mrow><mo>,</mo><ms>&lt;a &amp; b&gt;</ms><mo>,</mo><ms></ms><mo>)</mo></mrow></mrow></math>`,
+			content: `<math xmlns="http://www.w3.org/1998/Math/MathML"><piecewise><piece><cs>&lt;a &amp; b&gt;</cs><apply><neq/><ci>A1</ci><cn>0</cn></apply></piece><otherwise><cs></cs></otherwise></piecewise></math>`,
+		},
+	}
+	for _, res := range expected {
+		parser = NewParser(strings.NewReader(res.input))
+		parser.SetMode(res.mode)
+		cond, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(cond.MathML(), Equals, res.mathml, Commentf(res.input))
+		c.Assert(cond.ContentMathML(), Equals, res.content, Commentf(res.input))
+	}
+}
@@ -0,0 +1,470 @@
+package mathval
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// MatrixValue is a non-empty rectangular matrix of rationals. A list literal whose elements are lists of
+// numbers all of the same non-zero length evaluates to a matrix, so "[[1, 2], [3, 4]]" is a 2x2 matrix
+type MatrixValue struct {
+	rows [][]*big.Rat
+	prec uint // 0 if exact
+}
+
+// NewMatrixValue returns an exact MatrixValue holding a copy of the given rows, or an error if they are empty
+// or ragged
+func NewMatrixValue(rows [][]*big.Rat) (*MatrixValue, error) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return nil, errors.New("Matrix must not be empty")
+	}
+	m := newMatrix(len(rows), len(rows[0]))
+	for i, row := range rows {
+		if len(row) != len(rows[0]) {
+			return nil, fmt.Errorf("Row %d of matrix has %d columns, expected %d", i, len(row), len(rows[0]))
+		}
+		for j, r := range row {
+			m.rows[i][j].Set(r)
+		}
+	}
+	return m, nil
+}
+
+// newMatrix returns an exact zero matrix with the given dimensions
+func newMatrix(rows, cols int) *MatrixValue {
+	m := &MatrixValue{rows: make([][]*big.Rat, rows)}
+	for i := range m.rows {
+		m.rows[i] = make([]*big.Rat, cols)
+		for j := range m.rows[i] {
+			m.rows[i][j] = new(big.Rat)
+		}
+	}
+	return m
+}
+
+// identity returns the n by n identity matrix
+func identity(n int) *MatrixValue {
+	m := newMatrix(n, n)
+	for i := 0; i < n; i++ {
+		m.rows[i][i].SetInt64(1)
+	}
+	return m
+}
+
+// Rows returns the number of rows in the matrix
+func (m *MatrixValue) Rows() int {
+	return len(m.rows)
+}
+
+// Cols returns the number of columns in the matrix
+func (m *MatrixValue) Cols() int {
+	return len(m.rows[0])
+}
+
+// At returns a copy of the element at the given row and column
+func (m *MatrixValue) At(i, j int) *big.Rat {
+	return new(big.Rat).Set(m.rows[i][j])
+}
+
+// String returns the rows of the matrix as a list of lists
+func (m *MatrixValue) String() string {
+	return m.list().String()
+}
+
+// dims returns the dimensions of the matrix for use in error messages
+func (m *MatrixValue) dims() string {
+	return fmt.Sprintf("%dx%d", m.Rows(), m.Cols())
+}
+
+// list returns the matrix as a list of its rows
+func (m *MatrixValue) list() *ListValue {
+	rows := make([]Value, len(m.rows))
+	for i, row := range m.rows {
+		rows[i] = m.vector(row)
+	}
+	return &ListValue{elems: rows}
+}
+
+// vector returns the rationals as a list of numbers with the precision of the matrix
+func (m *MatrixValue) vector(rats []*big.Rat) *ListValue {
+	elems := make([]Value, len(rats))
+	for i, r := range rats {
+		elems[i] = numberOf(new(big.Rat).Set(r), m.prec)
+	}
+	return &ListValue{elems: elems}
+}
+
+// withPrec rounds every element of the matrix to prec bits if it is non-zero, like numberOf
+func (m *MatrixValue) withPrec(prec uint) *MatrixValue {
+	m.prec = prec
+	if prec != 0 {
+		for _, row := range m.rows {
+			for j, r := range row {
+				row[j] = numberOf(r, prec).val
+			}
+		}
+	}
+	return m
+}
+
+// matrixOf returns the list as a matrix if every element is a list of numbers, all of the same non-zero
+// length
+func matrixOf(list *ListValue) (*MatrixValue, bool) {
+	if len(list.elems) == 0 {
+		return nil, false
+	}
+	m := &MatrixValue{rows: make([][]*big.Rat, len(list.elems))}
+	for i, elem := range list.elems {
+		row, ok := elem.(*ListValue)
+		if !ok || len(row.elems) == 0 || len(row.elems) != len(list.elems[0].(*ListValue).elems) {
+			return nil, false
+		}
+		rats, ok := ratsOf(row)
+		if !ok {
+			return nil, false
+		}
+		m.rows[i] = rats
+	}
+	return m.withPrec(precOf(list.elems...)), true
+}
+
+// ratsOf returns copies of the elements of the list as rationals, if they are all numbers
+func ratsOf(list *ListValue) ([]*big.Rat, bool) {
+	rats := make([]*big.Rat, len(list.elems))
+	for i, elem := range list.elems {
+		n, ok := elem.(*NumberValue)
+		if !ok {
+			return nil, false
+		}
+		rats[i] = new(big.Rat).Set(n.val)
+	}
+	return rats, true
+}
+
+// column returns the rationals as a single column matrix
+func column(rats []*big.Rat) *MatrixValue {
+	m := &MatrixValue{rows: make([][]*big.Rat, len(rats))}
+	for i, r := range rats {
+		m.rows[i] = []*big.Rat{r}
+	}
+	return m
+}
+
+// isMatrix returns whether the value is a MatrixValue
+func isMatrix(val Value) bool {
+	_, ok := val.(*MatrixValue)
+	return ok
+}
+
+// toMatrix returns the MatrixValue held by the given value, or an error if it is not a matrix
+func toMatrix(val Value) (*MatrixValue, error) {
+	if m, ok := val.(*MatrixValue); ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("Expected matrix, got %s", val)
+}
+
+// DimensionError is returned when the dimensions of the operands of an operator or function are incompatible
+type DimensionError struct {
+	Msg string
+	Pos int // offset in runes of the operator or call in the source, or -1 if unknown
+}
+
+// dimensionError returns a DimensionError with the formatted message, positioned once it reaches the
+// operator or call it came from, see positioned
+func dimensionError(format string, args ...interface{}) *DimensionError {
+	return &DimensionError{Msg: fmt.Sprintf(format, args...), Pos: -1}
+}
+
+// Error returns the message, followed by the position if known
+func (e *DimensionError) Error() string {
+	if e.Pos < 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s at offset %d", e.Msg, e.Pos)
+}
+
+// positioned sets the position of err to pos if it is a DimensionError without one
+func positioned(err error, pos int) error {
+	if dim, ok := err.(*DimensionError); ok && dim.Pos < 0 {
+		dim.Pos = pos
+	}
+	return err
+}
+
+// matrixArithmetic applies the arithmetic operator where at least one operand is a matrix. '*' between two
+// matrices, or a matrix and a list, is matrix multiplication, treating the list as a column vector on the
+// right or a row vector on the left. Matrices can be added to and subtracted from matrices of the same
+// dimensions, and every other operator, including '^', applies element-wise like broadcast
+func matrixArithmetic(op Token, a, b Value) (Value, error) {
+	x, xMatrix := a.(*MatrixValue)
+	y, yMatrix := b.(*MatrixValue)
+	prec := precOf(a, b)
+
+	switch {
+	case (op == PLUS || op == MINUS) && xMatrix && yMatrix:
+		if x.Rows() != y.Rows() || x.Cols() != y.Cols() {
+			return nil, dimensionError("Cannot apply %s to %s and %s matrices", op, x.dims(), y.dims())
+		}
+		res := newMatrix(x.Rows(), x.Cols())
+		for i, row := range res.rows {
+			for j, r := range row {
+				if op == PLUS {
+					r.Add(x.rows[i][j], y.rows[i][j])
+				} else {
+					r.Sub(x.rows[i][j], y.rows[i][j])
+				}
+			}
+		}
+		return res.withPrec(prec), nil
+
+	case (op == MULTIPLY || op == IMPLICIT_MULTIPLY) && xMatrix && yMatrix:
+		if x.Cols() != y.Rows() {
+			return nil, dimensionError("Cannot multiply %s and %s matrices", x.dims(), y.dims())
+		}
+		return x.mul(y).withPrec(prec), nil
+
+	case (op == MULTIPLY || op == IMPLICIT_MULTIPLY) && (isList(a) || isList(b)):
+		if xMatrix {
+			v, ok := ratsOf(b.(*ListValue))
+			if !ok {
+				return nil, fmt.Errorf("Cannot multiply %s matrix by %s", x.dims(), b)
+			}
+			if len(v) != x.Cols() {
+				return nil, dimensionError("Cannot multiply %s matrix by vector of length %d", x.dims(), len(v))
+			}
+			res := x.mul(column(v)).transpose().withPrec(prec)
+			return res.vector(res.rows[0]), nil
+		}
+		v, ok := ratsOf(a.(*ListValue))
+		if !ok {
+			return nil, fmt.Errorf("Cannot multiply %s by %s matrix", a, y.dims())
+		}
+		if len(v) != y.Rows() {
+			return nil, dimensionError("Cannot multiply vector of length %d by %s matrix", len(v), y.dims())
+		}
+		res := (&MatrixValue{rows: [][]*big.Rat{v}}).mul(y).withPrec(prec)
+		return res.vector(res.rows[0]), nil
+	}
+
+	// Any other operator applies element-wise, as it does to nested lists
+	res, err := broadcast(op, rowsOf(a), rowsOf(b))
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := matrixOf(res.(*ListValue)); ok {
+		return m, nil
+	}
+	return res, nil
+}
+
+// rowsOf returns a matrix as the list of its rows, and any other value as it is
+func rowsOf(val Value) Value {
+	if m, ok := val.(*MatrixValue); ok {
+		return m.list()
+	}
+	return val
+}
+
+// mul returns the matrix product, which must be defined
+func (m *MatrixValue) mul(other *MatrixValue) *MatrixValue {
+	res := newMatrix(m.Rows(), other.Cols())
+	t := new(big.Rat)
+	for i, row := range res.rows {
+		for j, r := range row {
+			for k := range other.rows {
+				r.Add(r, t.Mul(m.rows[i][k], other.rows[k][j]))
+			}
+		}
+	}
+	return res
+}
+
+// transpose returns the transpose of the matrix
+func (m *MatrixValue) transpose() *MatrixValue {
+	res := newMatrix(m.Cols(), m.Rows())
+	for i, row := range res.rows {
+		for j, r := range row {
+			r.Set(m.rows[j][i])
+		}
+	}
+	res.prec = m.prec
+	return res
+}
+
+// eliminate reduces the square matrix with Gauss-Jordan elimination, applying the same row operations to
+// aug, which must have the same number of rows. It returns the determinant of the matrix, leaving aug holding
+// the solution if the determinant is non-zero. Neither matrix is modified
+func (m *MatrixValue) eliminate(aug *MatrixValue) (det *big.Rat, sol *MatrixValue) {
+	a := newMatrix(m.Rows(), m.Cols())
+	sol = newMatrix(aug.Rows(), aug.Cols())
+	for i := range m.rows {
+		for j := range m.rows[i] {
+			a.rows[i][j].Set(m.rows[i][j])
+		}
+		for j := range aug.rows[i] {
+			sol.rows[i][j].Set(aug.rows[i][j])
+		}
+	}
+
+	det = big.NewRat(1, 1)
+	t := new(big.Rat)
+	for col := range a.rows {
+		pivot := col
+		for pivot < len(a.rows) && a.rows[pivot][col].Sign() == 0 {
+			pivot++
+		}
+		if pivot == len(a.rows) {
+			return new(big.Rat), nil
+		}
+		if pivot != col {
+			a.rows[col], a.rows[pivot] = a.rows[pivot], a.rows[col]
+			sol.rows[col], sol.rows[pivot] = sol.rows[pivot], sol.rows[col]
+			det.Neg(det)
+		}
+
+		p := new(big.Rat).Set(a.rows[col][col])
+		det.Mul(det, p)
+		p.Inv(p)
+		for j := range a.rows[col] {
+			a.rows[col][j].Mul(a.rows[col][j], p)
+		}
+		for j := range sol.rows[col] {
+			sol.rows[col][j].Mul(sol.rows[col][j], p)
+		}
+
+		for i := range a.rows {
+			if i == col || a.rows[i][col].Sign() == 0 {
+				continue
+			}
+			f := new(big.Rat).Set(a.rows[i][col])
+			for j := range a.rows[i] {
+				a.rows[i][j].Sub(a.rows[i][j], t.Mul(f, a.rows[col][j]))
+			}
+			for j := range sol.rows[i] {
+				sol.rows[i][j].Sub(sol.rows[i][j], t.Mul(f, sol.rows[col][j]))
+			}
+		}
+	}
+	return det, sol
+}
+
+// inverse returns the inverse of the matrix, which must be square and non-singular
+func (m *MatrixValue) inverse() (*MatrixValue, error) {
+	if m.Rows() != m.Cols() {
+		return nil, dimensionError("Cannot invert non-square %s matrix", m.dims())
+	}
+	if _, inv := m.eliminate(identity(m.Rows())); inv != nil {
+		return inv.withPrec(m.prec), nil
+	}
+	return nil, errors.New("Matrix is singular")
+}
+
+// matrixArg evaluates the argument, which must be a matrix
+func (ev *Evaluator) matrixArg(name string, arg *Conditional) (*MatrixValue, error) {
+	val, err := ev.evalConditional(arg)
+	if err != nil {
+		return nil, err
+	}
+	m, err := toMatrix(val)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return m, nil
+}
+
+// builtinTranspose implements transpose(m)
+func builtinTranspose(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("transpose expects 1 argument, got %d", len(args))
+	}
+	m, err := ev.matrixArg("transpose", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return m.transpose(), nil
+}
+
+// builtinDet implements det(m), the determinant of a square matrix
+func builtinDet(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("det expects 1 argument, got %d", len(args))
+	}
+	m, err := ev.matrixArg("det", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if m.Rows() != m.Cols() {
+		return nil, dimensionError("det: Cannot take determinant of non-square %s matrix", m.dims())
+	}
+	det, _ := m.eliminate(newMatrix(m.Rows(), 1))
+	return numberOf(det, m.prec), nil
+}
+
+// builtinInverse implements inverse(m)
+func builtinInverse(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("inverse expects 1 argument, got %d", len(args))
+	}
+	m, err := ev.matrixArg("inverse", args[0])
+	if err != nil {
+		return nil, err
+	}
+	inv, err := m.inverse()
+	if dim, ok := err.(*DimensionError); ok {
+		dim.Msg = "inverse: " + dim.Msg
+		return nil, dim
+	} else if err != nil {
+		return nil, fmt.Errorf("inverse: %s", err)
+	}
+	return inv, nil
+}
+
+// builtinSolve implements solve(A, b), returning x such that A*x = b. b may be a list, giving a list, or a
+// matrix, giving a matrix. A must be square and non-singular
+func builtinSolve(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("solve expects 2 arguments, got %d", len(args))
+	}
+	a, err := ev.matrixArg("solve", args[0])
+	if err != nil {
+		return nil, err
+	}
+	val, err := ev.evalConditional(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var b *MatrixValue
+	vector := false
+	switch v := val.(type) {
+	case *MatrixValue:
+		b = v
+	case *ListValue:
+		if rats, ok := ratsOf(v); ok && len(rats) != 0 {
+			b, vector = column(rats), true
+		}
+	}
+	if b == nil {
+		return nil, fmt.Errorf("solve: Expected list of numbers or matrix, got %s", val)
+	}
+
+	if a.Rows() != a.Cols() {
+		return nil, dimensionError("solve: Cannot solve with non-square %s matrix", a.dims())
+	}
+	if b.Rows() != a.Rows() {
+		return nil, dimensionError("solve: Cannot solve %s matrix with %d right hand side rows", a.dims(), b.Rows())
+	}
+
+	_, sol := a.eliminate(b)
+	if sol == nil {
+		return nil, errors.New("solve: Matrix is singular")
+	}
+	sol.withPrec(precOf(a, val))
+	if vector {
+		row := sol.transpose()
+		return row.vector(row.rows[0]), nil
+	}
+	return sol, nil
+}
@@ -0,0 +1,128 @@
+package mathval
+
+import (
+	"math/big"
+	"regexp"
+
+	. "gopkg.in/check.v1"
+)
+
+type MatrixSuite struct{}
+
+var _ = Suite(&MatrixSuite{})
+
+func (m *MatrixSuite) TestMatrix(c *C) {
+	expected := []EvalResult{
+		{input: "[[1, 2], [3, 4]]", expected: "[[1, 2], [3, 4]]"},
+		{input: "[[1, 2], [3, 4]] * [[5, 6], [7, 8]]", expected: "[[19, 22], [43, 50]]"},
+		{input: "[[1, 2, 3]] * [[1], [2], [3]]", expected: "[[14]]"},
+		{input: "[[1, 2], [3, 4]] * [1, 1]", expected: "[3, 7]"},
+		{input: "[1, 1] * [[1, 2], [3, 4]]", expected: "[4, 6]"},
+		{input: "[[1, 2], [3, 4]] + [[1, 1], [1, 1]]", expected: "[[2, 3], [4, 5]]"},
+		{input: "[[1, 2], [3, 4]] - [[1, 1], [1, 1]]", expected: "[[0, 1], [2, 3]]"},
+		{input: "2 * [[1, 2], [3, 4]] / 4", expected: "[[1/2, 1], [3/2, 2]]"},
+		{input: "-[[1, 2], [3, 4]]", expected: "[[-1, -2], [-3, -4]]"},
+		{input: "[[1, 2], [3, 4]] + 1", expected: "[[2, 3], [4, 5]]"},
+		{input: "1 - [[1, 2], [3, 4]]", expected: "[[0, -1], [-2, -3]]"},
+		{input: "[[1, 2], [3, 4]] / 2", expected: "[[1/2, 1], [3/2, 2]]"},
+		{input: "12 / [[1, 2], [3, 4]]", expected: "[[12, 6], [4, 3]]"},
+		{input: "[[1, 2], [3, 4]]^2", expected: "[[1, 4], [9, 16]]"},
+		{input: "[[1, 2], [3, 4]] * [[1, 2], [3, 4]]", expected: "[[7, 10], [15, 22]]"},
+		{input: "[[1, 2], [3, 4]] + [10, 20]", expected: "[[11, 12], [23, 24]]"},
+		{input: "[[1, 2], [3, 4]] % 2", expected: "[[1, 0], [1, 0]]"},
+		{input: "[[1, 2], [3, 4]][1]", expected: "[3, 4]"},
+		{input: "[[1, 2], [3, 4]][1][0]", expected: "3"},
+		{input: "[[1, 2], [3, 4], [5, 6]][1:] * [[1], [1]]", expected: "[[7], [11]]"},
+		{input: "transpose([[1, 2, 3], [4, 5, 6]])", expected: "[[1, 4], [2, 5], [3, 6]]"},
+		{input: "det([[1, 2], [3, 4]])", expected: "-2"},
+		{input: "det([[0, 1], [1, 0]])", expected: "-1"},
+		{input: "det([[2, 0, 1], [1, 3, 2], [1, 1, 2]])", expected: "6"},
+		{input: "det([[1, 2], [2, 4]])", expected: "0"},
+		{input: "inverse([[1, 2], [3, 4]])", expected: "[[-2, 1], [3/2, -1/2]]"},
+		{input: "inverse([[0, 1], [1, 0]])", expected: "[[0, 1], [1, 0]]"},
+		{input: "[[1, 2], [3, 4]] * inverse([[1, 2], [3, 4]])", expected: "[[1, 0], [0, 1]]"},
+		{input: "solve([[2, 1], [1, 3]], [3, 5])", expected: "[4/5, 7/5]"},
+		{input: "solve([[1, 1], [1, -1]], [[2, 4], [0, 2]])", expected: "[[1, 3], [1, 1]]"},
+		// Ragged and non-numeric nested lists stay lists
+		{input: "[[1, 2], [3]]", expected: "[[1, 2], [3]]"},
+		{input: "[[1, 2], [3, x -> x]]", expected: "[[1, 2], [3, x -> x]]"},
+	}
+	for _, res := range expected {
+		val, err := evaluate(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+
+	val, err := evaluate(NewEvaluator(), "[[1, 2], [3, 4]]")
+	c.Assert(err, IsNil)
+	mat, ok := val.(*MatrixValue)
+	c.Assert(ok, Equals, true)
+	c.Assert(mat.Rows(), Equals, 2)
+	c.Assert(mat.Cols(), Equals, 2)
+	c.Assert(mat.At(1, 0).RatString(), Equals, "3")
+}
+
+func (m *MatrixSuite) TestMatrixAsList(c *C) {
+	// A matrix is the list of its rows for the list builtins
+	expected := []EvalResult{
+		{input: "len([[1, 2], [3, 4]])", expected: "2"},
+		{input: "len([[1, 2], [3, 4]][0])", expected: "2"},
+		{input: "map([[1, 2], [3, 4]], r -> len(r))", expected: "[2, 2]"},
+		{input: "map([[1, 2], [3, 4]], r -> sum(r))", expected: "[3, 7]"},
+		{input: "max(map([[1, 2], [3, 4]], r -> max(r)))", expected: "4"},
+		{input: "filter([[1, 2], [3, 4]], r -> r[0] > 1)", expected: "[[3, 4]]"},
+		{input: "reduce([[1, 2], [3, 4]], (a, b) -> a + b)", expected: "[4, 6]"},
+		{input: "reduce([[1, 2], [3, 4]], (n, r) -> n + len(r), 0)", expected: "4"},
+		{input: "any([[1, 2], [3, 4]], r -> r[1] == 4)", expected: "true"},
+		{input: "all([[1, 2], [3, 4]], r -> r[0] > 1)", expected: "false"},
+		{input: "sum(flatten([[1, 2], [3, 4]]))", expected: "10"},
+	}
+	for _, res := range expected {
+		val, err := evaluate(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+
+	// Aggregates take numbers, as for any nested list
+	_, err := evaluate(NewEvaluator(), "sum([[1, 2], [3, 4]])")
+	c.Assert(err, ErrorMatches, regexp.QuoteMeta("sum: Expected number, got [1, 2]"))
+}
+
+func (m *MatrixSuite) TestNewMatrixValue(c *C) {
+	mat, err := NewMatrixValue([][]*big.Rat{{big.NewRat(1, 2)}, {big.NewRat(3, 1)}})
+	c.Assert(err, IsNil)
+	c.Assert(mat.String(), Equals, "[[1/2], [3]]")
+
+	_, err = NewMatrixValue(nil)
+	c.Assert(err, NotNil)
+	_, err = NewMatrixValue([][]*big.Rat{{big.NewRat(1, 1)}, {}})
+	c.Assert(err, NotNil)
+}
+
+func (m *MatrixSuite) TestMatrixErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "[[1, 2, 3]] * [[1, 2, 3]]", err: "Cannot multiply 1x3 and 1x3 matrices at offset 12"},
+		{input: "[[1, 2]] + [[1], [2]]", err: "Cannot apply + to 1x2 and 2x1 matrices at offset 9"},
+		{input: "[[1, 2]] + [1, 2, 3]", err: "Cannot apply + to lists of length 1 and 3 at offset 9"},
+		{input: "[[1, 2], [3, 4]] * [1, 2, 3]", err: "Cannot multiply 2x2 matrix by vector of length 3 at offset 17"},
+		{input: "1 / [[1, 0]]", err: "Division by zero"},
+		{input: "det([[1, 2]])", err: "det: Cannot take determinant of non-square 1x2 matrix at offset 0"},
+		{input: "1 + inverse([[1, 2]])", err: "inverse: Cannot invert non-square 1x2 matrix at offset 4"},
+		{input: "inverse([[1, 2], [2, 4]])", err: "inverse: Matrix is singular"},
+		{input: "solve([[1, 2], [3, 4]], [1, 2, 3])", err: "solve: Cannot solve 2x2 matrix with 3 right hand side rows at offset 0"},
+		{input: "solve([[1, 2], [2, 4]], [1, 2])", err: "solve: Matrix is singular"},
+		{input: "transpose([1, 2])", err: "transpose: Expected matrix, got [1, 2]"},
+	}
+	for _, res := range expected {
+		_, err := evaluate(NewEvaluator(), res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+
+	_, err := evaluate(NewEvaluator(), "[[1, 2]] * [[3, 4]]")
+	dim, ok := err.(*DimensionError)
+	c.Assert(ok, Equals, true)
+	c.Assert(dim.Pos, Equals, 9)
+}
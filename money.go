@@ -0,0 +1,297 @@
+package mathval
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isCurrency returns whether the name has the form of an ISO 4217 currency code, three upper case letters
+func isCurrency(name string) bool {
+	if len(name) != 3 {
+		return false
+	}
+	for _, ch := range name {
+		if ch < 'A' || ch > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// MoneyValue is an exact amount of a currency, identified by its ISO 4217 code. Amounts in different currencies
+// can only be combined once converted to one currency with "to", see RateProvider
+type MoneyValue struct {
+	amount   *big.Rat
+	currency string
+}
+
+// NewMoneyValue returns a MoneyValue holding a copy of the given amount of the currency
+func NewMoneyValue(amount *big.Rat, currency string) *MoneyValue {
+	return &MoneyValue{amount: new(big.Rat).Set(amount), currency: currency}
+}
+
+// Amount returns a copy of the exact amount
+func (m *MoneyValue) Amount() *big.Rat {
+	return new(big.Rat).Set(m.amount)
+}
+
+// Currency returns the ISO 4217 code of the currency
+func (m *MoneyValue) Currency() string {
+	return m.currency
+}
+
+// String returns the amount in decimal followed by the currency code. Amounts are written with at least two
+// places, or as many as they need if they are a terminating decimal, otherwise they are rounded to two places
+func (m *MoneyValue) String() string {
+	return m.amount.FloatString(decimalPlaces(m.amount)) + " " + m.currency
+}
+
+// decimalPlaces returns the number of places needed to write r exactly in decimal, at least two, or two if r
+// isn't a terminating decimal
+func decimalPlaces(r *big.Rat) int {
+	d := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	for d.Bit(0) == 0 {
+		d.Rsh(d, 1)
+		twos++
+	}
+	five, m := big.NewInt(5), new(big.Int)
+	for {
+		q, _ := new(big.Int).QuoRem(d, five, m)
+		if m.Sign() != 0 {
+			break
+		}
+		d = q
+		fives++
+	}
+	places := 2
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return places
+	}
+	for _, n := range []int{twos, fives} {
+		if n > places {
+			places = n
+		}
+	}
+	return places
+}
+
+// isMoney returns whether the value is a MoneyValue
+func isMoney(val Value) bool {
+	_, ok := val.(*MoneyValue)
+	return ok
+}
+
+// amountOf returns the amount of a MoneyValue as a NumberValue, and any other value as it is
+func amountOf(val Value) Value {
+	if m, ok := val.(*MoneyValue); ok {
+		return NewNumberValue(m.amount)
+	}
+	return val
+}
+
+// moneyAndUnits returns an error if one of the values is money and the other a quantity, which can't be
+// combined, or nil otherwise
+func moneyAndUnits(a, b Value) error {
+	if (isMoney(a) && isQuantity(b)) || (isQuantity(a) && isMoney(b)) {
+		return fmt.Errorf("Cannot combine money with units, got %s and %s", a, b)
+	}
+	return nil
+}
+
+// moneyArithmetic applies the arithmetic operator where at least one operand is a MoneyValue. Amounts of the
+// same currency can be added, subtracted and divided to give a number, and amounts can be scaled by numbers
+func moneyArithmetic(op Token, a, b Value) (Value, error) {
+	x, xMoney := a.(*MoneyValue)
+	y, yMoney := b.(*MoneyValue)
+	scale := op == MULTIPLY || op == IMPLICIT_MULTIPLY
+
+	switch {
+	case xMoney && yMoney && x.currency != y.currency && !scale && op != POW:
+		return nil, fmt.Errorf("Cannot apply %s to %s and %s, convert them to one currency with 'to'", op, a, b)
+	case xMoney && yMoney && (op == DIVIDE || op == INT_DIVIDE):
+		return arithmetic(op, amountOf(a), amountOf(b))
+	case xMoney && yMoney && (op == PLUS || op == MINUS || op == MODULO),
+		xMoney && !yMoney && (scale || op == DIVIDE),
+		yMoney && !xMoney && scale:
+		res, err := arithmetic(op, amountOf(a), amountOf(b))
+		if err != nil {
+			return nil, err
+		}
+		if !xMoney {
+			x = y
+		}
+		return &MoneyValue{amount: res.(*NumberValue).val, currency: x.currency}, nil
+	}
+	return nil, fmt.Errorf("Cannot apply %s to %s and %s", op, a, b)
+}
+
+// compareMoney applies the comparison operator to two amounts of the same currency
+func compareMoney(op Token, a, b Value) (Value, error) {
+	x, xMoney := a.(*MoneyValue)
+	y, yMoney := b.(*MoneyValue)
+	if !xMoney || !yMoney || x.currency != y.currency {
+		return nil, fmt.Errorf("Cannot compare %s with %s", a, b)
+	}
+	return compare(op, amountOf(a), amountOf(b))
+}
+
+// exchange returns the money converted to the currency using the Evaluator's Rates. Lists are converted
+// element-wise. Other values are an error if strict, otherwise they are returned as they are
+func (ev *Evaluator) exchange(val Value, currency string, strict bool) (Value, error) {
+	switch v := val.(type) {
+	case *ListValue:
+		res := make([]Value, len(v.elems))
+		for i, elem := range v.elems {
+			var err error
+			if res[i], err = ev.exchange(elem, currency, strict); err != nil {
+				return nil, err
+			}
+		}
+		return &ListValue{elems: res}, nil
+	case *MoneyValue:
+		if v.currency == currency {
+			return v, nil
+		}
+		if ev.Rates == nil {
+			return nil, fmt.Errorf("No exchange rates to convert %s to %s", v.currency, currency)
+		}
+		rate, err := ev.Rates.Rate(v.currency, currency)
+		if err != nil {
+			return nil, err
+		}
+		return &MoneyValue{amount: new(big.Rat).Mul(v.amount, rate), currency: currency}, nil
+	}
+	if strict {
+		return nil, fmt.Errorf("Cannot convert %s to %s", val, currency)
+	}
+	return val, nil
+}
+
+// RateProvider supplies the exchange rates used to convert money between currencies
+type RateProvider interface {
+	// Rate returns how much of the currency to one unit of the currency from is worth
+	Rate(from, to string) (*big.Rat, error)
+}
+
+// RateTable is a RateProvider holding the rate of each currency against a common base currency, such as a
+// table published by a central bank, so that money can be converted offline. Rates between two currencies
+// other than the base are crossed through it
+type RateTable struct {
+	rates map[string]*big.Rat
+}
+
+// NewRateTable returns an empty RateTable
+func NewRateTable() *RateTable {
+	return &RateTable{rates: make(map[string]*big.Rat)}
+}
+
+// Set sets the amount of the currency which one unit of the base currency buys. The base currency itself has
+// a rate of 1
+func (t *RateTable) Set(currency string, rate *big.Rat) error {
+	if !isCurrency(currency) {
+		return fmt.Errorf("Invalid currency code %s", currency)
+	}
+	if rate.Sign() <= 0 {
+		return fmt.Errorf("Rate for %s must be positive", currency)
+	}
+	t.rates[currency] = new(big.Rat).Set(rate)
+	return nil
+}
+
+// Rate returns how much of the currency to one unit of the currency from is worth
+func (t *RateTable) Rate(from, to string) (*big.Rat, error) {
+	for _, currency := range []string{from, to} {
+		if _, ok := t.rates[currency]; !ok {
+			return nil, fmt.Errorf("No exchange rate for %s", currency)
+		}
+	}
+	return new(big.Rat).Quo(t.rates[to], t.rates[from]), nil
+}
+
+// ReadRatesCSV reads a RateTable from CSV records of a currency code and its rate against the base currency,
+// as in "EUR,0.92". The first record may be a header, and lines starting with '#' are comments
+func ReadRatesCSV(r io.Reader) (*RateTable, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	t := NewRateTable()
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return t, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rate, ok := new(big.Rat).SetString(strings.TrimSpace(record[1]))
+		if !ok && first {
+			continue
+		} else if !ok {
+			line, _ := reader.FieldPos(1)
+			return nil, fmt.Errorf("Invalid rate %q for %s on line %d", record[1], record[0], line)
+		}
+		if err := t.Set(strings.TrimSpace(record[0]), rate); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ReadRatesJSON reads a RateTable from a JSON object holding the code of the base currency and the rate of
+// each other currency against it, as in {"base": "USD", "rates": {"EUR": 0.92}}. Rates may be numbers or
+// strings, and are read exactly
+func ReadRatesJSON(r io.Reader) (*RateTable, error) {
+	var table struct {
+		Base  string
+		Rates map[string]json.Number
+	}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&table); err != nil {
+		return nil, err
+	}
+
+	t := NewRateTable()
+	if table.Base != "" {
+		if err := t.Set(table.Base, big.NewRat(1, 1)); err != nil {
+			return nil, err
+		}
+	}
+	for currency, num := range table.Rates {
+		rate, ok := new(big.Rat).SetString(num.String())
+		if !ok {
+			return nil, fmt.Errorf("Invalid rate %q for %s", num, currency)
+		}
+		if err := t.Set(currency, rate); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// LoadRates reads a RateTable from a ".csv" or ".json" file, see ReadRatesCSV and ReadRatesJSON
+func LoadRates(path string) (*RateTable, error) {
+	read := ReadRatesCSV
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+	case ".json":
+		read = ReadRatesJSON
+	default:
+		return nil, errors.New("Rate tables must be .csv or .json files")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(f)
+}
@@ -0,0 +1,184 @@
+package mathval
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type MoneySuite struct{}
+
+var _ = Suite(&MoneySuite{})
+
+// runMoney parses the program in Money mode and runs it with the given rates
+func runMoney(rates RateProvider, input string) (Value, error) {
+	parser := NewParser(strings.NewReader(input))
+	parser.SetMode(Money)
+	prog, err := parser.ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	ev := NewEvaluator()
+	ev.Rates = rates
+	res, err := ev.Run(prog)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+// testRates returns a RateTable against EUR
+func testRates() *RateTable {
+	t := NewRateTable()
+	t.Set("EUR", big.NewRat(1, 1))
+	t.Set("USD", big.NewRat(5, 4))
+	t.Set("GBP", big.NewRat(4, 5))
+	return t
+}
+
+func (m *MoneySuite) TestMoney(c *C) {
+	expected := []EvalResult{
+		{input: "100 USD + 50 EUR to GBP", expected: "104.00 GBP"},
+		{input: "100 USD + 50 USD", expected: "150.00 USD"},
+		{input: "100 USD - 150 USD", expected: "-50.00 USD"},
+		{input: "-5 EUR", expected: "-5.00 EUR"},
+		{input: "19.999 USD * 3", expected: "59.997 USD"},
+		{input: "3 * 0.1 USD", expected: "0.30 USD"},
+		{input: "10 USD / 4", expected: "2.50 USD"},
+		{input: "10 USD / 3", expected: "3.33 USD"},
+		{input: "20 USD / 3", expected: "6.67 USD"},
+		{input: "100 USD / 8 USD", expected: "25/2"},
+		{input: "100 USD \\ 8 USD", expected: "12"},
+		{input: "100 USD % 8 USD", expected: "4.00 USD"},
+		{input: "100 USD to EUR", expected: "80.00 EUR"},
+		{input: "100 USD to USD", expected: "100.00 USD"},
+		{input: "[10 USD, 20 GBP] to EUR", expected: "[8.00 EUR, 25.00 EUR]"},
+		{input: "[10 USD, 20 GBP] * 2", expected: "[20.00 USD, 40.00 GBP]"},
+		{input: "price = 20 USD; qty = 3; price * qty to EUR", expected: "48.00 EUR"},
+		{input: "(100 USD to EUR) + 5 EUR", expected: "85.00 EUR"},
+		{input: "(100 USD + 50 EUR to GBP) > 100 GBP", expected: "true"},
+		{input: "100 USD == 100 USD", expected: "true"},
+		{input: "100 USD < 50 USD", expected: "false"},
+		{input: "f(x) = x * 2; f(10 USD) + 5 EUR to EUR", expected: "21.00 EUR"},
+		{input: "sum(k, 1, 3, k * 1 USD)", expected: "6.00 USD"},
+		{input: "USD = 3; 2 * USD", expected: "6"},
+	}
+	for _, res := range expected {
+		val, err := runMoney(testRates(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+
+	// Amounts stay exact whatever is displayed
+	val, err := runMoney(nil, "10 USD / 3")
+	c.Assert(err, IsNil)
+	c.Assert(val.(*MoneyValue).Amount().RatString(), Equals, "10/3")
+	c.Assert(val.(*MoneyValue).Currency(), Equals, "USD")
+	c.Assert(LocaleDE.Format(NewMoneyValue(big.NewRat(246901, 200), "EUR"), 2), Equals, "1.234,51 EUR")
+}
+
+func (m *MoneySuite) TestMoneyErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "100 USD + 50 EUR", err: "Cannot apply + to 100.00 USD and 50.00 EUR, convert them to one currency with 'to'"},
+		{input: "100 USD / 50 EUR", err: "Cannot apply / to 100.00 USD and 50.00 EUR, convert them to one currency with 'to'"},
+		{input: "100 USD + 5", err: "Cannot apply + to 100.00 USD and 5"},
+		{input: "100 USD * 2 USD", err: "Cannot apply * to 100.00 USD and 2.00 USD"},
+		{input: "2 / 100 USD", err: "Cannot apply / to 2 and 100.00 USD"},
+		{input: "100 USD ^ 2", err: "Cannot apply ^ to 100.00 USD and 2"},
+		{input: "100 USD / 0", err: "Division by zero"},
+		{input: "100 USD > 50 EUR", err: "Cannot compare 100.00 USD with 50.00 EUR"},
+		{input: "100 USD > 50", err: "Cannot compare 100.00 USD with 50"},
+		{input: "100 USD to JPY", err: "No exchange rate for JPY"},
+		{input: "5 to EUR", err: "Cannot convert 5 to EUR"},
+		{input: "100 USD to 5", err: `Expected currency, got "5"`},
+		{input: "100 USD to usd", err: `Expected currency, got "usd"`},
+	}
+	for _, res := range expected {
+		_, err := runMoney(testRates(), res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+
+	_, err := runMoney(nil, "100 USD to EUR")
+	c.Assert(err, ErrorMatches, "No exchange rates to convert USD to EUR")
+
+	// Money and units can't be combined, so each is kept to its own kind of arithmetic
+	mixed := []struct {
+		input string
+		err   string
+	}{
+		{input: "100 USD * 2 m", err: "Cannot combine money with units, got 100.00 USD and 2 m"},
+		{input: "3 kg + 100 USD", err: "Cannot combine money with units, got 3 kg and 100.00 USD"},
+		{input: "[1 USD, 2 USD] / 1 h", err: "Cannot combine money with units, got 1.00 USD and 1 h"},
+		{input: "100 USD > 2 m", err: "Cannot combine money with units, got 100.00 USD and 2 m"},
+	}
+	for _, res := range mixed {
+		parser := NewParser(strings.NewReader(res.input))
+		parser.SetMode(Money | Units)
+		cond, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(res.input))
+		_, err = NewEvaluator().Eval(cond)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+}
+
+func (m *MoneySuite) TestParseMoney(c *C) {
+	expected := map[string]string{
+		"100 USD+50 EUR to GBP": "100 USD + 50 EUR to GBP",
+		"x to EUR":              "x to EUR",
+		"[1 USD, 2.50 EUR]":     "[1 USD, 2.50 EUR]",
+		"5 m to cm":             "5 m to cm",
+		"5 EUR / 2 m to EUR":    "5 EUR / 2 m to EUR",
+		"ABC(1) + 2":            "ABC(1) + 2",
+	}
+	for input, output := range expected {
+		parser = NewParser(strings.NewReader(input))
+		parser.SetMode(Money | Units)
+		cond, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(input))
+		c.Assert(cond.String(), Equals, output, Commentf(input))
+	}
+
+	// Without Money mode a currency is just an identifier
+	_, err := evaluate(NewEvaluator(), "100 USD")
+	c.Assert(err, NotNil)
+}
+
+func (m *MoneySuite) TestRateTable(c *C) {
+	for _, path := range []string{"testdata/rates.csv", "testdata/rates.json"} {
+		rates, err := LoadRates(path)
+		c.Assert(err, IsNil, Commentf(path))
+		rate, err := rates.Rate("USD", "GBP")
+		c.Assert(err, IsNil)
+		c.Assert(rate.RatString(), Equals, "16/25")
+		rate, err = rates.Rate("JPY", "EUR")
+		c.Assert(err, IsNil)
+		c.Assert(rate.RatString(), Equals, "1/160")
+
+		val, err := runMoney(rates, "100 USD + 50 EUR to GBP")
+		c.Assert(err, IsNil)
+		c.Assert(val.String(), Equals, "104.00 GBP")
+	}
+
+	_, err := LoadRates("testdata/rates.txt")
+	c.Assert(err, ErrorMatches, "Rate tables must be .csv or .json files")
+	_, err = LoadRates("testdata/missing.csv")
+	c.Assert(err, NotNil)
+
+	_, err = ReadRatesCSV(strings.NewReader("EUR,1\nUSD,abc\n"))
+	c.Assert(err, ErrorMatches, `Invalid rate "abc" for USD on line 2`)
+	_, err = ReadRatesCSV(strings.NewReader("EUR,1\nusd,1.25\n"))
+	c.Assert(err, ErrorMatches, "Invalid currency code usd")
+	_, err = ReadRatesCSV(strings.NewReader("EUR,1\nUSD,-1\n"))
+	c.Assert(err, ErrorMatches, "Rate for USD must be positive")
+	_, err = ReadRatesCSV(strings.NewReader("EUR,1,2\n"))
+	c.Assert(err, NotNil)
+	_, err = ReadRatesJSON(strings.NewReader(`{"base": "EUR", "rates": {"USD": "abc"}}`))
+	c.Assert(err, NotNil)
+	_, err = ReadRatesJSON(strings.NewReader(`{"base": "EUR", "rates": {"USD": 0}}`))
+	c.Assert(err, ErrorMatches, "Rate for USD must be positive")
+}
@@ -2,18 +2,95 @@ package mathval
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Mode is a set of flags controlling optional Parser behaviour
+type Mode uint
+
+const (
+	// ImplicitMultiplication multiplies juxtaposed terms, so "2x", "3(a+b)" and "(a+b)(a-b)" are products.
+	// Juxtaposition has the same precedence as '*', so "1/2x" is "(1/2)*x". An identifier directly followed
+	// by '(' is always a call, so "x(a+b)" must be written "x*(a+b)" or "(a+b)x". Identifiers may contain
+	// digits, so "x2" is an identifier rather than "x*2"
+	ImplicitMultiplication Mode = 1 << iota
+
+	// TightImplicitMultiplication implies ImplicitMultiplication, but makes juxtaposition bind tighter than
+	// '*' and '/', so "1/2x" is "1/(2x)"
+	TightImplicitMultiplication
+
+	// Units allows a number to be followed by a unit, as in "5 m" or "3 km/h", and a Conditional to be
+	// followed by "to" and a unit to convert it, as in "x to mph", see UnitRegistry. A unit after a number
+	// takes precedence over a variable of the same name
+	Units
+
+	// Dates reads ISO 8601 dates and times, as in "2024-03-15" or "2024-03-15T10:30:00Z", and durations, as in
+	// "3d", "2h30m" or "PT2H30M". A number directly followed by a duration unit is a duration, so "2m" is two
+	// minutes rather than "2*m", see DateValue and DurationValue
+	Dates
+
+	// Money allows a number to be followed by an ISO 4217 currency code, as in "100 USD", and a Conditional to be
+	// followed by "to" and a currency to convert it, as in "100 USD + 50 EUR to GBP", see MoneyValue. A currency
+	// code takes precedence over a unit or variable of the same name
+	Money
+
+	// Cells reads ranges of cells, as in "sum(A1:A10)", which evaluate to a list of the values of the variables
+	// named by each cell in the range, row by row, leaving out any which aren't set, see Sheet
+	Cells
+
+	// Excel reads formulas pasted from a spreadsheet, as in "=IF(A1>10, ROUND(A1*1.2, 2), 0)", and implies
+	// Cells. The leading '=' is dropped, '=' and '<>' compare, ';' separates arguments like ',', text is written
+	// in double quotes and joined with '&'. Function names are case-insensitive, and IF, SUM, ROUND, AVERAGE,
+	// MIN, MAX, ABS and MOD are read as the mathval equivalents, so formulas print in mathval's syntax. TRUE and
+	// FALSE are true() and false(), with or without parentheses. As '=' compares, Excel is meant for single
+	// formulas rather than Programs
+	Excel
 )
 
 // Parser is a parser including a Scanner and a buffer
 type Parser struct {
-	s   *Scanner
-	buf struct {
+	s     *Scanner
+	mode  Mode
+	units *UnitRegistry
+	buf   struct {
 		tok Token  // last read token
 		lit string // last read literal
+		pos int    // offset in runes of the last read token
 		n   int    // buffer size. Currently max=1 as no lookahead
 	}
+	ahead struct {
+		tok Token  // token following the buffered one, see peekSecond
+		lit string // literal following the buffered one
+		pos int    // offset in runes of the token following the buffered one
+		n   int    // buffer size, max=1
+	}
+
+	// comments holds comments read from the scanner which haven't yet been attached to a node
+	comments []string
+
+	// program is set while parsing a Program, where newlines can separate statements
+	program bool
+	lexed   struct {
+		last  Token // last non-whitespace token read from the scanner
+		depth int   // parenthesis and bracket nesting of the last token read from the scanner
+		pos   int   // offset in runes of the last token read from the scanner
+	}
+}
+
+// SyntaxError is an error in the source read by a front-end which reports where it is, such as LaTeXParser or
+// RPNParser
+type SyntaxError struct {
+	Msg string
+	Pos int // offset in runes in the source
+}
+
+// Error returns the message, followed by the position
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Msg, e.Pos)
 }
 
 // NewParser returns a new instance of Parser with the defined lookahead length
@@ -21,6 +98,102 @@ func NewParser(r io.Reader) *Parser {
 	return &Parser{s: NewScanner(r)}
 }
 
+// SetMode sets the flags controlling optional Parser behaviour
+func (p *Parser) SetMode(mode Mode) {
+	if mode&Excel != 0 {
+		mode |= Cells
+	}
+	p.mode = mode
+	p.s.SetDates(mode&Dates != 0)
+	p.s.SetRanges(mode&Cells != 0)
+}
+
+// SetUnits sets the UnitRegistry used in Units mode, which is a registry from NewUnitRegistry by default
+func (p *Parser) SetUnits(units *UnitRegistry) {
+	p.units = units
+}
+
+// registry returns the UnitRegistry used in Units mode
+func (p *Parser) registry() *UnitRegistry {
+	if p.units == nil {
+		return defaultUnits
+	}
+	return p.units
+}
+
+// SetLocale sets the Locale used to read numbers and argument lists, which is LocaleEN by default. The AST is
+// still printed with a '.' decimal mark and ',' separators whatever the Locale, see Locale.Format for results
+func (p *Parser) SetLocale(l *Locale) {
+	p.s.SetLocale(l)
+}
+
+// lex returns the next token from the scanner. Comments are set aside to be attached to the next node parsed,
+// see takeComments. While parsing a Program, whitespace containing a newline is returned as a SEMICOLON if it
+// is outside any parentheses or brackets and follows a token which can end a statement, so "1 +" followed by
+// a newline and "2" is still a single statement. A SEMICOLON inside them is a COMMA if the Locale uses ';' as
+// its separator or in Excel mode, where an ASSIGN is an EQ and "<>" is a NEQ
+func (p *Parser) lex() (Token, string) {
+	tok, lit := p.s.Scan()
+	for ; tok == COMMENT; tok, lit = p.s.Scan() {
+		p.comments = append(p.comments, lit)
+	}
+	p.lexed.pos = p.s.start
+	switch tok {
+	case LPAREN, LBRACKET:
+		p.lexed.depth++
+	case RPAREN, RBRACKET:
+		if p.lexed.depth > 0 {
+			p.lexed.depth--
+		}
+	case SEMICOLON:
+		if p.lexed.depth != 0 && (p.s.locale.Separator == ';' || p.mode&Excel != 0) {
+			tok = COMMA
+		}
+	case ASSIGN:
+		if p.mode&Excel != 0 {
+			tok = EQ
+		}
+	case LT:
+		if p.mode&Excel != 0 && p.s.readIf('>') {
+			tok, lit = NEQ, "<>"
+		}
+	case WS:
+		if !p.program || p.lexed.depth != 0 || !endsStatement(p.lexed.last) || !strings.ContainsRune(lit, '\n') {
+			return tok, lit
+		}
+		tok = SEMICOLON
+	}
+	p.lexed.last = tok
+	return tok, lit
+}
+
+// takeComments returns the comments read since the last call, to be attached to a node
+func (p *Parser) takeComments() []string {
+	comments := p.comments
+	p.comments = nil
+	return comments
+}
+
+// endsStatement returns whether a statement can end with the given token
+func endsStatement(tok Token) bool {
+	switch tok {
+	case DIGITS, DATE, DURATION, RANGE, STRING, UNKNOWN_KEYWORD, RPAREN, RBRACKET, FACTORIAL, MODULO, SUPERSCRIPT:
+		return true
+	}
+	return false
+}
+
+// next returns the next token and its offset from the lookahead buffer if it is full, otherwise from the
+// scanner
+func (p *Parser) next() (Token, string, int) {
+	if p.ahead.n != 0 {
+		p.ahead.n = 0
+		return p.ahead.tok, p.ahead.lit, p.ahead.pos
+	}
+	tok, lit := p.lex()
+	return tok, lit, p.lexed.pos
+}
+
 // scan returns the next token from the underlying scanner
 func (p *Parser) scan() (tok Token, lit string) {
 	// If we have a token on the buffer, then return it.
@@ -30,7 +203,7 @@ func (p *Parser) scan() (tok Token, lit string) {
 	}
 
 	// Otherwise read the next token from the scanner.
-	tok, lit = p.s.Scan()
+	tok, lit, p.buf.pos = p.next()
 
 	// Save it to the buffer in case we unscan later.
 	p.buf.tok, p.buf.lit = tok, lit
@@ -44,30 +217,274 @@ func (p *Parser) unscan() { p.buf.n = 1 }
 // peek returns the next token in the scanner. Whitespace is ignored
 func (p *Parser) peek() (Token, string) {
 	if p.buf.n == 0 {
-		p.buf.tok, p.buf.lit = p.s.Scan()
+		p.buf.tok, p.buf.lit, p.buf.pos = p.next()
 		p.buf.n = 1
 	}
 
-	// Ignore whitespace
-	if p.buf.tok == WS {
-		p.buf.tok, p.buf.lit = p.s.Scan()
+	// Ignore whitespace, which comments can split into several tokens
+	for p.buf.tok == WS {
+		p.buf.tok, p.buf.lit, p.buf.pos = p.next()
 	}
 
 	return p.buf.tok, p.buf.lit
 }
 
+// peekSecond returns the token after the one returned by peek. Whitespace is ignored
+func (p *Parser) peekSecond() (Token, string) {
+	p.peek()
+	if p.ahead.n == 0 {
+		p.ahead.tok, p.ahead.lit = p.lex()
+		for p.ahead.tok == WS {
+			p.ahead.tok, p.ahead.lit = p.lex()
+		}
+		p.ahead.pos = p.lexed.pos
+		p.ahead.n = 1
+	}
+	return p.ahead.tok, p.ahead.lit
+}
+
 // scanIgnoreWhitespace scans the next non-whitespace token
 func (p *Parser) scanIgnoreWhitespace() (tok Token, lit string) {
 	tok, lit = p.scan()
-	if tok == WS {
+	for tok == WS {
 		tok, lit = p.scan()
 	}
 	return
 }
 
-// Parse parses the output from the Scanner
-func (p *Parser) Parse() (*Expression, error) {
-	return p.parseExpression()
+// Parse parses the output from the Scanner, which must hold exactly one expression
+func (p *Parser) Parse() (*Conditional, error) {
+	// A formula in a spreadsheet cell starts with '=', which the lexer reads as an EQ in Excel mode
+	if tok, lit := p.peek(); p.mode&Excel != 0 && tok == EQ && lit == "=" {
+		p.scanIgnoreWhitespace()
+	}
+
+	cond, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok, lit := p.peek(); tok != EOF {
+		if p.startsOperand() {
+			return nil, fmt.Errorf("Unexpected %q after expression, use '*' or enable ImplicitMultiplication", lit)
+		}
+		return nil, fmt.Errorf("Unexpected %q after expression", lit)
+	}
+	return cond, nil
+}
+
+// ParseProgram parses the output from the Scanner as a sequence of statements separated by ';' or newlines
+func (p *Parser) ParseProgram() (*Program, error) {
+	p.program = true
+	defer func() { p.program = false }()
+
+	prog := &Program{}
+	for {
+		switch tok, lit := p.peek(); tok {
+		case EOF:
+			prog.comments = p.takeComments()
+			return prog, nil
+		case SEMICOLON:
+			p.scanIgnoreWhitespace()
+			continue
+		default:
+			comments := p.takeComments()
+			stmt, err := p.parseStatement()
+			if err != nil {
+				return nil, err
+			}
+			stmt.comments = append(comments, stmt.comments...)
+			prog.statements = append(prog.statements, stmt)
+
+			if tok, lit = p.peek(); tok != SEMICOLON && tok != EOF {
+				return nil, fmt.Errorf("Unexpected %q after statement", lit)
+			}
+		}
+	}
+}
+
+// parseStatement parses a Statement starting at the next Token. Assignments and definitions start out looking
+// like an identifier or a call, so they are parsed as a Conditional which is converted once the '=' is found.
+// Comments on the converted terms are kept on the Statement
+func (p *Parser) parseStatement() (stmt *Statement, err error) {
+	if tok, _ := p.peek(); tok == EOF {
+		return nil, errors.New("Unexpected EOF")
+	}
+
+	stmt = &Statement{}
+	if stmt.cond, err = p.parseConditional(); err != nil {
+		return nil, err
+	}
+	if tok, _ := p.peek(); tok != ASSIGN {
+		return
+	}
+	p.scanIgnoreWhitespace()
+
+	term := stmt.cond.soleTerm()
+	if term != nil && term.ident != nil {
+		asg := &Assignment{name: term.ident.name}
+		if asg.value, err = p.parseConditional(); err != nil {
+			return nil, err
+		}
+		return &Statement{assignment: asg, comments: term.comments()}, nil
+	}
+	if term == nil || term.call == nil {
+		return nil, fmt.Errorf("Cannot assign to %s", stmt.cond)
+	}
+	def := &Definition{name: term.call.name}
+	comments := term.comments()
+	for _, arg := range term.call.args {
+		param := arg.soleTerm()
+		if param == nil || param.ident == nil {
+			return nil, fmt.Errorf("Invalid parameter %s in definition of %s", arg, def.name)
+		}
+		def.params = append(def.params, param.ident.name)
+		comments = append(comments, param.comments()...)
+	}
+	if def.body, err = p.parseConditional(); err != nil {
+		return nil, err
+	}
+	return &Statement{definition: def, comments: comments}, nil
+}
+
+// parseConditional recursively parses a Conditional starting at the next Token
+func (p *Parser) parseConditional() (cond *Conditional, err error) {
+	if tok, _ := p.peek(); tok == EOF {
+		return nil, errors.New("Unexpected EOF")
+	}
+
+	cond = &Conditional{}
+	cond.disjunction, err = p.parseDisjunction()
+	if err != nil {
+		return
+	}
+
+	// Check for a ternary
+	if tok, _ := p.peek(); tok == QUESTION {
+		p.scanIgnoreWhitespace()
+		cond.then, err = p.parseConditional()
+		if err != nil {
+			return
+		}
+		if tok, _ = p.peek(); tok != COLON {
+			return cond, errors.New("Expected COLON")
+		}
+		p.scanIgnoreWhitespace()
+		if cond.els, err = p.parseConditional(); err != nil {
+			return
+		}
+	}
+
+	// Check for a conversion
+	if tok, lit := p.peek(); p.mode&(Units|Money) != 0 && tok == UNKNOWN_KEYWORD && lit == "to" {
+		p.scanIgnoreWhitespace()
+		if p.startsCurrency() {
+			_, cond.currency = p.scanIgnoreWhitespace()
+		} else if p.mode&Units != 0 {
+			cond.to, err = p.parseUnit()
+		} else {
+			_, lit = p.scanIgnoreWhitespace()
+			err = fmt.Errorf("Expected currency, got %q", lit)
+		}
+	}
+	return
+}
+
+// parseDisjunction recursively parses a Disjunction starting at the next Token
+func (p *Parser) parseDisjunction() (dis *Disjunction, err error) {
+	if tok, _ := p.peek(); tok == EOF {
+		return nil, errors.New("Unexpected EOF")
+	}
+
+	dis = &Disjunction{}
+	dis.conjunction, err = p.parseConjunction()
+	if err != nil {
+		return
+	}
+
+	// Check for a logical or
+	if tok, _ := p.peek(); tok == OR {
+		dis.op = &OrOp{}
+		dis.op.op, _ = p.scanIgnoreWhitespace()
+		dis.op.pos = p.buf.pos
+		dis.disjunction, err = p.parseDisjunction()
+	}
+	return
+}
+
+// parseConjunction recursively parses a Conjunction starting at the next Token
+func (p *Parser) parseConjunction() (con *Conjunction, err error) {
+	if tok, _ := p.peek(); tok == EOF {
+		return nil, errors.New("Unexpected EOF")
+	}
+
+	con = &Conjunction{}
+	con.comparison, err = p.parseComparison()
+	if err != nil {
+		return
+	}
+
+	// Check for a logical and
+	if tok, _ := p.peek(); tok == AND {
+		con.op = &AndOp{}
+		con.op.op, _ = p.scanIgnoreWhitespace()
+		con.op.pos = p.buf.pos
+		con.conjunction, err = p.parseConjunction()
+	}
+	return
+}
+
+// parseComparison parses a Comparison starting at the next Token. Comparisons do not chain, so "1 < 2 < 3"
+// leaves the second operator unconsumed
+func (p *Parser) parseComparison() (cmp *Comparison, err error) {
+	if tok, _ := p.peek(); tok == EOF {
+		return nil, errors.New("Unexpected EOF")
+	}
+
+	cmp = &Comparison{}
+	for tok, _ := p.peek(); tok == NOT; tok, _ = p.peek() {
+		not := &NotOp{}
+		not.op, _ = p.scanIgnoreWhitespace()
+		not.pos = p.buf.pos
+		cmp.not = append(cmp.not, not)
+	}
+
+	cmp.expression, err = p.parseConcatenation()
+	if err != nil {
+		return
+	}
+
+	// Check for a comparison operator
+	if tok, _ := p.peek(); tok >= comparison_begin && tok <= comparison_end {
+		cmp.op, err = p.parseCompareOp()
+		if err != nil {
+			return
+		}
+		cmp.right, err = p.parseConcatenation()
+	}
+	return
+}
+
+// parseConcatenation parses an Expression, followed in Excel mode by any Expressions joined to it with '&',
+// which binds looser than arithmetic but tighter than comparison. A concatenation is read as a call to concat
+func (p *Parser) parseConcatenation() (exp *Expression, err error) {
+	exp, err = p.parseExpression()
+	if tok, _ := p.peek(); err != nil || tok != CONCAT || p.mode&Excel == 0 {
+		return
+	}
+
+	call := &Call{name: "concat", args: []*Conditional{conditionalOf(exp)}}
+	for tok, _ := p.peek(); tok == CONCAT; tok, _ = p.peek() {
+		p.scanIgnoreWhitespace()
+		if call.pos == 0 {
+			call.pos = p.buf.pos
+		}
+		if exp, err = p.parseExpression(); err != nil {
+			return
+		}
+		call.args = append(call.args, conditionalOf(exp))
+	}
+	return &Expression{factor: &Factor{power: &Power{term: &Term{call: call}}}}, nil
 }
 
 // parseExpression recursively parses an Expression starting at the next Token
@@ -100,11 +517,22 @@ func (p *Parser) parseFactor() (fac *Factor, err error) {
 	}
 
 	fac = &Factor{}
-	fac.power, err = p.parsePower()
+	if p.mode&TightImplicitMultiplication != 0 {
+		fac.power, err = p.parseJuxtaposition()
+	} else {
+		fac.power, err = p.parsePower()
+	}
 	if err != nil {
 		return
 	}
 
+	// Check for juxtaposition, which is an implicit multiplicative operator
+	if p.mode&ImplicitMultiplication != 0 && p.startsOperand() {
+		fac.op = &MultiplyOp{op: IMPLICIT_MULTIPLY, pos: p.buf.pos}
+		fac.factor, err = p.parseFactor()
+		return
+	}
+
 	// Check for a multiplicative operator
 	if tok, _ := p.peek(); tok >= multiplicative_begin && tok <= multiplicative_end {
 		fac.op, err = p.parseMultiplyOp()
@@ -116,20 +544,56 @@ func (p *Parser) parseFactor() (fac *Factor, err error) {
 	return
 }
 
+// parseJuxtaposition parses a Power followed by any directly juxtaposed Powers. When there is more than one,
+// their product is returned as a parenthesised Power so that it binds tighter than '*' and '/'
+func (p *Parser) parseJuxtaposition() (pow *Power, err error) {
+	if pow, err = p.parsePower(); err != nil || !p.startsOperand() {
+		return
+	}
+
+	fac := &Factor{power: pow}
+	for last := fac; p.startsOperand(); last = last.factor {
+		last.op = &MultiplyOp{op: IMPLICIT_MULTIPLY, pos: p.buf.pos}
+		last.factor = &Factor{}
+		if last.factor.power, err = p.parsePower(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Power{term: &Term{exp: conditionalOf(&Expression{factor: fac}), group: true}}, nil
+}
+
+// startsOperand returns whether the next Token can start a Term, which makes it juxtaposed with the previous
+// Term
+func (p *Parser) startsOperand() bool {
+	switch tok, lit := p.peek(); tok {
+	case UNKNOWN_KEYWORD:
+		// In Units mode "to" begins a conversion rather than a factor
+		return p.mode&(Units|Money) == 0 || lit != "to"
+	case DIGITS, DATE, DURATION, RANGE, LPAREN, SQRT:
+		return true
+	}
+	return false
+}
+
 // parsePower recursively parses a Power starting at the next Token
 func (p *Parser) parsePower() (pow *Power, err error) {
 	if tok, _ := p.peek(); tok == EOF {
 		return nil, errors.New("Unexpected EOF")
 	}
 
-	pow = &Power{}
+	pow = &Power{unary: p.parseSigns()}
 	pow.term, err = p.parseTerm()
 	if err != nil {
 		return
 	}
 
-	// Check for an exponentiation operator
-	if tok, _ := p.peek(); tok >= exponentiation_begin && tok <= exponentiation_end {
+	// Check for an exponentiation operator. Superscript digits are an exponent on their own
+	if tok, lit := p.peek(); tok == SUPERSCRIPT {
+		p.scanIgnoreWhitespace()
+		pow.op = &ExponentOp{op: POW, pos: p.buf.pos}
+		pow.power, err = superscriptPower(lit)
+	} else if tok >= exponentiation_begin && tok <= exponentiation_end {
 		pow.op, err = p.parseExponentOp()
 		if err != nil {
 			return
@@ -139,31 +603,435 @@ func (p *Parser) parsePower() (pow *Power, err error) {
 	return
 }
 
+// parseSigns parses any unary '+' and '-' starting at the next Token
+func (p *Parser) parseSigns() (signs []*UnaryOp) {
+	for tok, _ := p.peek(); tok == PLUS || tok == MINUS; tok, _ = p.peek() {
+		unary := &UnaryOp{}
+		unary.op, _ = p.scanIgnoreWhitespace()
+		unary.pos = p.buf.pos
+		signs = append(signs, unary)
+	}
+	return
+}
+
 // parseTerm recursively parses a Term starting at the next Token
 func (p *Parser) parseTerm() (term *Term, err error) {
 	if tok, _ := p.peek(); tok == EOF {
 		return nil, errors.New("Unexpected EOF")
 	}
 
-	term = &Term{}
+	term = &Term{leading: p.takeComments()}
 
-	// '(' EXPRESSION ')'
+	// '(' CONDITIONAL ')'
+	// A parenthesised list of parameters is only distinguishable from a parenthesised CONDITIONAL once the
+	// '->' is found, so both are parsed as a list of Conditionals first
 	if tok, _ := p.peek(); tok == LPAREN {
 		p.scanIgnoreWhitespace()
-		term.exp, err = p.parseExpression()
-		if tok, _ = p.peek(); tok != RPAREN {
-			return term, errors.New("Expected RPAREN")
+		var elems []*Conditional
+		if elems, err = p.parseElements(RPAREN); err != nil {
+			return
+		}
+
+		if tok, _ = p.peek(); tok == ARROW {
+			var params []string
+			if params, err = paramNames(elems); err != nil {
+				return
+			}
+			term.lambda, err = p.parseLambda(params)
+		} else if len(elems) != 1 {
+			return term, errors.New("Expected ARROW after parameter list")
+		} else {
+			term.exp = elems[0]
 		}
+	} else if tok == LBRACKET {
 		p.scanIgnoreWhitespace()
+		term.list = &ListLiteral{}
+		term.list.elems, err = p.parseElements(RBRACKET)
+	} else if tok == SQRT {
+		// √ applies to the following signed Term, so "√4!" is "sqrt(4!)", "√-4" is "sqrt(-4)" and "√x^2" is
+		// "sqrt(x)^2"
+		p.scanIgnoreWhitespace()
+		term.call = &Call{name: "sqrt", pos: p.buf.pos}
+		signs := p.parseSigns()
+		var arg *Term
+		if arg, err = p.parseTerm(); err != nil {
+			return
+		}
+		term.call.args = []*Conditional{radicand(signs, arg)}
 	} else if tok == DIGITS {
-		term.number, err = p.parseNumber()
+		if term.number, err = p.parseNumber(); err == nil && p.startsCurrency() {
+			_, term.currency = p.scanIgnoreWhitespace()
+		} else if err == nil && p.startsUnit() {
+			term.unit, err = p.parseUnit()
+		}
+	} else if tok == DATE {
+		_, lit := p.scanIgnoreWhitespace()
+		term.date = &Date{str: lit}
+		term.date.val, err = parseDate(lit)
+	} else if tok == DURATION {
+		_, lit := p.scanIgnoreWhitespace()
+		term.duration = &Duration{str: lit}
+		term.duration.val, err = parseDuration(lit)
+	} else if tok == RANGE {
+		_, lit := p.scanIgnoreWhitespace()
+		i := strings.IndexByte(lit, ':')
+		term.cells = &Range{from: lit[:i], to: lit[i+1:]}
+	} else if tok == STRING && p.mode&Excel != 0 {
+		_, lit := p.scanIgnoreWhitespace()
+		term.text = &StringLiteral{str: lit, val: strings.ReplaceAll(lit[1:len(lit)-1], `""`, `"`)}
+	} else if tok == UNKNOWN_KEYWORD {
+		_, name := p.scanIgnoreWhitespace()
+		pos := p.buf.pos
+		if tok, _ = p.peek(); tok == LPAREN && name == "piecewise" {
+			term.piecewise, err = p.parsePiecewise()
+		} else if tok == LPAREN {
+			if term.call, err = p.parseCall(name); err == nil {
+				term.call.pos = pos
+			}
+			if err == nil && p.mode&Excel != 0 {
+				err = excelCall(term)
+			}
+		} else if tok == ARROW {
+			term.lambda, err = p.parseLambda([]string{name})
+		} else if p.mode&Excel != 0 && excelBoolean(name) {
+			term.call = &Call{name: strings.ToLower(name), pos: pos}
+		} else {
+			term.ident = &Identifier{name: name}
+		}
 	} else {
-		// TODO add helper in tokens.go to convert token values to names for errors
-		return nil, errors.New("Unexpected TOKEN")
+		return nil, fmt.Errorf("Unexpected %s", tok)
+	}
+	if err != nil {
+		return
+	}
+
+	for tok, _ := p.peek(); tok == LBRACKET; tok, _ = p.peek() {
+		var index *Index
+		if index, err = p.parseIndex(); err != nil {
+			return
+		}
+		term.index = append(term.index, index)
+	}
+
+	for p.isPostfixOp() {
+		var op *PostfixOp
+		if op, err = p.parsePostfixOp(); err != nil {
+			return
+		}
+		term.postfix = append(term.postfix, op)
 	}
+	term.trailing = p.takeComments()
 	return
 }
 
+// isPostfixOp returns whether the next Token is a postfix operator. A MODULO is only a percentage when it
+// isn't followed by something that could start its right hand operand, so "20 % 3" is a modulo but
+// "20% + 3" and "20%" are percentages. A sign is the start of a negative divisor if it is written against
+// it but apart from the '%', so "20 % -3" is a modulo but "20% - 3" and "20%-3" are percentages
+func (p *Parser) isPostfixOp() bool {
+	switch tok, _ := p.peek(); tok {
+	case FACTORIAL:
+		return true
+	case MODULO:
+		switch next, _ := p.peekSecond(); next {
+		case DIGITS, DATE, DURATION, RANGE, UNKNOWN_KEYWORD, LPAREN, LBRACKET, NOT, SQRT:
+			return false
+		case PLUS, MINUS:
+			return !p.signsOperand()
+		}
+		return true
+	}
+	return false
+}
+
+// signsOperand returns whether the sign peekSecond returned after a MODULO is separated from the '%' by
+// whitespace and directly followed by its operand
+func (p *Parser) signsOperand() bool {
+	if p.ahead.pos == p.buf.pos+1 {
+		return false
+	}
+	next := p.s.peekRunes(1)
+	return len(next) == 1 && !isWhitespace(next[0])
+}
+
+// parseElements parses a comma separated, possibly empty, list of Conditionals up to and including the given
+// closing Token
+func (p *Parser) parseElements(close Token) (elems []*Conditional, err error) {
+	if tok, _ := p.peek(); tok != close {
+		for {
+			var elem *Conditional
+			if elem, err = p.parseConditional(); err != nil {
+				return nil, err
+			}
+			elems = append(elems, elem)
+			if tok, _ = p.peek(); tok != COMMA {
+				break
+			}
+			p.scanIgnoreWhitespace()
+		}
+	}
+	if tok, _ := p.peek(); tok != close {
+		return nil, fmt.Errorf("Expected %q", close.String())
+	}
+	p.scanIgnoreWhitespace()
+	return
+}
+
+// parseIndex parses an Index or slice starting at the next Token, which must be '['
+func (p *Parser) parseIndex() (index *Index, err error) {
+	if tok, _ := p.peek(); tok != LBRACKET {
+		return nil, errors.New(`Expected "["`)
+	}
+	p.scanIgnoreWhitespace()
+
+	index = &Index{}
+	if tok, _ := p.peek(); tok != COLON {
+		if index.from, err = p.parseConditional(); err != nil {
+			return nil, err
+		}
+	}
+	if tok, _ := p.peek(); tok == COLON {
+		p.scanIgnoreWhitespace()
+		index.slice = true
+		if tok, _ = p.peek(); tok != RBRACKET {
+			if index.to, err = p.parseConditional(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if index.from == nil && !index.slice {
+		return nil, errors.New("Expected index")
+	}
+
+	if tok, _ := p.peek(); tok != RBRACKET {
+		return nil, errors.New(`Expected "]"`)
+	}
+	p.scanIgnoreWhitespace()
+	return
+}
+
+// parseLambda parses the '->' and body of a Lambda with the given parameters
+func (p *Parser) parseLambda(params []string) (lambda *Lambda, err error) {
+	if tok, _ := p.peek(); tok != ARROW {
+		return nil, errors.New("Expected ARROW")
+	}
+	p.scanIgnoreWhitespace()
+
+	lambda = &Lambda{params: params}
+	lambda.body, err = p.parseConditional()
+	return
+}
+
+// paramNames returns the names of the parameters of a Lambda, which were parsed as Conditionals that must each
+// be a sole identifier
+func paramNames(params []*Conditional) ([]string, error) {
+	names := make([]string, len(params))
+	for i, param := range params {
+		term := param.soleTerm()
+		if term == nil || term.ident == nil {
+			return nil, fmt.Errorf("Invalid parameter %s in lambda", param)
+		}
+		names[i] = term.ident.name
+	}
+	return names, nil
+}
+
+// parseCall parses the parenthesised argument list of a call to the named function
+func (p *Parser) parseCall(name string) (call *Call, err error) {
+	if tok, _ := p.peek(); tok != LPAREN {
+		return nil, errors.New("Expected LPAREN")
+	}
+	p.scanIgnoreWhitespace()
+
+	call = &Call{name: name}
+	if tok, _ := p.peek(); tok == RPAREN {
+		p.scanIgnoreWhitespace()
+		return
+	}
+
+	for {
+		var arg *Conditional
+		if arg, err = p.parseConditional(); err != nil {
+			return
+		}
+		call.args = append(call.args, arg)
+
+		tok, _ := p.scanIgnoreWhitespace()
+		if tok == RPAREN {
+			return
+		} else if tok != COMMA {
+			return call, errors.New("Expected COMMA or RPAREN")
+		}
+	}
+}
+
+// startsCurrency returns whether the Parser is in Money mode and the next Token is a currency code which isn't
+// being called as a function
+func (p *Parser) startsCurrency() bool {
+	if p.mode&Money == 0 {
+		return false
+	}
+	if tok, lit := p.peek(); tok != UNKNOWN_KEYWORD || !isCurrency(lit) {
+		return false
+	}
+	next, _ := p.peekSecond()
+	return next != LPAREN
+}
+
+// startsUnit returns whether the Parser is in Units mode and the next Token is the name of a unit which isn't
+// being called as a function
+func (p *Parser) startsUnit() bool {
+	if p.mode&Units == 0 {
+		return false
+	}
+	tok, lit := p.peek()
+	if tok != UNKNOWN_KEYWORD {
+		return false
+	}
+	if _, ok := p.registry().lookup(lit); !ok {
+		return false
+	}
+	next, _ := p.peekSecond()
+	return next != LPAREN
+}
+
+// parseUnit parses a Unit starting at the next Token. A '*' or '/' only continues the Unit if it is followed
+// by the name of a unit, so "5 m / 2 s" divides two quantities while "3 km/h" is a speed
+func (p *Parser) parseUnit() (unit *Unit, err error) {
+	unit = &Unit{scale: big.NewRat(1, 1)}
+	sign := 1
+	for {
+		tok, name := p.scanIgnoreWhitespace()
+		if tok != UNKNOWN_KEYWORD {
+			return nil, fmt.Errorf("Expected unit, got %q", name)
+		}
+		def, ok := p.registry().lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown unit %s", name)
+		}
+
+		exp := 1
+		if tok, _ = p.peek(); tok == POW {
+			if next, _ := p.peekSecond(); next == DIGITS || next == MINUS {
+				p.scanIgnoreWhitespace()
+				if exp, err = p.parseUnitExponent(); err != nil {
+					return
+				}
+			}
+		}
+		f := &Unit{factors: []unitFactor{{name: name, exp: 1}}, scale: def.scale, dims: def.dims}
+		if f, err = f.pow(exp); err != nil {
+			return
+		}
+		unit = unit.mul(f, sign)
+
+		tok, _ = p.peek()
+		if tok != MULTIPLY && tok != DIVIDE {
+			return
+		}
+		if next, lit := p.peekSecond(); next != UNKNOWN_KEYWORD {
+			return
+		} else if _, ok := p.registry().lookup(lit); !ok {
+			return
+		}
+		p.scanIgnoreWhitespace()
+		sign = 1
+		if tok == DIVIDE {
+			sign = -1
+		}
+	}
+}
+
+// parseUnitExponent parses the integer exponent of a unit following a '^'
+func (p *Parser) parseUnitExponent() (int, error) {
+	negative := false
+	if tok, _ := p.peek(); tok == MINUS {
+		p.scanIgnoreWhitespace()
+		negative = true
+	}
+	tok, lit := p.scanIgnoreWhitespace()
+	if tok != DIGITS {
+		return 0, errors.New("Expected unit exponent")
+	}
+	exp, err := strconv.Atoi(lit)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid unit exponent %s", lit)
+	}
+	if negative {
+		exp = -exp
+	}
+	return exp, nil
+}
+
+// superscriptPower returns the exponent written in superscript digits as a Power, given its ASCII form
+func superscriptPower(lit string) (*Power, error) {
+	pow := &Power{}
+	if strings.HasPrefix(lit, "-") {
+		pow.unary = []*UnaryOp{{op: MINUS}}
+		lit = lit[1:]
+	}
+	val, ok := new(big.Rat).SetString(lit)
+	if !ok {
+		return nil, fmt.Errorf("Invalid superscript %s", lit)
+	}
+	pow.term = &Term{number: &Number{str: lit, val: val}}
+	return pow, nil
+}
+
+// radicand returns the signed Term following a √ as the argument to sqrt, dropping its parentheses if it is only
+// a parenthesised Conditional so that "√(x + 1)" is the same as "sqrt(x + 1)"
+func radicand(signs []*UnaryOp, term *Term) *Conditional {
+	if len(signs) == 0 && term.exp != nil && !term.group && len(term.index) == 0 && len(term.postfix) == 0 && len(term.comments()) == 0 {
+		return term.exp
+	}
+	return conditionalOf(&Expression{factor: &Factor{power: &Power{unary: signs, term: term}}})
+}
+
+// parsePiecewise parses the parenthesised cases of a Piecewise, the next Token being '('. The else case must
+// come last
+func (p *Parser) parsePiecewise() (pw *Piecewise, err error) {
+	if tok, _ := p.peek(); tok != LPAREN {
+		return nil, errors.New("Expected LPAREN")
+	}
+	p.scanIgnoreWhitespace()
+
+	pw = &Piecewise{}
+	for {
+		if tok, lit := p.peek(); tok == UNKNOWN_KEYWORD && lit == "else" {
+			if next, _ := p.peekSecond(); next == COLON {
+				p.scanIgnoreWhitespace()
+				p.scanIgnoreWhitespace()
+				if pw.els, err = p.parseConditional(); err != nil {
+					return
+				}
+				if tok, _ := p.scanIgnoreWhitespace(); tok != RPAREN {
+					return pw, errors.New(`Expected ")" after else`)
+				}
+				return
+			}
+		}
+
+		c := &Case{}
+		if c.cond, err = p.parseConditional(); err != nil {
+			return
+		}
+		if tok, _ := p.scanIgnoreWhitespace(); tok != COLON {
+			return pw, errors.New(`Expected ":" after piecewise condition`)
+		}
+		if c.value, err = p.parseConditional(); err != nil {
+			return
+		}
+		pw.cases = append(pw.cases, c)
+
+		tok, _ := p.scanIgnoreWhitespace()
+		if tok == RPAREN {
+			return
+		} else if tok != COMMA {
+			return pw, errors.New("Expected COMMA or RPAREN")
+		}
+	}
+}
+
 // parseNumber parses the number represented by the next Token
 func (p *Parser) parseNumber() (num *Number, err error) {
 	if tok, _ := p.peek(); tok == EOF {
@@ -208,6 +1076,7 @@ func (p *Parser) parseAddOp() (add *AddOp, err error) {
 		return nil, errors.New("Expected additive operator")
 	}
 	add.op, _ = p.scanIgnoreWhitespace()
+	add.pos = p.buf.pos
 	return
 }
 
@@ -222,6 +1091,7 @@ func (p *Parser) parseMultiplyOp() (mul *MultiplyOp, err error) {
 		return nil, errors.New("Expected multiplicative operator")
 	}
 	mul.op, _ = p.scanIgnoreWhitespace()
+	mul.pos = p.buf.pos
 	return
 }
 
@@ -236,5 +1106,41 @@ func (p *Parser) parseExponentOp() (exp *ExponentOp, err error) {
 		return nil, errors.New("Expected exponentiation operator")
 	}
 	exp.op, _ = p.scanIgnoreWhitespace()
+	exp.pos = p.buf.pos
+	return
+}
+
+// parseCompareOp parses a CompareOp starting at the next Token
+func (p *Parser) parseCompareOp() (cmp *CompareOp, err error) {
+	if tok, _ := p.peek(); tok == EOF {
+		return nil, errors.New("Unexpected EOF")
+	}
+
+	cmp = &CompareOp{}
+	if tok, _ := p.peek(); tok < comparison_begin || tok > comparison_end {
+		return nil, errors.New("Expected comparison operator")
+	}
+	cmp.op, _ = p.scanIgnoreWhitespace()
+	cmp.pos = p.buf.pos
+	return
+}
+
+// parsePostfixOp parses a PostfixOp starting at the next Token
+func (p *Parser) parsePostfixOp() (post *PostfixOp, err error) {
+	if tok, _ := p.peek(); tok == EOF {
+		return nil, errors.New("Unexpected EOF")
+	}
+
+	post = &PostfixOp{}
+	tok, _ := p.scanIgnoreWhitespace()
+	post.pos = p.buf.pos
+	switch tok {
+	case FACTORIAL:
+		post.op = FACTORIAL
+	case MODULO:
+		post.op = PERCENT
+	default:
+		return nil, errors.New("Expected postfix operator")
+	}
 	return
 }
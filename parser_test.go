@@ -18,6 +18,17 @@ type ParseResult struct {
 	literal string
 }
 
+// wrap returns a Conditional containing only the given Expression, the shape the parser produces for
+// arithmetic expressions
+func wrap(exp *Expression) *Conditional {
+	return &Conditional{disjunction: &Disjunction{conjunction: &Conjunction{comparison: &Comparison{expression: exp}}}}
+}
+
+// unwrap returns the Expression held by a Conditional produced for an arithmetic expression
+func unwrap(cond *Conditional) *Expression {
+	return cond.disjunction.conjunction.comparison.expression
+}
+
 // Hook up gocheck into the "go test" runner.
 func Test(t *testing.T) { TestingT(t) }
 
@@ -28,6 +39,10 @@ var _ = Suite(&ParserSuite{})
 type expressionChecker struct {
 	info *CheckerInfo
 }
+type conditionalChecker expressionChecker
+type disjunctionChecker expressionChecker
+type conjunctionChecker expressionChecker
+type comparisonChecker expressionChecker
 type opChecker expressionChecker
 type factorChecker expressionChecker
 type powerChecker expressionChecker
@@ -38,6 +53,10 @@ var ExpressionEquals Checker = &expressionChecker{
 	&CheckerInfo{Name: "ExpressionEquals", Params: []string{"obtained", "expected"}},
 }
 
+var ConditionalEquals Checker = &conditionalChecker{
+	&CheckerInfo{Name: "ConditionalEquals", Params: []string{"obtained", "expected"}},
+}
+
 var OperatorEquals Checker = &opChecker{
 	&CheckerInfo{Name: "Operator", Params: []string{"obtained", "expected"}},
 }
@@ -57,9 +76,255 @@ func (p *ParserSuite) TestParse(c *C) {
 		op:         &AddOp{op: PLUS},
 		expression: &Expression{factor: &Factor{power: &Power{term: &Term{number: &Number{str: "1", val: big.NewRat(1, 1)}}}}},
 	}
-	exp, err := parser.Parse()
+	cond, err := parser.Parse()
+	c.Assert(err, IsNil)
+	c.Assert(cond, ConditionalEquals, wrap(expected))
+}
+
+func (p *ParserSuite) TestParseTrailing(c *C) {
+	for _, input := range []string{"x y", "2 3", "2x", "(1)(2)", "1 < 2 < 3", "1)"} {
+		parser = NewParser(strings.NewReader(input))
+		_, err := parser.Parse()
+		c.Assert(err, NotNil, Commentf(input))
+	}
+
+	parser = NewParser(strings.NewReader("x y"))
+	_, err := parser.Parse()
+	c.Assert(err, ErrorMatches, ".*ImplicitMultiplication.*")
+}
+
+func (p *ParserSuite) TestParseImplicitMultiplication(c *C) {
+	// "1/2x" is "(1/2)*x"
+	parser = NewParser(strings.NewReader("1/2x"))
+	parser.SetMode(ImplicitMultiplication)
+	cond, err := parser.Parse()
 	c.Assert(err, IsNil)
-	c.Assert(exp, ExpressionEquals, expected)
+	fac := unwrap(cond).factor
+	c.Assert(fac.op.op, Equals, DIVIDE)
+	c.Assert(fac.factor.power.term.number.str, Equals, "2")
+	c.Assert(fac.factor.op.op, Equals, IMPLICIT_MULTIPLY)
+	c.Assert(fac.factor.factor.power.term.ident.name, Equals, "x")
+
+	// "1/2x" is "1/(2x)"
+	parser = NewParser(strings.NewReader("1/2x"))
+	parser.SetMode(TightImplicitMultiplication)
+	cond, err = parser.Parse()
+	c.Assert(err, IsNil)
+	fac = unwrap(cond).factor
+	c.Assert(fac.op.op, Equals, DIVIDE)
+	c.Assert(fac.factor.op, IsNil)
+	group := unwrap(fac.factor.power.term.exp).factor
+	c.Assert(group.power.term.number.str, Equals, "2")
+	c.Assert(group.op.op, Equals, IMPLICIT_MULTIPLY)
+	c.Assert(group.factor.power.term.ident.name, Equals, "x")
+
+	for _, mode := range []Mode{ImplicitMultiplication, TightImplicitMultiplication} {
+		for _, input := range []string{"2x", "3(a+b)", "(a+b)(a-b)", "2 pi", "x y z", "2x^2", "-2x"} {
+			parser = NewParser(strings.NewReader(input))
+			parser.SetMode(mode)
+			_, err = parser.Parse()
+			c.Assert(err, IsNil, Commentf(input))
+		}
+	}
+}
+
+func (p *ParserSuite) TestParseProgram(c *C) {
+	parser = NewParser(strings.NewReader("f(x, y) = x^2 + y; ; f(3, 4) * 2;"))
+	prog, err := parser.ParseProgram()
+	c.Assert(err, IsNil)
+	c.Assert(prog.statements, HasLen, 2)
+
+	def := prog.statements[0].definition
+	c.Assert(def.name, Equals, "f")
+	c.Assert(def.params, DeepEquals, []string{"x", "y"})
+	c.Assert(def.body.String(), Equals, "x^2 + y")
+	c.Assert(prog.statements[1].definition, IsNil)
+	c.Assert(prog.statements[1].cond.String(), Equals, "f(3, 4) * 2")
+
+	// Empty programs are valid
+	parser = NewParser(strings.NewReader(" ; "))
+	prog, err = parser.ParseProgram()
+	c.Assert(err, IsNil)
+	c.Assert(prog.statements, HasLen, 0)
+
+	// Newlines separate statements only where a statement can end
+	parser = NewParser(strings.NewReader("a = 1\n\nb = (a\n+ 1) *\n2\nf(a, b) = a -\nb\n"))
+	prog, err = parser.ParseProgram()
+	c.Assert(err, IsNil)
+	c.Assert(prog.statements, HasLen, 3)
+	c.Assert(prog.statements[0].assignment.name, Equals, "a")
+	c.Assert(prog.statements[0].assignment.value.String(), Equals, "1")
+	c.Assert(prog.String(), Equals, "a = 1; b = (a + 1) * 2; f(a, b) = a - b")
+
+	// Newlines are whitespace outside programs
+	parser = NewParser(strings.NewReader("1\n+ 2"))
+	cond, err := parser.Parse()
+	c.Assert(err, IsNil)
+	c.Assert(cond.String(), Equals, "1 + 2")
+
+	// Invalid definitions and assignments
+	for _, input := range []string{"a + 1 = 2", "(a) = 2", "a = ", "f(1) = 2", "f(x + 1) = 2", "-f(x) = 2", "f(x) = ", "1 = 2", "f(x) 2"} {
+		parser = NewParser(strings.NewReader(input))
+		_, err = parser.ParseProgram()
+		c.Assert(err, NotNil, Commentf(input))
+	}
+}
+
+func (p *ParserSuite) TestParseComments(c *C) {
+	parser = NewParser(strings.NewReader("# header\nrate = /* vat */ 0.2 # standard\nnet(gross) = gross / (1 + rate) // ex vat\n# end"))
+	prog, err := parser.ParseProgram()
+	c.Assert(err, IsNil)
+	c.Assert(prog.statements, HasLen, 2)
+	c.Assert(prog.statements[0].comments, DeepEquals, []string{"# header"})
+	term := prog.statements[0].assignment.value.soleTerm()
+	c.Assert(term.leading, DeepEquals, []string{"/* vat */"})
+	c.Assert(term.trailing, DeepEquals, []string{"# standard"})
+	c.Assert(prog.statements[1].comments, IsNil)
+	c.Assert(prog.statements[1].definition.body.String(), Equals, "gross / (1 + rate) // ex vat\n")
+	c.Assert(prog.comments, DeepEquals, []string{"# end"})
+
+	// Comments on the name of an assignment are kept on the statement
+	parser = NewParser(strings.NewReader("a /* x */ = 1"))
+	prog, err = parser.ParseProgram()
+	c.Assert(err, IsNil)
+	c.Assert(prog.statements[0].comments, DeepEquals, []string{"/* x */"})
+
+	// Comments are skipped like whitespace
+	parser = NewParser(strings.NewReader("1 +/* a */# b\n// c\n2"))
+	cond, err := parser.Parse()
+	c.Assert(err, IsNil)
+	c.Assert(cond, ConditionalEquals, wrap(&Expression{
+		factor:     &Factor{power: &Power{term: &Term{number: &Number{str: "1", val: big.NewRat(1, 1)}}}},
+		op:         &AddOp{op: PLUS},
+		expression: &Expression{factor: &Factor{power: &Power{term: &Term{number: &Number{str: "2", val: big.NewRat(2, 1)}}}}},
+	}))
+
+	parser = NewParser(strings.NewReader("1 + /* 2"))
+	_, err = parser.Parse()
+	c.Assert(err, NotNil)
+}
+
+func (p *ParserSuite) TestParseLambda(c *C) {
+	expected := []struct {
+		input  string
+		params []string
+		body   string
+	}{
+		{input: "x -> x * 1.2", params: []string{"x"}, body: "x * 1.2"},
+		{input: "(a, b) -> a + b", params: []string{"a", "b"}, body: "a + b"},
+		{input: "() -> 1", params: []string{}, body: "1"},
+		{input: "(x) -> y -> x + y", params: []string{"x"}, body: "y -> x + y"},
+	}
+	for _, res := range expected {
+		parser = NewParser(strings.NewReader(res.input))
+		cond, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(res.input))
+		term := cond.soleTerm()
+		c.Assert(term, NotNil, Commentf(res.input))
+		c.Assert(term.lambda.params, DeepEquals, res.params)
+		c.Assert(term.lambda.body.String(), Equals, res.body)
+	}
+
+	// Lambdas as arguments end at the comma
+	parser = NewParser(strings.NewReader("reduce(xs, (a, b) -> a + b, 0)"))
+	cond, err := parser.Parse()
+	c.Assert(err, IsNil)
+	c.Assert(cond.soleTerm().call.args, HasLen, 3)
+
+	for _, input := range []string{"(1, 2)", "()", "(x + 1) -> x", "(a, 2) -> a", "1 -> 2", "x ->"} {
+		parser = NewParser(strings.NewReader(input))
+		_, err = parser.Parse()
+		c.Assert(err, NotNil, Commentf(input))
+	}
+}
+
+func (p *ParserSuite) TestParseList(c *C) {
+	parser = NewParser(strings.NewReader("[1, x][a ? 0 : 1][1:][:2]%"))
+	cond, err := parser.Parse()
+	c.Assert(err, IsNil)
+	term := cond.soleTerm()
+	c.Assert(term, IsNil)
+
+	term = unwrap(cond).factor.power.term
+	c.Assert(term.list.elems, HasLen, 2)
+	c.Assert(term.index, HasLen, 3)
+	c.Assert(term.index[0].slice, Equals, false)
+	c.Assert(term.index[0].from.String(), Equals, "a ? 0 : 1")
+	c.Assert(term.index[1].slice, Equals, true)
+	c.Assert(term.index[1].to, IsNil)
+	c.Assert(term.index[2].from, IsNil)
+	c.Assert(term.postfix, HasLen, 1)
+
+	// Newlines inside brackets don't separate statements
+	parser = NewParser(strings.NewReader("xs = [\n  1,\n  2\n]\nxs[0]"))
+	prog, err := parser.ParseProgram()
+	c.Assert(err, IsNil)
+	c.Assert(prog.statements, HasLen, 2)
+
+	for _, input := range []string{"[1, 2", "[1 2]", "xs[]", "xs[1:2:3]", "xs[1"} {
+		parser = NewParser(strings.NewReader(input))
+		_, err = parser.Parse()
+		c.Assert(err, NotNil, Commentf(input))
+	}
+}
+
+func (p *ParserSuite) TestParsePiecewise(c *C) {
+	parser = NewParser(strings.NewReader("piecewise(x < 10: 0, x < 50: x * 0.1, else: x * 0.2)"))
+	cond, err := parser.Parse()
+	c.Assert(err, IsNil)
+	term := cond.soleTerm()
+	c.Assert(term, NotNil)
+	c.Assert(term.piecewise, NotNil)
+	c.Assert(term.piecewise.cases, HasLen, 2)
+	c.Assert(term.piecewise.cases[0].cond.String(), Equals, "x < 10")
+	c.Assert(term.piecewise.cases[1].value.String(), Equals, "x * 0.1")
+	c.Assert(term.piecewise.els.String(), Equals, "x * 0.2")
+
+	// Without an else
+	parser = NewParser(strings.NewReader("piecewise(x < 0: -x, x >= 0: x)"))
+	cond, err = parser.Parse()
+	c.Assert(err, IsNil)
+	c.Assert(cond.soleTerm().piecewise.els, IsNil)
+
+	// Newlines inside the parentheses don't separate statements
+	parser = NewParser(strings.NewReader("tax(x) = piecewise(\n  x < 10: 0,\n  else: x / 10\n)\ntax(20)"))
+	prog, err := parser.ParseProgram()
+	c.Assert(err, IsNil)
+	c.Assert(prog.statements, HasLen, 2)
+
+	for _, input := range []string{"piecewise()", "piecewise(x < 1)", "piecewise(x < 1: 1", "piecewise(else: 1, x: 2)", "piecewise(x: 1 2)"} {
+		parser = NewParser(strings.NewReader(input))
+		_, err = parser.Parse()
+		c.Assert(err, NotNil, Commentf(input))
+	}
+}
+
+func (p *ParserSuite) TestParseLogical(c *C) {
+	parser = NewParser(strings.NewReader("not 1 < 2 and 3 >= 4 or 5 != 6 ? 7 : 8"))
+	num := func(s string, n int64) *Expression {
+		return &Expression{factor: &Factor{power: &Power{term: &Term{number: &Number{str: s, val: big.NewRat(n, 1)}}}}}
+	}
+	expected := &Conditional{
+		disjunction: &Disjunction{
+			conjunction: &Conjunction{
+				comparison: &Comparison{
+					not:        []*NotOp{{op: NOT}},
+					expression: num("1", 1),
+					op:         &CompareOp{op: LT},
+					right:      num("2", 2),
+				},
+				op:          &AndOp{op: AND},
+				conjunction: &Conjunction{comparison: &Comparison{expression: num("3", 3), op: &CompareOp{op: GTE}, right: num("4", 4)}},
+			},
+			op:          &OrOp{op: OR},
+			disjunction: &Disjunction{conjunction: &Conjunction{comparison: &Comparison{expression: num("5", 5), op: &CompareOp{op: NEQ}, right: num("6", 6)}}},
+		},
+		then: wrap(num("7", 7)),
+		els:  wrap(num("8", 8)),
+	}
+	cond, err := parser.Parse()
+	c.Assert(err, IsNil)
+	c.Assert(cond, ConditionalEquals, expected)
 }
 
 func (t *ParserSuite) TestNewParser(c *C) {
@@ -120,6 +385,71 @@ func (t *ParserSuite) TestPeek(c *C) {
 	c.Assert(lit, Equals, "+")
 }
 
+func (t *ParserSuite) TestPeekSecond(c *C) {
+	parser = NewParser(strings.NewReader("1 + 2"))
+
+	tok, lit := parser.peekSecond()
+	c.Assert(tok, Equals, PLUS)
+	c.Assert(lit, Equals, "+")
+
+	expected := []ParseResult{
+		{token: DIGITS, literal: "1"},
+		{token: PLUS, literal: "+"},
+		{token: DIGITS, literal: "2"},
+		{token: EOF, literal: ""},
+	}
+	for _, res := range expected {
+		token, literal := parser.scanIgnoreWhitespace()
+		c.Assert(token, Equals, res.token)
+		c.Assert(literal, Equals, res.literal)
+	}
+}
+
+func (p *ParserSuite) TestParsePostfixOp(c *C) {
+	// Assert EOF checking
+	parser = NewParser(strings.NewReader(""))
+	post, err := parser.parsePostfixOp()
+	c.Assert(post, IsNil)
+	c.Assert(err, NotNil)
+
+	// Normal inputs
+	expected := []PostfixOp{
+		{op: FACTORIAL},
+		{op: PERCENT},
+	}
+	parser = NewParser(strings.NewReader("!%"))
+	for _, res := range expected {
+		post, err = parser.parsePostfixOp()
+		c.Assert(post, NotNil)
+		c.Assert(post.op, Equals, res.op)
+		c.Assert(err, IsNil)
+	}
+
+	// Non-PostfixOp
+	parser = NewParser(strings.NewReader("+"))
+	_, err = parser.parsePostfixOp()
+	c.Assert(err, NotNil)
+}
+
+func (p *ParserSuite) TestParsePercentOrModulo(c *C) {
+	percent := []string{"20%", "20% + 1", "(20%)", "20 % - 1", "20%!", "20%-1", "20%+ x", "20 % -"}
+	for _, input := range percent {
+		parser = NewParser(strings.NewReader(input))
+		fac, err := parser.parseFactor()
+		c.Assert(err, IsNil, Commentf(input))
+		c.Assert(fac.op, IsNil, Commentf(input))
+	}
+
+	modulo := []string{"20 % 3", "20%x", "20 % (1)", "20 % -3", "20% +x", "20 % −(1)", "20 % --3"}
+	for _, input := range modulo {
+		parser = NewParser(strings.NewReader(input))
+		fac, err := parser.parseFactor()
+		c.Assert(err, IsNil, Commentf(input))
+		c.Assert(fac.op.op, Equals, MODULO, Commentf(input))
+		c.Assert(fac.power.term.postfix, HasLen, 0, Commentf(input))
+	}
+}
+
 func (p *ParserSuite) TestParseExponentOp(c *C) {
 	// Assert EOF checking
 	parser = NewParser(strings.NewReader(""))
@@ -238,13 +568,97 @@ func (p *ParserSuite) TestParseTerm(c *C) {
 	// "(10)"
 	parser = NewParser(strings.NewReader("(10)"))
 	term, err = parser.parseTerm()
-	c.Assert(term.exp.factor.power.term.number.str, Equals, "10")
+	c.Assert(unwrap(term.exp).factor.power.term.number.str, Equals, "10")
 	c.Assert(term.number, IsNil)
+	// "x"
+	parser = NewParser(strings.NewReader("x"))
+	term, err = parser.parseTerm()
+	c.Assert(err, IsNil)
+	c.Assert(term.ident.name, Equals, "x")
+	// "f(1, x)"
+	parser = NewParser(strings.NewReader("f(1, x)"))
+	term, err = parser.parseTerm()
+	c.Assert(err, IsNil)
+	c.Assert(term.call.name, Equals, "f")
+	c.Assert(term.call.args, HasLen, 2)
+	c.Assert(unwrap(term.call.args[1]).factor.power.term.ident.name, Equals, "x")
+	// "f()"
+	parser = NewParser(strings.NewReader("f()"))
+	term, err = parser.parseTerm()
+	c.Assert(err, IsNil)
+	c.Assert(term.call.args, HasLen, 0)
+	// "√-4", "√+x" and "√−−x^2", whose signs are part of the radicand
+	for input, signs := range map[string]int{"√-4": 1, "√+x": 1, "√−−x^2": 2} {
+		parser = NewParser(strings.NewReader(input))
+		term, err = parser.parseTerm()
+		c.Assert(err, IsNil, Commentf(input))
+		c.Assert(term.call.name, Equals, "sqrt", Commentf(input))
+		c.Assert(unwrap(term.call.args[0]).factor.power.unary, HasLen, signs, Commentf(input))
+		c.Assert(unwrap(term.call.args[0]).factor.power.op, IsNil, Commentf(input))
+	}
 
 	// No RPAREN
 	parser = NewParser(strings.NewReader("(10"))
 	_, err = parser.parseTerm()
 	c.Assert(err, NotNil)
+	parser = NewParser(strings.NewReader("f(1 2)"))
+	_, err = parser.parseTerm()
+	c.Assert(err, NotNil)
+	// No radicand
+	parser = NewParser(strings.NewReader("√-"))
+	_, err = parser.parseTerm()
+	c.Assert(err, NotNil)
+}
+
+func (p *ParserSuite) TestParseCompareOp(c *C) {
+	// Assert EOF checking
+	parser = NewParser(strings.NewReader(""))
+	cmp, err := parser.parseCompareOp()
+	c.Assert(cmp, IsNil)
+	c.Assert(err, NotNil)
+
+	// Normal inputs
+	expected := []CompareOp{
+		{op: EQ},
+		{op: NEQ},
+		{op: LTE},
+		{op: LT},
+		{op: GTE},
+		{op: GT},
+	}
+	parser = NewParser(strings.NewReader("== != <= < >= >"))
+	for _, res := range expected {
+		cmp, err = parser.parseCompareOp()
+		c.Assert(cmp, NotNil)
+		c.Assert(cmp.op, Equals, res.op)
+		c.Assert(err, IsNil)
+	}
+
+	// Non-CompareOp
+	parser = NewParser(strings.NewReader("+"))
+	_, err = parser.parseCompareOp()
+	c.Assert(err, NotNil)
+}
+
+func (p *ParserSuite) TestParseConditional(c *C) {
+	// Assert EOF checking
+	parser = NewParser(strings.NewReader(""))
+	cond, err := parser.parseConditional()
+	c.Assert(cond, IsNil)
+	c.Assert(err, NotNil)
+
+	// Ternaries nest to the right
+	parser = NewParser(strings.NewReader("1 ? 2 : 3 ? 4 : 5"))
+	cond, err = parser.parseConditional()
+	c.Assert(err, IsNil)
+	c.Assert(unwrap(cond.then).factor.power.term.number.str, Equals, "2")
+	c.Assert(unwrap(cond.els.then).factor.power.term.number.str, Equals, "4")
+	c.Assert(unwrap(cond.els.els).factor.power.term.number.str, Equals, "5")
+
+	// No COLON
+	parser = NewParser(strings.NewReader("1 ? 2"))
+	_, err = parser.parseConditional()
+	c.Assert(err, NotNil)
 }
 
 func (p *ParserSuite) TestParsePower(c *C) {
@@ -268,10 +682,24 @@ func (p *ParserSuite) TestParsePower(c *C) {
 	c.Assert(pow.op.op, Equals, POW)
 	c.Assert(pow.power.term.number.str, Equals, "2")
 
+	// "-2^-3!"
+	parser = NewParser(strings.NewReader("-2^-3!"))
+	pow, err = parser.parsePower()
+	c.Assert(err, IsNil)
+	c.Assert(pow.unary, HasLen, 1)
+	c.Assert(pow.unary[0].op, Equals, MINUS)
+	c.Assert(pow.term.number.str, Equals, "2")
+	c.Assert(pow.power.unary[0].op, Equals, MINUS)
+	c.Assert(pow.power.term.postfix[0].op, Equals, FACTORIAL)
+
 	// No POWER after POW
 	parser = NewParser(strings.NewReader("10^"))
 	_, err = parser.parsePower()
 	c.Assert(err, NotNil)
+	// No TERM after UNARY_OP
+	parser = NewParser(strings.NewReader("--"))
+	_, err = parser.parsePower()
+	c.Assert(err, NotNil)
 }
 
 func (p *ParserSuite) TestParseFactor(c *C) {
@@ -329,6 +757,179 @@ func (p *ParserSuite) TestParseExpression(c *C) {
 }
 
 // Checker methods
+func (e *conditionalChecker) Check(params []interface{}, names []string) (result bool, err string) {
+	var obtained, expected *Conditional
+	var ok bool
+	if obtained, ok = params[0].(*Conditional); !ok {
+		return false, "Not a Conditional"
+	}
+	if expected, ok = params[1].(*Conditional); !ok {
+		return false, "Not a Conditional"
+	}
+
+	// Nil checks
+	if ((obtained == nil || expected == nil) && obtained != expected) ||
+		((obtained.disjunction == nil || expected.disjunction == nil) && obtained.disjunction != expected.disjunction) ||
+		((obtained.then == nil || expected.then == nil) && obtained.then != expected.then) ||
+		((obtained.els == nil || expected.els == nil) && obtained.els != expected.els) {
+		return false, "Conditionals not equal"
+	}
+
+	if obtained.disjunction != nil {
+		d := &disjunctionChecker{}
+		if result, err = d.Check([]interface{}{obtained.disjunction, expected.disjunction}, names); !result {
+			return
+		}
+	}
+
+	if obtained.then != nil {
+		if result, err = e.Check([]interface{}{obtained.then, expected.then}, names); !result {
+			return
+		}
+		if result, err = e.Check([]interface{}{obtained.els, expected.els}, names); !result {
+			return
+		}
+	}
+
+	return true, ""
+}
+func (e *conditionalChecker) Info() *CheckerInfo {
+	return e.info
+}
+
+func (d *disjunctionChecker) Check(params []interface{}, names []string) (result bool, err string) {
+	var obtained, expected *Disjunction
+	var ok bool
+	if obtained, ok = params[0].(*Disjunction); !ok {
+		return false, "Not a Disjunction"
+	}
+	if expected, ok = params[1].(*Disjunction); !ok {
+		return false, "Not a Disjunction"
+	}
+
+	// Nil checks
+	if ((obtained == nil || expected == nil) && obtained != expected) ||
+		((obtained.conjunction == nil || expected.conjunction == nil) && obtained.conjunction != expected.conjunction) ||
+		((obtained.disjunction == nil || expected.disjunction == nil) && obtained.disjunction != expected.disjunction) ||
+		((obtained.op == nil || expected.op == nil) && obtained.op != expected.op) {
+		return false, "Disjunctions not equal"
+	}
+
+	if obtained.disjunction != nil {
+		if result, err = d.Check([]interface{}{obtained.disjunction, expected.disjunction}, names); !result {
+			return
+		}
+	}
+
+	if obtained.conjunction != nil {
+		con := &conjunctionChecker{}
+		if result, err = con.Check([]interface{}{obtained.conjunction, expected.conjunction}, names); !result {
+			return
+		}
+	}
+
+	if obtained.op != nil {
+		o := &opChecker{}
+		if result, err = o.Check([]interface{}{obtained.op, expected.op}, names); !result {
+			return
+		}
+	}
+
+	return true, ""
+}
+func (d *disjunctionChecker) Info() *CheckerInfo {
+	return d.info
+}
+
+func (con *conjunctionChecker) Check(params []interface{}, names []string) (result bool, err string) {
+	var obtained, expected *Conjunction
+	var ok bool
+	if obtained, ok = params[0].(*Conjunction); !ok {
+		return false, "Not a Conjunction"
+	}
+	if expected, ok = params[1].(*Conjunction); !ok {
+		return false, "Not a Conjunction"
+	}
+
+	// Nil checks
+	if ((obtained == nil || expected == nil) && obtained != expected) ||
+		((obtained.comparison == nil || expected.comparison == nil) && obtained.comparison != expected.comparison) ||
+		((obtained.conjunction == nil || expected.conjunction == nil) && obtained.conjunction != expected.conjunction) ||
+		((obtained.op == nil || expected.op == nil) && obtained.op != expected.op) {
+		return false, "Conjunctions not equal"
+	}
+
+	if obtained.conjunction != nil {
+		if result, err = con.Check([]interface{}{obtained.conjunction, expected.conjunction}, names); !result {
+			return
+		}
+	}
+
+	if obtained.comparison != nil {
+		cmp := &comparisonChecker{}
+		if result, err = cmp.Check([]interface{}{obtained.comparison, expected.comparison}, names); !result {
+			return
+		}
+	}
+
+	if obtained.op != nil {
+		o := &opChecker{}
+		if result, err = o.Check([]interface{}{obtained.op, expected.op}, names); !result {
+			return
+		}
+	}
+
+	return true, ""
+}
+func (con *conjunctionChecker) Info() *CheckerInfo {
+	return con.info
+}
+
+func (cmp *comparisonChecker) Check(params []interface{}, names []string) (result bool, err string) {
+	var obtained, expected *Comparison
+	var ok bool
+	if obtained, ok = params[0].(*Comparison); !ok {
+		return false, "Not a Comparison"
+	}
+	if expected, ok = params[1].(*Comparison); !ok {
+		return false, "Not a Comparison"
+	}
+
+	// Nil checks
+	if ((obtained == nil || expected == nil) && obtained != expected) ||
+		((obtained.expression == nil || expected.expression == nil) && obtained.expression != expected.expression) ||
+		((obtained.right == nil || expected.right == nil) && obtained.right != expected.right) ||
+		((obtained.op == nil || expected.op == nil) && obtained.op != expected.op) ||
+		len(obtained.not) != len(expected.not) {
+		return false, "Comparisons not equal"
+	}
+
+	e := &expressionChecker{}
+	if obtained.expression != nil {
+		if result, err = e.Check([]interface{}{obtained.expression, expected.expression}, names); !result {
+			return
+		}
+	}
+
+	if obtained.right != nil {
+		if result, err = e.Check([]interface{}{obtained.right, expected.right}, names); !result {
+			return
+		}
+	}
+
+	if obtained.op != nil {
+		o := &opChecker{}
+		if result, err = o.Check([]interface{}{obtained.op, expected.op}, names); !result {
+			return
+		}
+	}
+
+	return true, ""
+}
+func (cmp *comparisonChecker) Info() *CheckerInfo {
+	return cmp.info
+}
+
 func (e *expressionChecker) Check(params []interface{}, names []string) (result bool, err string) {
 	var obtained, expected *Expression
 	var ok bool
@@ -474,12 +1075,84 @@ func (t *termChecker) Check(params []interface{}, names []string) (result bool,
 	// Nil checks
 	if ((obtained == nil || expected == nil) && obtained != expected) ||
 		((obtained.exp == nil || expected.exp == nil) && obtained.exp != expected.exp) ||
-		((obtained.number == nil || expected.number == nil) && obtained.number != expected.number) {
+		((obtained.number == nil || expected.number == nil) && obtained.number != expected.number) ||
+		((obtained.ident == nil || expected.ident == nil) && obtained.ident != expected.ident) ||
+		((obtained.call == nil || expected.call == nil) && obtained.call != expected.call) ||
+		((obtained.lambda == nil || expected.lambda == nil) && obtained.lambda != expected.lambda) ||
+		((obtained.list == nil || expected.list == nil) && obtained.list != expected.list) ||
+		((obtained.piecewise == nil || expected.piecewise == nil) && obtained.piecewise != expected.piecewise) ||
+		len(obtained.index) != len(expected.index) {
+		return false, "Terms not equal"
+	}
+
+	if obtained.list != nil {
+		if len(obtained.list.elems) != len(expected.list.elems) {
+			return false, "Terms not equal"
+		}
+		e := &conditionalChecker{}
+		for i := range obtained.list.elems {
+			if result, err = e.Check([]interface{}{obtained.list.elems[i], expected.list.elems[i]}, names); !result {
+				return
+			}
+		}
+	}
+
+	if obtained.piecewise != nil {
+		if len(obtained.piecewise.cases) != len(expected.piecewise.cases) ||
+			(obtained.piecewise.els == nil) != (expected.piecewise.els == nil) {
+			return false, "Terms not equal"
+		}
+		e := &conditionalChecker{}
+		for i, obtainedCase := range obtained.piecewise.cases {
+			expectedCase := expected.piecewise.cases[i]
+			if result, err = e.Check([]interface{}{obtainedCase.cond, expectedCase.cond}, names); !result {
+				return
+			}
+			if result, err = e.Check([]interface{}{obtainedCase.value, expectedCase.value}, names); !result {
+				return
+			}
+		}
+		if obtained.piecewise.els != nil {
+			if result, err = e.Check([]interface{}{obtained.piecewise.els, expected.piecewise.els}, names); !result {
+				return
+			}
+		}
+	}
+
+	for i := range obtained.index {
+		if obtained.index[i].String() != expected.index[i].String() {
+			return false, "Indexes not equal"
+		}
+	}
+
+	if obtained.ident != nil && obtained.ident.name != expected.ident.name {
 		return false, "Terms not equal"
 	}
 
+	if obtained.call != nil {
+		if obtained.call.name != expected.call.name || len(obtained.call.args) != len(expected.call.args) {
+			return false, "Terms not equal"
+		}
+		e := &conditionalChecker{}
+		for i := range obtained.call.args {
+			if result, err = e.Check([]interface{}{obtained.call.args[i], expected.call.args[i]}, names); !result {
+				return
+			}
+		}
+	}
+
+	if obtained.lambda != nil {
+		if strings.Join(obtained.lambda.params, ",") != strings.Join(expected.lambda.params, ",") {
+			return false, "Terms not equal"
+		}
+		e := &conditionalChecker{}
+		if result, err = e.Check([]interface{}{obtained.lambda.body, expected.lambda.body}, names); !result {
+			return
+		}
+	}
+
 	if obtained.exp != nil {
-		e := &expressionChecker{}
+		e := &conditionalChecker{}
 		if result, err = e.Check([]interface{}{obtained.exp, expected.exp}, names); !result {
 			return
 		}
@@ -535,6 +1208,15 @@ func (o *opChecker) Check(params []interface{}, names []string) (result bool, er
 	} else if a, ok := params[0].(*ExponentOp); ok {
 		obtained = (*Operator)(a)
 		expected = (*Operator)(params[1].(*ExponentOp))
+	} else if a, ok := params[0].(*CompareOp); ok {
+		obtained = (*Operator)(a)
+		expected = (*Operator)(params[1].(*CompareOp))
+	} else if a, ok := params[0].(*AndOp); ok {
+		obtained = (*Operator)(a)
+		expected = (*Operator)(params[1].(*AndOp))
+	} else if a, ok := params[0].(*OrOp); ok {
+		obtained = (*Operator)(a)
+		expected = (*Operator)(params[1].(*OrOp))
 	} else {
 		return false, "Not an Operator"
 	}
@@ -0,0 +1,57 @@
+package mathval
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// evalPiecewise evaluates the value of the first Case whose condition is true, or the else value. If there is
+// no else value and no condition is true the Piecewise isn't exhaustive for the current values of the variables
+// it depends on, which are included in the error
+func (ev *Evaluator) evalPiecewise(pw *Piecewise) (Value, error) {
+	for _, c := range pw.cases {
+		val, err := ev.evalConditional(c.cond)
+		if err != nil {
+			return nil, err
+		}
+		b, err := toBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("piecewise: %s", err)
+		}
+		if b {
+			return ev.evalConditional(c.value)
+		}
+	}
+	if pw.els != nil {
+		return ev.evalConditional(pw.els)
+	}
+
+	unmatched := ev.unmatched(pw)
+	if len(unmatched) == 0 {
+		return nil, errors.New("piecewise: No case matches")
+	}
+	return nil, fmt.Errorf("piecewise: No case matches %s", strings.Join(unmatched, ", "))
+}
+
+// unmatched describes the value of each variable in the conditions of the Piecewise, in the order they first
+// appear. Constants and functions are left out
+func (ev *Evaluator) unmatched(pw *Piecewise) []string {
+	var res []string
+	seen := make(map[string]bool)
+	for _, c := range pw.cases {
+		c.cond.rewrite(func(term *Term) *Term {
+			if term.ident == nil || seen[term.ident.name] || ev.isConstant(term.ident.name) {
+				return term
+			}
+			seen[term.ident.name] = true
+			if val, err := ev.evalOperand(&Term{ident: term.ident}); err == nil {
+				if _, ok := val.(*FunctionValue); !ok {
+					res = append(res, term.ident.name+" = "+val.String())
+				}
+			}
+			return term
+		})
+	}
+	return res
+}
@@ -0,0 +1,47 @@
+package mathval
+
+import (
+	"regexp"
+
+	. "gopkg.in/check.v1"
+)
+
+type PiecewiseSuite struct{}
+
+var _ = Suite(&PiecewiseSuite{})
+
+func (p *PiecewiseSuite) TestPiecewise(c *C) {
+	expected := []EvalResult{
+		{input: "tax(x) = piecewise(x < 10: 0, x < 50: x * 0.1, else: x * 0.2); tax(5)", expected: "0"},
+		{input: "tax(x) = piecewise(x < 10: 0, x < 50: x * 0.1, else: x * 0.2); tax(10)", expected: "1"},
+		{input: "tax(x) = piecewise(x < 10: 0, x < 50: x * 0.1, else: x * 0.2); tax(100)", expected: "20"},
+		{input: "x = 3; piecewise(x > 1: 1, x > 2: 2)", expected: "1"},
+		{input: "x = -4; piecewise(x < 0: -x, x >= 0: x)", expected: "4"},
+		{input: "piecewise(else: 7)", expected: "7"},
+		{input: "map([-1, 0, 1], x -> piecewise(x < 0: -1, x == 0: 0, else: 1))", expected: "[-1, 0, 1]"},
+		{input: "piecewise(1 < 2: 1, 1 / 0 > 0: 2)", expected: "1"},
+		{input: "piecewise(1 > 2: [1], else: [2])[0] + 1", expected: "3"},
+	}
+	for _, res := range expected {
+		val, err := run(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (p *PiecewiseSuite) TestPiecewiseErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "x = 75; piecewise(x < 10: 0, x < 50: 1)", err: "piecewise: No case matches x = 75"},
+		{input: "f(a, b) = piecewise(a < b: -1, a > b: 1); f(2, 2)", err: "piecewise: No case matches a = 2, b = 2"},
+		{input: "r = 3; piecewise(r > pi: 1)", err: "piecewise: No case matches r = 3"},
+		{input: "piecewise(1 > 2: 1)", err: "piecewise: No case matches"},
+		{input: "piecewise(1: 1)", err: "piecewise: Expected boolean, got 1"},
+	}
+	for _, res := range expected {
+		_, err := run(NewEvaluator(), res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+}
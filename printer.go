@@ -0,0 +1,430 @@
+package mathval
+
+import (
+	"strings"
+)
+
+// The methods below print the AST back in a normalised form which parses to the same AST. Binary operators
+// other than '^' are surrounded by single spaces and juxtaposition is printed as a single space. Identifiers,
+// including constants such as pi, are always printed by name rather than by value. Comments are printed where
+// they were attached, with a newline after each line comment so it doesn't swallow what follows
+
+// Style selects the symbols used when printing the AST
+type Style int
+
+const (
+	// ASCII prints operators as they are typed, as in "x^2 * y <= 3", and is what String uses
+	ASCII Style = iota
+
+	// Unicode prints the typographic symbols for operators, pi, square roots and integer exponents, as in
+	// "x² × y ≤ 3" or "√(2 π)"
+	Unicode
+)
+
+// unicodeSymbols holds the symbol printed for each operator with one in the Unicode Style
+var unicodeSymbols = map[Token]string{
+	MINUS:    "−",
+	MULTIPLY: "×",
+	DIVIDE:   "÷",
+	NEQ:      "≠",
+	LTE:      "≤",
+	GTE:      "≥",
+}
+
+// symbol returns the operator as printed in the given Style
+func symbol(tok Token, style Style) string {
+	if s, ok := unicodeSymbols[tok]; ok && style == Unicode {
+		return s
+	}
+	return tok.String()
+}
+
+// Format returns the Program in its normalised form using the given Style
+func (prog *Program) Format(style Style) string {
+	return prog.format(style)
+}
+
+// Format returns the Conditional in its normalised form using the given Style
+func (cond *Conditional) Format(style Style) string {
+	return cond.format(style)
+}
+
+// String returns the Program in its normalised form, with statements separated by "; "
+func (prog *Program) String() string {
+	return prog.format(ASCII)
+}
+
+// format returns the Program in its normalised form in the given Style, with statements separated by "; "
+func (prog *Program) format(style Style) string {
+	var buf strings.Builder
+	for i, stmt := range prog.statements {
+		// A statement ending in a line comment is already separated from the next by a newline
+		if s := buf.String(); i > 0 && !strings.HasSuffix(s, "\n") {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(stmt.format(style))
+	}
+	for _, comment := range prog.comments {
+		if buf.Len() != 0 && !strings.HasSuffix(buf.String(), "\n") {
+			buf.WriteString(" ")
+		}
+		writeComment(&buf, comment)
+	}
+	return strings.TrimSuffix(buf.String(), " ")
+}
+
+// String returns the Statement in its normalised form
+func (stmt *Statement) String() string {
+	return stmt.format(ASCII)
+}
+
+// format returns the Statement in its normalised form in the given Style
+func (stmt *Statement) format(style Style) string {
+	var buf strings.Builder
+	for _, comment := range stmt.comments {
+		writeComment(&buf, comment)
+	}
+	switch {
+	case stmt.assignment != nil:
+		buf.WriteString(stmt.assignment.format(style))
+	case stmt.definition != nil:
+		buf.WriteString(stmt.definition.format(style))
+	default:
+		buf.WriteString(stmt.cond.format(style))
+	}
+	return buf.String()
+}
+
+// writeComment writes the comment followed by a newline if it is a line comment, otherwise a space
+func writeComment(buf *strings.Builder, comment string) {
+	buf.WriteString(comment)
+	if strings.HasPrefix(comment, "/*") {
+		buf.WriteString(" ")
+	} else {
+		buf.WriteString("\n")
+	}
+}
+
+// String returns the Assignment in its normalised form
+func (asg *Assignment) String() string {
+	return asg.format(ASCII)
+}
+
+// format returns the Assignment in its normalised form in the given Style
+func (asg *Assignment) format(style Style) string {
+	return asg.name + " = " + asg.value.format(style)
+}
+
+// String returns the Definition in its normalised form
+func (def *Definition) String() string {
+	return def.format(ASCII)
+}
+
+// format returns the Definition in its normalised form in the given Style
+func (def *Definition) format(style Style) string {
+	return def.name + "(" + strings.Join(def.params, ", ") + ") = " + def.body.format(style)
+}
+
+// String returns the Conditional in its normalised form
+func (cond *Conditional) String() string {
+	return cond.format(ASCII)
+}
+
+// format returns the Conditional in its normalised form in the given Style
+func (cond *Conditional) format(style Style) string {
+	s := cond.disjunction.format(style)
+	if cond.then != nil {
+		s += " ? " + cond.then.format(style) + " : " + cond.els.format(style)
+	}
+	if cond.to != nil {
+		s += " to " + cond.to.String()
+	} else if cond.currency != "" {
+		s += " to " + cond.currency
+	}
+	return s
+}
+
+// String returns the Disjunction in its normalised form
+func (dis *Disjunction) String() string {
+	return dis.format(ASCII)
+}
+
+// format returns the Disjunction in its normalised form in the given Style
+func (dis *Disjunction) format(style Style) string {
+	s := dis.conjunction.format(style)
+	if dis.op != nil {
+		s += " " + symbol(dis.op.op, style) + " " + dis.disjunction.format(style)
+	}
+	return s
+}
+
+// String returns the Conjunction in its normalised form
+func (con *Conjunction) String() string {
+	return con.format(ASCII)
+}
+
+// format returns the Conjunction in its normalised form in the given Style
+func (con *Conjunction) format(style Style) string {
+	s := con.comparison.format(style)
+	if con.op != nil {
+		s += " " + symbol(con.op.op, style) + " " + con.conjunction.format(style)
+	}
+	return s
+}
+
+// String returns the Comparison in its normalised form
+func (cmp *Comparison) String() string {
+	return cmp.format(ASCII)
+}
+
+// format returns the Comparison in its normalised form in the given Style
+func (cmp *Comparison) format(style Style) string {
+	var buf strings.Builder
+	for _, not := range cmp.not {
+		buf.WriteString(symbol(not.op, style) + " ")
+	}
+	buf.WriteString(cmp.expression.format(style))
+	if cmp.op != nil {
+		buf.WriteString(" " + symbol(cmp.op.op, style) + " " + cmp.right.format(style))
+	}
+	return buf.String()
+}
+
+// String returns the Expression in its normalised form
+func (exp *Expression) String() string {
+	return exp.format(ASCII)
+}
+
+// format returns the Expression in its normalised form in the given Style
+func (exp *Expression) format(style Style) string {
+	s := exp.factor.format(style)
+	if exp.op != nil {
+		s += " " + symbol(exp.op.op, style) + " " + exp.expression.format(style)
+	}
+	return s
+}
+
+// String returns the Factor in its normalised form
+func (fac *Factor) String() string {
+	return fac.format(ASCII)
+}
+
+// format returns the Factor in its normalised form in the given Style
+func (fac *Factor) format(style Style) string {
+	s := fac.power.format(style)
+	if fac.op != nil {
+		if fac.op.op == IMPLICIT_MULTIPLY {
+			s += " " + fac.factor.format(style)
+		} else {
+			s += " " + symbol(fac.op.op, style) + " " + fac.factor.format(style)
+		}
+	}
+	return s
+}
+
+// String returns the Power in its normalised form
+func (pow *Power) String() string {
+	return pow.format(ASCII)
+}
+
+// format returns the Power in its normalised form in the given Style
+func (pow *Power) format(style Style) string {
+	var buf strings.Builder
+	for _, unary := range pow.unary {
+		buf.WriteString(symbol(unary.op, style))
+	}
+	buf.WriteString(pow.term.format(style))
+	if exponent, ok := pow.superscript(); ok && style == Unicode {
+		buf.WriteString(exponent)
+	} else if pow.op != nil {
+		buf.WriteString(symbol(pow.op.op, style) + pow.power.format(style))
+	}
+	return buf.String()
+}
+
+// superscript returns the exponent of the Power in superscript digits, if it is an integer written as a number
+// and optionally negated
+func (pow *Power) superscript() (string, bool) {
+	if pow.op == nil || pow.power.op != nil || len(pow.power.unary) > 1 {
+		return "", false
+	}
+	term := pow.power.term
+	if term.number == nil || term.unit != nil || term.currency != "" || len(term.index) != 0 || len(term.postfix) != 0 || len(term.comments()) != 0 {
+		return "", false
+	}
+
+	var buf strings.Builder
+	if len(pow.power.unary) == 1 {
+		if pow.power.unary[0].op != MINUS {
+			return "", false
+		}
+		buf.WriteRune('⁻')
+	}
+	for _, ch := range term.number.str {
+		if ch < '0' || ch > '9' {
+			return "", false
+		}
+		buf.WriteRune(superscriptDigits[ch-'0'])
+	}
+	return buf.String(), true
+}
+
+// String returns the Term in its normalised form
+func (term *Term) String() string {
+	return term.format(ASCII)
+}
+
+// format returns the Term in its normalised form in the given Style
+func (term *Term) format(style Style) string {
+	var buf strings.Builder
+	for _, comment := range term.leading {
+		writeComment(&buf, comment)
+	}
+	switch {
+	case term.group:
+		buf.WriteString(term.exp.format(style))
+	case term.exp != nil:
+		buf.WriteString("(" + term.exp.format(style) + ")")
+	case term.number != nil:
+		buf.WriteString(term.number.String())
+		if term.unit != nil {
+			buf.WriteString(" " + term.unit.String())
+		} else if term.currency != "" {
+			buf.WriteString(" " + term.currency)
+		}
+	case term.date != nil:
+		buf.WriteString(term.date.str)
+	case term.duration != nil:
+		buf.WriteString(term.duration.str)
+	case term.cells != nil:
+		buf.WriteString(term.cells.from + ":" + term.cells.to)
+	case term.text != nil:
+		buf.WriteString(term.text.str)
+	case term.ident != nil:
+		buf.WriteString(term.ident.format(style))
+	case term.call != nil:
+		buf.WriteString(term.call.format(style))
+	case term.lambda != nil:
+		buf.WriteString(term.lambda.format(style))
+	case term.list != nil:
+		buf.WriteString(term.list.format(style))
+	case term.piecewise != nil:
+		buf.WriteString(term.piecewise.format(style))
+	}
+	for _, index := range term.index {
+		buf.WriteString(index.format(style))
+	}
+	for _, post := range term.postfix {
+		buf.WriteString(symbol(post.op, style))
+	}
+	for _, comment := range term.trailing {
+		buf.WriteString(" ")
+		writeComment(&buf, comment)
+	}
+	return strings.TrimSuffix(buf.String(), " ")
+}
+
+// String returns the ListLiteral in its normalised form
+func (list *ListLiteral) String() string {
+	return list.format(ASCII)
+}
+
+// format returns the ListLiteral in its normalised form in the given Style
+func (list *ListLiteral) format(style Style) string {
+	elems := make([]string, len(list.elems))
+	for i, elem := range list.elems {
+		elems[i] = elem.format(style)
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+// String returns the Piecewise in its normalised form, as in "piecewise(x < 0: -x, else: x)"
+func (pw *Piecewise) String() string {
+	return pw.format(ASCII)
+}
+
+// format returns the Piecewise in its normalised form in the given Style, as in "piecewise(x < 0: -x, else: x)"
+func (pw *Piecewise) format(style Style) string {
+	cases := make([]string, 0, len(pw.cases)+1)
+	for _, c := range pw.cases {
+		cases = append(cases, c.cond.format(style)+": "+c.value.format(style))
+	}
+	if pw.els != nil {
+		cases = append(cases, "else: "+pw.els.format(style))
+	}
+	return "piecewise(" + strings.Join(cases, ", ") + ")"
+}
+
+// String returns the Index in its normalised form
+func (index *Index) String() string {
+	return index.format(ASCII)
+}
+
+// format returns the Index in its normalised form in the given Style
+func (index *Index) format(style Style) string {
+	var buf strings.Builder
+	buf.WriteString("[")
+	if index.from != nil {
+		buf.WriteString(index.from.format(style))
+	}
+	if index.slice {
+		buf.WriteString(":")
+	}
+	if index.to != nil {
+		buf.WriteString(index.to.format(style))
+	}
+	buf.WriteString("]")
+	return buf.String()
+}
+
+// String returns the Lambda in its normalised form. A single parameter is written without parentheses
+func (lambda *Lambda) String() string {
+	return lambda.format(ASCII)
+}
+
+// format returns the Lambda in its normalised form in the given Style. A single parameter is written without parentheses
+func (lambda *Lambda) format(style Style) string {
+	if len(lambda.params) == 1 {
+		return lambda.params[0] + " -> " + lambda.body.format(style)
+	}
+	return "(" + strings.Join(lambda.params, ", ") + ") -> " + lambda.body.format(style)
+}
+
+// String returns the Call in its normalised form
+func (call *Call) String() string {
+	return call.format(ASCII)
+}
+
+// format returns the Call in its normalised form in the given Style. In the Unicode Style sqrt is printed as
+// √, parenthesising its argument unless it is a single Term
+func (call *Call) format(style Style) string {
+	if call.name == "sqrt" && len(call.args) == 1 && style == Unicode {
+		if term := call.args[0].soleTerm(); term != nil && term.lambda == nil && !term.group && len(term.comments()) == 0 {
+			return "√" + term.format(style)
+		}
+		return "√(" + call.args[0].format(style) + ")"
+	}
+	args := make([]string, len(call.args))
+	for i, arg := range call.args {
+		args[i] = arg.format(style)
+	}
+	return call.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// String returns the name of the Identifier
+func (ident *Identifier) String() string {
+	return ident.format(ASCII)
+}
+
+// format returns the name of the Identifier, except that pi is π in the Unicode Style
+func (ident *Identifier) format(style Style) string {
+	if ident.name == "pi" && style == Unicode {
+		return "π"
+	}
+	return ident.name
+}
+
+// String returns the Number as it was written
+func (num *Number) String() string {
+	return num.str
+}
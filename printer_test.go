@@ -0,0 +1,130 @@
+package mathval
+
+import (
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type PrinterSuite struct{}
+
+var _ = Suite(&PrinterSuite{})
+
+func (p *PrinterSuite) TestString(c *C) {
+	expected := []struct {
+		mode     Mode
+		input    string
+		expected string
+	}{
+		{input: "10^2*4+1", expected: "10^2 * 4 + 1"},
+		{input: "(49 + 77)*((14-2)/11)\\2", expected: "(49 + 77) * ((14 - 2) / 11) \\ 2"},
+		{input: "-2^-3! + 20%", expected: "-2^-3! + 20%"},
+		{input: "20 % -3 + 20% - 3", expected: "20 % -3 + 20% - 3"},
+		{input: "not x<1 and y>=2 or z", expected: "not x < 1 and y >= 2 or z"},
+		{input: "a ? b : c ? d : e", expected: "a ? b : c ? d : e"},
+		{input: "if(x>10,x*0.9,x)", expected: "if(x > 10, x * 0.9, x)"},
+		{input: "f()", expected: "f()"},
+		{input: "map(xs,x->x*2)", expected: "map(xs, x -> x * 2)"},
+		{input: "(x)->(a,b)->a+b", expected: "x -> (a, b) -> a + b"},
+		{input: "(()->1)+1", expected: "(() -> 1) + 1"},
+		{input: "[1,[2,3],[]]", expected: "[1, [2, 3], []]"},
+		{input: "xs[0]+xs[1:]-xs[:-1][ 2 ]!", expected: "xs[0] + xs[1:] - xs[:-1][2]!"},
+		{input: "piecewise(x<10:0,x<50:x*0.1,else:x*0.2)", expected: "piecewise(x < 10: 0, x < 50: x * 0.1, else: x * 0.2)"},
+		{input: "piecewise(a ? b : c : 1)+1", expected: "piecewise(a ? b : c: 1) + 1"},
+		{input: "2pi r", expected: "2 pi r", mode: ImplicitMultiplication},
+		{input: "2√2 πr²", expected: "2 sqrt(2) pi r^2", mode: ImplicitMultiplication},
+		{input: "1/2x", expected: "1 / 2 x", mode: TightImplicitMultiplication},
+		{input: "1/(2x)", expected: "1 / (2 x)", mode: TightImplicitMultiplication},
+	}
+
+	for _, res := range expected {
+		parser = NewParser(strings.NewReader(res.input))
+		parser.SetMode(res.mode)
+		cond, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(cond.String(), Equals, res.expected)
+
+		// The printed form parses to the same AST
+		parser = NewParser(strings.NewReader(res.expected))
+		parser.SetMode(res.mode)
+		reparsed, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(res.expected))
+		c.Assert(reparsed, ConditionalEquals, cond)
+	}
+}
+
+func (p *PrinterSuite) TestProgramString(c *C) {
+	parser = NewParser(strings.NewReader("f(x,y)=x^2+y;f(3,4)*2"))
+	prog, err := parser.ParseProgram()
+	c.Assert(err, IsNil)
+	c.Assert(prog.String(), Equals, "f(x, y) = x^2 + y; f(3, 4) * 2")
+}
+
+func (p *PrinterSuite) TestCommentString(c *C) {
+	expected := []struct {
+		input    string
+		expected string
+	}{
+		{input: "1+/*one*/2", expected: "1 + /*one*/ 2"},
+		{input: "f(1 # a\n,2)", expected: "f(1 # a\n, 2)"},
+		{input: "# total\nx=1 // one\ny=2;x+y", expected: "# total\nx = 1 // one\ny = 2; x + y"},
+		{input: "f(x) /* f */ = x\n/* end */", expected: "/* f */ f(x) = x /* end */"},
+		{input: "# only", expected: "# only\n"},
+	}
+
+	for _, res := range expected {
+		parser = NewParser(strings.NewReader(res.input))
+		prog, err := parser.ParseProgram()
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(prog.String(), Equals, res.expected)
+
+		// The printed form reproduces itself
+		parser = NewParser(strings.NewReader(res.expected))
+		reparsed, err := parser.ParseProgram()
+		c.Assert(err, IsNil, Commentf(res.expected))
+		c.Assert(reparsed.String(), Equals, res.expected)
+	}
+}
+
+func (p *PrinterSuite) TestUnicodeFormat(c *C) {
+	expected := []struct {
+		input   string
+		unicode string
+	}{
+		{input: "2*3/4-1", unicode: "2 × 3 ÷ 4 − 1"},
+		{input: "-x^2 <= 3 and y != 4 or z >= 5", unicode: "−x² ≤ 3 and y ≠ 4 or z ≥ 5"},
+		{input: "x^-12 + x^0.5 + x^(2) + x^2!", unicode: "x⁻¹² + x^0.5 + x^(2) + x^2!"},
+		{input: "2*pi*r", unicode: "2 × π × r"},
+		{input: "sqrt(2) + sqrt(x + 1) + sqrt(-4) + sqrt(4!)", unicode: "√2 + √(x + 1) + √(−4) + √(4!)"},
+		{input: "sqrt(sqrt(16)) + sqrt(1, 2)", unicode: "√√16 + sqrt(1, 2)"},
+		{input: "sqrt(-x) * sqrt(+4)", unicode: "√(−x) × √(+4)"},
+		{input: "2 \\ 3 % 2", unicode: "2 \\ 3 % 2"},
+	}
+
+	for _, res := range expected {
+		parser = NewParser(strings.NewReader(res.input))
+		cond, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(cond.Format(Unicode), Equals, res.unicode)
+		c.Assert(cond.Format(ASCII), Equals, cond.String())
+
+		// The Unicode form parses to the same AST
+		parser = NewParser(strings.NewReader(res.unicode))
+		reparsed, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(res.unicode))
+		c.Assert(reparsed.String(), Equals, cond.String())
+	}
+
+	parser = NewParser(strings.NewReader("r = √2 × π\nr²"))
+	prog, err := parser.ParseProgram()
+	c.Assert(err, IsNil)
+	c.Assert(prog.String(), Equals, "r = sqrt(2) * pi; r^2")
+	c.Assert(prog.Format(Unicode), Equals, "r = √2 × π; r²")
+}
+
+func (p *PrinterSuite) TestTokenString(c *C) {
+	c.Assert(PLUS.String(), Equals, "+")
+	c.Assert(GTE.String(), Equals, ">=")
+	c.Assert(EOF.String(), Equals, "EOF")
+	c.Assert(Token(-1).String(), Equals, "token(-1)")
+}
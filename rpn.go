@@ -0,0 +1,428 @@
+package mathval
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// RPNParser reads formulas in Reverse Polish Notation, as typed into a stack calculator, into the same AST as
+// Parser. Tokens are separated by whitespace, and each operand is pushed onto a stack which each operator pops
+// its operands from, so "3 4 + 2 *" is "(3 + 4) * 2". The operators are the binary + - * / \ % ^ == != < <= > >=
+// and or, and the unary neg, not and the factorial !. A '-' directly followed by digits is a negative number,
+// as in "-3".
+//
+// A name is a call if it is a function whose arity is fixed, such as sqrt, atan2 or if, which takes that many
+// operands, otherwise a variable. Any function can be called with an explicit number of operands after an
+// '@', as in "x y 2 f@3" for f(x, y, 2) or "xs 2 round@2". Operators and calls which would pop more operands
+// than the stack holds, and operands left over at the end, are SyntaxErrors at their offsets
+type RPNParser struct {
+	r io.Reader
+}
+
+// NewRPNParser returns a new instance of RPNParser
+func NewRPNParser(r io.Reader) *RPNParser {
+	return &RPNParser{r: r}
+}
+
+// rpnOperators holds the binary operators of RPN by their token
+var rpnOperators = map[string]Token{
+	"+": PLUS, "-": MINUS, "*": MULTIPLY, "/": DIVIDE, "\\": INT_DIVIDE, "%": MODULO, "^": POW,
+	"==": EQ, "!=": NEQ, "<": LT, "<=": LTE, ">": GT, ">=": GTE, "and": AND, "or": OR,
+}
+
+// rpnUnary holds the prefix operators of RPN by their token
+var rpnUnary = map[string]Token{"neg": MINUS, "not": NOT}
+
+// rpnArities holds the arity of the builtins, besides those in realFuncs, which are called without an '@'
+var rpnArities = map[string]int{"if": 3, "abs": 1}
+
+// rpnArity returns the fixed number of arguments of the function, or -1 if it has none
+func rpnArity(name string) int {
+	if f, ok := realFuncs[name]; ok {
+		return f.arity
+	} else if n, ok := rpnArities[name]; ok {
+		return n
+	}
+	return -1
+}
+
+// rpnOperand is a Conditional on the stack of RPNParser
+type rpnOperand struct {
+	cond *Conditional
+	pos  int // offset in runes of the first token of the operand
+}
+
+// Parse parses the RPN into a Conditional
+func (p *RPNParser) Parse() (*Conditional, error) {
+	src, err := io.ReadAll(p.r)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(string(src))
+
+	var stack []rpnOperand
+	// pop removes and returns the top n operands for the token, in the order they were pushed
+	pop := func(tok string, pos, n int) ([]rpnOperand, error) {
+		if len(stack) < n {
+			noun := "operands"
+			if n == 1 {
+				noun = "operand"
+			}
+			return nil, &SyntaxError{Msg: fmt.Sprintf("Stack underflow, %q needs %d %s, got %d", tok, n, noun, len(stack)), Pos: pos}
+		}
+		ops := append([]rpnOperand{}, stack[len(stack)-n:]...)
+		stack = stack[:len(stack)-n]
+		return ops, nil
+	}
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		pos := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			i++
+		}
+		tok := string(runes[pos:i])
+
+		if op, ok := rpnOperators[tok]; ok {
+			ops, err := pop(tok, pos, 2)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, rpnOperand{cond: binaryAt(ops[0].cond, op, pos, ops[1].cond), pos: ops[0].pos})
+			continue
+		}
+		if op, ok := rpnUnary[tok]; ok {
+			ops, err := pop(tok, pos, 1)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, rpnOperand{cond: unaryAt(op, pos, ops[0].cond), pos: ops[0].pos})
+			continue
+		}
+		if tok == "!" {
+			ops, err := pop(tok, pos, 1)
+			if err != nil {
+				return nil, err
+			}
+			term := *termOfConditional(ops[0].cond)
+			term.postfix = append(term.postfix[:len(term.postfix):len(term.postfix)], &PostfixOp{op: FACTORIAL, pos: pos})
+			stack = append(stack, rpnOperand{cond: termConditional(&term), pos: ops[0].pos})
+			continue
+		}
+
+		digits := strings.TrimPrefix(tok, "-")
+		if digits != "" && isDigit(rune(digits[0])) {
+			val, ok := new(big.Rat).SetString(digits)
+			if !ok || !isDecimal(digits) {
+				return nil, &SyntaxError{Msg: "Invalid number " + tok, Pos: pos}
+			}
+			cond := termConditional(&Term{number: &Number{str: digits, val: val}})
+			if digits != tok {
+				cond = unaryAt(MINUS, pos, cond)
+			}
+			stack = append(stack, rpnOperand{cond: cond, pos: pos})
+			continue
+		}
+
+		name, arity := tok, -1
+		if at := strings.IndexRune(tok, '@'); at >= 0 {
+			name = tok[:at]
+			n, err := strconv.Atoi(tok[at+1:])
+			if err != nil || n < 0 || strings.HasPrefix(tok[at+1:], "+") {
+				return nil, &SyntaxError{Msg: fmt.Sprintf("Invalid number of operands %q", tok[at+1:]), Pos: pos}
+			}
+			arity = n
+		} else {
+			arity = rpnArity(name)
+		}
+		if !isIdentifier(name) {
+			return nil, &SyntaxError{Msg: fmt.Sprintf("Unexpected %q", tok), Pos: pos}
+		}
+		if arity < 0 {
+			stack = append(stack, rpnOperand{cond: termConditional(&Term{ident: &Identifier{name: name}}), pos: pos})
+			continue
+		}
+		ops, err := pop(tok, pos, arity)
+		if err != nil {
+			return nil, err
+		}
+		call, start := &Call{name: name, args: make([]*Conditional, arity), pos: pos}, pos
+		for j, op := range ops {
+			call.args[j] = op.cond
+			if j == 0 {
+				start = op.pos
+			}
+		}
+		stack = append(stack, rpnOperand{cond: termConditional(&Term{call: call}), pos: start})
+	}
+
+	switch len(stack) {
+	case 0:
+		return nil, &SyntaxError{Msg: "Empty expression", Pos: len(runes)}
+	case 1:
+		return stack[0].cond, nil
+	}
+	return nil, &SyntaxError{Msg: fmt.Sprintf("%d operands left on the stack, expected 1", len(stack)), Pos: stack[1].pos}
+}
+
+// isDecimal returns whether s is digits with an optional fractional part, as in "12" or "1.5"
+func isDecimal(s string) bool {
+	whole, frac, dot := strings.Cut(s, ".")
+	for _, part := range []string{whole, frac} {
+		if part == "" && (dot || part == whole) {
+			return false
+		}
+		for _, ch := range part {
+			if !isDigit(ch) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// The methods below print the AST in RPN which RPNParser reads back. Each node is written as a sequence of
+// operands and operators in infix order, with parenthesised Conditionals, calls and terms with postfix
+// operators as single operands, which the shunting-yard algorithm converts to RPN by the precedence and
+// associativity of the operators. Ternaries are calls to if and percentages are divided by 100, with one added
+// or subtracted scaling the left operand as "100 + 10%" does in "100 1 10 100 / + *". Units, currencies,
+// dates, text, cells, lists, indexes, lambdas and piecewise functions can't be written in RPN
+
+// rpnItem is an operand or operator of a formula in infix order, see shunt
+type rpnItem struct {
+	operand string // the operand in RPN, or "" for an operator
+	op      Token
+	prefix  bool // whether the operator is unary
+}
+
+// rpnPrecedence returns the precedence of the operator, higher binding tighter
+func rpnPrecedence(item rpnItem) int {
+	switch {
+	case item.op == OR:
+		return 1
+	case item.op == AND:
+		return 2
+	case item.op == NOT:
+		return 3
+	case item.op > comparison_begin && item.op < comparison_end:
+		return 4
+	case item.prefix:
+		return 7
+	case item.op > additive_begin && item.op < additive_end:
+		return 5
+	case item.op > multiplicative_begin && item.op < multiplicative_end:
+		return 6
+	}
+	return 8
+}
+
+// rpnToken returns the RPN token of the operator
+func (item rpnItem) rpnToken() string {
+	switch {
+	case item.op == MINUS && item.prefix:
+		return "neg"
+	case item.op == IMPLICIT_MULTIPLY:
+		return "*"
+	}
+	return item.op.String()
+}
+
+// shunt converts the items from infix order to RPN with the shunting-yard algorithm. Operators only wait on
+// the stack for operators which bind tighter, or as tightly and are left associative, and prefix operators
+// never pop others as they precede their operand
+func shunt(items []rpnItem) string {
+	var out []string
+	var stack []rpnItem
+	for _, item := range items {
+		switch {
+		case item.operand != "":
+			out = append(out, item.operand)
+			continue
+		case item.prefix:
+			stack = append(stack, item)
+			continue
+		}
+		prec := rpnPrecedence(item)
+		for len(stack) != 0 {
+			top := stack[len(stack)-1]
+			if rpnPrecedence(top) < prec || (rpnPrecedence(top) == prec && item.op == POW) {
+				break
+			}
+			out, stack = append(out, top.rpnToken()), stack[:len(stack)-1]
+		}
+		stack = append(stack, item)
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		out = append(out, stack[i].rpnToken())
+	}
+	return strings.Join(out, " ")
+}
+
+// RPN returns the Conditional in Reverse Polish Notation, as RPNParser reads it, or an error if it has nodes
+// which can't be written in RPN
+func (cond *Conditional) RPN() (string, error) {
+	items, err := cond.rpn()
+	if err != nil {
+		return "", err
+	}
+	return shunt(items), nil
+}
+
+// rpn returns the Conditional as items in infix order
+func (cond *Conditional) rpn() ([]rpnItem, error) {
+	if cond.to != nil || cond.currency != "" {
+		return nil, fmt.Errorf("Cannot write a conversion in RPN")
+	}
+	if cond.then == nil {
+		return cond.disjunction.rpn()
+	}
+	var args []string
+	for _, arg := range []*Conditional{{disjunction: cond.disjunction}, cond.then, cond.els} {
+		s, err := arg.RPN()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, s)
+	}
+	return []rpnItem{{operand: strings.Join(args, " ") + " if"}}, nil
+}
+
+// rpn returns the Disjunction as items in infix order
+func (dis *Disjunction) rpn() ([]rpnItem, error) {
+	items, err := dis.conjunction.rpn()
+	if err != nil || dis.op == nil {
+		return items, err
+	}
+	right, err := dis.disjunction.rpn()
+	return append(append(items, rpnItem{op: dis.op.op}), right...), err
+}
+
+// rpn returns the Conjunction as items in infix order
+func (con *Conjunction) rpn() ([]rpnItem, error) {
+	items, err := con.comparison.rpn()
+	if err != nil || con.op == nil {
+		return items, err
+	}
+	right, err := con.conjunction.rpn()
+	return append(append(items, rpnItem{op: con.op.op}), right...), err
+}
+
+// rpn returns the Comparison as items in infix order
+func (cmp *Comparison) rpn() ([]rpnItem, error) {
+	var items []rpnItem
+	for _, not := range cmp.not {
+		items = append(items, rpnItem{op: not.op, prefix: true})
+	}
+	left, err := cmp.expression.rpn()
+	if err != nil || cmp.op == nil {
+		return append(items, left...), err
+	}
+	right, err := cmp.right.rpn()
+	return append(append(append(items, left...), rpnItem{op: cmp.op.op}), right...), err
+}
+
+// rpn returns the Expression as items in infix order. A percentage added or subtracted scales the operands
+// before it as a single operand
+func (exp *Expression) rpn() ([]rpnItem, error) {
+	items, err := exp.factor.rpn()
+	for ; err == nil && exp.op != nil; exp = exp.expression {
+		var right []rpnItem
+		if right, err = exp.expression.factor.rpn(); err != nil {
+			break
+		}
+		if isPercentage(exp.expression.factor) {
+			items = []rpnItem{{operand: shunt(items) + " 1 " + shunt(right) + " " + exp.op.op.String() + " *"}}
+			continue
+		}
+		items = append(append(items, rpnItem{op: exp.op.op}), right...)
+	}
+	return items, err
+}
+
+// rpn returns the Factor as items in infix order
+func (factor *Factor) rpn() ([]rpnItem, error) {
+	items, err := factor.power.rpn()
+	if err != nil || factor.op == nil {
+		return items, err
+	}
+	right, err := factor.factor.rpn()
+	return append(append(items, rpnItem{op: factor.op.op}), right...), err
+}
+
+// rpn returns the Power as items in infix order. A unary plus is dropped
+func (pow *Power) rpn() ([]rpnItem, error) {
+	var items []rpnItem
+	for _, op := range pow.unary {
+		if op.op == MINUS {
+			items = append(items, rpnItem{op: MINUS, prefix: true})
+		}
+	}
+	term, err := pow.term.rpn()
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, rpnItem{operand: term})
+	if pow.op == nil {
+		return items, nil
+	}
+	right, err := pow.power.rpn()
+	return append(append(items, rpnItem{op: POW}), right...), err
+}
+
+// rpn returns the Term in RPN as a single operand
+func (term *Term) rpn() (string, error) {
+	var s string
+	var err error
+	switch {
+	case term.unit != nil || term.currency != "":
+		return "", fmt.Errorf("Cannot write a quantity in RPN")
+	case len(term.index) != 0:
+		return "", fmt.Errorf("Cannot write an index in RPN")
+	case term.exp != nil:
+		s, err = term.exp.RPN()
+	case term.number != nil:
+		s = term.number.String()
+	case term.ident != nil:
+		s = term.ident.name
+	case term.call != nil:
+		s, err = term.call.rpn()
+	default:
+		return "", fmt.Errorf("Cannot write %s in RPN", term)
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, post := range term.postfix {
+		if post.op == PERCENT {
+			s += " 100 /"
+		} else {
+			s += " " + post.op.String()
+		}
+	}
+	return s, nil
+}
+
+// rpn returns the Call in RPN, with the number of arguments after an '@' unless the
+// function's arity is fixed
+func (call *Call) rpn() (string, error) {
+	var args []string
+	for _, arg := range call.args {
+		s, err := arg.RPN()
+		if err != nil {
+			return "", err
+		}
+		args = append(args, s)
+	}
+	name := call.name
+	if rpnArity(name) != len(args) {
+		name += "@" + strconv.Itoa(len(args))
+	}
+	return strings.Join(append(args, name), " "), nil
+}
@@ -0,0 +1,181 @@
+package mathval
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type RPNSuite struct{}
+
+var _ = Suite(&RPNSuite{})
+
+// parseRPN parses the RPN with a new RPNParser
+func parseRPN(input string) (*Conditional, error) {
+	return NewRPNParser(strings.NewReader(input)).Parse()
+}
+
+// parseInfix parses the formula in mathval's syntax with ImplicitMultiplication
+func parseInfix(input string) (*Conditional, error) {
+	p := NewParser(strings.NewReader(input))
+	p.SetMode(ImplicitMultiplication)
+	return p.Parse()
+}
+
+func (r *RPNSuite) TestParse(c *C) {
+	// Formulas are printed in mathval's syntax
+	expected := []EvalResult{
+		{input: "3 4 + 2 *", expected: "(3 + 4) * 2"},
+		{input: "3 4 2 * +", expected: "3 + 4 * 2"},
+		{input: "1 2 - 3 -", expected: "1 - 2 - 3"},
+		{input: "1 2 3 - -", expected: "1 - (2 - 3)"},
+		{input: "a b * c / d *", expected: "a * b / c * d"},
+		{input: "2 3 ^ 2 ^", expected: "(2^3)^2"},
+		{input: "2 3 2 ^ ^", expected: "2^3^2"},
+		{input: "2 neg 2 ^", expected: "(-2)^2"},
+		{input: "2 2 ^ neg", expected: "-2^2"},
+		{input: "-3 x *", expected: "-3 * x"},
+		{input: "1.5 x 7 2 \\ % +", expected: "1.5 + x % (7 \\ 2)"},
+		{input: "n ! n 1 + ! +", expected: "n! + (n + 1)!"},
+		{input: "2 sqrt 8 1 3 / ^ + y x atan2 -", expected: "sqrt(2) + 8^(1 / 3) - atan2(y, x)"},
+		{input: "x 1 - abs pi *", expected: "abs(x - 1) * pi"},
+		{input: "x y 2 f@3 g@0 +", expected: "f(x, y, 2) + g()"},
+		{input: "x 0 > x x neg if", expected: "if(x > 0, x, -x)"},
+		{input: "x 1 < y 2 >= and z or", expected: "x < 1 and y >= 2 or z"},
+		{input: "a b or c and", expected: "(a or b) and c"},
+		{input: "x 1 == not", expected: "not x == 1"},
+		{input: "a b and not", expected: "not (a and b)"},
+		{input: "1 2 < 3 ==", expected: "(1 < 2) == 3"},
+		{input: "  3\t4\n+ ", expected: "3 + 4"},
+	}
+	for _, res := range expected {
+		cond, err := parseRPN(res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(cond.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (r *RPNSuite) TestEval(c *C) {
+	expected := []EvalResult{
+		{input: "3 4 + 2 *", expected: "14"},
+		{input: "1 2 3 - -", expected: "2"},
+		{input: "1 2 / 1 3 / +", expected: "5/6"},
+		{input: "2 3 2 ^ ^", expected: "512"},
+		{input: "2 2 ^ neg", expected: "-4"},
+		{input: "x 5 ! *", expected: "360"},
+		{input: "x 2 > 10 20 if", expected: "10"},
+		{input: "x 4 3 / round@1 +", expected: "4"},
+		{input: "100 1 10 100 / + *", expected: "110"},
+	}
+	ev := NewEvaluator()
+	ev.Set("x", NewNumberValue(big.NewRat(3, 1)))
+	for _, res := range expected {
+		cond, err := parseRPN(res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		val, err := ev.Eval(cond)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (r *RPNSuite) TestPrint(c *C) {
+	expected := []EvalResult{
+		{input: "(3 + 4) * 2", expected: "3 4 + 2 *"},
+		{input: "3 + 4 * 2", expected: "3 4 2 * +"},
+		{input: "1 - 2 - 3", expected: "1 2 - 3 -"},
+		{input: "1 - (2 - 3)", expected: "1 2 3 - -"},
+		{input: "2^3^2", expected: "2 3 2 ^ ^"},
+		{input: "-2^2 * 3", expected: "2 2 ^ neg 3 *"},
+		{input: "2^-x", expected: "2 x neg ^"},
+		{input: "-a * -b", expected: "a neg b neg *"},
+		{input: "+a", expected: "a"},
+		{input: "2 (x + 1) x", expected: "2 x 1 + * x *"},
+		{input: "n! + (n + 1)!", expected: "n ! n 1 + ! +"},
+		{input: "50% * x", expected: "50 100 / x *"},
+		{input: "a + b - 10% * x", expected: "a b + 10 100 / x * -"},
+		{input: "a + b - 10% + c", expected: "a b + 1 10 100 / - * c +"},
+		{input: "sqrt(x) + max(a, b) + f()", expected: "x sqrt a b max@2 + f@0 +"},
+		{input: "x > 0 ? x : y < 0 ? -y : 0", expected: "x 0 > x y 0 < y neg 0 if if"},
+		{input: "not x == 1 and y or z", expected: "x 1 == not y and z or"},
+		{input: "not (a or b)", expected: "a b or not"},
+	}
+	for _, res := range expected {
+		cond, err := parseInfix(res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		rpn, err := cond.RPN()
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(rpn, Equals, res.expected, Commentf(res.input))
+	}
+
+	for _, input := range []string{"[1, 2]", "xs[0]", "x -> x", "5 km to m", `"a"`} {
+		p := NewParser(strings.NewReader(input))
+		p.SetMode(ImplicitMultiplication | Units | Excel)
+		cond, err := p.Parse()
+		c.Assert(err, IsNil, Commentf(input))
+		_, err = cond.RPN()
+		c.Assert(err, ErrorMatches, "Cannot write .* in RPN", Commentf(input))
+	}
+}
+
+func (r *RPNSuite) TestRoundTrip(c *C) {
+	// Printing as RPN and reading it back gives the same formula
+	inputs := []string{
+		"(a + b) / 2",
+		"a * b / c * d",
+		"a - (b - c) + (d + e)",
+		"x^2 + y^(n - 1)",
+		"(x^y)^z",
+		"-2^2 + (-2)^2",
+		"7 \\ 2 % 3",
+		"n! + (n + 1)! * 2",
+		"sqrt(x^2 + 1) * x^(1 / 3) + log(2, 8)",
+		"f(x, y) + g(h(1))",
+		"x == 1 or not y != 2 and z <= 3",
+		"(a or b) and (c or d)",
+		"not (a and b)",
+		"(1 < 2) == (3 > 4)",
+	}
+	for _, input := range inputs {
+		cond, err := parseInfix(input)
+		c.Assert(err, IsNil, Commentf(input))
+
+		rpn, err := cond.RPN()
+		c.Assert(err, IsNil, Commentf(input))
+		read, err := parseRPN(rpn)
+		c.Assert(err, IsNil, Commentf(rpn))
+		c.Assert(read.String(), Equals, cond.String(), Commentf(rpn))
+	}
+}
+
+func (r *RPNSuite) TestErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "3 +", err: `Stack underflow, "+" needs 2 operands, got 1 at offset 2`},
+		{input: "neg", err: `Stack underflow, "neg" needs 1 operand, got 0 at offset 0`},
+		{input: "1 2 atan2 log", err: `Stack underflow, "log" needs 2 operands, got 1 at offset 10`},
+		{input: "x y f@3", err: `Stack underflow, "f@3" needs 3 operands, got 2 at offset 4`},
+		{input: "1 2 3 +", err: `2 operands left on the stack, expected 1 at offset 2`},
+		{input: "1 2 3 * +  5", err: `2 operands left on the stack, expected 1 at offset 11`},
+		{input: "1 2", err: `2 operands left on the stack, expected 1 at offset 2`},
+		{input: "  ", err: `Empty expression at offset 2`},
+		{input: "1 2 ( +", err: `Unexpected "(" at offset 4`},
+		{input: "1 x+ +", err: `Unexpected "x+" at offset 2`},
+		{input: "1.2.3", err: `Invalid number 1.2.3 at offset 0`},
+		{input: "2 1. +", err: `Invalid number 1. at offset 2`},
+		{input: "1 1e5 +", err: `Invalid number 1e5 at offset 2`},
+		{input: "x f@n", err: `Invalid number of operands "n" at offset 2`},
+	}
+	for _, res := range expected {
+		_, err := parseRPN(res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+
+	_, err := parseRPN("1 2 3 +")
+	syntax, ok := err.(*SyntaxError)
+	c.Assert(ok, Equals, true)
+	c.Assert(syntax.Pos, Equals, 2)
+}
@@ -4,17 +4,41 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"regexp"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Scanner is a lexical scanner
 type Scanner struct {
-	r *bufio.Reader
+	r      *bufio.Reader
+	pos    int // offset in runes of the next rune
+	start  int // offset in runes of the last token scanned
+	locale *Locale
+	dates  bool // scan DATE and DURATION tokens, see SetDates
+	ranges bool // scan RANGE tokens, see SetRanges
 }
 
 // NewScanner returns a new Scanner instance
 func NewScanner(r io.Reader) *Scanner {
-	return &Scanner{r: bufio.NewReader(r)}
+	return &Scanner{r: bufio.NewReader(r), locale: LocaleEN}
+}
+
+// SetLocale sets the Locale whose decimal mark and group separator are accepted in numbers. The decimal mark
+// is always scanned as a DOT, and a '.' which isn't the decimal mark or a group separator is ILLEGAL
+func (s *Scanner) SetLocale(l *Locale) {
+	s.locale = l
+}
+
+// SetDates sets whether ISO 8601 dates and durations are scanned as DATE and DURATION tokens, see Dates
+func (s *Scanner) SetDates(on bool) {
+	s.dates = on
+}
+
+// SetRanges sets whether ranges of cells such as "A1:B10" are scanned as RANGE tokens, see Cells
+func (s *Scanner) SetRanges(on bool) {
+	s.ranges = on
 }
 
 // read reads the next rune from the Reader
@@ -24,25 +48,41 @@ func (s *Scanner) read() rune {
 	if err != nil {
 		return eof
 	}
+	s.pos++
 	return ch
 }
 
 // unread places the previously read rune back on the reader.
-func (s *Scanner) unread() { _ = s.r.UnreadRune() }
+func (s *Scanner) unread() {
+	if s.r.UnreadRune() == nil {
+		s.pos--
+	}
+}
 
 // Scan returns the next token and its literal value
 func (s *Scanner) Scan() (Token, string) {
+	s.start = s.pos
 	ch := s.read()
 
 	if isWhitespace(ch) {
 		s.unread()
 		return WS, s.scanContiguous(unicode.White_Space)
+	} else if ch == 'π' {
+		return UNKNOWN_KEYWORD, "pi"
+	} else if isSuperscript(ch) {
+		s.unread()
+		return s.scanSuperscript()
 	} else if isLetter(ch) {
 		s.unread()
 		return s.scanKeyword()
 	} else if isDigit(ch) {
 		s.unread()
+		if tok, lit, ok := s.scanTemporal(); ok {
+			return tok, lit
+		}
 		return s.scanDigits()
+	} else if ch == s.locale.Decimal {
+		return DOT, string(ch)
 	}
 
 	// Single-character token
@@ -53,49 +93,303 @@ func (s *Scanner) Scan() (Token, string) {
 	case '+':
 		return PLUS, string(ch)
 	case '-':
+		if s.readIf('>') {
+			return ARROW, "->"
+		}
 		return MINUS, string(ch)
-	case '*':
+	case '*', '×', '·', '⋅':
 		return MULTIPLY, string(ch)
 	case '/':
+		if s.readIf('/') {
+			return COMMENT, "//" + s.scanLine()
+		} else if s.readIf('*') {
+			return s.scanBlockComment()
+		}
 		return DIVIDE, string(ch)
+	case '÷':
+		return DIVIDE, string(ch)
+	case '−':
+		return MINUS, string(ch)
+	case '√':
+		return SQRT, string(ch)
 	case '\\':
 		return INT_DIVIDE, string(ch)
 	case '^':
 		return POW, string(ch)
 	case '%':
 		return MODULO, string(ch)
+	case '&':
+		return CONCAT, string(ch)
+	// Comparison operators
+	case '=':
+		if s.readIf('=') {
+			return EQ, "=="
+		}
+		return ASSIGN, string(ch)
+	case '!':
+		if s.readIf('=') {
+			return NEQ, "!="
+		}
+		return FACTORIAL, string(ch)
+	case '≠':
+		return NEQ, string(ch)
+	case '≤':
+		return LTE, string(ch)
+	case '≥':
+		return GTE, string(ch)
+	case '<':
+		if s.readIf('=') {
+			return LTE, "<="
+		}
+		return LT, string(ch)
+	case '>':
+		if s.readIf('=') {
+			return GTE, ">="
+		}
+		return GT, string(ch)
 	// Misc characters
 	case '(':
 		return LPAREN, string(ch)
 	case ')':
 		return RPAREN, string(ch)
-	case '.':
-		return DOT, string(ch)
+	case '[':
+		return LBRACKET, string(ch)
+	case ']':
+		return RBRACKET, string(ch)
+	case ',':
+		return COMMA, string(ch)
+	case '?':
+		return QUESTION, string(ch)
+	case ':':
+		return COLON, string(ch)
+	case ';':
+		return SEMICOLON, string(ch)
+	case '"':
+		return s.scanString()
+	// Comments
+	case '#':
+		return COMMENT, string(ch) + s.scanLine()
 	}
 
 	return ILLEGAL, string(ch)
 }
 
-// scanKeyword consumes all contiguous character runes and checks whether they are a known keyword
+// readIf consumes the next rune only if it is the given rune, returning whether it was consumed
+func (s *Scanner) readIf(want rune) bool {
+	if ch := s.read(); ch == want {
+		return true
+	} else if ch != eof {
+		s.unread()
+	}
+	return false
+}
+
+// scanLine consumes all runes up to, but not including, the next newline
+func (s *Scanner) scanLine() string {
+	var buf bytes.Buffer
+	for {
+		if ch := s.read(); ch == eof {
+			break
+		} else if ch == '\n' {
+			s.unread()
+			break
+		} else {
+			buf.WriteRune(ch)
+		}
+	}
+	return buf.String()
+}
+
+// scanBlockComment consumes the remainder of a block comment once its opening "/*" has been consumed. An
+// unterminated block comment is ILLEGAL
+func (s *Scanner) scanBlockComment() (Token, string) {
+	var buf bytes.Buffer
+	buf.WriteString("/*")
+	for {
+		ch := s.read()
+		if ch == eof {
+			return ILLEGAL, buf.String()
+		}
+		buf.WriteRune(ch)
+		if ch == '*' && s.readIf('/') {
+			buf.WriteRune('/')
+			return COMMENT, buf.String()
+		}
+	}
+}
+
+// scanString consumes the remainder of a string literal once its opening '"' has been consumed. A '"' inside
+// it is written twice, as spreadsheets do. An unterminated string is ILLEGAL
+func (s *Scanner) scanString() (Token, string) {
+	var buf bytes.Buffer
+	buf.WriteRune('"')
+	for {
+		ch := s.read()
+		if ch == eof {
+			return ILLEGAL, buf.String()
+		}
+		buf.WriteRune(ch)
+		if ch == '"' {
+			if !s.readIf('"') {
+				return STRING, buf.String()
+			}
+			buf.WriteRune('"')
+		}
+	}
+}
+
+// scanKeyword consumes a letter followed by all contiguous letter, digit and underscore runes and checks
+// whether they are a known keyword
 func (s *Scanner) scanKeyword() (Token, string) {
-	keyword := s.scanContiguous(unicode.Letter)
+	var buf bytes.Buffer
+	for {
+		if ch := s.read(); ch == eof {
+			break
+		} else if ch == 'π' || (!isLetter(ch) && (buf.Len() == 0 || (!isDigit(ch) && ch != '_'))) {
+			s.unread()
+			break
+		} else {
+			buf.WriteRune(ch)
+		}
+	}
+	keyword := buf.String()
 
-	// TODO iterate over a defined list of functions
-	/*switch keyword {
-	case "func":
-		return FUNCTION, keyword
-	}*/
+	switch keyword {
+	case "and":
+		return AND, keyword
+	case "or":
+		return OR, keyword
+	case "not":
+		return NOT, keyword
+	}
+	if s.dates && isoDuration.MatchString(keyword) && keyword != "P" && !strings.HasSuffix(keyword, "T") {
+		return DURATION, keyword
+	}
+	if s.ranges && isCell(keyword) {
+		if end := s.scanRangeEnd(); end != "" {
+			return RANGE, keyword + end
+		}
+	}
 
 	// Otherwise return as a regular identifier.
 	return UNKNOWN_KEYWORD, keyword
 }
 
-// scanDigits consumes all contiguous decimal digit runes
+var (
+	// dateLiteral matches an ISO 8601 date, optionally followed by a time and an offset
+	dateLiteral = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(T\d{2}:\d{2}(:\d{2}(\.\d+)?)?(Z|[+-]\d{2}:\d{2})?)?`)
+
+	// durationLiteral matches whole numbers of weeks, days, hours, minutes, seconds and milliseconds
+	durationLiteral = regexp.MustCompile(`^(\d+(ms|w|d|h|m|s))+`)
+
+	// isoDuration matches an ISO 8601 duration, which also matches "P" and a trailing 'T'
+	isoDuration = regexp.MustCompile(`^P(\d+Y)?(\d+M)?(\d+W)?(\d+D)?(T(\d+H)?(\d+M)?(\d+S)?)?$`)
+)
+
+// rangeEnd matches the ':' and second cell of a range
+var rangeEnd = regexp.MustCompile(`^:[A-Z]+[1-9][0-9]*`)
+
+// scanRangeEnd consumes a ':' directly followed by a cell reference, which isn't followed by a letter, digit or
+// underscore, after the first cell of a range. It returns "" and consumes nothing if there isn't one
+func (s *Scanner) scanRangeEnd() string {
+	next := string(s.peekRunes(32))
+	end := rangeEnd.FindString(next)
+	if after, _ := utf8.DecodeRuneInString(next[len(end):]); end == "" || isLetter(after) || isDigit(after) || after == '_' {
+		return ""
+	}
+	for range end {
+		s.read()
+	}
+	return end
+}
+
+// scanTemporal consumes a DATE or DURATION in Dates mode, returning false and consuming nothing if the next
+// runes aren't one. A date mustn't be followed by a digit, and a duration by a letter, digit or underscore, so
+// "2min" is still a number and an identifier
+func (s *Scanner) scanTemporal() (Token, string, bool) {
+	if !s.dates {
+		return ILLEGAL, "", false
+	}
+	next := string(s.peekRunes(64))
+	tok, lit := DATE, dateLiteral.FindString(next)
+	if after, _ := utf8.DecodeRuneInString(next[len(lit):]); lit == "" || isDigit(after) {
+		tok, lit = DURATION, durationLiteral.FindString(next)
+		if after, _ = utf8.DecodeRuneInString(next[len(lit):]); lit == "" || isLetter(after) || isDigit(after) || after == '_' {
+			return ILLEGAL, "", false
+		}
+	}
+	// Both literals are ASCII, so each byte is a rune
+	for range lit {
+		s.read()
+	}
+	return tok, lit, true
+}
+
+// scanSuperscript consumes a superscript minus and superscript digits, returning them in their ASCII form. A
+// minus which isn't followed by a digit is ILLEGAL
+func (s *Scanner) scanSuperscript() (Token, string) {
+	var buf bytes.Buffer
+	if s.readIf('⁻') {
+		buf.WriteRune('-')
+	}
+	for {
+		ch := s.read()
+		digit, ok := superscripts[ch]
+		if !ok || digit == '-' {
+			if ch != eof {
+				s.unread()
+			}
+			break
+		}
+		buf.WriteRune(digit)
+	}
+	if lit := buf.String(); lit != "" && lit != "-" {
+		return SUPERSCRIPT, lit
+	}
+	return ILLEGAL, "⁻"
+}
+
+// scanDigits consumes all contiguous decimal digit runes. If the Locale has a group separator, a run of at
+// most three digits may be followed by groups of exactly three digits, each preceded by the separator, which
+// is dropped from the literal
 func (s *Scanner) scanDigits() (Token, string) {
 	keyword := s.scanContiguous(unicode.Digit)
+	if !s.locale.groups() || utf8.RuneCountInString(keyword) > 3 {
+		return DIGITS, keyword
+	}
+	for s.groupFollows() {
+		s.read()
+		keyword += s.scanContiguous(unicode.Digit)
+	}
 	return DIGITS, keyword
 }
 
+// groupFollows returns whether the next runes are the group separator followed by exactly three digits
+func (s *Scanner) groupFollows() bool {
+	next := s.peekRunes(5)
+	if len(next) < 4 || next[0] != s.locale.Group {
+		return false
+	}
+	for _, ch := range next[1:4] {
+		if !isDigit(ch) {
+			return false
+		}
+	}
+	return len(next) == 4 || !isDigit(next[4])
+}
+
+// peekRunes returns up to n of the following runes without consuming them
+func (s *Scanner) peekRunes(n int) []rune {
+	b, _ := s.r.Peek(n * utf8.UTFMax)
+	var res []rune
+	for len(b) > 0 && len(res) < n {
+		ch, size := utf8.DecodeRune(b)
+		res = append(res, ch)
+		b = b[size:]
+	}
+	return res
+}
+
 // scanContiguous consumes all contiguous runes from the current rune to the first that isn't in
 // the given unicode.RangeTable
 func (s *Scanner) scanContiguous(table *unicode.RangeTable) string {
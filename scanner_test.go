@@ -42,6 +42,24 @@ func (s *ScannerSuite) TestScanKeyword(c *C) {
 	c.Assert(keyword, Equals, alphabet)
 }
 
+func (s *ScannerSuite) TestScanLogicalKeywords(c *C) {
+	expected := []ScanResult{
+		{token: AND, literal: "and"},
+		{token: OR, literal: "or"},
+		{token: NOT, literal: "not"},
+		{token: UNKNOWN_KEYWORD, literal: "nor"},
+		{token: UNKNOWN_KEYWORD, literal: "log10"},
+		{token: UNKNOWN_KEYWORD, literal: "tax_rate"},
+	}
+
+	for _, res := range expected {
+		scanner = NewScanner(strings.NewReader(res.literal))
+		token, literal := scanner.scanKeyword()
+		c.Assert(token, Equals, res.token)
+		c.Assert(literal, Equals, res.literal)
+	}
+}
+
 func (s *ScannerSuite) TestScanDigits(c *C) {
 	digitStr := "123 456*789"
 	scanner = NewScanner(strings.NewReader(digitStr))
@@ -111,3 +129,235 @@ func (s *ScannerSuite) TestScan(c *C) {
 		c.Assert(literal, Equals, res.literal)
 	}
 }
+
+func (s *ScannerSuite) TestScanComparison(c *C) {
+	scan_str := "a==b!=c<d<=e>f>=g?h:i,j=!;"
+	scanner = NewScanner(strings.NewReader(scan_str))
+
+	expected := []ScanResult{
+		{token: UNKNOWN_KEYWORD, literal: "a"},
+		{token: EQ, literal: "=="},
+		{token: UNKNOWN_KEYWORD, literal: "b"},
+		{token: NEQ, literal: "!="},
+		{token: UNKNOWN_KEYWORD, literal: "c"},
+		{token: LT, literal: "<"},
+		{token: UNKNOWN_KEYWORD, literal: "d"},
+		{token: LTE, literal: "<="},
+		{token: UNKNOWN_KEYWORD, literal: "e"},
+		{token: GT, literal: ">"},
+		{token: UNKNOWN_KEYWORD, literal: "f"},
+		{token: GTE, literal: ">="},
+		{token: UNKNOWN_KEYWORD, literal: "g"},
+		{token: QUESTION, literal: "?"},
+		{token: UNKNOWN_KEYWORD, literal: "h"},
+		{token: COLON, literal: ":"},
+		{token: UNKNOWN_KEYWORD, literal: "i"},
+		{token: COMMA, literal: ","},
+		{token: UNKNOWN_KEYWORD, literal: "j"},
+		{token: ASSIGN, literal: "="},
+		{token: FACTORIAL, literal: "!"},
+		{token: SEMICOLON, literal: ";"},
+		{token: EOF, literal: ""},
+	}
+
+	for _, res := range expected {
+		token, literal := scanner.Scan()
+		c.Assert(token, Equals, res.token)
+		c.Assert(literal, Equals, res.literal)
+	}
+}
+
+func (s *ScannerSuite) TestScanComments(c *C) {
+	scanner = NewScanner(strings.NewReader("1 # one\n/ 2 // two\n/* three\n*/3/**/"))
+
+	expected := []ScanResult{
+		{token: DIGITS, literal: "1"},
+		{token: WS, literal: " "},
+		{token: COMMENT, literal: "# one"},
+		{token: WS, literal: "\n"},
+		{token: DIVIDE, literal: "/"},
+		{token: WS, literal: " "},
+		{token: DIGITS, literal: "2"},
+		{token: WS, literal: " "},
+		{token: COMMENT, literal: "// two"},
+		{token: WS, literal: "\n"},
+		{token: COMMENT, literal: "/* three\n*/"},
+		{token: DIGITS, literal: "3"},
+		{token: COMMENT, literal: "/**/"},
+		{token: EOF, literal: ""},
+	}
+
+	for _, res := range expected {
+		token, literal := scanner.Scan()
+		c.Assert(token, Equals, res.token)
+		c.Assert(literal, Equals, res.literal)
+	}
+
+	scanner = NewScanner(strings.NewReader("/* unterminated *"))
+	token, literal := scanner.Scan()
+	c.Assert(token, Equals, ILLEGAL)
+	c.Assert(literal, Equals, "/* unterminated *")
+}
+
+func (s *ScannerSuite) TestScanUnicode(c *C) {
+	scanner = NewScanner(strings.NewReader("2×3÷4−√πr²·x⁻¹⁰≤≥≠"))
+
+	expected := []ScanResult{
+		{token: DIGITS, literal: "2"},
+		{token: MULTIPLY, literal: "×"},
+		{token: DIGITS, literal: "3"},
+		{token: DIVIDE, literal: "÷"},
+		{token: DIGITS, literal: "4"},
+		{token: MINUS, literal: "−"},
+		{token: SQRT, literal: "√"},
+		{token: UNKNOWN_KEYWORD, literal: "pi"},
+		{token: UNKNOWN_KEYWORD, literal: "r"},
+		{token: SUPERSCRIPT, literal: "2"},
+		{token: MULTIPLY, literal: "·"},
+		{token: UNKNOWN_KEYWORD, literal: "x"},
+		{token: SUPERSCRIPT, literal: "-10"},
+		{token: LTE, literal: "≤"},
+		{token: GTE, literal: "≥"},
+		{token: NEQ, literal: "≠"},
+		{token: EOF, literal: ""},
+	}
+
+	for _, res := range expected {
+		token, literal := scanner.Scan()
+		c.Assert(token, Equals, res.token)
+		c.Assert(literal, Equals, res.literal)
+	}
+
+	scanner = NewScanner(strings.NewReader("x⁻"))
+	scanner.Scan()
+	token, literal := scanner.Scan()
+	c.Assert(token, Equals, ILLEGAL)
+	c.Assert(literal, Equals, "⁻")
+}
+
+func (s *ScannerSuite) TestScanLocale(c *C) {
+	scanner = NewScanner(strings.NewReader("1.234.567,89;12.34"))
+	scanner.SetLocale(LocaleDE)
+
+	expected := []ScanResult{
+		{token: DIGITS, literal: "1234567"},
+		{token: DOT, literal: ","},
+		{token: DIGITS, literal: "89"},
+		{token: SEMICOLON, literal: ";"},
+		{token: DIGITS, literal: "12"},
+		{token: ILLEGAL, literal: "."},
+		{token: DIGITS, literal: "34"},
+		{token: EOF, literal: ""},
+	}
+
+	for _, res := range expected {
+		token, literal := scanner.Scan()
+		c.Assert(token, Equals, res.token)
+		c.Assert(literal, Equals, res.literal)
+	}
+}
+
+func (s *ScannerSuite) TestScanDates(c *C) {
+	input := "2024-03-15 - 3d + 2h30m*2min PT2H30M P1W P 2024-03-15T10:30:00.5+01:00 2024-03-150 500ms 3d_ 2024-03-15T10"
+	expected := []ScanResult{
+		{token: DATE, literal: "2024-03-15"},
+		{token: MINUS, literal: "-"},
+		{token: DURATION, literal: "3d"},
+		{token: PLUS, literal: "+"},
+		{token: DURATION, literal: "2h30m"},
+		{token: MULTIPLY, literal: "*"},
+		{token: DIGITS, literal: "2"},
+		{token: UNKNOWN_KEYWORD, literal: "min"},
+		{token: DURATION, literal: "PT2H30M"},
+		{token: DURATION, literal: "P1W"},
+		{token: UNKNOWN_KEYWORD, literal: "P"},
+		{token: DATE, literal: "2024-03-15T10:30:00.5+01:00"},
+		{token: DIGITS, literal: "2024"},
+		{token: MINUS, literal: "-"},
+		{token: DIGITS, literal: "03"},
+		{token: MINUS, literal: "-"},
+		{token: DIGITS, literal: "150"},
+		{token: DURATION, literal: "500ms"},
+		{token: DIGITS, literal: "3"},
+		{token: UNKNOWN_KEYWORD, literal: "d_"},
+		{token: DATE, literal: "2024-03-15"},
+		{token: UNKNOWN_KEYWORD, literal: "T10"},
+		{token: EOF, literal: ""},
+	}
+
+	scanner = NewScanner(strings.NewReader(input))
+	scanner.SetDates(true)
+	for _, res := range expected {
+		token, literal := scanner.Scan()
+		for token == WS {
+			token, literal = scanner.Scan()
+		}
+		c.Assert(token, Equals, res.token, Commentf(res.literal))
+		c.Assert(literal, Equals, res.literal)
+	}
+
+	// Outside Dates mode they are numbers and identifiers
+	scanner = NewScanner(strings.NewReader("3d"))
+	token, literal := scanner.Scan()
+	c.Assert(token, Equals, DIGITS)
+	c.Assert(literal, Equals, "3")
+}
+
+func (s *ScannerSuite) TestScanRanges(c *C) {
+	scanner = NewScanner(strings.NewReader("sum(A1:A10) + B2:AA3 x ? A1 : B1 A1:b2 A1:B0 A1:B2x"))
+	scanner.SetRanges(true)
+
+	expected := []ScanResult{
+		{token: UNKNOWN_KEYWORD, literal: "sum"},
+		{token: LPAREN, literal: "("},
+		{token: RANGE, literal: "A1:A10"},
+		{token: RPAREN, literal: ")"},
+		{token: PLUS, literal: "+"},
+		{token: RANGE, literal: "B2:AA3"},
+		{token: UNKNOWN_KEYWORD, literal: "x"},
+		{token: QUESTION, literal: "?"},
+		{token: UNKNOWN_KEYWORD, literal: "A1"},
+		{token: COLON, literal: ":"},
+		{token: UNKNOWN_KEYWORD, literal: "B1"},
+		{token: UNKNOWN_KEYWORD, literal: "A1"},
+		{token: COLON, literal: ":"},
+		{token: UNKNOWN_KEYWORD, literal: "b2"},
+		{token: UNKNOWN_KEYWORD, literal: "A1"},
+		{token: COLON, literal: ":"},
+		{token: UNKNOWN_KEYWORD, literal: "B0"},
+		{token: UNKNOWN_KEYWORD, literal: "A1"},
+		{token: COLON, literal: ":"},
+		{token: UNKNOWN_KEYWORD, literal: "B2x"},
+		{token: EOF, literal: ""},
+	}
+	for _, res := range expected {
+		token, literal := scanner.Scan()
+		for token == WS {
+			token, literal = scanner.Scan()
+		}
+		c.Assert(token, Equals, res.token, Commentf(res.literal))
+		c.Assert(literal, Equals, res.literal)
+	}
+}
+
+func (s *ScannerSuite) TestScanStrings(c *C) {
+	scanner = NewScanner(strings.NewReader(`"a" & "say ""hi""" & "" "unterminated`))
+
+	expected := []ScanResult{
+		{token: STRING, literal: `"a"`},
+		{token: CONCAT, literal: "&"},
+		{token: STRING, literal: `"say ""hi"""`},
+		{token: CONCAT, literal: "&"},
+		{token: STRING, literal: `""`},
+		{token: ILLEGAL, literal: `"unterminated`},
+		{token: EOF, literal: ""},
+	}
+	for _, res := range expected {
+		token, literal := scanner.Scan()
+		for token == WS {
+			token, literal = scanner.Scan()
+		}
+		c.Assert(token, Equals, res.token, Commentf(res.literal))
+		c.Assert(literal, Equals, res.literal)
+	}
+}
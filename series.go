@@ -0,0 +1,124 @@
+package mathval
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// builtinProd implements prod(k, lo, hi, body), the product of body for each integer k from lo to hi
+func builtinProd(ev *Evaluator, args []*Conditional) (Value, error) {
+	if len(args) != 4 {
+		return nil, fmt.Errorf("prod expects 4 arguments, got %d", len(args))
+	}
+	return ev.series("prod", args)
+}
+
+// series evaluates sum(k, lo, hi, body) or prod(k, lo, hi, body). The iteration variable is bound only within
+// the body, shadowing any variable of the same name, and the bounds must be integers. An empty range gives 0
+// for a sum and 1 for a product. A sum whose body is a polynomial in k of low degree is computed from its
+// closed form, so it isn't subject to MaxIterations
+func (ev *Evaluator) series(name string, args []*Conditional) (Value, error) {
+	ident := args[0].soleTerm()
+	if ident == nil || ident.ident == nil {
+		return nil, fmt.Errorf("%s: Expected iteration variable, got %s", name, args[0])
+	}
+	k := ident.ident.name
+	if ev.isConstant(k) {
+		return nil, fmt.Errorf("%s: Iteration variable %s shadows a constant", name, k)
+	}
+
+	lo, err := ev.bound(name, args[1])
+	if err != nil {
+		return nil, err
+	}
+	hi, err := ev.bound(name, args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	op, acc := PLUS, Value(NewNumberValue(new(big.Rat)))
+	if name == "prod" {
+		op, acc = MULTIPLY, NewNumberValue(big.NewRat(1, 1))
+	}
+	if hi.Cmp(lo) < 0 {
+		return acc, nil
+	}
+
+	if poly, ok := polynomial(args[3], k); ok && op == PLUS {
+		return ev.sumPolynomial(poly, lo, hi)
+	}
+
+	count := new(big.Int).Sub(hi, lo)
+	if count.Cmp(big.NewInt(ev.MaxIterations)) >= 0 {
+		return nil, fmt.Errorf("%s: %s iterations exceeds the limit of %d", name, count.Add(count, big.NewInt(1)), ev.MaxIterations)
+	}
+
+	local := &scope{vars: make(map[string]Value, 1), parent: ev.scope}
+	caller := ev.scope
+	ev.scope = local
+	defer func() { ev.scope = caller }()
+
+	for i := new(big.Int).Set(lo); i.Cmp(hi) <= 0; i.Add(i, big.NewInt(1)) {
+		local.vars[k] = NewNumberValue(new(big.Rat).SetInt(i))
+		val, err := ev.evalConditional(args[3])
+		if err != nil {
+			return nil, err
+		}
+		// Start from the first term rather than the identity, so a series of quantities keeps its unit
+		if i.Cmp(lo) == 0 {
+			acc = val
+		} else if acc, err = arithmetic(op, acc, val); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// bound evaluates a bound of a sum or product, which must be an integer
+func (ev *Evaluator) bound(name string, arg *Conditional) (*big.Int, error) {
+	val, err := ev.evalConditional(arg)
+	if err != nil {
+		return nil, err
+	}
+	r, err := toRat(val)
+	if err != nil || !r.IsInt() {
+		return nil, fmt.Errorf("%s: Bounds must be integers, got %s", name, val)
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// sumPolynomial evaluates the sum of the polynomial for k from lo to hi, which must not be an empty range, as
+// the sum to hi less the sum to lo - 1
+func (ev *Evaluator) sumPolynomial(poly []*monomial, lo, hi *big.Int) (Value, error) {
+	to := new(big.Rat).SetInt(hi)
+	below := new(big.Rat).SetInt(new(big.Int).Sub(lo, big.NewInt(1)))
+
+	var acc Value = NewNumberValue(new(big.Rat))
+	for i, mono := range poly {
+		sum := faulhaber(mono.degree, to)
+		sum.Sub(sum, faulhaber(mono.degree, below))
+
+		var term Value = NewNumberValue(sum)
+		if mono.coeff != nil {
+			coeff, err := ev.evalFactor(mono.coeff)
+			if err != nil {
+				return nil, err
+			}
+			if term, err = arithmetic(MULTIPLY, coeff, term); err != nil {
+				return nil, err
+			}
+		}
+
+		op := PLUS
+		if mono.negative {
+			op = MINUS
+		}
+		var err error
+		if i == 0 && !mono.negative {
+			acc = term
+		} else if acc, err = arithmetic(op, acc, term); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
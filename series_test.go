@@ -0,0 +1,82 @@
+package mathval
+
+import (
+	"regexp"
+
+	. "gopkg.in/check.v1"
+)
+
+type SeriesSuite struct{}
+
+var _ = Suite(&SeriesSuite{})
+
+func (s *SeriesSuite) TestSeries(c *C) {
+	expected := []EvalResult{
+		{input: "sum(k, 1, 10, k^2)", expected: "385"},
+		{input: "sum(k, 1, 100, k)", expected: "5050"},
+		{input: "sum(k, 1, 10, k + 10%)", expected: "121/2"},
+		{input: "sum(k, 1, 10, 10% + k)", expected: "56"},
+		{input: "sum(k, 0, 10, 2 * k + 1)", expected: "121"},
+		{input: "sum(k, -3, 3, k^3)", expected: "0"},
+		{input: "sum(k, 1, 10, 1 / k) == sum(k, 1, 10, 1 / k)", expected: "true"},
+		{input: "sum(k, 1, 4, 1 / k)", expected: "25/12"},
+		{input: "sum(k, 0, 10, 2^k)", expected: "2047"},
+		{input: "sum(k, 1, 3, [k, k^2])", expected: "[6, 14]"},
+		{input: "prod(i, 1, 5, i)", expected: "120"},
+		{input: "prod(i, 1, 3, i + 1/2)", expected: "105/8"},
+		{input: "sum(k, 5, 1, k)", expected: "0"},
+		{input: "prod(k, 5, 1, k)", expected: "1"},
+		{input: "sum(i, 1, 3, sum(j, 1, i, i * j))", expected: "25"},
+		{input: "sum(k, 1, 10^30, k)", expected: "500000000000000000000000000000500000000000000000000000000000"},
+	}
+	for _, res := range expected {
+		val, err := evaluate(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (s *SeriesSuite) TestSeriesScope(c *C) {
+	expected := []EvalResult{
+		{input: "k = 100; sum(k, 1, 3, k) + k", expected: "106"},
+		{input: "n = 4; prod(k, 1, n, k)", expected: "24"},
+		{input: "a = 2; sum(k, 1, 3, a * k)", expected: "12"},
+		{input: "f(n) = sum(k, 1, n, k^3); f(10)", expected: "3025"},
+		{input: "f(x) = x + 1; prod(k, 1, 3, f(k))", expected: "24"},
+	}
+	for _, res := range expected {
+		val, err := run(NewEvaluator(), res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+
+	_, err := run(NewEvaluator(), "sum(k, 1, 3, k); k")
+	c.Assert(err, NotNil)
+}
+
+func (s *SeriesSuite) TestSeriesErrors(c *C) {
+	ev := NewEvaluator()
+	ev.MaxIterations = 100
+
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "prod(k, 1, 1000, k)", err: "prod: 1000 iterations exceeds the limit of 100"},
+		{input: "sum(k, 1, 101, 2^k)", err: "sum: 101 iterations exceeds the limit of 100"},
+		{input: "sum(1, 1, 3, 1)", err: "sum: Expected iteration variable, got 1"},
+		{input: "sum(pi, 1, 3, pi)", err: "sum: Iteration variable pi shadows a constant"},
+		{input: "sum(k, 1/2, 3, k)", err: "sum: Bounds must be integers, got 1/2"},
+		{input: "prod(k, 1, 1 < 2, k)", err: "prod: Bounds must be integers, got true"},
+		{input: "prod(k, 1, 3)", err: "prod expects 4 arguments, got 3"},
+	}
+	for _, res := range expected {
+		_, err := evaluate(ev, res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+
+	// Polynomial sums have a closed form, so aren't limited
+	val, err := evaluate(ev, "sum(k, 1, 1000, k)")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "500500")
+}
@@ -0,0 +1,222 @@
+package mathval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The functions below encode the AST as S-expressions, which are the JSON document of a Program, see
+// Program.JSON, written as Lisp data and so just as lossless. An object is a property list of keywords and
+// values, an array is in square brackets and strings are quoted as in Go:
+//
+//	(:version 1 :statements [(:conditional (:disjunction (:conjunction ...)))])
+//
+// Fields are written in the same order as in JSON, and true, false and nil stand for their JSON values
+
+// SExpr returns the Program as an S-expression, with the offsets of operators and calls if positions is set
+func (prog *Program) SExpr(positions bool) (string, error) {
+	data, err := prog.JSON(positions)
+	if err != nil {
+		return "", err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var out strings.Builder
+	if err := writeSExpr(&out, dec); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// writeSExpr writes the next JSON value read from the decoder as an S-expression
+func writeSExpr(out *strings.Builder, dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		open, end := "[", "]"
+		if tok == '{' {
+			open, end = "(", ")"
+		}
+		out.WriteString(open)
+		for i := 0; dec.More(); i++ {
+			if i > 0 {
+				out.WriteString(" ")
+			}
+			if tok == '{' {
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				out.WriteString(":" + key.(string) + " ")
+			}
+			if err := writeSExpr(out, dec); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+		out.WriteString(end)
+	case string:
+		out.WriteString(strconv.Quote(tok))
+	case json.Number:
+		out.WriteString(tok.String())
+	case bool:
+		out.WriteString(strconv.FormatBool(tok))
+	case nil:
+		out.WriteString("nil")
+	}
+	return nil
+}
+
+// ParseSExpr reads a Program from an S-expression written by SExpr. Malformed S-expressions are SyntaxErrors
+// at their offset, and well formed ones are decoded as their JSON would be
+func ParseSExpr(r io.Reader) (*Program, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &sexprReader{src: []rune(string(src))}
+	var out bytes.Buffer
+	if err := p.value(&out); err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.i < len(p.src) {
+		return nil, p.unexpected()
+	}
+
+	prog := &Program{}
+	if err := json.Unmarshal(out.Bytes(), prog); err != nil {
+		return nil, err
+	}
+	return prog, nil
+}
+
+// sexprReader converts an S-expression to JSON
+type sexprReader struct {
+	src []rune
+	i   int // offset of the next rune
+}
+
+// skipSpace skips any whitespace
+func (p *sexprReader) skipSpace() {
+	for p.i < len(p.src) && unicode.IsSpace(p.src[p.i]) {
+		p.i++
+	}
+}
+
+// unexpected returns the error for the rune at the offset, or the end of the source
+func (p *sexprReader) unexpected() error {
+	if p.i >= len(p.src) {
+		return &SyntaxError{Msg: "Unexpected EOF", Pos: p.i}
+	}
+	return &SyntaxError{Msg: fmt.Sprintf("Unexpected %q", string(p.src[p.i])), Pos: p.i}
+}
+
+// atom reads a symbol, keyword or number, which run up to whitespace or a delimiter
+func (p *sexprReader) atom() string {
+	start := p.i
+	for p.i < len(p.src) && !unicode.IsSpace(p.src[p.i]) && !strings.ContainsRune(`()[]"`, p.src[p.i]) {
+		p.i++
+	}
+	return string(p.src[start:p.i])
+}
+
+// value reads the next value and writes it as JSON
+func (p *sexprReader) value(out *bytes.Buffer) error {
+	p.skipSpace()
+	if p.i >= len(p.src) {
+		return p.unexpected()
+	}
+	start := p.i
+	switch ch := p.src[p.i]; ch {
+	case '(', '[':
+		p.i++
+		end := ')'
+		if ch == '(' {
+			out.WriteString("{")
+		} else {
+			end = ']'
+			out.WriteString("[")
+		}
+		for n := 0; ; n++ {
+			if p.skipSpace(); p.i < len(p.src) && p.src[p.i] == end {
+				p.i++
+				break
+			}
+			if n > 0 {
+				out.WriteString(",")
+			}
+			if ch == '(' {
+				if err := p.keyword(out); err != nil {
+					return err
+				}
+			}
+			if err := p.value(out); err != nil {
+				return err
+			}
+		}
+		if ch == '(' {
+			out.WriteString("}")
+		} else {
+			out.WriteString("]")
+		}
+		return nil
+	case '"':
+		for p.i++; p.i < len(p.src) && p.src[p.i] != '"'; p.i++ {
+			if p.src[p.i] == '\\' {
+				p.i++
+			}
+		}
+		if p.i >= len(p.src) {
+			return &SyntaxError{Msg: "Unterminated string", Pos: start}
+		}
+		p.i++
+		s, err := strconv.Unquote(string(p.src[start:p.i]))
+		if err != nil {
+			return &SyntaxError{Msg: "Invalid string " + string(p.src[start:p.i]), Pos: start}
+		}
+		data, _ := json.Marshal(s)
+		out.Write(data)
+		return nil
+	}
+
+	switch atom := p.atom(); {
+	case atom == "":
+		return p.unexpected()
+	case atom == "true" || atom == "false":
+		out.WriteString(atom)
+	case atom == "nil":
+		out.WriteString("null")
+	default:
+		if _, err := strconv.ParseInt(atom, 10, 64); err != nil {
+			return &SyntaxError{Msg: fmt.Sprintf("Unexpected %q", atom), Pos: start}
+		}
+		out.WriteString(atom)
+	}
+	return nil
+}
+
+// keyword reads the keyword naming the next field of an object and writes it as a JSON key
+func (p *sexprReader) keyword(out *bytes.Buffer) error {
+	p.skipSpace()
+	start := p.i
+	atom := p.atom()
+	if atom == "" {
+		return p.unexpected()
+	} else if len(atom) < 2 || atom[0] != ':' {
+		return &SyntaxError{Msg: fmt.Sprintf("Expected keyword, got %q", atom), Pos: start}
+	}
+	data, _ := json.Marshal(atom[1:])
+	out.Write(data)
+	out.WriteString(":")
+	return nil
+}
@@ -0,0 +1,115 @@
+package mathval
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+type SExprSuite struct{}
+
+var _ = Suite(&SExprSuite{})
+
+// checkSExprRoundTrip checks that the Program reads back from its S-expression, with and without positions,
+// as a Program which prints and encodes the same
+func checkSExprRoundTrip(fatalf func(format string, args ...interface{}), prog *Program) {
+	for _, positions := range []bool{true, false} {
+		s, err := prog.SExpr(positions)
+		if err != nil {
+			fatalf("%s: %s", prog, err)
+		}
+		read, err := ParseSExpr(strings.NewReader(s))
+		if err != nil {
+			fatalf("%s: %s in %s", prog, err, s)
+		}
+		again, err := read.SExpr(positions)
+		if err != nil {
+			fatalf("%s: %s", prog, err)
+		}
+		if read.String() != prog.String() || again != s {
+			fatalf("%s: read back as %s\n%s\n%s", prog, read, s, again)
+		}
+	}
+}
+
+func (s *SExprSuite) TestEncode(c *C) {
+	prog, err := parseProgram(`x = a // "text"`)
+	c.Assert(err, IsNil)
+
+	out, err := prog.SExpr(false)
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, `(:version 1 :statements [(:assignment (:name "x" :value (:disjunction (:conjunction (:comparison (:expression (:factor (:power (:term (:identifier "a" :trailing ["// \"text\""]))))))))))])`)
+
+	prog, err = parseProgram("[] + 2 x!")
+	c.Assert(err, IsNil)
+	out, err = prog.SExpr(true)
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, `(:version 1 :statements [(:conditional (:disjunction (:conjunction (:comparison (:expression (:factor (:power (:term (:list (:elems [])))) :op (:op "+" :pos 3) :expression (:factor (:power (:term (:number (:str "2" :val "2/1"))) :op (:op "implicit" :pos 7) :factor (:power (:term (:identifier "x" :postfix [(:op "!" :pos 8)])))))))))))])`)
+}
+
+func (s *SExprSuite) TestRoundTrip(c *C) {
+	for _, path := range []string{"testdata/latex.golden", "testdata/mathml.golden"} {
+		inputs, err := goldenInputs(path)
+		c.Assert(err, IsNil)
+		for _, input := range inputs {
+			prog, err := parseProgram(input)
+			c.Assert(err, IsNil, Commentf(input))
+			checkSExprRoundTrip(c.Fatalf, prog)
+		}
+	}
+
+	// Whitespace is free and strings are quoted as in Go
+	prog, err := ParseSExpr(strings.NewReader(`
+		(:version 1
+		 :statements [(:conditional
+		   (:disjunction (:conjunction (:comparison (:expression (:factor (:power
+		     (:term (:identifier "x" :leading ["/* é */"])))))))))])`))
+	c.Assert(err, IsNil)
+	c.Assert(prog.String(), Equals, "/* é */ x")
+}
+
+func (s *SExprSuite) TestErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: `(:version 1 :statements [`, err: `Unexpected EOF at offset 25`},
+		{input: `(:version 1 :statements [] extra)`, err: `Expected keyword, got "extra" at offset 27`},
+		{input: `(:version 1 :statements []) x`, err: `Unexpected "x" at offset 28`},
+		{input: `(:version 1 :statements [)])`, err: `Unexpected ")" at offset 25`},
+		{input: `(:version 1.5)`, err: `Unexpected "1.5" at offset 10`},
+		{input: `(:version 1 :statements ["a)`, err: `Unterminated string at offset 25`},
+		{input: `(:version "\q")`, err: `Invalid string "\q" at offset 10`},
+		{input: `(:version 2 :statements [])`, err: `Unsupported JSON schema version 2, expected 1`},
+		{input: `(:version 1 :statements [()])`, err: `Statement must have exactly one of assignment, definition and conditional, got 0`},
+		{input: `(:version 1 :statements [(1)])`, err: `Expected keyword, got "1" at offset 26`},
+		{input: `(:version 1 :statements [(:conditional])`, err: `Unexpected "]" at offset 38`},
+		{input: ``, err: `Unexpected EOF at offset 0`},
+	}
+	for _, res := range expected {
+		_, err := ParseSExpr(strings.NewReader(res.input))
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+}
+
+// FuzzSExpr checks that any formula which parses round trips through an S-expression
+func FuzzSExpr(f *testing.F) {
+	for _, path := range []string{"testdata/latex.golden", "testdata/mathml.golden", "testdata/contentmathml.golden"} {
+		inputs, err := goldenInputs(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, input := range inputs {
+			f.Add(input)
+		}
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		prog, err := parseProgram(input)
+		if err != nil {
+			return
+		}
+		checkSExprRoundTrip(t.Fatalf, prog)
+	})
+}
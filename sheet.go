@@ -0,0 +1,366 @@
+package mathval
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRangeCells is the most cells a range may cover
+const maxRangeCells = 100000
+
+// parseCell returns the column and row, both counted from 1, of a cell reference such as "B12". Columns are
+// lettered A to Z, then AA to AZ and so on
+func parseCell(name string) (col, row int, ok bool) {
+	i := strings.IndexFunc(name, func(ch rune) bool { return ch < 'A' || ch > 'Z' })
+	if i <= 0 || i > 3 || name[i] < '1' || name[i] > '9' {
+		return 0, 0, false
+	}
+	for _, ch := range name[:i] {
+		col = col*26 + int(ch-'A') + 1
+	}
+	row, err := strconv.Atoi(name[i:])
+	if err != nil {
+		return 0, 0, false
+	}
+	return col, row, true
+}
+
+// isCell returns whether the name is a cell reference, see parseCell
+func isCell(name string) bool {
+	_, _, ok := parseCell(name)
+	return ok
+}
+
+// cellName returns the reference of the cell in the given column and row
+func cellName(col, row int) string {
+	var letters []byte
+	for ; col > 0; col = (col - 1) / 26 {
+		letters = append([]byte{byte('A' + (col-1)%26)}, letters...)
+	}
+	return string(letters) + strconv.Itoa(row)
+}
+
+// String returns the Range as it is written
+func (r *Range) String() string {
+	return r.from + ":" + r.to
+}
+
+// names returns the references of the cells in the Range row by row. Either corner may come first
+func (r *Range) names() ([]string, error) {
+	fromCol, fromRow, ok := parseCell(r.from)
+	toCol, toRow, ok2 := parseCell(r.to)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("Invalid range %s", r)
+	}
+	if fromCol > toCol {
+		fromCol, toCol = toCol, fromCol
+	}
+	if fromRow > toRow {
+		fromRow, toRow = toRow, fromRow
+	}
+	if rows := toRow - fromRow + 1; rows > maxRangeCells || (toCol-fromCol+1)*rows > maxRangeCells {
+		return nil, fmt.Errorf("Range %s has more than %d cells", r, maxRangeCells)
+	}
+
+	var names []string
+	for row := fromRow; row <= toRow; row++ {
+		for col := fromCol; col <= toCol; col++ {
+			names = append(names, cellName(col, row))
+		}
+	}
+	return names, nil
+}
+
+// evalRange evaluates a Range to a list of the values of the variables named by its cells, leaving out any which
+// aren't set
+func (ev *Evaluator) evalRange(r *Range) (Value, error) {
+	names, err := r.names()
+	if err != nil {
+		return nil, err
+	}
+	elems := []Value{}
+	for _, name := range names {
+		if val, ok := ev.constant(name); ok {
+			elems = append(elems, val)
+		} else if val, ok := ev.scope.lookup(name); ok {
+			elems = append(elems, val)
+		} else if val, ok := ev.vars[name]; ok {
+			elems = append(elems, val)
+		}
+	}
+	return &ListValue{elems: elems}, nil
+}
+
+// CellError is the error of a cell whose formula failed to evaluate, or which depends on one that did
+type CellError struct {
+	Cell string // the cell whose formula failed
+	Err  error
+}
+
+// Error returns the error prefixed with the cell it came from
+func (e *CellError) Error() string {
+	return e.Cell + ": " + e.Err.Error()
+}
+
+// CycleError is returned when setting a formula would make a cell depend on itself
+type CycleError struct {
+	Path []string // the cells in the cycle, starting and ending with the cell being set
+}
+
+// Error returns the path of the cycle
+func (e *CycleError) Error() string {
+	return "Cycle " + strings.Join(e.Path, " -> ")
+}
+
+// cell is a cell of a Sheet. Cells without a formula exist while other cells depend on them
+type cell struct {
+	formula    string
+	cond       *Conditional
+	refs       []string        // every cell the formula depends on, sorted
+	direct     map[string]bool // cells the formula refers to by name rather than as part of a range
+	dependents map[string]bool // cells whose formulas depend on this one
+	value      Value
+	err        error
+}
+
+// Sheet is a grid of cells holding formulas, which may refer to other cells by name, as in "A1 + B2*2", or to
+// ranges of them, as in "sum(A1:A10)". A cell without a formula is 0 when referred to by name, and is left out
+// of ranges. When a cell is set, it and the cells which depend on it are recalculated in dependency order, and
+// a formula which would make a cell depend on itself is rejected
+type Sheet struct {
+	ev    *Evaluator
+	mode  Mode
+	cells map[string]*cell
+}
+
+// NewSheet returns an empty Sheet
+func NewSheet() *Sheet {
+	return &Sheet{ev: NewEvaluator(), cells: make(map[string]*cell)}
+}
+
+// Evaluator returns the Evaluator formulas are evaluated with, so that constants, functions and limits can be set.
+// Cells are variables in it, so they shouldn't be set directly
+func (s *Sheet) Evaluator() *Evaluator {
+	return s.ev
+}
+
+// SetMode sets the flags formulas set afterwards are parsed with, in addition to Cells
+func (s *Sheet) SetMode(mode Mode) {
+	s.mode = mode
+}
+
+// Set sets the formula of the cell, or clears it if the formula is empty, and recalculates it and every cell
+// which depends on it. It returns the cells recalculated, in the order they were. A formula which doesn't parse
+// or would make a cycle is an error, and leaves the Sheet unchanged. A formula which fails to evaluate is not,
+// see Value
+func (s *Sheet) Set(ref, formula string) ([]string, error) {
+	if !isCell(ref) {
+		return nil, fmt.Errorf("Invalid cell reference %s", ref)
+	}
+
+	var cond *Conditional
+	var refs []string
+	var direct map[string]bool
+	if strings.TrimSpace(formula) != "" {
+		parser := NewParser(strings.NewReader(formula))
+		parser.SetMode(s.mode | Cells)
+		var err error
+		if cond, err = parser.Parse(); err != nil {
+			return nil, err
+		}
+		if refs, direct, err = references(cond); err != nil {
+			return nil, err
+		}
+		if path := s.cycle(ref, refs); path != nil {
+			return nil, &CycleError{Path: path}
+		}
+	}
+
+	c := s.cell(ref)
+	old := c.refs
+	c.formula, c.cond, c.refs, c.direct = formula, cond, refs, direct
+	for _, dep := range old {
+		delete(s.cells[dep].dependents, ref)
+	}
+	for _, dep := range refs {
+		s.cell(dep).dependents[ref] = true
+	}
+
+	order := s.affected(ref)
+	for _, r := range order {
+		s.recalculate(r)
+	}
+	for _, r := range append(old, ref) {
+		s.prune(r)
+	}
+	return order, nil
+}
+
+// Value returns the value of the cell, which is nil if it has no formula. If its formula, or that of a cell it
+// depends on, failed to evaluate, the error is a CellError
+func (s *Sheet) Value(ref string) (Value, error) {
+	if !isCell(ref) {
+		return nil, fmt.Errorf("Invalid cell reference %s", ref)
+	}
+	c, ok := s.cells[ref]
+	if !ok {
+		return nil, nil
+	}
+	return c.value, c.err
+}
+
+// Formula returns the formula of the cell as it was set, or "" if it has none
+func (s *Sheet) Formula(ref string) string {
+	if c, ok := s.cells[ref]; ok {
+		return c.formula
+	}
+	return ""
+}
+
+// Cells returns the cells which have a formula, sorted
+func (s *Sheet) Cells() []string {
+	var refs []string
+	for ref, c := range s.cells {
+		if c.cond != nil {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// cell returns the named cell, adding an empty one if there isn't one
+func (s *Sheet) cell(ref string) *cell {
+	c, ok := s.cells[ref]
+	if !ok {
+		c = &cell{dependents: make(map[string]bool)}
+		s.cells[ref] = c
+	}
+	return c
+}
+
+// prune removes the cell if it has no formula and no cells depend on it
+func (s *Sheet) prune(ref string) {
+	if c := s.cells[ref]; c.cond == nil && len(c.dependents) == 0 {
+		delete(s.cells, ref)
+	}
+}
+
+// references returns every cell the Conditional depends on, sorted, and those it refers to by name
+func references(cond *Conditional) (refs []string, direct map[string]bool, err error) {
+	all := make(map[string]bool)
+	direct = make(map[string]bool)
+	cond.rewrite(func(term *Term) *Term {
+		if term.ident != nil && isCell(term.ident.name) {
+			all[term.ident.name] = true
+			direct[term.ident.name] = true
+		} else if term.cells != nil && err == nil {
+			var names []string
+			names, err = term.cells.names()
+			for _, name := range names {
+				all[name] = true
+			}
+		}
+		return term
+	})
+	for ref := range all {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs, direct, err
+}
+
+// cycle returns the path by which refs lead back to the cell ref, starting and ending with it, or nil if they
+// don't
+func (s *Sheet) cycle(ref string, refs []string) []string {
+	seen := make(map[string]bool)
+	var path []string
+	var visit func(r string) bool
+	visit = func(r string) bool {
+		path = append(path, r)
+		if r == ref {
+			return true
+		}
+		if c, ok := s.cells[r]; ok && !seen[r] {
+			seen[r] = true
+			for _, dep := range c.refs {
+				if visit(dep) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+
+	for _, r := range refs {
+		if visit(r) {
+			return append([]string{ref}, path...)
+		}
+	}
+	return nil
+}
+
+// affected returns the cell and every cell which depends on it, directly or indirectly, ordered so that each
+// comes after the cells it depends on
+func (s *Sheet) affected(ref string) []string {
+	// The reverse of a depth-first post-order over dependents is a topological order
+	var order []string
+	seen := make(map[string]bool)
+	var visit func(r string)
+	visit = func(r string) {
+		seen[r] = true
+		var dependents []string
+		for d := range s.cells[r].dependents {
+			dependents = append(dependents, d)
+		}
+		sort.Sort(sort.Reverse(sort.StringSlice(dependents)))
+		for _, d := range dependents {
+			if !seen[d] {
+				visit(d)
+			}
+		}
+		order = append(order, r)
+	}
+	visit(ref)
+
+	for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+		order[i], order[j] = order[j], order[i]
+	}
+	return order
+}
+
+// recalculate evaluates the formula of the cell, whose dependencies must already have been recalculated, and
+// binds the cell's variable to the result
+func (s *Sheet) recalculate(ref string) {
+	c := s.cells[ref]
+	delete(s.ev.vars, ref)
+	c.value, c.err = nil, nil
+	if c.cond == nil {
+		return
+	}
+
+	// Empty cells referred to by name are 0, but are left out of ranges
+	empty := make(map[string]Value)
+	for _, dep := range c.refs {
+		d := s.cells[dep]
+		if d.err != nil {
+			c.err = d.err
+			return
+		}
+		if d.cond == nil && c.direct[dep] {
+			empty[dep] = NewNumberValue(new(big.Rat))
+		}
+	}
+
+	s.ev.scope = &scope{vars: empty}
+	defer func() { s.ev.scope = nil }()
+	if c.value, c.err = s.ev.Eval(c.cond); c.err != nil {
+		c.value, c.err = nil, &CellError{Cell: ref, Err: c.err}
+		return
+	}
+	s.ev.vars[ref] = c.value
+}
@@ -0,0 +1,172 @@
+package mathval
+
+import (
+	"math/big"
+
+	. "gopkg.in/check.v1"
+)
+
+type SheetSuite struct{}
+
+var _ = Suite(&SheetSuite{})
+
+// set sets each cell of the sheet in turn, failing the test on error
+func set(c *C, sheet *Sheet, cells ...string) {
+	for i := 0; i < len(cells); i += 2 {
+		_, err := sheet.Set(cells[i], cells[i+1])
+		c.Assert(err, IsNil, Commentf(cells[i]))
+	}
+}
+
+// values returns the values of the cells as strings, or their errors
+func values(sheet *Sheet, refs ...string) []string {
+	res := make([]string, len(refs))
+	for i, ref := range refs {
+		val, err := sheet.Value(ref)
+		switch {
+		case err != nil:
+			res[i] = err.Error()
+		case val == nil:
+			res[i] = "<empty>"
+		default:
+			res[i] = val.String()
+		}
+	}
+	return res
+}
+
+func (s *SheetSuite) TestFormulas(c *C) {
+	sheet := NewSheet()
+	set(c, sheet,
+		"A1", "1",
+		"A2", "2",
+		"A3", "3",
+		"B2", "10",
+		"C1", "A1 + B2*2",
+		"C2", "sum(A1:A10)",
+		"C3", "mean(A1:A3) + len(A1:B3)",
+		"C4", "A1:A3 * 2",
+		"C5", "B1 + 1",
+		"C6", "max(A3:A1)",
+		"C7", "A1 > 0 ? A2 : A3",
+	)
+	c.Assert(values(sheet, "C1", "C2", "C3", "C4", "C5", "C6", "C7", "D1"), DeepEquals,
+		[]string{"21", "6", "6", "[2, 4, 6]", "1", "3", "2", "<empty>"})
+	c.Assert(sheet.Formula("C1"), Equals, "A1 + B2*2")
+	c.Assert(sheet.Formula("D1"), Equals, "")
+	c.Assert(sheet.Cells(), DeepEquals, []string{"A1", "A2", "A3", "B2", "C1", "C2", "C3", "C4", "C5", "C6", "C7"})
+
+	// The Evaluator can be configured, and formulas can use its functions
+	sheet.Evaluator().RegisterConstant("rate", NewNumberValue(big.NewRat(1, 10)))
+	set(c, sheet, "D1", "C1 * rate", "D2", "map(A1:A3, x -> x^2)")
+	c.Assert(values(sheet, "D1", "D2"), DeepEquals, []string{"21/10", "[1, 4, 9]"})
+}
+
+func (s *SheetSuite) TestRecalculation(c *C) {
+	sheet := NewSheet()
+	set(c, sheet,
+		"A1", "1",
+		"A2", "A1 * 2",
+		"A3", "A2 + A1",
+		"B1", "sum(A1:A3)",
+		"C1", "42",
+	)
+	c.Assert(values(sheet, "A2", "A3", "B1"), DeepEquals, []string{"2", "3", "6"})
+
+	// Only the cell and those depending on it are recalculated, each after the cells it depends on
+	order, err := sheet.Set("A1", "5")
+	c.Assert(err, IsNil)
+	c.Assert(order, DeepEquals, []string{"A1", "A2", "A3", "B1"})
+	c.Assert(values(sheet, "A2", "A3", "B1"), DeepEquals, []string{"10", "15", "30"})
+
+	order, err = sheet.Set("A3", "7")
+	c.Assert(err, IsNil)
+	c.Assert(order, DeepEquals, []string{"A3", "B1"})
+	c.Assert(values(sheet, "B1"), DeepEquals, []string{"22"})
+
+	order, err = sheet.Set("C1", "43")
+	c.Assert(err, IsNil)
+	c.Assert(order, DeepEquals, []string{"C1"})
+
+	// A1 no longer depends on anything, and A2 no longer affects A3
+	order, err = sheet.Set("A2", "C1")
+	c.Assert(err, IsNil)
+	c.Assert(order, DeepEquals, []string{"A2", "B1"})
+	order, err = sheet.Set("C1", "1")
+	c.Assert(err, IsNil)
+	c.Assert(order, DeepEquals, []string{"C1", "A2", "B1"})
+	c.Assert(values(sheet, "B1"), DeepEquals, []string{"13"})
+
+	// Cleared cells are 0 by name and left out of ranges
+	order, err = sheet.Set("A1", "")
+	c.Assert(err, IsNil)
+	c.Assert(order, DeepEquals, []string{"A1", "B1"})
+	c.Assert(values(sheet, "A1", "B1"), DeepEquals, []string{"<empty>", "8"})
+	set(c, sheet, "D1", "A1 + 1", "D2", "len(A1:A3)")
+	c.Assert(values(sheet, "D1", "D2"), DeepEquals, []string{"1", "2"})
+}
+
+func (s *SheetSuite) TestCycles(c *C) {
+	sheet := NewSheet()
+	set(c, sheet,
+		"A1", "B1 + 1",
+		"B1", "C1 * 2",
+		"C1", "3",
+	)
+
+	_, err := sheet.Set("C1", "A1")
+	c.Assert(err, ErrorMatches, "Cycle C1 -> A1 -> B1 -> C1")
+	c.Assert(err.(*CycleError).Path, DeepEquals, []string{"C1", "A1", "B1", "C1"})
+	_, err = sheet.Set("A1", "A1 + 1")
+	c.Assert(err, ErrorMatches, "Cycle A1 -> A1")
+	_, err = sheet.Set("D5", "sum(A1:C10)")
+	c.Assert(err, IsNil)
+	_, err = sheet.Set("C1", "D5")
+	c.Assert(err, ErrorMatches, "Cycle C1 -> D5 -> A1 -> B1 -> C1")
+
+	// Rejected formulas leave the sheet unchanged
+	c.Assert(sheet.Formula("C1"), Equals, "3")
+	c.Assert(values(sheet, "A1", "D5"), DeepEquals, []string{"7", "16"})
+}
+
+func (s *SheetSuite) TestErrors(c *C) {
+	sheet := NewSheet()
+	set(c, sheet,
+		"A1", "1 / 0",
+		"A2", "A1 + 1",
+		"A3", "sum(A1:A2)",
+		"B1", "x + 1",
+	)
+	c.Assert(values(sheet, "A1", "A2", "A3", "B1"), DeepEquals,
+		[]string{"A1: Division by zero", "A1: Division by zero", "A1: Division by zero", "B1: Unknown variable x"})
+	_, err := sheet.Value("A2")
+	c.Assert(err.(*CellError).Cell, Equals, "A1")
+
+	// Fixing the cell fixes those depending on it
+	set(c, sheet, "A1", "2")
+	c.Assert(values(sheet, "A2", "A3"), DeepEquals, []string{"3", "5"})
+
+	_, err = sheet.Set("A1", "1 +")
+	c.Assert(err, ErrorMatches, "Unexpected EOF")
+	_, err = sheet.Set("a1", "1")
+	c.Assert(err, ErrorMatches, "Invalid cell reference a1")
+	_, err = sheet.Set("A0", "1")
+	c.Assert(err, ErrorMatches, "Invalid cell reference A0")
+	_, err = sheet.Set("A1", "sum(A1:ZZ100000)")
+	c.Assert(err, ErrorMatches, "Range A1:ZZ100000 has more than 100000 cells")
+	_, err = sheet.Value("1A")
+	c.Assert(err, ErrorMatches, "Invalid cell reference 1A")
+	c.Assert(values(sheet, "A1"), DeepEquals, []string{"2"})
+}
+
+func (s *SheetSuite) TestCellNames(c *C) {
+	for name, pos := range map[string][2]int{"A1": {1, 1}, "Z9": {26, 9}, "AA10": {27, 10}, "AZ1": {52, 1}, "ZZZ3": {18278, 3}} {
+		col, row, ok := parseCell(name)
+		c.Assert(ok, Equals, true, Commentf(name))
+		c.Assert([2]int{col, row}, Equals, pos, Commentf(name))
+		c.Assert(cellName(col, row), Equals, name)
+	}
+	for _, name := range []string{"A", "1", "A0", "a1", "AAAA1", "A1B", "A01"} {
+		c.Assert(isCell(name), Equals, false, Commentf(name))
+	}
+}
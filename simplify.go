@@ -0,0 +1,516 @@
+package mathval
+
+import (
+	"math/big"
+)
+
+// Simplify returns an equivalent copy of the Conditional with sums of common polynomials, such as
+// "sum(k, 1, n, k^2)", replaced by their closed forms. The original is not modified
+func Simplify(cond *Conditional) *Conditional {
+	res := cond.rewrite(func(term *Term) *Term {
+		if term.call == nil || term.call.name != "sum" || len(term.call.args) != 4 {
+			return term
+		}
+		closed := closedSum(term.call.args)
+		if closed == nil {
+			return term
+		}
+		return &Term{exp: closed, index: term.index, postfix: term.postfix, leading: term.leading, trailing: term.trailing}
+	})
+
+	// Drop the parentheses around a closed form which makes up the whole Conditional
+	if term := res.soleTerm(); term != nil && term.exp != nil && !term.group {
+		return term.exp
+	}
+	return res
+}
+
+// rewrite returns a copy of the Conditional with fn applied to every Term, innermost first
+func (cond *Conditional) rewrite(fn func(*Term) *Term) *Conditional {
+	if cond == nil {
+		return nil
+	}
+	return &Conditional{disjunction: cond.disjunction.rewrite(fn), then: cond.then.rewrite(fn), els: cond.els.rewrite(fn), to: cond.to, currency: cond.currency}
+}
+
+// rewrite returns a copy of the Disjunction with fn applied to every Term
+func (dis *Disjunction) rewrite(fn func(*Term) *Term) *Disjunction {
+	if dis == nil {
+		return nil
+	}
+	return &Disjunction{conjunction: dis.conjunction.rewrite(fn), op: dis.op, disjunction: dis.disjunction.rewrite(fn)}
+}
+
+// rewrite returns a copy of the Conjunction with fn applied to every Term
+func (con *Conjunction) rewrite(fn func(*Term) *Term) *Conjunction {
+	if con == nil {
+		return nil
+	}
+	return &Conjunction{comparison: con.comparison.rewrite(fn), op: con.op, conjunction: con.conjunction.rewrite(fn)}
+}
+
+// rewrite returns a copy of the Comparison with fn applied to every Term
+func (cmp *Comparison) rewrite(fn func(*Term) *Term) *Comparison {
+	return &Comparison{not: cmp.not, expression: cmp.expression.rewrite(fn), op: cmp.op, right: cmp.right.rewrite(fn)}
+}
+
+// rewrite returns a copy of the Expression with fn applied to every Term
+func (exp *Expression) rewrite(fn func(*Term) *Term) *Expression {
+	if exp == nil {
+		return nil
+	}
+	return &Expression{factor: exp.factor.rewrite(fn), op: exp.op, expression: exp.expression.rewrite(fn)}
+}
+
+// rewrite returns a copy of the Factor with fn applied to every Term
+func (fac *Factor) rewrite(fn func(*Term) *Term) *Factor {
+	if fac == nil {
+		return nil
+	}
+	return &Factor{power: fac.power.rewrite(fn), op: fac.op, factor: fac.factor.rewrite(fn)}
+}
+
+// rewrite returns a copy of the Power with fn applied to every Term
+func (pow *Power) rewrite(fn func(*Term) *Term) *Power {
+	if pow == nil {
+		return nil
+	}
+	return &Power{unary: pow.unary, term: pow.term.rewrite(fn), op: pow.op, power: pow.power.rewrite(fn)}
+}
+
+// rewrite returns fn applied to a copy of the Term, whose nested Conditionals have already been rewritten
+func (term *Term) rewrite(fn func(*Term) *Term) *Term {
+	res := *term
+	res.exp = term.exp.rewrite(fn)
+	if term.call != nil {
+		res.call = &Call{name: term.call.name, args: rewriteAll(term.call.args, fn), pos: term.call.pos}
+	}
+	if term.lambda != nil {
+		res.lambda = &Lambda{params: term.lambda.params, body: term.lambda.body.rewrite(fn)}
+	}
+	if term.list != nil {
+		res.list = &ListLiteral{elems: rewriteAll(term.list.elems, fn)}
+	}
+	if term.piecewise != nil {
+		res.piecewise = &Piecewise{cases: make([]*Case, len(term.piecewise.cases)), els: term.piecewise.els.rewrite(fn)}
+		for i, c := range term.piecewise.cases {
+			res.piecewise.cases[i] = &Case{cond: c.cond.rewrite(fn), value: c.value.rewrite(fn)}
+		}
+	}
+	res.index = make([]*Index, len(term.index))
+	for i, index := range term.index {
+		res.index[i] = &Index{from: index.from.rewrite(fn), to: index.to.rewrite(fn), slice: index.slice}
+	}
+	return fn(&res)
+}
+
+// rewriteAll returns a copy of each Conditional with fn applied to every Term
+func rewriteAll(conds []*Conditional, fn func(*Term) *Term) []*Conditional {
+	res := make([]*Conditional, len(conds))
+	for i, cond := range conds {
+		res[i] = cond.rewrite(fn)
+	}
+	return res
+}
+
+// mentions returns whether the name appears anywhere in the Conditional as an identifier or the name of a call
+func (cond *Conditional) mentions(name string) (found bool) {
+	cond.rewrite(func(term *Term) *Term {
+		found = found || (term.ident != nil && term.ident.name == name) || (term.call != nil && term.call.name == name)
+		return term
+	})
+	return
+}
+
+// monomial is one term of a polynomial in the iteration variable of a sum: sign * coeff * k^degree. The
+// coefficient is a left-folded chain of multiplications and divisions which doesn't mention k
+type monomial struct {
+	negative bool
+	coeff    *Factor // nil for 1
+	degree   int
+}
+
+// maxDegree is the highest power of the iteration variable with a closed-form sum, see faulhaber
+const maxDegree = 3
+
+// polynomial returns the body of a sum as a list of monomials in the named variable, if it is a sum of
+// products of terms which don't mention the variable and at most one power of the variable itself. A
+// percentage added or subtracted scales the terms before it, see Evaluator.evalExpression, so isn't a monomial
+func polynomial(body *Conditional, name string) ([]*monomial, bool) {
+	exp := body.soleExpression()
+	if exp == nil {
+		return nil, false
+	}
+
+	var poly []*monomial
+	negative := false
+	for ; exp != nil; exp = exp.expression {
+		if len(poly) > 0 && isPercentage(exp.factor) {
+			return nil, false
+		}
+		mono, ok := monomialOf(exp.factor, name)
+		if !ok {
+			return nil, false
+		}
+		mono.negative = mono.negative != negative
+		poly = append(poly, mono)
+		negative = exp.op != nil && exp.op.op == MINUS
+	}
+	return poly, true
+}
+
+// monomialOf returns the Factor as a monomial in the named variable
+func monomialOf(fac *Factor, name string) (*monomial, bool) {
+	mono := &monomial{}
+	var last *Factor
+	op := MULTIPLY
+	for ; fac != nil; fac = fac.factor {
+		if op == IMPLICIT_MULTIPLY {
+			op = MULTIPLY
+		}
+		if op != MULTIPLY && op != DIVIDE {
+			return nil, false
+		}
+
+		if conditionalOf(&Expression{factor: &Factor{power: fac.power}}).mentions(name) {
+			degree, negative, ok := powerOf(fac.power, name)
+			if !ok || mono.degree != 0 || op == DIVIDE {
+				return nil, false
+			}
+			mono.degree, mono.negative = degree, negative
+		} else {
+			next := &Factor{power: fac.power}
+			switch {
+			case last != nil:
+				last.op, last.factor = &MultiplyOp{op: op}, next
+			case op == DIVIDE:
+				mono.coeff = &Factor{power: powerOfConditional(numberConditional(1)), op: &MultiplyOp{op: op}, factor: next}
+			default:
+				mono.coeff = next
+			}
+			last = next
+		}
+
+		if fac.op != nil {
+			op = fac.op.op
+		}
+	}
+	return mono, true
+}
+
+// powerOf returns the degree of a Power which is a plain power of the named variable, such as "k" or "-k^2"
+func powerOf(pow *Power, name string) (degree int, negative bool, ok bool) {
+	term := pow.term
+	if term.ident == nil || term.ident.name != name || len(term.index) != 0 || len(term.postfix) != 0 {
+		return 0, false, false
+	}
+	for _, unary := range pow.unary {
+		negative = negative != (unary.op == MINUS)
+	}
+	if pow.op == nil {
+		return 1, negative, true
+	}
+	exp := pow.power
+	if exp.op != nil || len(exp.unary) != 0 || exp.term.number == nil || exp.term.unit != nil || exp.term.currency != "" || len(exp.term.postfix) != 0 {
+		return 0, false, false
+	}
+	if n := exp.term.number.val; n.IsInt() && n.Num().IsInt64() && n.Num().Int64() >= 1 && n.Num().Int64() <= maxDegree {
+		return int(n.Num().Int64()), negative, true
+	}
+	return 0, false, false
+}
+
+// faulhaber returns the sum of k^degree for k from 1 to n, for degree up to maxDegree
+func faulhaber(degree int, n *big.Rat) *big.Rat {
+	one := big.NewRat(1, 1)
+	n1 := new(big.Rat).Add(n, one)
+	res := new(big.Rat)
+	switch degree {
+	case 0:
+		res.Set(n)
+	case 1:
+		res.Mul(n, n1).Quo(res, big.NewRat(2, 1))
+	case 2:
+		twoN1 := new(big.Rat).Add(new(big.Rat).Mul(n, big.NewRat(2, 1)), one)
+		res.Mul(n, n1).Mul(res, twoN1).Quo(res, big.NewRat(6, 1))
+	case 3:
+		res.Mul(n, n1).Quo(res, big.NewRat(2, 1))
+		res.Mul(res, res)
+	}
+	return res
+}
+
+// faulhaberConditional returns the AST for the sum of k^degree for k from 1 to n, for degree up to maxDegree
+func faulhaberConditional(degree int, n *Conditional) *Conditional {
+	n1 := binary(n, PLUS, numberConditional(1))
+	switch degree {
+	case 0:
+		return n
+	case 1:
+		return binary(binary(n, MULTIPLY, n1), DIVIDE, numberConditional(2))
+	case 2:
+		twoN1 := binary(binary(numberConditional(2), MULTIPLY, n), PLUS, numberConditional(1))
+		return binary(binary(binary(n, MULTIPLY, n1), MULTIPLY, twoN1), DIVIDE, numberConditional(6))
+	}
+	return binary(binary(binary(n, MULTIPLY, n1), DIVIDE, numberConditional(2)), POW, numberConditional(2))
+}
+
+// closedSum returns the closed form of sum(k, lo, hi, body) if the body is a polynomial in k, otherwise nil.
+// Like the evaluator, the closed form is 0 when hi < lo
+func closedSum(args []*Conditional) *Conditional {
+	k := args[0].soleTerm()
+	if k == nil || k.ident == nil || args[1].mentions(k.ident.name) || args[2].mentions(k.ident.name) {
+		return nil
+	}
+	poly, ok := polynomial(args[3], k.ident.name)
+	if !ok {
+		return nil
+	}
+
+	lo, hi := args[1], args[2]
+	from, fromOK := integerOf(lo)
+	to, toOK := integerOf(hi)
+	var res *Conditional
+	for _, mono := range poly {
+		// Sum from lo to hi as the sum to hi less the sum to lo - 1, folding whichever parts are numbers
+		var sum *Conditional
+		switch {
+		case fromOK && toOK:
+			r := faulhaber(mono.degree, new(big.Rat).SetInt(to))
+			sum = intConditional(r.Sub(r, faulhaber(mono.degree, new(big.Rat).SetInt(from).Sub(new(big.Rat).SetInt(from), big.NewRat(1, 1)))).Num())
+		case fromOK:
+			sum = faulhaberConditional(mono.degree, hi)
+			below := faulhaber(mono.degree, new(big.Rat).Sub(new(big.Rat).SetInt(from), big.NewRat(1, 1))).Num()
+			if below.Sign() < 0 {
+				sum = binary(sum, PLUS, intConditional(new(big.Int).Neg(below)))
+			} else if below.Sign() > 0 {
+				sum = binary(sum, MINUS, intConditional(below))
+			}
+		default:
+			below := binary(lo, MINUS, numberConditional(1))
+			sum = binary(faulhaberConditional(mono.degree, hi), MINUS, faulhaberConditional(mono.degree, below))
+		}
+		if mono.coeff != nil {
+			if coeff := conditionalOf(&Expression{factor: mono.coeff}); !isNumber(coeff, 1) {
+				sum = binary(coeff, MULTIPLY, sum)
+			}
+		}
+		switch {
+		case res == nil && mono.negative:
+			res = conditionalOf(&Expression{factor: &Factor{power: &Power{unary: []*UnaryOp{{op: MINUS}}, term: termOfConditional(sum)}}})
+		case res == nil:
+			res = sum
+		case mono.negative:
+			res = binary(res, MINUS, sum)
+		default:
+			res = binary(res, PLUS, sum)
+		}
+	}
+
+	// The bounds can only be compared when they are both numbers
+	if fromOK && toOK && to.Cmp(from) >= 0 {
+		return res
+	}
+	cmp := &Comparison{expression: expressionOfConditional(hi), op: &CompareOp{op: LT}, right: expressionOfConditional(lo)}
+	return &Conditional{disjunction: &Disjunction{conjunction: &Conjunction{comparison: cmp}}, then: numberConditional(0), els: res}
+}
+
+// integerOf returns the value of a Conditional which is an integer written as a number, optionally negated
+func integerOf(cond *Conditional) (*big.Int, bool) {
+	exp := cond.soleExpression()
+	if exp == nil || exp.op != nil || exp.factor.op != nil {
+		return nil, false
+	}
+	pow := exp.factor.power
+	term := pow.term
+	if pow.op != nil || term.number == nil || term.unit != nil || term.currency != "" || !term.number.val.IsInt() || len(term.index) != 0 || len(term.postfix) != 0 {
+		return nil, false
+	}
+	n := new(big.Int).Set(term.number.val.Num())
+	for _, unary := range pow.unary {
+		if unary.op == MINUS {
+			n.Neg(n)
+		}
+	}
+	return n, true
+}
+
+// isNumber returns whether the Conditional is the given integer written as a number
+func isNumber(cond *Conditional, n int64) bool {
+	term := cond.soleTerm()
+	return term != nil && term.number != nil && term.number.val.Cmp(big.NewRat(n, 1)) == 0
+}
+
+// numberConditional returns the AST for the given integer
+func numberConditional(n int64) *Conditional {
+	return intConditional(big.NewInt(n))
+}
+
+// intConditional returns the AST for the given integer, negated with a unary minus if it is negative
+func intConditional(n *big.Int) *Conditional {
+	abs := new(big.Int).Abs(n)
+	pow := &Power{term: &Term{number: &Number{str: abs.String(), val: new(big.Rat).SetInt(abs)}}}
+	if n.Sign() < 0 {
+		pow.unary = []*UnaryOp{{op: MINUS}}
+	}
+	return conditionalOf(&Expression{factor: &Factor{power: pow}})
+}
+
+// expressionOfConditional returns the Conditional as an Expression, parenthesising it unless it already is a
+// sole Expression
+func expressionOfConditional(cond *Conditional) *Expression {
+	if exp := cond.soleExpression(); exp != nil {
+		return exp
+	}
+	return &Expression{factor: &Factor{power: &Power{term: &Term{exp: cond}}}}
+}
+
+// termOfConditional returns the Conditional as a Term, parenthesising it unless it already is a sole Term
+func termOfConditional(cond *Conditional) *Term {
+	if term := cond.soleTerm(); term != nil {
+		return term
+	}
+	return &Term{exp: cond}
+}
+
+// powerOfConditional returns the Conditional as a Power, parenthesising it unless it already is a sole Power
+func powerOfConditional(cond *Conditional) *Power {
+	if exp := cond.soleExpression(); exp != nil && exp.op == nil && exp.factor.op == nil {
+		return exp.factor.power
+	}
+	return &Power{term: &Term{exp: cond}}
+}
+
+// binary returns the AST for "a op b", parenthesising the operands only where needed. Chains of operators
+// with the same precedence are extended rather than nested, as they fold from the left
+func binary(a *Conditional, op Token, b *Conditional) *Conditional {
+	return binaryAt(a, op, 0, b)
+}
+
+// binaryAt is binary with the operator at the given offset in the source
+func binaryAt(a *Conditional, op Token, pos int, b *Conditional) *Conditional {
+	switch op {
+	case PLUS, MINUS:
+		right := &Expression{factor: factorOfConditional(b)}
+		if exp := a.soleExpression(); exp != nil {
+			return conditionalOf(appendExpression(exp, &AddOp{op: op, pos: pos}, right))
+		}
+		return conditionalOf(&Expression{factor: &Factor{power: powerOfConditional(a)}, op: &AddOp{op: op, pos: pos}, expression: right})
+	case MULTIPLY, DIVIDE, INT_DIVIDE, MODULO, IMPLICIT_MULTIPLY:
+		right := &Factor{power: powerOfConditional(b)}
+		if op == MODULO {
+			// A '%' followed by a sign can read as a percentage, see Parser.isPostfixOp
+			right.power = &Power{term: termOfConditional(b)}
+		}
+		if exp := a.soleExpression(); exp != nil && exp.op == nil {
+			return conditionalOf(&Expression{factor: appendFactor(exp.factor, &MultiplyOp{op: op, pos: pos}, right)})
+		}
+		return conditionalOf(&Expression{factor: &Factor{power: powerOfConditional(a), op: &MultiplyOp{op: op, pos: pos}, factor: right}})
+	case EQ, NEQ, LT, LTE, GT, GTE:
+		cmp := &Comparison{expression: expressionOfConditional(a), op: &CompareOp{op: op, pos: pos}, right: expressionOfConditional(b)}
+		return conditionalOfConjunction(&Conjunction{comparison: cmp})
+	case AND:
+		right := &Conjunction{comparison: comparisonOfConditional(b)}
+		if con := a.soleConjunction(); con != nil {
+			return conditionalOfConjunction(appendConjunction(con, &AndOp{op: op, pos: pos}, right))
+		}
+		return conditionalOfConjunction(&Conjunction{comparison: comparisonOfConditional(a), op: &AndOp{op: op, pos: pos}, conjunction: right})
+	case OR:
+		right := &Disjunction{conjunction: conjunctionOfConditional(b)}
+		if a.then == nil && a.to == nil && a.currency == "" {
+			return &Conditional{disjunction: appendDisjunction(a.disjunction, &OrOp{op: op, pos: pos}, right)}
+		}
+		return &Conditional{disjunction: &Disjunction{conjunction: conjunctionOfConditional(a), op: &OrOp{op: op, pos: pos}, disjunction: right}}
+	}
+	pow := &Power{term: termOfConditional(a), op: &ExponentOp{op: op, pos: pos}, power: powerOfConditional(b)}
+	return conditionalOf(&Expression{factor: &Factor{power: pow}})
+}
+
+// unaryAt returns the AST for the prefix operator at the given offset applied to cond. A NOT applies to a whole
+// comparison and a sign to a whole power, so the operand is only parenthesised if it is looser than those
+func unaryAt(op Token, pos int, cond *Conditional) *Conditional {
+	if op == NOT {
+		cmp := *comparisonOfConditional(cond)
+		cmp.not = append([]*NotOp{{op: op, pos: pos}}, cmp.not...)
+		return conditionalOfConjunction(&Conjunction{comparison: &cmp})
+	}
+	pow := *powerOfConditional(cond)
+	pow.unary = append([]*UnaryOp{{op: op, pos: pos}}, pow.unary...)
+	return conditionalOf(&Expression{factor: &Factor{power: &pow}})
+}
+
+// soleConjunction returns the Conjunction if the Conditional consists of a single Conjunction with no OR or
+// ternary operators or conversion, otherwise nil
+func (cond *Conditional) soleConjunction() *Conjunction {
+	if cond.then != nil || cond.to != nil || cond.currency != "" || cond.disjunction.op != nil {
+		return nil
+	}
+	return cond.disjunction.conjunction
+}
+
+// conditionalOfConjunction returns a Conditional holding only the given Conjunction
+func conditionalOfConjunction(con *Conjunction) *Conditional {
+	return &Conditional{disjunction: &Disjunction{conjunction: con}}
+}
+
+// conjunctionOfConditional returns the Conditional as a Conjunction, parenthesising it unless it already is a
+// sole Conjunction
+func conjunctionOfConditional(cond *Conditional) *Conjunction {
+	if con := cond.soleConjunction(); con != nil {
+		return con
+	}
+	return &Conjunction{comparison: comparisonOfConditional(cond)}
+}
+
+// comparisonOfConditional returns the Conditional as a Comparison, parenthesising it unless it already is a
+// sole Comparison
+func comparisonOfConditional(cond *Conditional) *Comparison {
+	if con := cond.soleConjunction(); con != nil && con.op == nil {
+		return con.comparison
+	}
+	return &Comparison{expression: &Expression{factor: &Factor{power: &Power{term: &Term{exp: cond}}}}}
+}
+
+// factorOfConditional returns the Conditional as a Factor, parenthesising it unless it already is a sole Factor
+func factorOfConditional(cond *Conditional) *Factor {
+	if exp := cond.soleExpression(); exp != nil && exp.op == nil {
+		return exp.factor
+	}
+	return &Factor{power: &Power{term: &Term{exp: cond}}}
+}
+
+// appendExpression returns a copy of the chain of Expressions with "op right" appended
+func appendExpression(exp *Expression, op *AddOp, right *Expression) *Expression {
+	res := &Expression{factor: exp.factor, op: op, expression: right}
+	if exp.op != nil {
+		res.op, res.expression = exp.op, appendExpression(exp.expression, op, right)
+	}
+	return res
+}
+
+// appendDisjunction returns a copy of the chain of Disjunctions with "op right" appended
+func appendDisjunction(dis *Disjunction, op *OrOp, right *Disjunction) *Disjunction {
+	res := &Disjunction{conjunction: dis.conjunction, op: op, disjunction: right}
+	if dis.op != nil {
+		res.op, res.disjunction = dis.op, appendDisjunction(dis.disjunction, op, right)
+	}
+	return res
+}
+
+// appendConjunction returns a copy of the chain of Conjunctions with "op right" appended
+func appendConjunction(con *Conjunction, op *AndOp, right *Conjunction) *Conjunction {
+	res := &Conjunction{comparison: con.comparison, op: op, conjunction: right}
+	if con.op != nil {
+		res.op, res.conjunction = con.op, appendConjunction(con.conjunction, op, right)
+	}
+	return res
+}
+
+// appendFactor returns a copy of the chain of Factors with "op right" appended
+func appendFactor(fac *Factor, op *MultiplyOp, right *Factor) *Factor {
+	res := &Factor{power: fac.power, op: op, factor: right}
+	if fac.op != nil {
+		res.op, res.factor = fac.op, appendFactor(fac.factor, op, right)
+	}
+	return res
+}
@@ -0,0 +1,62 @@
+package mathval
+
+import (
+	"math/big"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type SimplifySuite struct{}
+
+var _ = Suite(&SimplifySuite{})
+
+func (s *SimplifySuite) TestSimplify(c *C) {
+	expected := map[string]string{
+		"sum(k, 1, n, k)":          "n < 1 ? 0 : n * (n + 1) / 2",
+		"sum(k, 1, n, k^2)":        "n < 1 ? 0 : n * (n + 1) * (2 * n + 1) / 6",
+		"sum(k, 1, n, k^3 - k)":    "n < 1 ? 0 : (n * (n + 1) / 2)^2 - n * (n + 1) / 2",
+		"sum(k, 0, n, k)":          "n < 0 ? 0 : n * (n + 1) / 2",
+		"sum(i, 2, n, 2 * i)":      "n < 2 ? 0 : 2 * (n * (n + 1) / 2 - 1)",
+		"sum(k, a, b, 3)":          "b < a ? 0 : 3 * (b - (a - 1))",
+		"sum(k, 0, 10, 2 * k + 1)": "2 * 55 + 11",
+		"sum(k, 1, 5, x * k)":      "x * 15",
+		"1 + sum(j, 1, n, j)":      "1 + (n < 1 ? 0 : n * (n + 1) / 2)",
+		"sum(k, 1, n, 2^k)":        "sum(k, 1, n, 2^k)",
+		"sum(k, 1, n, 1 / k)":      "sum(k, 1, n, 1 / k)",
+		"sum(k, 1, n, k + 10%)":    "sum(k, 1, n, k + 10%)",
+		"sum(k, 1, n, 10% + k)":    "n < 1 ? 0 : 10% * n + n * (n + 1) / 2",
+		"prod(k, 1, n, k)":         "prod(k, 1, n, k)",
+		"sum(k, 1, k, k)":          "sum(k, 1, k, k)",
+	}
+	for input, output := range expected {
+		cond, err := NewParser(strings.NewReader(input)).Parse()
+		c.Assert(err, IsNil, Commentf(input))
+		c.Assert(Simplify(cond).String(), Equals, output, Commentf(input))
+		c.Assert(cond.String(), Equals, input, Commentf("%s was modified", input))
+	}
+}
+
+func (s *SimplifySuite) TestSimplifyEval(c *C) {
+	// Adding 0 * 2^k stops the body being a polynomial, so the evaluator has to iterate
+	bodies := []string{"k^2", "3 * k^3 - k / 2 + 7", "-k^2", "x * k", "k + 10%", "50% - k^2 - 10%", "20% * k"}
+	for _, body := range bodies {
+		input := "sum(k, m, n, " + body + ")"
+		cond, err := NewParser(strings.NewReader(input)).Parse()
+		c.Assert(err, IsNil, Commentf(input))
+		simple := Simplify(cond)
+
+		for _, bounds := range [][2]int64{{1, 0}, {1, 1}, {-1, 7}, {3, 20}} {
+			ev := NewEvaluator()
+			c.Assert(ev.Set("m", NewNumberValue(big.NewRat(bounds[0], 1))), IsNil)
+			c.Assert(ev.Set("n", NewNumberValue(big.NewRat(bounds[1], 1))), IsNil)
+			c.Assert(ev.Set("x", NewNumberValue(big.NewRat(5, 3))), IsNil)
+
+			want, err := evaluate(ev, "sum(k, m, n, "+body+" + 0 * 2^k)")
+			c.Assert(err, IsNil, Commentf(input))
+			got, err := ev.Eval(simple)
+			c.Assert(err, IsNil, Commentf(input))
+			c.Assert(got.String(), Equals, want.String(), Commentf("%s with m = %d, n = %d", input, bounds[0], bounds[1]))
+		}
+	}
+}
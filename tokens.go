@@ -1,5 +1,10 @@
 package mathval
 
+import (
+	"strconv"
+)
+
+// Token is a lexical token produced by the Scanner
 type Token int
 
 const (
@@ -11,7 +16,8 @@ const (
 	// Special tokens
 	special_tokens_begin
 	EOF
-	WS // Whitespace
+	WS      // Whitespace
+	COMMENT // # or // to the end of the line, or /* to */
 	special_tokens_end
 
 	// Arithmetic operators
@@ -23,27 +29,122 @@ const (
 	additive_end
 
 	multiplicative_begin
-	MULTIPLY   // *
-	DIVIDE     // /
-	INT_DIVIDE // \
-	MODULO     // %
+	MULTIPLY          // *
+	DIVIDE            // /
+	INT_DIVIDE        // \
+	MODULO            // %
+	IMPLICIT_MULTIPLY // juxtaposition, as in "2x". Only produced by the Parser, see ImplicitMultiplication
 	multiplicative_end
 
 	exponentiation_begin
 	POW // ^
 	exponentiation_end
 
+	SUPERSCRIPT // superscript digits, optionally negated, as in "x²" or "x⁻¹". The literal is the ASCII form
+	SQRT        // √, a prefix square root
+	CONCAT      // &, which joins text. Only in Excel mode
+
+	postfix_begin
+	FACTORIAL // !
+	PERCENT   // % when not followed by an operand. The Scanner always emits MODULO, see Parser.parsePostfixOp
+	postfix_end
+
+	comparison_begin
+	EQ  // ==
+	NEQ // !=
+	LT  // <
+	LTE // <=
+	GT  // >
+	GTE // >=
+	comparison_end
+
+	logical_begin
+	AND // and
+	OR  // or
+	NOT // not
+	logical_end
+
 	operators_end
 
 	// Known types/keywords
 	keywords_begin
-	DIGITS // Contiguous block of digits
+	DIGITS   // Contiguous block of digits
+	DATE     // ISO 8601 date or date and time, as in "2024-03-15" or "2024-03-15T10:30Z". Only in Dates mode
+	DURATION // duration, as in "3d", "2h30m" or the ISO 8601 "PT2H30M". Only in Dates mode
+	RANGE    // rectangle of cells, as in "A1:B10". Only in Cells mode
+	STRING   // text in double quotes, as in "abc", with a '"' in it doubled. Only in Excel mode
 	keywords_end
 
 	// Misc characters
 	misc_begin
-	LPAREN // (
-	RPAREN // )
-	DOT    // .
+	LPAREN    // (
+	RPAREN    // )
+	LBRACKET  // [
+	RBRACKET  // ]
+	DOT       // .
+	COMMA     // ,
+	QUESTION  // ?
+	COLON     // :
+	ASSIGN    // =
+	SEMICOLON // ;
+	ARROW     // ->
 	misc_end
 )
+
+// tokens holds the source representation of operator and misc tokens, and the name of every other token
+var tokens = map[Token]string{
+	ILLEGAL:         "ILLEGAL",
+	UNKNOWN_KEYWORD: "IDENTIFIER",
+	EOF:             "EOF",
+	WS:              "WS",
+	COMMENT:         "COMMENT",
+
+	PLUS:              "+",
+	MINUS:             "-",
+	MULTIPLY:          "*",
+	DIVIDE:            "/",
+	INT_DIVIDE:        "\\",
+	MODULO:            "%",
+	IMPLICIT_MULTIPLY: " ",
+	POW:               "^",
+	SUPERSCRIPT:       "SUPERSCRIPT",
+	SQRT:              "√",
+	CONCAT:            "&",
+	FACTORIAL:         "!",
+	PERCENT:           "%",
+	EQ:                "==",
+	NEQ:               "!=",
+	LT:                "<",
+	LTE:               "<=",
+	GT:                ">",
+	GTE:               ">=",
+	AND:               "and",
+	OR:                "or",
+	NOT:               "not",
+
+	DIGITS:   "DIGITS",
+	DATE:     "DATE",
+	DURATION: "DURATION",
+	RANGE:    "RANGE",
+	STRING:   "STRING",
+
+	LPAREN:    "(",
+	RPAREN:    ")",
+	LBRACKET:  "[",
+	RBRACKET:  "]",
+	DOT:       ".",
+	COMMA:     ",",
+	QUESTION:  "?",
+	COLON:     ":",
+	ASSIGN:    "=",
+	SEMICOLON: ";",
+	ARROW:     "->",
+}
+
+// String returns the source representation of operator and misc tokens, and the name of any other token
+func (tok Token) String() string {
+	if s, ok := tokens[tok]; ok {
+		return s
+	}
+	return "token(" + strconv.Itoa(int(tok)) + ")"
+}
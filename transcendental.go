@@ -0,0 +1,479 @@
+package mathval
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// realFunc is a function of real arguments computed at arbitrary precision
+type realFunc struct {
+	arity int
+
+	// exact returns the exact result for special arguments, such as sin(0), or nil if there isn't one
+	exact func(args []*big.Rat) *big.Rat
+
+	// eval computes the result to at least wp bits
+	eval func(args []*big.Float, wp uint) (*big.Float, error)
+}
+
+// maxZivAttempts is the number of times a realFunc is recomputed at increasing precision while looking for
+// two results which round to the same value
+const maxZivAttempts = 8
+
+// realFuncs holds the built-in functions of real arguments, keyed by name
+var realFuncs = map[string]realFunc{
+	"sqrt":  {arity: 1, exact: exactSqrt, eval: unary(sqrtFloat)},
+	"exp":   {arity: 1, exact: exactAt(0, 1), eval: unary(expFloat)},
+	"ln":    {arity: 1, exact: exactAt(1, 0), eval: unary(lnFloat)},
+	"log10": {arity: 1, exact: exactAt(1, 0), eval: unary(log10Float)},
+	"log":   {arity: 2, exact: exactLog, eval: logFloat},
+	"sin":   {arity: 1, exact: exactAt(0, 0), eval: unary(sinFloat)},
+	"cos":   {arity: 1, exact: exactAt(0, 1), eval: unary(cosFloat)},
+	"tan":   {arity: 1, exact: exactAt(0, 0), eval: unary(tanFloat)},
+	"asin":  {arity: 1, exact: exactAt(0, 0), eval: unary(asinFloat)},
+	"acos":  {arity: 1, exact: exactAt(1, 0), eval: unary(acosFloat)},
+	"atan":  {arity: 1, exact: exactAt(0, 0), eval: unary(atanFloat)},
+	"atan2": {arity: 2, exact: exactAtan2, eval: atan2Float},
+	"sinh":  {arity: 1, exact: exactAt(0, 0), eval: unary(sinhFloat)},
+	"cosh":  {arity: 1, exact: exactAt(0, 1), eval: unary(coshFloat)},
+	"tanh":  {arity: 1, exact: exactAt(0, 0), eval: unary(tanhFloat)},
+}
+
+// evalRealFunc evaluates the arguments and applies the named realFunc to them. The result is computed to the
+// evaluator's Precision, or the lowest precision of any inexact argument, and is correctly rounded
+func (ev *Evaluator) evalRealFunc(name string, fn realFunc, args []*Conditional) (Value, error) {
+	if len(args) != fn.arity {
+		return nil, fmt.Errorf("%s expects %d arguments, got %d", name, fn.arity, len(args))
+	}
+
+	vals := make([]Value, len(args))
+	rats := make([]*big.Rat, len(args))
+	for i, arg := range args {
+		var err error
+		if vals[i], err = ev.evalConditional(arg); err != nil {
+			return nil, err
+		}
+		if rats[i], err = toRat(vals[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	inexact := precOf(vals...)
+	if inexact == 0 {
+		if r := fn.exact(rats); r != nil {
+			return numberOf(r, 0), nil
+		}
+	}
+
+	prec := ev.Precision
+	if inexact != 0 && inexact < prec {
+		prec = inexact
+	}
+
+	// Ziv's strategy: recompute with more guard bits until two results round to the same value
+	var res *big.Float
+	for i, wp := 0, prec+guardBits; i < maxZivAttempts; i, wp = i+1, wp+guardBits<<uint(i) {
+		floats := make([]*big.Float, len(rats))
+		for j, r := range rats {
+			floats[j] = newFloat(wp).SetRat(r)
+		}
+		f, err := fn.eval(floats, wp)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		rounded := newFloat(prec).Set(f)
+		if res != nil && res.Cmp(rounded) == 0 {
+			break
+		}
+		res = rounded
+	}
+
+	r, _ := res.Rat(nil)
+	return &NumberValue{val: r, prec: prec}, nil
+}
+
+// unary adapts a function of one argument to realFunc.eval
+func unary(f func(x *big.Float, wp uint) (*big.Float, error)) func([]*big.Float, uint) (*big.Float, error) {
+	return func(args []*big.Float, wp uint) (*big.Float, error) {
+		return f(args[0], wp)
+	}
+}
+
+// exactAt returns a realFunc.exact for a function of one argument which is exactly y at x
+func exactAt(x, y int64) func([]*big.Rat) *big.Rat {
+	return func(args []*big.Rat) *big.Rat {
+		if args[0].Cmp(big.NewRat(x, 1)) == 0 {
+			return big.NewRat(y, 1)
+		}
+		return nil
+	}
+}
+
+// exactSqrt returns the square root of perfect squares, such as 4/9
+func exactSqrt(args []*big.Rat) *big.Rat {
+	x := args[0]
+	if x.Sign() < 0 {
+		return nil
+	}
+	num, den := new(big.Int).Sqrt(x.Num()), new(big.Int).Sqrt(x.Denom())
+	root := new(big.Rat).SetFrac(num, den)
+	if new(big.Rat).Mul(root, root).Cmp(x) == 0 {
+		return root
+	}
+	return nil
+}
+
+// exactLog returns log(b, 1) = 0
+func exactLog(args []*big.Rat) *big.Rat {
+	return exactAt(1, 0)(args[1:])
+}
+
+// exactAtan2 returns atan2(0, x) = 0 for positive x
+func exactAtan2(args []*big.Rat) *big.Rat {
+	if args[0].Sign() == 0 && args[1].Sign() > 0 {
+		return new(big.Rat)
+	}
+	return nil
+}
+
+// sqrtFloat computes the square root of x
+func sqrtFloat(x *big.Float, wp uint) (*big.Float, error) {
+	if x.Sign() < 0 {
+		return nil, errors.New("Argument must not be negative")
+	}
+	return newFloat(wp).Sqrt(x), nil
+}
+
+// expFloat computes e^x. The argument is reduced to x = k*ln2 + r so that e^x = 2^k * e^r, and r is halved
+// a few times so the Taylor series for e^r converges quickly. A negative argument is the reciprocal of e^-x
+func expFloat(x *big.Float, wp uint) (*big.Float, error) {
+	if x.Sign() == 0 {
+		return newFloat(wp).SetInt64(1), nil
+	}
+	if x.Sign() < 0 {
+		res, err := expFloat(newFloat(wp+2).Neg(x), wp+2)
+		if err != nil {
+			return nil, err
+		}
+		return newFloat(wp).Quo(newFloat(wp).SetInt64(1), res), nil
+	}
+	if x.MantExp(nil) > 30 {
+		return nil, errors.New("Argument too large")
+	}
+
+	const halvings = 8
+	ip := wp + 64 + halvings
+	ln2 := computeLn2(ip)
+	k, _ := newFloat(ip).Quo(x, ln2).Int64()
+	r := newFloat(ip).Mul(ln2, newFloat(ip).SetInt64(k))
+	r.Sub(x, r)
+	r.SetMantExp(r, -halvings)
+
+	sum := newFloat(ip).SetInt64(1)
+	term := newFloat(ip).SetInt64(1)
+	for n := int64(1); ; n++ {
+		term.Mul(term, r)
+		term.Quo(term, newFloat(ip).SetInt64(n))
+		if negligible(term, sum, ip) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	for i := 0; i < halvings; i++ {
+		sum.Mul(sum, sum)
+	}
+	return newFloat(wp).SetMantExp(sum, int(k)), nil
+}
+
+// lnFloat computes the natural logarithm of x. With x = m * 2^e and m near 1, ln(x) = e*ln2 + ln(m), and
+// ln(m) = 2*atanh((m-1)/(m+1)) converges quickly
+func lnFloat(x *big.Float, wp uint) (*big.Float, error) {
+	if x.Sign() <= 0 {
+		return nil, errors.New("Argument must be positive")
+	}
+
+	ip := wp + 64
+	m := newFloat(ip)
+	e := x.MantExp(m)
+	// Move m from [0.5, 1) to [0.707, 1.414)
+	if m.Cmp(big.NewFloat(0.7071067811865476)) < 0 {
+		m.SetMantExp(m, 1)
+		e--
+	}
+
+	one := newFloat(ip).SetInt64(1)
+	z := newFloat(ip).Sub(m, one)
+	z.Quo(z, newFloat(ip).Add(m, one))
+	z2 := newFloat(ip).Mul(z, z)
+	sum := newFloat(ip).Set(z)
+	power := newFloat(ip).Set(z)
+	term := newFloat(ip)
+	for n := int64(3); ; n += 2 {
+		power.Mul(power, z2)
+		term.Quo(power, newFloat(ip).SetInt64(n))
+		if negligible(term, sum, ip) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	sum.SetMantExp(sum, 1)
+
+	if e != 0 {
+		ln2 := computeLn2(ip)
+		sum.Add(sum, ln2.Mul(ln2, newFloat(ip).SetInt64(int64(e))))
+	}
+	return newFloat(wp).Set(sum), nil
+}
+
+// log10Float computes the base 10 logarithm of x
+func log10Float(x *big.Float, wp uint) (*big.Float, error) {
+	return logFloat([]*big.Float{newFloat(wp).SetInt64(10), x}, wp)
+}
+
+// logFloat computes the logarithm of args[1] to the base args[0]
+func logFloat(args []*big.Float, wp uint) (*big.Float, error) {
+	b, x := args[0], args[1]
+	if b.Sign() <= 0 || b.Cmp(big.NewFloat(1)) == 0 {
+		return nil, errors.New("Base must be positive and not 1")
+	}
+	lnx, err := lnFloat(x, wp+8)
+	if err != nil {
+		return nil, err
+	}
+	lnb, err := lnFloat(b, wp+8)
+	if err != nil {
+		return nil, err
+	}
+	return newFloat(wp).Quo(lnx, lnb), nil
+}
+
+// sinCos computes the sine and cosine of x. The argument is reduced to x = k*pi/2 + r with |r| <= pi/4,
+// then the Taylor series for sin(r) and cos(r) are combined according to the quadrant k
+func sinCos(x *big.Float, wp uint) (sin, cos *big.Float) {
+	ip := wp + 64
+	if exp := x.MantExp(nil); exp > 0 {
+		ip += uint(exp)
+	}
+
+	halfPi := computePi(ip)
+	halfPi.SetMantExp(halfPi, -1)
+	q := newFloat(ip).Quo(x, halfPi)
+	if q.Sign() < 0 {
+		q.Sub(q, big.NewFloat(0.5))
+	} else {
+		q.Add(q, big.NewFloat(0.5))
+	}
+	k, _ := q.Int(nil)
+	r := newFloat(ip).Mul(halfPi, newFloat(ip).SetInt(k))
+	r.Sub(x, r)
+
+	r2 := newFloat(ip).Mul(r, r)
+	sin, cos = newFloat(ip).Set(r), newFloat(ip).SetInt64(1)
+	sinTerm, cosTerm := newFloat(ip).Set(r), newFloat(ip).SetInt64(1)
+	for n := int64(1); !negligible(sinTerm, sin, ip) || !negligible(cosTerm, cos, ip); n++ {
+		sinTerm.Mul(sinTerm, r2)
+		sinTerm.Quo(sinTerm, newFloat(ip).SetInt64(-(2*n)*(2*n+1)))
+		cosTerm.Mul(cosTerm, r2)
+		cosTerm.Quo(cosTerm, newFloat(ip).SetInt64(-(2*n-1)*(2*n)))
+		sin.Add(sin, sinTerm)
+		cos.Add(cos, cosTerm)
+	}
+
+	switch new(big.Int).Mod(k, big.NewInt(4)).Int64() {
+	case 1:
+		sin, cos = cos, sin.Neg(sin)
+	case 2:
+		sin, cos = sin.Neg(sin), cos.Neg(cos)
+	case 3:
+		sin, cos = cos.Neg(cos), sin
+	}
+	return sin, cos
+}
+
+// sinFloat computes the sine of x
+func sinFloat(x *big.Float, wp uint) (*big.Float, error) {
+	sin, _ := sinCos(x, wp)
+	return newFloat(wp).Set(sin), nil
+}
+
+// cosFloat computes the cosine of x
+func cosFloat(x *big.Float, wp uint) (*big.Float, error) {
+	_, cos := sinCos(x, wp)
+	return newFloat(wp).Set(cos), nil
+}
+
+// tanFloat computes the tangent of x
+func tanFloat(x *big.Float, wp uint) (*big.Float, error) {
+	sin, cos := sinCos(x, wp)
+	if cos.Sign() == 0 {
+		return nil, errors.New("Undefined")
+	}
+	return newFloat(wp).Quo(sin, cos), nil
+}
+
+// atanFloat computes the arctangent of x. Arguments above 1 use atan(x) = pi/2 - atan(1/x), then the
+// argument is halved with atan(x) = 2*atan(x / (1 + sqrt(1 + x^2))) until the Taylor series converges quickly
+func atanFloat(x *big.Float, wp uint) (*big.Float, error) {
+	if x.Sign() == 0 {
+		return newFloat(wp), nil
+	}
+
+	ip := wp + 64
+	a := newFloat(ip).Abs(x)
+	one := newFloat(ip).SetInt64(1)
+	invert := a.Cmp(one) > 0
+	if invert {
+		a.Quo(one, a)
+	}
+
+	halvings := 0
+	for ; a.MantExp(nil) > -8; halvings++ {
+		root := newFloat(ip).Mul(a, a)
+		root.Sqrt(root.Add(root, one))
+		a.Quo(a, root.Add(root, one))
+	}
+
+	a2 := newFloat(ip).Mul(a, a)
+	a2.Neg(a2)
+	sum := newFloat(ip).Set(a)
+	power := newFloat(ip).Set(a)
+	term := newFloat(ip)
+	for n := int64(3); ; n += 2 {
+		power.Mul(power, a2)
+		term.Quo(power, newFloat(ip).SetInt64(n))
+		if negligible(term, sum, ip) {
+			break
+		}
+		sum.Add(sum, term)
+	}
+	sum.SetMantExp(sum, halvings)
+
+	if invert {
+		halfPi := computePi(ip)
+		sum.Sub(halfPi.SetMantExp(halfPi, -1), sum)
+	}
+	if x.Sign() < 0 {
+		sum.Neg(sum)
+	}
+	return newFloat(wp).Set(sum), nil
+}
+
+// asinFloat computes the arcsine of x as atan(x / sqrt(1 - x^2))
+func asinFloat(x *big.Float, wp uint) (*big.Float, error) {
+	ip := wp + 64
+	one := newFloat(ip).SetInt64(1)
+	abs := newFloat(ip).Abs(x)
+	switch abs.Cmp(one) {
+	case 1:
+		return nil, errors.New("Argument must be between -1 and 1")
+	case 0:
+		halfPi := computePi(wp)
+		halfPi.SetMantExp(halfPi, -1)
+		if x.Sign() < 0 {
+			halfPi.Neg(halfPi)
+		}
+		return halfPi, nil
+	}
+
+	root := newFloat(ip).Mul(x, x)
+	root.Sqrt(root.Sub(one, root))
+	return atanFloat(newFloat(ip).Quo(x, root), wp)
+}
+
+// acosFloat computes the arccosine of x as pi/2 - asin(x)
+func acosFloat(x *big.Float, wp uint) (*big.Float, error) {
+	ip := wp + 64
+	asin, err := asinFloat(x, ip)
+	if err != nil {
+		return nil, err
+	}
+	halfPi := computePi(ip)
+	halfPi.SetMantExp(halfPi, -1)
+	return newFloat(wp).Sub(halfPi, asin), nil
+}
+
+// atan2Float computes the angle of the point (args[1], args[0]) from the positive x axis
+func atan2Float(args []*big.Float, wp uint) (*big.Float, error) {
+	y, x := args[0], args[1]
+	ip := wp + 64
+	if x.Sign() == 0 {
+		halfPi := computePi(wp)
+		halfPi.SetMantExp(halfPi, -1)
+		switch y.Sign() {
+		case 1:
+			return halfPi, nil
+		case -1:
+			return halfPi.Neg(halfPi), nil
+		}
+		return newFloat(wp), nil
+	}
+
+	atan, err := atanFloat(newFloat(ip).Quo(y, x), ip)
+	if err != nil || x.Sign() > 0 {
+		return atan, err
+	}
+	pi := computePi(ip)
+	if y.Sign() < 0 {
+		return newFloat(wp).Sub(atan, pi), nil
+	}
+	return newFloat(wp).Add(atan, pi), nil
+}
+
+// sinhFloat computes the hyperbolic sine of x, using its Taylor series for small x where (e^x - e^-x)/2
+// would cancel
+func sinhFloat(x *big.Float, wp uint) (*big.Float, error) {
+	ip := wp + 64
+	if x.MantExp(nil) <= 0 {
+		x2 := newFloat(ip).Mul(x, x)
+		sum := newFloat(ip).Set(x)
+		term := newFloat(ip).Set(x)
+		for n := int64(1); ; n++ {
+			term.Mul(term, x2)
+			term.Quo(term, newFloat(ip).SetInt64((2*n)*(2*n+1)))
+			if negligible(term, sum, ip) {
+				return newFloat(wp).Set(sum), nil
+			}
+			sum.Add(sum, term)
+		}
+	}
+
+	ex, err := expFloat(x, ip)
+	if err != nil {
+		return nil, err
+	}
+	inv := newFloat(ip).Quo(newFloat(ip).SetInt64(1), ex)
+	res := newFloat(ip).Sub(ex, inv)
+	return newFloat(wp).SetMantExp(res, -1), nil
+}
+
+// coshFloat computes the hyperbolic cosine of x as (e^x + e^-x)/2
+func coshFloat(x *big.Float, wp uint) (*big.Float, error) {
+	ip := wp + 64
+	ex, err := expFloat(x, ip)
+	if err != nil {
+		return nil, err
+	}
+	inv := newFloat(ip).Quo(newFloat(ip).SetInt64(1), ex)
+	res := newFloat(ip).Add(ex, inv)
+	return newFloat(wp).SetMantExp(res, -1), nil
+}
+
+// tanhFloat computes the hyperbolic tangent of x. For large x the result rounds to +-1, which saves
+// computing e^x when it would overflow
+func tanhFloat(x *big.Float, wp uint) (*big.Float, error) {
+	if exp := x.MantExp(nil); exp >= 32 || (exp > 0 && 1<<uint(exp) > wp) {
+		return newFloat(wp).SetInt64(int64(x.Sign())), nil
+	}
+
+	ip := wp + 64
+	sinh, err := sinhFloat(x, ip)
+	if err != nil {
+		return nil, err
+	}
+	cosh, err := coshFloat(x, ip)
+	if err != nil {
+		return nil, err
+	}
+	return newFloat(wp).Quo(sinh, cosh), nil
+}
@@ -0,0 +1,145 @@
+package mathval
+
+import (
+	"bufio"
+	"math/big"
+	"os"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type TranscendentalSuite struct{}
+
+var _ = Suite(&TranscendentalSuite{})
+
+// reference is an expression and its value from testdata/transcendental.txt
+type reference struct {
+	input string
+	value string
+}
+
+// loadReferences reads the reference values from testdata
+func loadReferences(c *C) []reference {
+	f, err := os.Open("testdata/transcendental.txt")
+	c.Assert(err, IsNil)
+	defer f.Close()
+
+	var refs []reference
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		refs = append(refs, reference{input: line[:i], value: line[i+1:]})
+	}
+	c.Assert(scanner.Err(), IsNil)
+	return refs
+}
+
+func (t *TranscendentalSuite) TestReferenceValues(c *C) {
+	refs := loadReferences(c)
+	c.Assert(len(refs) > 0, Equals, true)
+
+	// The reference values have 100 significant digits, which is enough to check rounding up to ~300 bits
+	for _, prec := range []uint{24, 53, 113, 256} {
+		ev := NewEvaluator()
+		ev.Precision = prec
+		for _, ref := range refs {
+			val, err := evaluate(ev, ref.input)
+			c.Assert(err, IsNil, Commentf(ref.input))
+			num := val.(*NumberValue)
+			c.Assert(num.Exact(), Equals, false, Commentf(ref.input))
+
+			expected, _, err := big.ParseFloat(ref.value, 10, prec, big.ToNearestEven)
+			c.Assert(err, IsNil)
+			obtained := new(big.Float).SetPrec(prec).SetRat(num.val)
+			c.Assert(obtained.Cmp(expected), Equals, 0,
+				Commentf("%s at %d bits: %s != %s", ref.input, prec, obtained.Text('g', 40), expected.Text('g', 40)))
+		}
+	}
+}
+
+func (t *TranscendentalSuite) TestExactValues(c *C) {
+	expected := []EvalResult{
+		{input: "sin(0)", expected: "0"},
+		{input: "cos(0)", expected: "1"},
+		{input: "exp(0)", expected: "1"},
+		{input: "ln(1)", expected: "0"},
+		{input: "log(7, 1)", expected: "0"},
+		{input: "atan2(0, 3)", expected: "0"},
+		{input: "sqrt(4/9)", expected: "2/3"},
+		{input: "sqrt(144)", expected: "12"},
+	}
+
+	ev := NewEvaluator()
+	for _, res := range expected {
+		val, err := evaluate(ev, res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+		c.Assert(val.(*NumberValue).Exact(), Equals, true, Commentf(res.input))
+	}
+}
+
+func (t *TranscendentalSuite) TestInexactArguments(c *C) {
+	ev := NewEvaluator()
+	ev.Precision = 53
+
+	val, err := evaluate(ev, "sin(pi/6)")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "0.5")
+
+	val, err = evaluate(ev, "ln(e^3)")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "3")
+
+	val, err = evaluate(ev, "tanh(100000000000)")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "1")
+}
+
+func (t *TranscendentalSuite) TestTinyValues(c *C) {
+	// e^-1000000 is about 3.3e-434295, which is computed and printed without converting 2^-1442696 exactly
+	val, err := evaluate(NewEvaluator(), "exp(-1000000)")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Matches, `3\.29683\d+e-434295`)
+	val, err = evaluate(NewEvaluator(), "exp(-1000000) * exp(1000000)")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Matches, `(1|0\.9{60,}\d*|1\.0{60,}\d*)`)
+
+	// Scaling before printing gives the digits big.Float does
+	for _, exp := range []int{-4097, -5000, -12345} {
+		for _, r := range []*big.Rat{big.NewRat(1, 3), big.NewRat(-7, 5), big.NewRat(1, 1), big.NewRat(99999, 100000)} {
+			f := new(big.Float).SetPrec(256).SetRat(r)
+			f.SetMantExp(f, exp)
+			for _, digits := range []int{1, 15, 77} {
+				c.Assert(formatFloat(f, digits), Equals, f.Text('g', digits), Commentf("%s * 2^%d to %d digits", r, exp, digits))
+			}
+		}
+	}
+}
+
+func (t *TranscendentalSuite) TestDomainErrors(c *C) {
+	inputs := []string{
+		"ln(0)",
+		"ln(-1)",
+		"log10(0)",
+		"log(1, 5)",
+		"log(-2, 5)",
+		"asin(2)",
+		"acos(-1.5)",
+		"sqrt(-1)",
+		"exp(10000000000)",
+		"sin(1 < 2)",
+		"sin(1, 2)",
+		"atan2(1)",
+	}
+
+	ev := NewEvaluator()
+	for _, input := range inputs {
+		_, err := evaluate(ev, input)
+		c.Assert(err, NotNil, Commentf(input))
+	}
+}
@@ -0,0 +1,385 @@
+package mathval
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// dimension holds the exponent of each SI base dimension: length, mass, time, current, temperature, amount of
+// substance and luminous intensity
+type dimension [7]int
+
+// dimensionless returns whether every exponent is zero
+func (dim dimension) dimensionless() bool {
+	return dim == dimension{}
+}
+
+// unitDef is a named unit in a UnitRegistry
+type unitDef struct {
+	scale      *big.Rat // size in SI base units
+	dims       dimension
+	prefixable bool // whether SI prefixes such as "k" may be applied
+}
+
+// prefixes holds the exact scale of each SI prefix
+var prefixes = map[string]*big.Rat{
+	"T":  big.NewRat(1000000000000, 1),
+	"G":  big.NewRat(1000000000, 1),
+	"M":  big.NewRat(1000000, 1),
+	"k":  big.NewRat(1000, 1),
+	"h":  big.NewRat(100, 1),
+	"da": big.NewRat(10, 1),
+	"d":  big.NewRat(1, 10),
+	"c":  big.NewRat(1, 100),
+	"m":  big.NewRat(1, 1000),
+	"u":  big.NewRat(1, 1000000),
+	"µ":  big.NewRat(1, 1000000),
+	"n":  big.NewRat(1, 1000000000),
+	"p":  big.NewRat(1, 1000000000000),
+}
+
+// UnitRegistry holds the units which may follow a number when the Parser's Units mode is set
+type UnitRegistry struct {
+	units map[string]*unitDef
+}
+
+// NewUnitRegistry returns a UnitRegistry holding the SI base units, the common derived SI units, which all
+// accept SI prefixes, and common units of time, imperial length and mass. Every conversion factor is exact
+func NewUnitRegistry() *UnitRegistry {
+	r := &UnitRegistry{units: make(map[string]*unitDef)}
+	for i, name := range []string{"m", "g", "s", "A", "K", "mol", "cd"} {
+		def := &unitDef{scale: big.NewRat(1, 1), prefixable: true}
+		def.dims[i] = 1
+		r.units[name] = def
+	}
+	// The SI base unit of mass is the kilogram
+	r.units["g"].scale = big.NewRat(1, 1000)
+
+	for _, unit := range []struct {
+		name       string
+		scale      *big.Rat
+		of         string
+		prefixable bool
+	}{
+		{"N", big.NewRat(1, 1), "kg*m/s^2", true},
+		{"J", big.NewRat(1, 1), "N*m", true},
+		{"W", big.NewRat(1, 1), "J/s", true},
+		{"Pa", big.NewRat(1, 1), "N/m^2", true},
+		{"Hz", big.NewRat(1, 1), "s^-1", true},
+		{"C", big.NewRat(1, 1), "A*s", true},
+		{"V", big.NewRat(1, 1), "W/A", true},
+		{"L", big.NewRat(1, 1000), "m^3", true},
+		{"min", big.NewRat(60, 1), "s", false},
+		{"h", big.NewRat(60, 1), "min", false},
+		{"day", big.NewRat(24, 1), "h", false},
+		{"in", big.NewRat(254, 10000), "m", false},
+		{"ft", big.NewRat(12, 1), "in", false},
+		{"yd", big.NewRat(3, 1), "ft", false},
+		{"mi", big.NewRat(1760, 1), "yd", false},
+		{"mph", big.NewRat(1, 1), "mi/h", false},
+		{"lb", big.NewRat(45359237, 100000000), "kg", false},
+		{"oz", big.NewRat(1, 16), "lb", false},
+	} {
+		if err := r.define(unit.name, unit.scale, unit.of, unit.prefixable); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Define adds a unit to the registry which is scale times the unit expression of, as in
+// Define("furlong", big.NewRat(220, 1), "yd"). The name must be an identifier which isn't already a unit
+func (r *UnitRegistry) Define(name string, scale *big.Rat, of string) error {
+	return r.define(name, scale, of, false)
+}
+
+// define adds a unit to the registry, see Define
+func (r *UnitRegistry) define(name string, scale *big.Rat, of string, prefixable bool) error {
+	if !isIdentifier(name) {
+		return fmt.Errorf("Invalid unit name %s", name)
+	}
+	if _, ok := r.lookup(name); ok {
+		return fmt.Errorf("Unit %s is already defined", name)
+	}
+	if scale.Sign() <= 0 {
+		return fmt.Errorf("Unit %s must have a positive scale", name)
+	}
+
+	p := NewParser(strings.NewReader(of))
+	p.SetUnits(r)
+	unit, err := p.parseUnit()
+	if err != nil {
+		return err
+	}
+	if tok, lit := p.peek(); tok != EOF {
+		return fmt.Errorf("Unexpected %s after unit", lit)
+	}
+	r.units[name] = &unitDef{scale: new(big.Rat).Mul(scale, unit.scale), dims: unit.dims, prefixable: prefixable}
+	return nil
+}
+
+// lookup returns the named unit, which is either in the registry or an SI prefix followed by a prefixable unit
+func (r *UnitRegistry) lookup(name string) (*unitDef, bool) {
+	if def, ok := r.units[name]; ok {
+		return def, true
+	}
+	for prefix, scale := range prefixes {
+		if def, ok := r.units[strings.TrimPrefix(name, prefix)]; ok && def.prefixable && strings.HasPrefix(name, prefix) {
+			return &unitDef{scale: new(big.Rat).Mul(scale, def.scale), dims: def.dims}, true
+		}
+	}
+	return nil, false
+}
+
+// defaultUnits is the registry used by Parsers in Units mode which haven't been given one, see Parser.SetUnits
+var defaultUnits *UnitRegistry
+
+func init() {
+	defaultUnits = NewUnitRegistry()
+}
+
+// Unit represents a UNIT in the EBNF grammar: a product of powers of named units, such as "km/h" or
+// "kg*m/s^2". It is also the unit a QuantityValue is displayed in
+// UNIT = UNIT_POWER { ( '*' | '/' ) UNIT_POWER }
+type Unit struct {
+	factors []unitFactor
+	scale   *big.Rat // size in SI base units
+	dims    dimension
+}
+
+// unitFactor represents a UNIT_POWER in the EBNF grammar
+// UNIT_POWER = IDENTIFIER [ '^' [ '-' ] DIGITS ]
+type unitFactor struct {
+	name string
+	exp  int
+}
+
+// dimensionlessUnit is the Unit of a plain number
+var dimensionlessUnit = &Unit{scale: big.NewRat(1, 1)}
+
+// String returns the Unit with its positive powers first, each joined by '*', followed by each negative
+// power after a '/'. A Unit with only negative powers is written with negative exponents, as in "s^-1"
+func (unit *Unit) String() string {
+	var num, den []string
+	for _, f := range unit.factors {
+		if f.exp > 0 {
+			num = append(num, f.String())
+		} else {
+			den = append(den, unitFactor{name: f.name, exp: -f.exp}.String())
+		}
+	}
+	if len(num) == 0 {
+		res := make([]string, len(unit.factors))
+		for i, f := range unit.factors {
+			res[i] = f.String()
+		}
+		return strings.Join(res, "*")
+	}
+	s := strings.Join(num, "*")
+	for _, d := range den {
+		s += "/" + d
+	}
+	return s
+}
+
+// String returns the name of the unit, followed by its exponent unless that is 1
+func (f unitFactor) String() string {
+	if f.exp == 1 {
+		return f.name
+	}
+	return fmt.Sprintf("%s^%d", f.name, f.exp)
+}
+
+// mul returns the product of the two Units, or the quotient if sign is -1. Powers of the same named unit are
+// combined, and dropped if they cancel out
+func (unit *Unit) mul(other *Unit, sign int) *Unit {
+	res := &Unit{factors: append([]unitFactor{}, unit.factors...), scale: new(big.Rat).Set(unit.scale), dims: unit.dims}
+	for _, f := range other.factors {
+		res.factors = withFactor(res.factors, unitFactor{name: f.name, exp: sign * f.exp})
+	}
+	if sign < 0 {
+		res.scale.Quo(res.scale, other.scale)
+	} else {
+		res.scale.Mul(res.scale, other.scale)
+	}
+	for i := range res.dims {
+		res.dims[i] += sign * other.dims[i]
+	}
+	return res
+}
+
+// withFactor returns the factors with f multiplied in
+func withFactor(factors []unitFactor, f unitFactor) []unitFactor {
+	for i, existing := range factors {
+		if existing.name != f.name {
+			continue
+		}
+		if existing.exp+f.exp == 0 {
+			return append(factors[:i:i], factors[i+1:]...)
+		}
+		factors[i].exp += f.exp
+		return factors
+	}
+	return append(factors, f)
+}
+
+// pow returns the Unit raised to the integer power n
+func (unit *Unit) pow(n int) (*Unit, error) {
+	scale, err := pow(unit.scale, big.NewRat(int64(n), 1))
+	if err != nil {
+		return nil, err
+	}
+	res := &Unit{scale: scale}
+	if n == 0 {
+		return res, nil
+	}
+	for _, f := range unit.factors {
+		res.factors = append(res.factors, unitFactor{name: f.name, exp: f.exp * n})
+	}
+	for i, d := range unit.dims {
+		res.dims[i] = d * n
+	}
+	return res, nil
+}
+
+// QuantityValue is a number with a physical unit. The magnitude is held in SI base units, so quantities in
+// different units of the same dimension can be combined directly, and the Unit is only used for display
+type QuantityValue struct {
+	val  *big.Rat
+	prec uint // 0 if exact, see NumberValue
+	unit *Unit
+}
+
+// quantityOf returns a NumberValue for a dimensionless quantity, otherwise a QuantityValue in the given unit.
+// val is in SI base units
+func quantityOf(val *big.Rat, prec uint, unit *Unit) Value {
+	num := numberOf(val, prec)
+	if unit.dims.dimensionless() {
+		return num
+	}
+	return &QuantityValue{val: num.val, prec: prec, unit: unit}
+}
+
+// Magnitude returns the size of the quantity in its unit
+func (q *QuantityValue) Magnitude() *big.Rat {
+	return new(big.Rat).Quo(q.val, q.unit.scale)
+}
+
+// Unit returns the unit the quantity is displayed in
+func (q *QuantityValue) Unit() *Unit {
+	return q.unit
+}
+
+// String returns the magnitude, formatted like a NumberValue, followed by the unit
+func (q *QuantityValue) String() string {
+	return (&NumberValue{val: q.Magnitude(), prec: q.prec}).String() + " " + q.unit.String()
+}
+
+// isQuantity returns whether the value is a QuantityValue
+func isQuantity(val Value) bool {
+	_, ok := val.(*QuantityValue)
+	return ok
+}
+
+// toQuantity returns the magnitude in SI base units and unit of a QuantityValue, treating a NumberValue as
+// dimensionless
+func toQuantity(val Value) (*big.Rat, *Unit, error) {
+	if q, ok := val.(*QuantityValue); ok {
+		return q.val, q.unit, nil
+	}
+	r, err := toRat(val)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, dimensionlessUnit, nil
+}
+
+// quantityArithmetic applies the arithmetic operator where at least one operand is a QuantityValue. Adding,
+// subtracting and taking the modulo of quantities requires them to have the same dimension, and the result is
+// in the unit of the left operand. Quantities may only be raised to integer powers
+func quantityArithmetic(op Token, a, b Value) (Value, error) {
+	x, xUnit, err := toQuantity(a)
+	if err != nil {
+		return nil, err
+	}
+	y, yUnit, err := toQuantity(b)
+	if err != nil {
+		return nil, err
+	}
+	prec := precOf(a, b)
+
+	switch op {
+	case PLUS, MINUS, MODULO, INT_DIVIDE:
+		if xUnit.dims != yUnit.dims {
+			return nil, dimensionError("Cannot apply %s to %s and %s", op, a, b)
+		}
+		res, err := arithmetic(op, NewNumberValue(x), NewNumberValue(y))
+		if err != nil {
+			return nil, err
+		}
+		if op == INT_DIVIDE {
+			return numberOf(res.(*NumberValue).val, prec), nil
+		}
+		return quantityOf(res.(*NumberValue).val, prec, xUnit), nil
+	case MULTIPLY, IMPLICIT_MULTIPLY:
+		return quantityOf(new(big.Rat).Mul(x, y), prec, xUnit.mul(yUnit, 1)), nil
+	case DIVIDE:
+		if y.Sign() == 0 {
+			return nil, errors.New("Division by zero")
+		}
+		return quantityOf(new(big.Rat).Quo(x, y), prec, xUnit.mul(yUnit, -1)), nil
+	case POW:
+		if isQuantity(b) || !y.IsInt() || !y.Num().IsInt64() {
+			return nil, dimensionError("Cannot raise %s to the power %s", a, b)
+		}
+		res, err := pow(x, y)
+		if err != nil {
+			return nil, err
+		}
+		unit, err := xUnit.pow(int(y.Num().Int64()))
+		if err != nil {
+			return nil, err
+		}
+		return quantityOf(res, prec, unit), nil
+	}
+	return nil, errors.New("Expected arithmetic operator")
+}
+
+// compareQuantities applies the comparison operator to two quantities of the same dimension
+func compareQuantities(op Token, a, b Value) (Value, error) {
+	x, xUnit, err := toQuantity(a)
+	if err != nil {
+		return nil, err
+	}
+	y, yUnit, err := toQuantity(b)
+	if err != nil {
+		return nil, err
+	}
+	if xUnit.dims != yUnit.dims {
+		return nil, dimensionError("Cannot compare %s with %s", a, b)
+	}
+	return compare(op, NewNumberValue(x), NewNumberValue(y))
+}
+
+// convert returns the quantity displayed in the given unit, which must have the same dimension. Lists are
+// converted element-wise
+func convert(val Value, unit *Unit) (Value, error) {
+	if list, ok := val.(*ListValue); ok {
+		res := make([]Value, len(list.elems))
+		for i, elem := range list.elems {
+			var err error
+			if res[i], err = convert(elem, unit); err != nil {
+				return nil, err
+			}
+		}
+		return &ListValue{elems: res}, nil
+	}
+
+	q, ok := val.(*QuantityValue)
+	if !ok || q.unit.dims != unit.dims {
+		return nil, dimensionError("Cannot convert %s to %s", val, unit)
+	}
+	return &QuantityValue{val: q.val, prec: q.prec, unit: unit}, nil
+}
@@ -0,0 +1,155 @@
+package mathval
+
+import (
+	"math/big"
+	"regexp"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type UnitsSuite struct{}
+
+var _ = Suite(&UnitsSuite{})
+
+// runUnits parses the program in Units mode with the given registry, or the default if nil, and runs it
+func runUnits(units *UnitRegistry, input string) (Value, error) {
+	parser := NewParser(strings.NewReader(input))
+	parser.SetMode(Units)
+	parser.SetUnits(units)
+	prog, err := parser.ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	res, err := NewEvaluator().Run(prog)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+func (u *UnitsSuite) TestUnits(c *C) {
+	expected := []EvalResult{
+		{input: "5 m / 2 s + 3 km/h", expected: "10/3 m/s"},
+		{input: "3 km + 5 m", expected: "601/200 km"},
+		{input: "5 m + 3 km", expected: "3005 m"},
+		{input: "10 m/s^2 * 2 kg", expected: "20 m*kg/s^2"},
+		{input: "(2 m)^2", expected: "4 m^2"},
+		{input: "2 m^2 / 4 m", expected: "1/2 m"},
+		{input: "2 m^-1", expected: "2 m^-1"},
+		{input: "-3 m * 2", expected: "-6 m"},
+		{input: "5 m / 5 m", expected: "1"},
+		{input: "1 km / 1 m", expected: "1000"},
+		{input: "1 Hz * 1 s", expected: "1"},
+		{input: "7 m % 2 m", expected: "1 m"},
+		{input: "7 m \\ 2 m", expected: "3"},
+		{input: "2 m > 1 ft", expected: "true"},
+		{input: "100 cm == 1 m", expected: "true"},
+		{input: "[1, 2] * 3 m", expected: "[3 m, 6 m]"},
+		{input: "m = 3; 2 m", expected: "2 m"},
+		{input: "m = 3; 2 * m", expected: "6"},
+		{input: "d = 42 km; t = 2 h; d / t", expected: "21 km/h"},
+		{input: "sum(k, 1, 3, k * 1 m)", expected: "6 m"},
+	}
+	for _, res := range expected {
+		val, err := runUnits(nil, res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (u *UnitsSuite) TestConversion(c *C) {
+	expected := []EvalResult{
+		{input: "1 h to s", expected: "3600 s"},
+		{input: "1 mi to m", expected: "201168/125 m"},
+		{input: "12 in to ft", expected: "1 ft"},
+		{input: "60 mph to km/h", expected: "301752/3125 km/h"},
+		{input: "100 km / 1 h to m/s", expected: "250/9 m/s"},
+		{input: "1 kg * 1 m / 1 s^2 to N", expected: "1 N"},
+		{input: "1 kJ to W*s", expected: "1000 W*s"},
+		{input: "1 L to cm^3", expected: "1000 cm^3"},
+		{input: "1 lb to g", expected: "45359237/100000 g"},
+		{input: "1 day to min", expected: "1440 min"},
+		{input: "[1 m, 2 km] to cm", expected: "[100 cm, 200000 cm]"},
+		{input: "x = 88 km/h; x to mph", expected: "62500/1143 mph"},
+		{input: "1 < 2 ? 1 m : 2 m to cm", expected: "1 m"},
+		{input: "(1 < 2 ? 1 m : 2 m) to cm", expected: "100 cm"},
+	}
+	for _, res := range expected {
+		val, err := runUnits(nil, res.input)
+		c.Assert(err, IsNil, Commentf(res.input))
+		c.Assert(val.String(), Equals, res.expected, Commentf(res.input))
+	}
+}
+
+func (u *UnitsSuite) TestUnitErrors(c *C) {
+	expected := []struct {
+		input string
+		err   string
+	}{
+		{input: "5 m + 2 s", err: "Cannot apply + to 5 m and 2 s at offset 4"},
+		{input: "1 + 2 m", err: "Cannot apply + to 1 and 2 m at offset 2"},
+		{input: "2 m < 1", err: "Cannot compare 2 m with 1"},
+		{input: "1 m to s", err: "Cannot convert 1 m to s"},
+		{input: "2 to m", err: "Cannot convert 2 to m"},
+		{input: "2^(1 m)", err: "Cannot raise 2 to the power 1 m at offset 1"},
+		{input: "(4 m)^0.5", err: "Cannot raise 4 m to the power 1/2 at offset 5"},
+		{input: "sqrt(4 m)", err: "Expected number, got 4 m"},
+		{input: "1 m to furlong", err: "Unknown unit furlong"},
+		{input: "1 m to 2", err: `Expected unit, got "2"`},
+		{input: "1 m / 0 s", err: "Division by zero"},
+	}
+	for _, res := range expected {
+		_, err := runUnits(nil, res.input)
+		c.Assert(err, ErrorMatches, regexp.QuoteMeta(res.err), Commentf(res.input))
+	}
+
+	// Without Units mode a unit is just an identifier
+	_, err := evaluate(NewEvaluator(), "5 m")
+	c.Assert(err, NotNil)
+}
+
+func (u *UnitsSuite) TestParseUnits(c *C) {
+	expected := map[string]string{
+		"5 m/2 s":          "5 m / 2 s",
+		"3 km/h":           "3 km/h",
+		"3 km / h":         "3 km/h",
+		"1 kg*m/s^2":       "1 kg*m/s^2",
+		"9.81 m/s/s":       "9.81 m/s^2",
+		"2 m * x":          "2 m * x",
+		"x to km/h":        "x to km/h",
+		"2 min([1, 2])":    "2 min([1, 2])",
+		"[1 s, 2 min]":     "[1 s, 2 min]",
+		"2 ms + 3 mm":      "2 ms + 3 mm",
+		"1 cd + 1 mol":     "1 cd + 1 mol",
+		"f(2 m^2, 3 s^-1)": "f(2 m^2, 3 s^-1)",
+	}
+	for input, output := range expected {
+		parser = NewParser(strings.NewReader(input))
+		parser.SetMode(Units | ImplicitMultiplication)
+		cond, err := parser.Parse()
+		c.Assert(err, IsNil, Commentf(input))
+		c.Assert(cond.String(), Equals, output, Commentf(input))
+	}
+}
+
+func (u *UnitsSuite) TestRegistry(c *C) {
+	units := NewUnitRegistry()
+	c.Assert(units.Define("furlong", big.NewRat(220, 1), "yd"), IsNil)
+	c.Assert(units.Define("fortnight", big.NewRat(14, 1), "day"), IsNil)
+	c.Assert(units.Define("fpf", big.NewRat(1, 1), "furlong/fortnight"), IsNil)
+
+	val, err := runUnits(units, "1 fpf to m/h")
+	c.Assert(err, IsNil)
+	c.Assert(val.String(), Equals, "4191/7000 m/h")
+
+	c.Assert(units.Define("km", big.NewRat(1, 1), "m"), ErrorMatches, "Unit km is already defined")
+	c.Assert(units.Define("2x", big.NewRat(1, 1), "m"), ErrorMatches, "Invalid unit name 2x")
+	c.Assert(units.Define("zero", big.NewRat(0, 1), "m"), ErrorMatches, "Unit zero must have a positive scale")
+	c.Assert(units.Define("bad", big.NewRat(1, 1), "parsec"), ErrorMatches, "Unknown unit parsec")
+	c.Assert(units.Define("bad", big.NewRat(1, 1), "m m"), ErrorMatches, "Unexpected m after unit")
+
+	// Units defined on one registry aren't in another
+	_, err = runUnits(nil, "1 furlong")
+	c.Assert(err, NotNil)
+}
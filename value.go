@@ -0,0 +1,167 @@
+package mathval
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Value is the result of evaluating an expression
+type Value interface {
+	String() string
+}
+
+// NumberValue is a rational number. Numbers derived from irrational constants or functions are inexact,
+// holding a rational approximation accurate to prec bits
+type NumberValue struct {
+	val  *big.Rat
+	prec uint // 0 if exact
+}
+
+// NewNumberValue returns a NumberValue holding a copy of the given rational
+func NewNumberValue(r *big.Rat) *NumberValue {
+	return &NumberValue{val: new(big.Rat).Set(r)}
+}
+
+// Rat returns a copy of the underlying rational
+func (n *NumberValue) Rat() *big.Rat {
+	return new(big.Rat).Set(n.val)
+}
+
+// Exact returns whether the number is exact, rather than an approximation of an irrational number
+func (n *NumberValue) Exact() bool {
+	return n.prec == 0
+}
+
+// String returns an exact number as an integer if it is one, otherwise as a fraction. Inexact numbers are
+// returned in decimal to the number of significant digits their precision supports
+func (n *NumberValue) String() string {
+	if n.prec == 0 {
+		return n.val.RatString()
+	}
+	digits := int(float64(n.prec) * log10Of2)
+	return formatFloat(new(big.Float).SetPrec(n.prec).SetRat(n.val), digits)
+}
+
+// formatFloat returns f.Text('g', digits). big.Float converts a number far below 1 to decimal exactly, which
+// takes time quadratic in its binary exponent, so such a number is first scaled up by a power of ten
+func formatFloat(f *big.Float, digits int) string {
+	exp := f.MantExp(nil)
+	if f.Sign() == 0 || exp > -4096 {
+		return f.Text('g', digits)
+	}
+
+	prec := f.Prec() + 64
+	shift := int64(float64(-exp) * log10Of2)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(shift), nil)
+	scaled := new(big.Float).SetPrec(prec).Mul(f, new(big.Float).SetPrec(prec).SetInt(scale))
+	mant, e, _ := strings.Cut(scaled.Text('e', digits-1), "e")
+	if strings.Contains(mant, ".") {
+		mant = strings.TrimRight(strings.TrimRight(mant, "0"), ".")
+	}
+	n, _ := strconv.ParseInt(e, 10, 64)
+	return fmt.Sprintf("%se-%02d", mant, shift-n)
+}
+
+// numberOf returns a NumberValue holding r. If prec is non-zero the number is inexact, and r is rounded to
+// prec bits so that approximations don't grow without bound
+func numberOf(r *big.Rat, prec uint) *NumberValue {
+	if prec == 0 {
+		return &NumberValue{val: r}
+	}
+	r, _ = new(big.Float).SetPrec(prec).SetRat(r).Rat(nil)
+	return &NumberValue{val: r, prec: prec}
+}
+
+// log10Of2 converts a precision in bits to decimal digits
+const log10Of2 = 0.30102999566398119521
+
+// precOf returns the lowest precision of any inexact NumberValue, MatrixValue or QuantityValue in vals, or 0
+// if they are all exact
+func precOf(vals ...Value) (prec uint) {
+	for _, val := range vals {
+		var p uint
+		switch v := val.(type) {
+		case *NumberValue:
+			p = v.prec
+		case *MatrixValue:
+			p = v.prec
+		case *QuantityValue:
+			p = v.prec
+		}
+		if p != 0 && (prec == 0 || p < prec) {
+			prec = p
+		}
+	}
+	return
+}
+
+// BoolValue is the result of a comparison or logical operator
+type BoolValue struct {
+	val bool
+}
+
+// NewBoolValue returns a BoolValue holding the given bool
+func NewBoolValue(b bool) *BoolValue {
+	return &BoolValue{val: b}
+}
+
+// Bool returns the underlying bool
+func (b *BoolValue) Bool() bool {
+	return b.val
+}
+
+// String returns "true" or "false"
+func (b *BoolValue) String() string {
+	if b.val {
+		return "true"
+	}
+	return "false"
+}
+
+// ListValue is an ordered list of values
+type ListValue struct {
+	elems []Value
+}
+
+// NewListValue returns a ListValue holding the given values
+func NewListValue(vals ...Value) *ListValue {
+	return &ListValue{elems: append([]Value{}, vals...)}
+}
+
+// Values returns a copy of the values in the list
+func (l *ListValue) Values() []Value {
+	return append([]Value{}, l.elems...)
+}
+
+// Len returns the number of values in the list
+func (l *ListValue) Len() int {
+	return len(l.elems)
+}
+
+// String returns the values in the list, comma separated inside square brackets
+func (l *ListValue) String() string {
+	elems := make([]string, len(l.elems))
+	for i, elem := range l.elems {
+		elems[i] = elem.String()
+	}
+	return "[" + strings.Join(elems, ", ") + "]"
+}
+
+// FunctionValue is a function which can be passed to and returned from other functions. Lambdas are closures,
+// so their free variables refer to the scope they were created in rather than the one they are called from
+type FunctionValue struct {
+	name    string // empty for a lambda
+	params  []string
+	body    *Conditional
+	closure *scope
+}
+
+// String returns the name of a user-defined function, or the source of a lambda
+func (f *FunctionValue) String() string {
+	if f.name != "" {
+		return f.name
+	}
+	return (&Lambda{params: f.params, body: f.body}).String()
+}